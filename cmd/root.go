@@ -14,7 +14,5 @@ func main() {
 
 	root := cmd.NewRootCommand(cmd.NewIOStreams())
 
-	if err := root.Execute(); err != nil {
-		os.Exit(1)
-	}
+	os.Exit(cmd.ExitCode(root.Execute()))
 }
@@ -1,43 +1,82 @@
 package consul
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
 )
 
 // ServiceInstance represents a Consul Connect service instance
 type ServiceInstance struct {
-	ServiceName   string
-	ServiceID     string
-	Address       string
-	Port          int
-	ProxyService  string
-	ProxyAddress  string
-	ProxyPort     int
-	AllocID       string
-	Node          string
-	Namespace     string
-	Datacenter    string
-	Tags          []string
-	Meta          map[string]string
-	HealthStatus  string
+	ServiceName  string
+	ServiceID    string
+	Address      string
+	Port         int
+	ProxyService string
+	ProxyAddress string
+	ProxyPort    int
+	AllocID      string
+	Node         string
+	Namespace    string
+	Datacenter   string
+	Tags         []string
+	Meta         map[string]string
+	HealthStatus string
+}
+
+// ConsulDiscovery defines the interface for discovering Consul Connect services
+type ConsulDiscovery interface {
+	ListConnectServices() ([]string, error)
+	GetServiceInstances(serviceName string, healthyOnly bool) ([]ServiceInstance, error)
+	GetConnectProxyInstances(serviceName string, healthyOnly bool) ([]ServiceInstance, error)
+	GetAllConnectProxyInstances(healthyOnly bool) ([]ServiceInstance, error)
+	GetUpstreamServices(serviceName string) ([]string, error)
+	GetServiceIntentions(serviceName string) (*ServiceIntentions, error)
+	GetServiceChecks(serviceName string) ([]ServiceCheck, error)
+	GetEnvoyAdminPort(instance ServiceInstance) int
 }
 
 // Discovery provides methods for discovering Consul Connect services
 type Discovery struct {
-	client *consulapi.Client
+	client  *consulapi.Client
+	timeout time.Duration // per query; zero waits indefinitely
+	filter  string        // Consul filter expression for health queries
+}
+
+// ErrInvalidFilter is returned when Consul rejects the discovery filter
+// expression
+var ErrInvalidFilter = errors.New("invalid Consul filter")
+
+// DiscoveryOptions tune how Discovery queries Consul
+type DiscoveryOptions struct {
+	// Timeout bounds each query; zero waits indefinitely
+	Timeout time.Duration
+	// Filter is a Consul filter expression evaluated server-side against the
+	// health entries of proxies and gateways, e.g. Service.Meta.team == "payments"
+	Filter string
 }
 
-// NewDiscovery creates a new Discovery instance
-func NewDiscovery(client *consulapi.Client) *Discovery {
+var _ ConsulDiscovery = &Discovery{}
+
+// NewDiscovery creates a new ConsulDiscovery
+func NewDiscovery(client *consulapi.Client) ConsulDiscovery {
 	return &Discovery{client: client}
 }
 
-// NewDiscoveryFromEnv creates a Discovery instance using environment variables
-func NewDiscoveryFromEnv() (*Discovery, error) {
+// NewDiscoveryWithOptions creates a ConsulDiscovery using the given options
+func NewDiscoveryWithOptions(client *consulapi.Client, opts DiscoveryOptions) ConsulDiscovery {
+	return &Discovery{client: client, timeout: opts.Timeout, filter: opts.Filter}
+}
+
+// NewDiscoveryFromEnv creates a ConsulDiscovery using environment variables
+func NewDiscoveryFromEnv() (ConsulDiscovery, error) {
 	config := consulapi.DefaultConfig()
 	if addr := os.Getenv("CONSUL_HTTP_ADDR"); addr != "" {
 		config.Address = addr
@@ -54,20 +93,96 @@ func NewDiscoveryFromEnv() (*Discovery, error) {
 	return &Discovery{client: client}, nil
 }
 
-// ListConnectServices returns all services that have Consul Connect sidecars
+// queryOptions returns the options for a single Consul query, bounded by the
+// discovery timeout. The returned cancel func must be called once the query
+// has completed.
+func (d *Discovery) queryOptions(filter string) (*consulapi.QueryOptions, context.CancelFunc) {
+	opts := &consulapi.QueryOptions{Filter: filter}
+	if d.timeout <= 0 {
+		return opts, func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	opts.WaitTime = d.timeout
+	return opts.WithContext(ctx), cancel
+}
+
+// healthQueryOptions returns the options for a health query that selects
+// proxies, applying the discovery filter
+func (d *Discovery) healthQueryOptions() (*consulapi.QueryOptions, context.CancelFunc) {
+	return d.queryOptions(d.filter)
+}
+
+// queryError explains a query that ran out of time or whose filter Consul
+// rejected. filter is the filter the query sent.
+func (d *Discovery) queryError(err error, filter string) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("Consul did not respond within %s: %w", d.timeout, err)
+	}
+	if d.rejectedFilter(err, filter) {
+		return fmt.Errorf("%w %q: %w", ErrInvalidFilter, d.filter, err)
+	}
+	return err
+}
+
+// rejectedFilter reports whether err is Consul refusing the discovery filter
+// expression, which only a query that sent it as filter can do
+func (d *Discovery) rejectedFilter(err error, filter string) bool {
+	var statusErr consulapi.StatusError
+	return d.filter != "" && filter == d.filter && errors.As(err, &statusErr) && statusErr.Code == http.StatusBadRequest
+}
+
+// ProxyKinds are the Consul service kinds that are backed by an Envoy proxy
+var ProxyKinds = []consulapi.ServiceKind{
+	consulapi.ServiceKindConnectProxy,
+	consulapi.ServiceKindMeshGateway,
+	consulapi.ServiceKindTerminatingGateway,
+	consulapi.ServiceKindIngressGateway,
+	consulapi.ServiceKindAPIGateway,
+}
+
+// proxyKindFilter selects catalog services of any proxy kind
+const proxyKindFilter = `ServiceKind != ""`
+
+// isProxyKind reports whether a service kind is backed by an Envoy proxy
+func isProxyKind(kind consulapi.ServiceKind) bool {
+	for _, k := range ProxyKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// ListConnectServices returns all services that are fronted by an Envoy proxy:
+// services with a Connect sidecar (by destination service name, regardless of
+// how the sidecar is named) and gateways (by their own name)
 func (d *Discovery) ListConnectServices() ([]string, error) {
-	services, _, err := d.client.Catalog().Services(nil)
+	proxyServices, err := d.listProxyServiceNames()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list services: %w", err)
+		return nil, err
 	}
 
 	var connectServices []string
 	seen := make(map[string]bool)
 
-	for svc := range services {
-		// Look for sidecar proxy services
-		if strings.HasSuffix(svc, "-sidecar-proxy") {
-			baseName := strings.TrimSuffix(svc, "-sidecar-proxy")
+	for _, proxySvc := range proxyServices {
+		q, cancel := d.healthQueryOptions()
+		entries, _, err := d.client.Health().Service(proxySvc, "", false, q)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) || d.rejectedFilter(err, q.Filter) {
+			return nil, fmt.Errorf("failed to query service %s: %w", proxySvc, d.queryError(err, q.Filter))
+		}
+		if err != nil {
+			continue // Skip services we can't query
+		}
+		for _, entry := range entries {
+			if entry.Service == nil || !isProxyKind(entry.Service.Kind) {
+				continue
+			}
+			baseName := entry.Service.Service
+			if entry.Service.Kind == consulapi.ServiceKindConnectProxy && entry.Service.Proxy != nil && entry.Service.Proxy.DestinationServiceName != "" {
+				baseName = entry.Service.Proxy.DestinationServiceName
+			}
 			if !seen[baseName] {
 				connectServices = append(connectServices, baseName)
 				seen[baseName] = true
@@ -75,27 +190,46 @@ func (d *Discovery) ListConnectServices() ([]string, error) {
 		}
 	}
 
+	sort.Strings(connectServices)
 	return connectServices, nil
 }
 
+// listProxyServiceNames returns the names of catalog services that may be
+// proxies. Consul filters by ServiceKind server-side; Consul versions that
+// ignore the filter return every service, and the kind is checked per instance
+// by the caller.
+func (d *Discovery) listProxyServiceNames() ([]string, error) {
+	q, cancel := d.queryOptions(proxyKindFilter)
+	defer cancel()
+	services, _, err := d.client.Catalog().Services(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", d.queryError(err, q.Filter))
+	}
+
+	names := make([]string, 0, len(services))
+	for svc := range services {
+		names = append(names, svc)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // GetServiceInstances returns all instances of a Consul Connect service
 func (d *Discovery) GetServiceInstances(serviceName string, healthyOnly bool) ([]ServiceInstance, error) {
 	var results []ServiceInstance
 
-	// Get the main service instances
-	healthStatus := ""
-	if healthyOnly {
-		healthStatus = "passing"
-	}
-
-	entries, _, err := d.client.Health().Service(serviceName, "", healthyOnly, nil)
+	q, cancel := d.healthQueryOptions()
+	defer cancel()
+	entries, _, err := d.client.Health().Service(serviceName, "", healthyOnly, q)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get service %s: %w", serviceName, err)
+		return nil, fmt.Errorf("failed to get service %s: %w", serviceName, d.queryError(err, q.Filter))
 	}
 
-	// Also get the sidecar proxy instances
-	proxyServiceName := serviceName + "-sidecar-proxy"
-	proxyEntries, _, err := d.client.Health().Service(proxyServiceName, "", healthyOnly, nil)
+	// Also get the sidecar proxy instances, found by destination service
+	// rather than by naming convention
+	pq, pcancel := d.healthQueryOptions()
+	defer pcancel()
+	proxyEntries, _, err := d.client.Health().Connect(serviceName, "", healthyOnly, pq)
 	if err != nil {
 		// Not all services have explicit proxy entries, continue
 		proxyEntries = nil
@@ -104,41 +238,13 @@ func (d *Discovery) GetServiceInstances(serviceName string, healthyOnly bool) ([
 	// Build a map of proxy info by node
 	proxyByNode := make(map[string]*consulapi.ServiceEntry)
 	for _, entry := range proxyEntries {
-		proxyByNode[entry.Node.Node] = entry
+		if entry.Service != nil && entry.Service.Kind == consulapi.ServiceKindConnectProxy {
+			proxyByNode[entry.Node.Node] = entry
+		}
 	}
 
 	for _, entry := range entries {
-		instance := ServiceInstance{
-			ServiceName:  entry.Service.Service,
-			ServiceID:    entry.Service.ID,
-			Address:      entry.Service.Address,
-			Port:         entry.Service.Port,
-			Node:         entry.Node.Node,
-			Datacenter:   entry.Node.Datacenter,
-			Tags:         entry.Service.Tags,
-			Meta:         entry.Service.Meta,
-			HealthStatus: healthStatus,
-		}
-
-		// Set address fallback to node address
-		if instance.Address == "" {
-			instance.Address = entry.Node.Address
-		}
-
-		// Try to extract allocation ID from service metadata
-		if entry.Service.Meta != nil {
-			if allocID, ok := entry.Service.Meta["alloc_id"]; ok {
-				instance.AllocID = allocID
-			}
-			if ns, ok := entry.Service.Meta["namespace"]; ok {
-				instance.Namespace = ns
-			}
-		}
-
-		// Try to extract from service ID if not in metadata
-		if instance.AllocID == "" {
-			instance.AllocID = extractAllocIDFromServiceID(entry.Service.ID)
-		}
+		instance := newServiceInstance(entry, healthyOnly)
 
 		// Add proxy information if available
 		if proxy, ok := proxyByNode[entry.Node.Node]; ok {
@@ -156,10 +262,199 @@ func (d *Discovery) GetServiceInstances(serviceName string, healthyOnly bool) ([
 	return results, nil
 }
 
-// GetConnectProxyInstances returns all sidecar proxy instances for a service
+// GetConnectProxyInstances returns all proxy instances for a service: its
+// Connect sidecars, or the gateway instances when serviceName is a gateway
 func (d *Discovery) GetConnectProxyInstances(serviceName string, healthyOnly bool) ([]ServiceInstance, error) {
-	proxyServiceName := serviceName + "-sidecar-proxy"
-	return d.GetServiceInstances(proxyServiceName, healthyOnly)
+	q, cancel := d.healthQueryOptions()
+	defer cancel()
+	entries, _, err := d.client.Health().Connect(serviceName, "", healthyOnly, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proxies for service %s: %w", serviceName, d.queryError(err, q.Filter))
+	}
+
+	var results []ServiceInstance
+	for _, entry := range entries {
+		if entry.Service != nil && entry.Service.Kind == consulapi.ServiceKindConnectProxy {
+			results = append(results, newServiceInstance(entry, healthyOnly))
+		}
+	}
+	if len(results) > 0 {
+		return results, nil
+	}
+
+	// Gateways are proxies themselves and have no separate sidecar
+	gq, gcancel := d.healthQueryOptions()
+	defer gcancel()
+	gatewayEntries, _, err := d.client.Health().Service(serviceName, "", healthyOnly, gq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service %s: %w", serviceName, d.queryError(err, gq.Filter))
+	}
+	for _, entry := range gatewayEntries {
+		if entry.Service != nil && isProxyKind(entry.Service.Kind) {
+			results = append(results, newServiceInstance(entry, healthyOnly))
+		}
+	}
+
+	return results, nil
+}
+
+// GetUpstreamServices returns the names of the services a service's Connect
+// sidecars are configured to reach. Prepared-query upstreams are ignored.
+func (d *Discovery) GetUpstreamServices(serviceName string) ([]string, error) {
+	q, cancel := d.queryOptions("")
+	defer cancel()
+	entries, _, err := d.client.Health().Connect(serviceName, "", false, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proxies for service %s: %w", serviceName, d.queryError(err, q.Filter))
+	}
+
+	var upstreams []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Service == nil || entry.Service.Proxy == nil {
+			continue
+		}
+		for _, u := range entry.Service.Proxy.Upstreams {
+			if u.DestinationType == consulapi.UpstreamDestTypePreparedQuery || u.DestinationName == "" || seen[u.DestinationName] {
+				continue
+			}
+			seen[u.DestinationName] = true
+			upstreams = append(upstreams, u.DestinationName)
+		}
+	}
+
+	sort.Strings(upstreams)
+	return upstreams, nil
+}
+
+// ServiceIntentions holds the intentions that match traffic to and from a
+// service, each list in precedence order as returned by Consul
+type ServiceIntentions struct {
+	Service  string                 `json:"service"`
+	Inbound  []*consulapi.Intention `json:"inbound"`  // service is the destination
+	Outbound []*consulapi.Intention `json:"outbound"` // service is the source
+}
+
+// GetServiceIntentions returns the intentions that apply to a service as a
+// destination and as a source, including wildcard intentions
+func (d *Discovery) GetServiceIntentions(serviceName string) (*ServiceIntentions, error) {
+	result := &ServiceIntentions{Service: serviceName}
+	for _, by := range []consulapi.IntentionMatchType{consulapi.IntentionMatchDestination, consulapi.IntentionMatchSource} {
+		q, cancel := d.queryOptions("")
+		matches, _, err := d.client.Connect().IntentionMatch(&consulapi.IntentionMatch{By: by, Names: []string{serviceName}}, q)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to match intentions by %s for service %s: %w", by, serviceName, d.queryError(err, q.Filter))
+		}
+		if by == consulapi.IntentionMatchDestination {
+			result.Inbound = matches[serviceName]
+		} else {
+			result.Outbound = matches[serviceName]
+		}
+	}
+	return result, nil
+}
+
+// ServiceCheck is one health check of a service instance, its sidecar proxy
+// or the node it runs on, including the check's last output
+type ServiceCheck struct {
+	Node        string `json:"node"`
+	ServiceID   string `json:"service_id,omitempty"` // empty for node checks
+	ServiceName string `json:"service_name,omitempty"`
+	AllocID     string `json:"alloc_id,omitempty"`
+	CheckID     string `json:"check_id"`
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Status      string `json:"status"`
+	Output      string `json:"output"`
+}
+
+// GetServiceChecks returns every health check, with its output, of the
+// instances of a service and of their Connect sidecar proxies. Node checks
+// are included once per node since they also affect the instance's health.
+func (d *Discovery) GetServiceChecks(serviceName string) ([]ServiceCheck, error) {
+	q, cancel := d.queryOptions("")
+	entries, _, err := d.client.Health().Service(serviceName, "", false, q)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get health checks of service %s: %w", serviceName, d.queryError(err, q.Filter))
+	}
+
+	pq, pcancel := d.queryOptions("")
+	proxyEntries, _, err := d.client.Health().Connect(serviceName, "", false, pq)
+	pcancel()
+	if err == nil {
+		entries = append(entries, proxyEntries...)
+	}
+
+	var checks []ServiceCheck
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		for _, check := range entry.Checks {
+			if check == nil {
+				continue
+			}
+			key := check.Node + "/" + check.ServiceID + "/" + check.CheckID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			checks = append(checks, ServiceCheck{
+				Node:        check.Node,
+				ServiceID:   check.ServiceID,
+				ServiceName: check.ServiceName,
+				AllocID:     extractAllocIDFromServiceID(check.ServiceID),
+				CheckID:     check.CheckID,
+				Name:        check.Name,
+				Type:        check.Type,
+				Status:      check.Status,
+				Output:      check.Output,
+			})
+		}
+	}
+	return checks, nil
+}
+
+// newServiceInstance converts a Consul health entry into a ServiceInstance
+func newServiceInstance(entry *consulapi.ServiceEntry, healthyOnly bool) ServiceInstance {
+	healthStatus := ""
+	if healthyOnly {
+		healthStatus = "passing"
+	}
+
+	instance := ServiceInstance{
+		ServiceName:  entry.Service.Service,
+		ServiceID:    entry.Service.ID,
+		Address:      entry.Service.Address,
+		Port:         entry.Service.Port,
+		Node:         entry.Node.Node,
+		Datacenter:   entry.Node.Datacenter,
+		Tags:         entry.Service.Tags,
+		Meta:         entry.Service.Meta,
+		HealthStatus: healthStatus,
+	}
+
+	// Set address fallback to node address
+	if instance.Address == "" {
+		instance.Address = entry.Node.Address
+	}
+
+	// Try to extract allocation ID from service metadata
+	if entry.Service.Meta != nil {
+		if allocID, ok := entry.Service.Meta["alloc_id"]; ok {
+			instance.AllocID = allocID
+		}
+		if ns, ok := entry.Service.Meta["namespace"]; ok {
+			instance.Namespace = ns
+		}
+	}
+
+	// Try to extract from service ID if not in metadata
+	if instance.AllocID == "" {
+		instance.AllocID = extractAllocIDFromServiceID(entry.Service.ID)
+	}
+
+	return instance
 }
 
 // GetAllConnectProxyInstances returns all sidecar proxy instances in the catalog
@@ -0,0 +1,296 @@
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// newTestDiscovery serves canned catalog and health responses keyed by
+// request path.
+func newTestDiscovery(t *testing.T, responses map[string]interface{}) *Discovery {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			body = []interface{}{}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := consulapi.NewClient(&consulapi.Config{Address: strings.TrimPrefix(srv.URL, "http://")})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return &Discovery{client: client}
+}
+
+func proxyEntry(name string, kind consulapi.ServiceKind, destination, serviceID string) *consulapi.ServiceEntry {
+	svc := &consulapi.AgentService{ID: serviceID, Service: name, Kind: kind}
+	if destination != "" {
+		svc.Proxy = &consulapi.AgentServiceConnectProxyConfig{DestinationServiceName: destination}
+	}
+	return &consulapi.ServiceEntry{Node: &consulapi.Node{Node: "node1"}, Service: svc}
+}
+
+func TestListConnectServicesByKind(t *testing.T) {
+	d := newTestDiscovery(t, map[string]interface{}{
+		"/v1/catalog/services": map[string][]string{
+			"web-envoy":    nil,
+			"mesh-gateway": nil,
+			"api":          nil, // ignored filter on older Consul
+		},
+		"/v1/health/service/web-envoy": []*consulapi.ServiceEntry{
+			proxyEntry("web-envoy", consulapi.ServiceKindConnectProxy, "web", "p1"),
+		},
+		"/v1/health/service/mesh-gateway": []*consulapi.ServiceEntry{
+			proxyEntry("mesh-gateway", consulapi.ServiceKindMeshGateway, "", "g1"),
+		},
+		"/v1/health/service/api": []*consulapi.ServiceEntry{
+			proxyEntry("api", consulapi.ServiceKindTypical, "", "a1"),
+		},
+	})
+
+	got, err := d.ListConnectServices()
+	if err != nil {
+		t.Fatalf("ListConnectServices: %v", err)
+	}
+	want := []string{"mesh-gateway", "web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetConnectProxyInstances(t *testing.T) {
+	allocID := "0b5ba2a6-2b93-4c7e-9a3c-3b1f0c9d2e11"
+	d := newTestDiscovery(t, map[string]interface{}{
+		"/v1/health/connect/web": []*consulapi.ServiceEntry{
+			proxyEntry("web-envoy", consulapi.ServiceKindConnectProxy, "web", "_nomad-task-"+allocID+"-group-web-web-envoy"),
+		},
+		"/v1/health/service/ingress": []*consulapi.ServiceEntry{
+			proxyEntry("ingress", consulapi.ServiceKindIngressGateway, "", "ig1"),
+		},
+	})
+
+	tests := []struct {
+		service string
+		wantIDs []string
+	}{
+		{"web", []string{"_nomad-task-" + allocID + "-group-web-web-envoy"}},
+		{"ingress", []string{"ig1"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			instances, err := d.GetConnectProxyInstances(tt.service, false)
+			if err != nil {
+				t.Fatalf("GetConnectProxyInstances: %v", err)
+			}
+			var ids []string
+			for _, inst := range instances {
+				ids = append(ids, inst.ServiceID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("got %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+
+	instances, _ := d.GetConnectProxyInstances("web", false)
+	if instances[0].AllocID != allocID {
+		t.Errorf("AllocID = %q, want %q", instances[0].AllocID, allocID)
+	}
+}
+
+func TestGetUpstreamServices(t *testing.T) {
+	proxy := proxyEntry("web-sidecar-proxy", consulapi.ServiceKindConnectProxy, "web", "p1")
+	proxy.Service.Proxy.Upstreams = []consulapi.Upstream{
+		{DestinationName: "api", LocalBindPort: 8080},
+		{DestinationName: "db", LocalBindPort: 5432},
+		{DestinationType: consulapi.UpstreamDestTypePreparedQuery, DestinationName: "geo-db"},
+	}
+	other := proxyEntry("web-sidecar-proxy", consulapi.ServiceKindConnectProxy, "web", "p2")
+	other.Service.Proxy.Upstreams = []consulapi.Upstream{{DestinationName: "api", LocalBindPort: 8080}}
+
+	d := newTestDiscovery(t, map[string]interface{}{
+		"/v1/health/connect/web": []*consulapi.ServiceEntry{proxy, other},
+	})
+
+	got, err := d.GetUpstreamServices("web")
+	if err != nil {
+		t.Fatalf("GetUpstreamServices: %v", err)
+	}
+	if want := []string{"api", "db"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetServiceIntentions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/connect/intentions/match" || r.URL.Query().Get("name") != "api" {
+			http.NotFound(w, r)
+			return
+		}
+		var body map[string][]*consulapi.Intention
+		switch r.URL.Query().Get("by") {
+		case "destination":
+			body = map[string][]*consulapi.Intention{"api": {
+				{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionAllow},
+				{SourceName: "*", DestinationName: "api", Action: consulapi.IntentionActionDeny},
+			}}
+		case "source":
+			body = map[string][]*consulapi.Intention{"api": {
+				{SourceName: "api", DestinationName: "db", Action: consulapi.IntentionActionAllow},
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+	client, err := consulapi.NewClient(&consulapi.Config{Address: strings.TrimPrefix(srv.URL, "http://")})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	got, err := (&Discovery{client: client}).GetServiceIntentions("api")
+	if err != nil {
+		t.Fatalf("GetServiceIntentions: %v", err)
+	}
+	if got.Service != "api" || len(got.Inbound) != 2 || len(got.Outbound) != 1 {
+		t.Fatalf("unexpected intentions: %+v", got)
+	}
+	if got.Inbound[1].SourceName != "*" || got.Outbound[0].DestinationName != "db" {
+		t.Errorf("intentions not assigned by direction: %+v", got)
+	}
+}
+
+func TestGetServiceChecks(t *testing.T) {
+	const allocID = "11111111-2222-3333-4444-555555555555"
+	nodeCheck := &consulapi.HealthCheck{Node: "node1", CheckID: "serfHealth", Name: "Serf Health Status", Status: consulapi.HealthPassing}
+	web := proxyEntry("web", "", "", "_nomad-task-"+allocID+"-group-web-web-http")
+	web.Checks = consulapi.HealthChecks{
+		nodeCheck,
+		{Node: "node1", ServiceID: web.Service.ID, ServiceName: "web", CheckID: "web-http", Name: "web http", Type: "http",
+			Status: consulapi.HealthCritical, Output: "HTTP GET http://10.0.0.1:8080/health: 503 Service Unavailable"},
+	}
+	proxy := proxyEntry("web-sidecar-proxy", consulapi.ServiceKindConnectProxy, "web", "_nomad-task-"+allocID+"-group-web-web-http-sidecar-proxy")
+	proxy.Checks = consulapi.HealthChecks{
+		nodeCheck,
+		{Node: "node1", ServiceID: proxy.Service.ID, ServiceName: "web-sidecar-proxy", CheckID: "proxy-tcp", Name: "Connect Sidecar Listening", Type: "tcp", Status: consulapi.HealthPassing},
+	}
+	d := newTestDiscovery(t, map[string]interface{}{
+		"/v1/health/service/web": []*consulapi.ServiceEntry{web},
+		"/v1/health/connect/web": []*consulapi.ServiceEntry{proxy},
+	})
+
+	checks, err := d.GetServiceChecks("web")
+	if err != nil {
+		t.Fatalf("GetServiceChecks: %v", err)
+	}
+	var ids []string
+	for _, c := range checks {
+		ids = append(ids, c.CheckID)
+	}
+	if want := []string{"serfHealth", "web-http", "proxy-tcp"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("check IDs = %v, want %v", ids, want)
+	}
+	if checks[1].AllocID != allocID || !strings.Contains(checks[1].Output, "503") {
+		t.Errorf("service check = %+v", checks[1])
+	}
+	if checks[0].AllocID != "" {
+		t.Errorf("node check has alloc ID %q", checks[0].AllocID)
+	}
+}
+
+func TestDiscoveryTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+	client, err := consulapi.NewClient(&consulapi.Config{Address: strings.TrimPrefix(srv.URL, "http://")})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	d := NewDiscoveryWithOptions(client, DiscoveryOptions{Timeout: 50 * time.Millisecond})
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"list services", func() error { _, err := d.ListConnectServices(); return err }},
+		{"proxy instances", func() error { _, err := d.GetConnectProxyInstances("web", true); return err }},
+		{"intentions", func() error { _, err := d.GetServiceIntentions("web"); return err }},
+		{"health checks", func() error { _, err := d.GetServiceChecks("web"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if err == nil || !strings.Contains(err.Error(), "did not respond within 50ms") {
+				t.Errorf("expected timeout error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryFilter(t *testing.T) {
+	const filter = `Service.Meta.team == "payments"`
+	var healthFilters, catalogFilters []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := r.URL.Query().Get("filter")
+		switch {
+		case r.URL.Path == "/v1/catalog/services":
+			catalogFilters = append(catalogFilters, f)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"web-envoy": nil})
+		case r.URL.Path == "/v1/connect/intentions/match":
+			http.Error(w, "Bad request", http.StatusBadRequest)
+		case f == "bogus ==":
+			http.Error(w, "Failed to create boolean expression evaluator", http.StatusBadRequest)
+		default:
+			healthFilters = append(healthFilters, f)
+			_ = json.NewEncoder(w).Encode([]*consulapi.ServiceEntry{
+				proxyEntry("web-envoy", consulapi.ServiceKindConnectProxy, "web", "p1"),
+			})
+		}
+	}))
+	defer srv.Close()
+	client, err := consulapi.NewClient(&consulapi.Config{Address: strings.TrimPrefix(srv.URL, "http://")})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	d := NewDiscoveryWithOptions(client, DiscoveryOptions{Filter: filter})
+	if _, err := d.ListConnectServices(); err != nil {
+		t.Fatalf("ListConnectServices: %v", err)
+	}
+	if _, err := d.GetConnectProxyInstances("web", true); err != nil {
+		t.Fatalf("GetConnectProxyInstances: %v", err)
+	}
+	// A query that doesn't send the discovery filter can't have it rejected
+	if _, err := d.GetServiceIntentions("web"); err == nil || errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("GetServiceIntentions() error = %v, want a plain request error", err)
+	}
+	if !reflect.DeepEqual(catalogFilters, []string{proxyKindFilter}) {
+		t.Errorf("catalog filters = %q, want only the proxy kind filter", catalogFilters)
+	}
+	if len(healthFilters) != 2 || healthFilters[0] != filter || healthFilters[1] != filter {
+		t.Errorf("health filters = %q, want %q on each query", healthFilters, filter)
+	}
+
+	bad := NewDiscoveryWithOptions(client, DiscoveryOptions{Filter: "bogus =="})
+	_, err = bad.ListConnectServices()
+	if !errors.Is(err, ErrInvalidFilter) || !strings.Contains(err.Error(), `"bogus =="`) {
+		t.Errorf("expected ErrInvalidFilter naming the expression, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package nomad
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// AdminError is a failed Envoy admin request made through exec, or directly
+// over HTTP with MethodDirect. Exactly one of Err (the exec or request
+// failed), Status (Envoy answered with an HTTP error) or a non-zero ExitCode
+// (the HTTP tool failed) describes the failure.
+type AdminError struct {
+	Method   HTTPMethod
+	Path     string
+	ExitCode int
+	Status   int // HTTP status, when the response was parsed
+	Stderr   string
+	Err      error
+}
+
+func (e *AdminError) Error() string {
+	switch {
+	case e.Err != nil && e.Method == MethodDirect:
+		return fmt.Sprintf("request to %s failed: %v", e.Path, e.Err)
+	case e.Err != nil:
+		return fmt.Sprintf("exec failed: %v (stderr: %s)", e.Err, e.Stderr)
+	case e.Status != 0:
+		return fmt.Sprintf("%s returned HTTP %d", e.Path, e.Status)
+	default:
+		return fmt.Sprintf("%s exited with code %d (stderr: %s)", e.Method, e.ExitCode, e.Stderr)
+	}
+}
+
+func (e *AdminError) Unwrap() error {
+	return e.Err
+}
+
+// httpStatus returns the status code of a raw HTTP response, or 0 when the
+// response does not start with a status line.
+func httpStatus(raw []byte) int {
+	line, _, _ := bytes.Cut(raw, []byte("\r\n"))
+	fields := bytes.Fields(line)
+	if len(fields) < 2 || !bytes.HasPrefix(fields[0], []byte("HTTP/")) {
+		return 0
+	}
+	status, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0
+	}
+	return status
+}
@@ -0,0 +1,69 @@
+package nomad
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{"HTTP/1.1 200 OK\r\ncontent-type: text/plain\r\n\r\nLIVE", 200},
+		{"HTTP/1.1 404 Not Found\r\n\r\n", 404},
+		{"LIVE", 0},
+		{"", 0},
+		{"HTTP/1.1 abc\r\n", 0},
+	}
+	for _, tt := range tests {
+		if got := httpStatus([]byte(tt.raw)); got != tt.want {
+			t.Errorf("httpStatus(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestAdminResponse(t *testing.T) {
+	execErr := errors.New("alloc not running")
+	tests := []struct {
+		name       string
+		method     HTTPMethod
+		code       int
+		stdout     string
+		err        error
+		wantBody   string
+		wantErr    bool
+		wantStatus int
+		wantCode   int
+	}{
+		{name: "curl ok", method: MethodCurl, stdout: "LIVE", wantBody: "LIVE"},
+		{name: "curl connection refused", method: MethodCurl, code: 7, wantErr: true, wantCode: 7},
+		{name: "exec failure", method: MethodWget, code: -1, err: execErr, wantErr: true, wantCode: -1},
+		{name: "bash ok", method: MethodBashTCP, stdout: "HTTP/1.1 200 OK\r\n\r\nLIVE", wantBody: "LIVE"},
+		{name: "bash http error", method: MethodBashTCP, stdout: "HTTP/1.1 404 Not Found\r\n\r\ninvalid path", wantErr: true, wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := adminResponse(tt.method, "/ready", tt.code, []byte(tt.stdout), "", tt.err)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+				return
+			}
+			var adminErr *AdminError
+			if !errors.As(err, &adminErr) {
+				t.Fatalf("error = %v, want *AdminError", err)
+			}
+			if adminErr.Status != tt.wantStatus || adminErr.ExitCode != tt.wantCode {
+				t.Errorf("AdminError = %+v, want status %d exit code %d", adminErr, tt.wantStatus, tt.wantCode)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("error %v does not wrap the exec error", err)
+			}
+		})
+	}
+}
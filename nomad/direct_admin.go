@@ -0,0 +1,64 @@
+package nomad
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirectAdminTimeout bounds each Envoy admin request made with MethodDirect
+const DirectAdminTimeout = 30 * time.Second
+
+// directClient leaves timeouts to the per-request context
+var directClient = &http.Client{}
+
+// DirectStrategy returns the strategy that reaches an allocation's Envoy
+// admin API through the host port Nomad mapped to portLabel, for
+// allocations that can't be exec'd into. task is still used by features
+// that have to run commands in the allocation.
+func DirectStrategy(alloc AllocationInfo, portLabel, task string) (*ExecStrategy, error) {
+	hostPort, ok := alloc.Ports[portLabel]
+	if !ok {
+		labels := make([]string, 0, len(alloc.Ports))
+		for label := range alloc.Ports {
+			labels = append(labels, label)
+		}
+		if len(labels) == 0 {
+			return nil, fmt.Errorf("allocation %s has no mapped ports", alloc.ID[:8])
+		}
+		sort.Strings(labels)
+		return nil, fmt.Errorf("allocation %s has no port labelled %q (ports: %s)", alloc.ID[:8], portLabel, strings.Join(labels, ", "))
+	}
+	return &ExecStrategy{Task: task, Method: MethodDirect, HostPort: hostPort}, nil
+}
+
+// directAdminRequest makes an Envoy admin request over HTTP to
+// strategy.HostPort.
+func directAdminRequest(method string, strategy *ExecStrategy, path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), strategy.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+strategy.HostPort+adminPath(strategy.PathPrefix, path), nil)
+	if err != nil {
+		return nil, &AdminError{Method: MethodDirect, Path: path, Err: err}
+	}
+	for _, h := range strategy.Headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+	resp, err := directClient.Do(req)
+	if err != nil {
+		return nil, &AdminError{Method: MethodDirect, Path: path, Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &AdminError{Method: MethodDirect, Path: path, Err: err}
+	}
+	if resp.StatusCode >= 400 {
+		return nil, &AdminError{Method: MethodDirect, Path: path, Status: resp.StatusCode}
+	}
+	return body, nil
+}
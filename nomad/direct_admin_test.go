@@ -0,0 +1,96 @@
+package nomad
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectStrategy(t *testing.T) {
+	alloc := AllocationInfo{
+		ID:    "abcdef12-3456-7890-abcd-ef1234567890",
+		Ports: map[string]string{"envoy_admin": "10.0.0.5:24567", "http": "10.0.0.5:8080"},
+	}
+	strategy, err := DirectStrategy(alloc, "envoy_admin", "connect-proxy-web")
+	if err != nil {
+		t.Fatalf("DirectStrategy() error = %v", err)
+	}
+	if strategy.Method != MethodDirect || strategy.HostPort != "10.0.0.5:24567" || strategy.Task != "connect-proxy-web" {
+		t.Errorf("DirectStrategy() = %+v", strategy)
+	}
+
+	if _, err := DirectStrategy(alloc, "admin", ""); err == nil || !strings.Contains(err.Error(), "ports: envoy_admin, http") {
+		t.Errorf("DirectStrategy() unknown label error = %v, want the mapped labels listed", err)
+	}
+	alloc.Ports = nil
+	if _, err := DirectStrategy(alloc, "admin", ""); err == nil || !strings.Contains(err.Error(), "no mapped ports") {
+		t.Errorf("DirectStrategy() without ports error = %v", err)
+	}
+}
+
+func TestDirectAdminRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/admin/ready":
+			w.Write([]byte("LIVE\n"))
+		case "/admin/logging":
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	strategy := &ExecStrategy{
+		Method:     MethodDirect,
+		HostPort:   strings.TrimPrefix(srv.URL, "http://"),
+		Headers:    []Header{{Name: "Authorization", Value: "Bearer tok"}},
+		PathPrefix: "/admin",
+	}
+	body, err := directAdminRequest(http.MethodGet, strategy, "/ready")
+	if err != nil || string(body) != "LIVE\n" {
+		t.Errorf("GET /ready = %q, %v", body, err)
+	}
+	if _, err := directAdminRequest(http.MethodPost, strategy, "/logging"); err != nil {
+		t.Errorf("POST /logging error = %v", err)
+	}
+
+	var adminErr *AdminError
+	_, err = directAdminRequest(http.MethodGet, strategy, "/nope")
+	if !errors.As(err, &adminErr) || adminErr.Status != http.StatusNotFound {
+		t.Errorf("GET /nope error = %v, want HTTP 404", err)
+	}
+
+	srv.Close()
+	_, err = directAdminRequest(http.MethodGet, strategy, "/ready")
+	if !errors.As(err, &adminErr) || adminErr.Err == nil || adminErr.Method != MethodDirect {
+		t.Errorf("GET against closed server error = %v, want a request error", err)
+	}
+}
+
+func TestDirectAdminRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	strategy := &ExecStrategy{Method: MethodDirect, HostPort: strings.TrimPrefix(srv.URL, "http://"), Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := directAdminRequest(http.MethodGet, strategy, "/config_dump"); err == nil {
+		t.Fatal("directAdminRequest() succeeded, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("directAdminRequest() took %v, want it bounded by the strategy timeout", elapsed)
+	}
+}
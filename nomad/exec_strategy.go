@@ -2,9 +2,14 @@ package nomad
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // HTTPMethod represents a method for making HTTP requests from inside a container.
@@ -16,6 +21,7 @@ const (
 	MethodPython3                   // python3 urllib
 	MethodNode                      // node http
 	MethodBashTCP                   // bash /dev/tcp
+	MethodDirect                    // HTTP from this host to a port Nomad maps to the admin API, no exec
 )
 
 func (m HTTPMethod) String() string {
@@ -30,6 +36,8 @@ func (m HTTPMethod) String() string {
 		return "node"
 	case MethodBashTCP:
 		return "bash"
+	case MethodDirect:
+		return "direct"
 	default:
 		return "unknown"
 	}
@@ -39,6 +47,99 @@ func (m HTTPMethod) String() string {
 type ExecStrategy struct {
 	Task   string
 	Method HTTPMethod
+	// Headers are sent with every Envoy admin request (e.g. Authorization)
+	Headers []Header
+	// PathPrefix is prepended to every Envoy admin path, for an admin API
+	// routed under a prefix such as /admin
+	PathPrefix string
+	// Address is the IP the Envoy admin API listens on inside the
+	// allocation; EnvoyAdminAddr when empty
+	Address string
+	// HostPort is the node address and mapped port the admin API is
+	// fetched from with MethodDirect
+	HostPort string
+	// Timeout bounds each admin request; DefaultExecTimeout, or
+	// DirectAdminTimeout with MethodDirect, when zero
+	Timeout time.Duration
+}
+
+func (s *ExecStrategy) timeout() time.Duration {
+	switch {
+	case s.Timeout > 0:
+		return s.Timeout
+	case s.Method == MethodDirect:
+		return DirectAdminTimeout
+	default:
+		return DefaultExecTimeout
+	}
+}
+
+// adminPath prepends prefix to an Envoy admin path. A missing leading slash
+// and any trailing slash on prefix are tolerated.
+func adminPath(prefix, path string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" {
+		return path
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix + path
+}
+
+// ValidateAdminAddr checks an --envoy-admin-ip value, which must be a
+// literal IPv4 or IPv6 address.
+func ValidateAdminAddr(addr string) error {
+	if addr != "" && net.ParseIP(addr) == nil {
+		return fmt.Errorf("invalid Envoy admin IP %q: expected an IPv4 or IPv6 address", addr)
+	}
+	return nil
+}
+
+// adminHost returns addr, or EnvoyAdminAddr when it is empty.
+func adminHost(addr string) string {
+	if addr == "" {
+		return EnvoyAdminAddr
+	}
+	return addr
+}
+
+// Header is an HTTP request header sent to the Envoy admin API.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// ParseAdminAuth parses an --admin-auth value of the form "basic:user:pass"
+// or "bearer:token" into an Authorization header.
+func ParseAdminAuth(spec string) (Header, error) {
+	scheme, rest, ok := strings.Cut(spec, ":")
+	if !ok || rest == "" {
+		return Header{}, fmt.Errorf("invalid admin auth %q: expected basic:user:pass or bearer:token", spec)
+	}
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !strings.Contains(rest, ":") {
+			return Header{}, fmt.Errorf("invalid basic admin auth: expected basic:user:pass")
+		}
+		return Header{Name: "Authorization", Value: "Basic " + base64.StdEncoding.EncodeToString([]byte(rest))}, nil
+	case "bearer":
+		return Header{Name: "Authorization", Value: "Bearer " + rest}, nil
+	default:
+		return Header{}, fmt.Errorf("unsupported admin auth scheme %q (use basic or bearer)", scheme)
+	}
+}
+
+// ValidatePathPrefix checks an --admin-path-prefix value. The prefix is
+// embedded in shell, Python and JavaScript commands, so only plain path
+// characters are allowed.
+func ValidatePathPrefix(prefix string) error {
+	for _, r := range prefix {
+		if strings.ContainsRune("?#\"'`$\\", r) || r <= ' ' || r == 0x7f {
+			return fmt.Errorf("invalid admin path prefix %q: only path characters are allowed", prefix)
+		}
+	}
+	return nil
 }
 
 // probeCommands are lightweight commands used to detect available HTTP tools.
@@ -93,23 +194,35 @@ func ResolveExecStrategy(svc NomadApiService, allocID string, taskOrder []string
 	)
 }
 
-// BuildGETCommand builds the exec command for a GET request using the given method.
-func BuildGETCommand(method HTTPMethod, port int, path string) []string {
+// BuildGETCommand builds the exec command for a GET request to addr:port
+// using the given method. An empty addr means EnvoyAdminAddr. Any headers
+// are added to the request.
+func BuildGETCommand(method HTTPMethod, addr string, port int, path string, headers ...Header) []string {
+	addr = adminHost(addr)
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(addr, strconv.Itoa(port)), path)
 	switch method {
 	case MethodCurl:
-		return []string{"curl", "-s", fmt.Sprintf("http://127.0.0.2:%d%s", port, path)}
+		return append(append([]string{"curl", "-s"}, curlHeaderArgs(headers)...), url)
 	case MethodWget:
-		return []string{"wget", "-qO-", fmt.Sprintf("http://127.0.0.2:%d%s", port, path)}
+		return append(append([]string{"wget", "-qO-"}, wgetHeaderArgs(headers)...), url)
 	case MethodPython3:
+		if len(headers) > 0 {
+			return []string{"python3", "-c",
+				fmt.Sprintf(`import urllib.request,sys;sys.stdout.buffer.write(urllib.request.urlopen(urllib.request.Request(%s,headers=%s)).read())`, stringLiteral(url), headerLiteral(headers))}
+		}
 		return []string{"python3", "-c",
-			fmt.Sprintf(`import urllib.request,sys;sys.stdout.buffer.write(urllib.request.urlopen("http://127.0.0.2:%d%s").read())`, port, path)}
+			fmt.Sprintf(`import urllib.request,sys;sys.stdout.buffer.write(urllib.request.urlopen(%s).read())`, stringLiteral(url))}
 	case MethodNode:
+		opts := ""
+		if len(headers) > 0 {
+			opts = fmt.Sprintf(`,{headers:%s}`, headerLiteral(headers))
+		}
 		return []string{"node", "-e",
-			fmt.Sprintf(`var http=require("http");http.get("http://127.0.0.2:%d%s",function(r){var d=[];r.on("data",function(c){d.push(c)});r.on("end",function(){process.stdout.write(Buffer.concat(d))})}).on("error",function(){process.exit(1)})`, port, path)}
+			fmt.Sprintf(`var http=require("http");http.get(%s%s,function(r){var d=[];r.on("data",function(c){d.push(c)});r.on("end",function(){process.stdout.write(Buffer.concat(d))})}).on("error",function(){process.exit(1)})`, stringLiteral(url), opts)}
 	case MethodBashTCP:
 		bashCmd := fmt.Sprintf(
-			`exec 3<>/dev/tcp/127.0.0.2/%d; echo -e "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n" >&3; cat <&3`,
-			port, path,
+			`exec 3<>/dev/tcp/%s/%d; echo -e "GET %s HTTP/1.1\r\nHost: localhost\r\n%sConnection: close\r\n\r\n" >&3; cat <&3`,
+			addr, port, bashEscape.Replace(path), bashHeaderLines(headers),
 		)
 		return []string{"bash", "-c", bashCmd}
 	default:
@@ -117,26 +230,89 @@ func BuildGETCommand(method HTTPMethod, port int, path string) []string {
 	}
 }
 
-// BuildPOSTCommand builds the exec command for a POST request using the given method.
-func BuildPOSTCommand(method HTTPMethod, port int, path string) []string {
+// BuildPOSTCommand builds the exec command for a POST request to addr:port
+// using the given method. An empty addr means EnvoyAdminAddr. Any headers
+// are added to the request.
+func BuildPOSTCommand(method HTTPMethod, addr string, port int, path string, headers ...Header) []string {
+	addr = adminHost(addr)
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(addr, strconv.Itoa(port)), path)
 	switch method {
 	case MethodCurl:
-		return []string{"curl", "-s", "-X", "POST", fmt.Sprintf("http://127.0.0.2:%d%s", port, path)}
+		return append(append([]string{"curl", "-s", "-X", "POST"}, curlHeaderArgs(headers)...), url)
 	case MethodWget:
-		return []string{"wget", "-qO-", "--post-data=", fmt.Sprintf("http://127.0.0.2:%d%s", port, path)}
+		return append(append([]string{"wget", "-qO-", "--post-data="}, wgetHeaderArgs(headers)...), url)
 	case MethodPython3:
+		extra := ""
+		if len(headers) > 0 {
+			extra = ",headers=" + headerLiteral(headers)
+		}
 		return []string{"python3", "-c",
-			fmt.Sprintf(`import urllib.request;urllib.request.urlopen(urllib.request.Request("http://127.0.0.2:%d%s",data=b"",method="POST"))`, port, path)}
+			fmt.Sprintf(`import urllib.request;urllib.request.urlopen(urllib.request.Request(%s,data=b"",method="POST"%s))`, stringLiteral(url), extra)}
 	case MethodNode:
+		extra := ""
+		if len(headers) > 0 {
+			extra = ",headers:" + headerLiteral(headers)
+		}
 		return []string{"node", "-e",
-			fmt.Sprintf(`var http=require("http");var r=http.request({hostname:"127.0.0.2",port:%d,path:"%s",method:"POST"},function(res){res.resume()});r.on("error",function(){process.exit(1)});r.end()`, port, path)}
+			fmt.Sprintf(`var http=require("http");var r=http.request({hostname:%s,port:%d,path:%s,method:"POST"%s},function(res){res.resume()});r.on("error",function(){process.exit(1)});r.end()`, stringLiteral(addr), port, stringLiteral(path), extra)}
 	case MethodBashTCP:
 		bashCmd := fmt.Sprintf(
-			`exec 3<>/dev/tcp/127.0.0.2/%d; echo -e "POST %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nContent-Length: 0\r\n\r\n" >&3; cat <&3`,
-			port, path,
+			`exec 3<>/dev/tcp/%s/%d; echo -e "POST %s HTTP/1.1\r\nHost: localhost\r\n%sConnection: close\r\nContent-Length: 0\r\n\r\n" >&3; cat <&3`,
+			addr, port, bashEscape.Replace(path), bashHeaderLines(headers),
 		)
 		return []string{"bash", "-c", bashCmd}
 	default:
 		return nil
 	}
 }
+
+func curlHeaderArgs(headers []Header) []string {
+	var args []string
+	for _, h := range headers {
+		args = append(args, "-H", h.Name+": "+h.Value)
+	}
+	return args
+}
+
+func wgetHeaderArgs(headers []Header) []string {
+	var args []string
+	for _, h := range headers {
+		args = append(args, "--header="+h.Name+": "+h.Value)
+	}
+	return args
+}
+
+// stringLiteral quotes s as a JSON string, which is also a valid Python and
+// JavaScript string literal, so a quote in a path can't end the literal.
+func stringLiteral(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// headerLiteral renders headers as a JSON object, which is also a valid
+// Python dict and JavaScript object literal.
+func headerLiteral(headers []Header) string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[h.Name] = h.Value
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// bashEscape escapes text for a double-quoted echo -e string.
+var bashEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// bashHeaderLines renders headers as raw HTTP header lines for the bash
+// /dev/tcp request, escaped for a double-quoted echo -e string.
+func bashHeaderLines(headers []Header) string {
+	var b strings.Builder
+	for _, h := range headers {
+		b.WriteString(bashEscape.Replace(h.Name + ": " + h.Value))
+		b.WriteString(`\r\n`)
+	}
+	return b.String()
+}
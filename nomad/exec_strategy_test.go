@@ -7,6 +7,8 @@ import (
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/markcampv/xDSnap/consul"
 )
 
 // mockExecResponse defines what a mocked exec call returns.
@@ -59,6 +61,10 @@ func (m *mockNomadService) GetAllocation(allocID string) (*AllocationInfo, error
 	return nil, nil
 }
 
+func (m *mockNomadService) GetNode(nodeID string) (*NodeInfo, error) {
+	return nil, nil
+}
+
 func (m *mockNomadService) FindConnectAllocations(namespace string) ([]AllocationInfo, error) {
 	return nil, nil
 }
@@ -67,6 +73,30 @@ func (m *mockNomadService) FindConnectAllocationsByService(namespace, serviceNam
 	return nil, nil
 }
 
+func (m *mockNomadService) FindUpstreamAllocations(namespace, serviceName string) ([]AllocationInfo, error) {
+	return nil, nil
+}
+
+func (m *mockNomadService) GetServiceIntentions(serviceName string) (*consul.ServiceIntentions, error) {
+	return nil, nil
+}
+
+func (m *mockNomadService) GetNodeStatus(nodeID string) (*NodeStatus, error) {
+	return nil, nil
+}
+
+func (m *mockNomadService) GetAllocationStats(allocID string) (*AllocResourceStats, error) {
+	return nil, nil
+}
+
+func (m *mockNomadService) GetJobDeployment(namespace, jobID string) (*JobDeployment, error) {
+	return nil, nil
+}
+
+func (m *mockNomadService) GetServiceChecks(serviceName string) ([]consul.ServiceCheck, error) {
+	return nil, nil
+}
+
 func (m *mockNomadService) EnvoyAdminGETViaExec(allocID, task string, port int, path string) ([]byte, error) {
 	return nil, nil
 }
@@ -76,7 +106,7 @@ func (m *mockNomadService) EnvoyAdminPOSTViaExec(allocID, task string, port int,
 }
 
 func (m *mockNomadService) EnvoyAdminGET(allocID string, strategy *ExecStrategy, port int, path string) ([]byte, error) {
-	cmd := BuildGETCommand(strategy.Method, port, path)
+	cmd := BuildGETCommand(strategy.Method, strategy.Address, port, path, strategy.Headers...)
 	var stdout, stderr bytes.Buffer
 	_, err := m.ExecuteCommandWithStderr(allocID, strategy.Task, cmd, &stdout, &stderr)
 	if err != nil {
@@ -93,7 +123,7 @@ func (m *mockNomadService) EnvoyAdminGET(allocID string, strategy *ExecStrategy,
 }
 
 func (m *mockNomadService) EnvoyAdminPOST(allocID string, strategy *ExecStrategy, port int, path string) error {
-	cmd := BuildPOSTCommand(strategy.Method, port, path)
+	cmd := BuildPOSTCommand(strategy.Method, strategy.Address, port, path, strategy.Headers...)
 	var stdout, stderr bytes.Buffer
 	_, err := m.ExecuteCommandWithStderr(allocID, strategy.Task, cmd, &stdout, &stderr)
 	return err
@@ -179,7 +209,7 @@ func TestBuildGETCommand(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := BuildGETCommand(tt.method, tt.port, tt.path)
+			got := BuildGETCommand(tt.method, "", tt.port, tt.path)
 			if tt.want == nil {
 				if got != nil {
 					t.Errorf("BuildGETCommand() = %v, want nil", got)
@@ -257,7 +287,7 @@ func TestBuildPOSTCommand(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := BuildPOSTCommand(tt.method, tt.port, tt.path)
+			got := BuildPOSTCommand(tt.method, "", tt.port, tt.path)
 			if tt.want == nil {
 				if got != nil {
 					t.Errorf("BuildPOSTCommand() = %v, want nil", got)
@@ -532,3 +562,288 @@ func TestDecodeChunked(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAdminAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Header
+		wantErr bool
+	}{
+		{
+			name: "basic",
+			spec: "basic:admin:s3cret",
+			want: Header{Name: "Authorization", Value: "Basic YWRtaW46czNjcmV0"},
+		},
+		{
+			name: "bearer",
+			spec: "bearer:abc.def",
+			want: Header{Name: "Authorization", Value: "Bearer abc.def"},
+		},
+		{
+			name: "scheme is case-insensitive",
+			spec: "Bearer:tok",
+			want: Header{Name: "Authorization", Value: "Bearer tok"},
+		},
+		{name: "basic without password", spec: "basic:admin", wantErr: true},
+		{name: "missing value", spec: "bearer:", wantErr: true},
+		{name: "unknown scheme", spec: "digest:x", wantErr: true},
+		{name: "no scheme", spec: "token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAdminAuth(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAdminAuth(%q) expected error, got %+v", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAdminAuth(%q) unexpected error: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAdminAuth(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminPath(t *testing.T) {
+	tests := []struct {
+		prefix, path, want string
+	}{
+		{"", "/stats", "/stats"},
+		{"/admin", "/stats", "/admin/stats"},
+		{"/admin/", "/config_dump", "/admin/config_dump"},
+		{"admin", "/logging?level=debug", "/admin/logging?level=debug"},
+		{"/", "/ready", "/ready"},
+	}
+	for _, tt := range tests {
+		if got := adminPath(tt.prefix, tt.path); got != tt.want {
+			t.Errorf("adminPath(%q, %q) = %q, want %q", tt.prefix, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePathPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{"", false},
+		{"/admin", false},
+		{"/envoy/admin-v1/", false},
+		{"/admin?x=1", true},
+		{`/admin"`, true},
+		{"/ad min", true},
+		{"/$(id)", true},
+	}
+	for _, tt := range tests {
+		if err := ValidatePathPrefix(tt.prefix); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePathPrefix(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"", false},
+		{"10.0.0.5", false},
+		{"fd00::5", false},
+		{"envoy.local", true},
+		{"10.0.0.5:19001", true},
+		{"10.0.0.5; id", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateAdminAddr(tt.addr); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateAdminAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBuildCommandsWithAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "curl GET ipv4",
+			got:  BuildGETCommand(MethodCurl, "10.0.0.5", 19001, "/stats"),
+			want: []string{"curl", "-s", "http://10.0.0.5:19001/stats"},
+		},
+		{
+			name: "curl GET ipv6",
+			got:  BuildGETCommand(MethodCurl, "fd00::5", 19001, "/stats"),
+			want: []string{"curl", "-s", "http://[fd00::5]:19001/stats"},
+		},
+		{
+			name: "bash GET",
+			got:  BuildGETCommand(MethodBashTCP, "10.0.0.5", 19001, "/stats"),
+			want: []string{"bash", "-c",
+				`exec 3<>/dev/tcp/10.0.0.5/19001; echo -e "GET /stats HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n" >&3; cat <&3`,
+			},
+		},
+		{
+			name: "node POST",
+			got:  BuildPOSTCommand(MethodNode, "10.0.0.5", 19001, "/logging?level=debug"),
+			want: []string{"node", "-e",
+				`var http=require("http");var r=http.request({hostname:"10.0.0.5",port:19001,path:"/logging?level=debug",method:"POST"},function(res){res.resume()});r.on("error",function(){process.exit(1)});r.end()`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d\ngot:  %v\nwant: %v", len(tt.got), len(tt.want), tt.got, tt.want)
+			}
+			for i := range tt.got {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("[%d] = %q, want %q", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCommandsWithHeaders(t *testing.T) {
+	auth := Header{Name: "Authorization", Value: "Bearer tok"}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "curl GET",
+			got:  BuildGETCommand(MethodCurl, "", 19001, "/stats", auth),
+			want: []string{"curl", "-s", "-H", "Authorization: Bearer tok", "http://127.0.0.2:19001/stats"},
+		},
+		{
+			name: "wget GET",
+			got:  BuildGETCommand(MethodWget, "", 19001, "/stats", auth),
+			want: []string{"wget", "-qO-", "--header=Authorization: Bearer tok", "http://127.0.0.2:19001/stats"},
+		},
+		{
+			name: "python3 GET",
+			got:  BuildGETCommand(MethodPython3, "", 19001, "/stats", auth),
+			want: []string{"python3", "-c",
+				`import urllib.request,sys;sys.stdout.buffer.write(urllib.request.urlopen(urllib.request.Request("http://127.0.0.2:19001/stats",headers={"Authorization":"Bearer tok"})).read())`,
+			},
+		},
+		{
+			name: "node GET",
+			got:  BuildGETCommand(MethodNode, "", 19001, "/stats", auth),
+			want: []string{"node", "-e",
+				`var http=require("http");http.get("http://127.0.0.2:19001/stats",{headers:{"Authorization":"Bearer tok"}},function(r){var d=[];r.on("data",function(c){d.push(c)});r.on("end",function(){process.stdout.write(Buffer.concat(d))})}).on("error",function(){process.exit(1)})`,
+			},
+		},
+		{
+			name: "bash GET",
+			got:  BuildGETCommand(MethodBashTCP, "", 19001, "/stats", auth),
+			want: []string{"bash", "-c",
+				`exec 3<>/dev/tcp/127.0.0.2/19001; echo -e "GET /stats HTTP/1.1\r\nHost: localhost\r\nAuthorization: Bearer tok\r\nConnection: close\r\n\r\n" >&3; cat <&3`,
+			},
+		},
+		{
+			name: "curl POST",
+			got:  BuildPOSTCommand(MethodCurl, "", 19001, "/logging?level=debug", auth),
+			want: []string{"curl", "-s", "-X", "POST", "-H", "Authorization: Bearer tok", "http://127.0.0.2:19001/logging?level=debug"},
+		},
+		{
+			name: "python3 POST",
+			got:  BuildPOSTCommand(MethodPython3, "", 19001, "/logging?level=debug", auth),
+			want: []string{"python3", "-c",
+				`import urllib.request;urllib.request.urlopen(urllib.request.Request("http://127.0.0.2:19001/logging?level=debug",data=b"",method="POST",headers={"Authorization":"Bearer tok"}))`,
+			},
+		},
+		{
+			name: "node POST",
+			got:  BuildPOSTCommand(MethodNode, "", 19001, "/logging?level=debug", auth),
+			want: []string{"node", "-e",
+				`var http=require("http");var r=http.request({hostname:"127.0.0.2",port:19001,path:"/logging?level=debug",method:"POST",headers:{"Authorization":"Bearer tok"}},function(res){res.resume()});r.on("error",function(){process.exit(1)});r.end()`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d\ngot:  %v\nwant: %v", len(tt.got), len(tt.want), tt.got, tt.want)
+			}
+			for i := range tt.got {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("[%d] = %q, want %q", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCommandsEscapePath(t *testing.T) {
+	path := "/stats$(id)\"`x`"
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "python3 GET",
+			got:  BuildGETCommand(MethodPython3, "", 19001, path),
+			want: []string{"python3", "-c",
+				`import urllib.request,sys;sys.stdout.buffer.write(urllib.request.urlopen("http://127.0.0.2:19001/stats$(id)\"` + "`x`" + `").read())`,
+			},
+		},
+		{
+			name: "node GET",
+			got:  BuildGETCommand(MethodNode, "", 19001, path),
+			want: []string{"node", "-e",
+				`var http=require("http");http.get("http://127.0.0.2:19001/stats$(id)\"` + "`x`" + `",function(r){var d=[];r.on("data",function(c){d.push(c)});r.on("end",function(){process.stdout.write(Buffer.concat(d))})}).on("error",function(){process.exit(1)})`,
+			},
+		},
+		{
+			name: "bash GET",
+			got:  BuildGETCommand(MethodBashTCP, "", 19001, path),
+			want: []string{"bash", "-c",
+				`exec 3<>/dev/tcp/127.0.0.2/19001; echo -e "GET /stats\$(id)\"\` + "`x\\`" + ` HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n" >&3; cat <&3`,
+			},
+		},
+		{
+			name: "python3 POST",
+			got:  BuildPOSTCommand(MethodPython3, "", 19001, path),
+			want: []string{"python3", "-c",
+				`import urllib.request;urllib.request.urlopen(urllib.request.Request("http://127.0.0.2:19001/stats$(id)\"` + "`x`" + `",data=b"",method="POST"))`,
+			},
+		},
+		{
+			name: "node POST",
+			got:  BuildPOSTCommand(MethodNode, "", 19001, path),
+			want: []string{"node", "-e",
+				`var http=require("http");var r=http.request({hostname:"127.0.0.2",port:19001,path:"/stats$(id)\"` + "`x`" + `",method:"POST"},function(res){res.resume()});r.on("error",function(){process.exit(1)});r.end()`,
+			},
+		},
+		{
+			name: "bash POST",
+			got:  BuildPOSTCommand(MethodBashTCP, "", 19001, path),
+			want: []string{"bash", "-c",
+				`exec 3<>/dev/tcp/127.0.0.2/19001; echo -e "POST /stats\$(id)\"\` + "`x\\`" + ` HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nContent-Length: 0\r\n\r\n" >&3; cat <&3`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("len = %d, want %d\ngot:  %v\nwant: %v", len(tt.got), len(tt.want), tt.got, tt.want)
+			}
+			for i := range tt.got {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("[%d] = %q, want %q", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
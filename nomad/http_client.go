@@ -0,0 +1,45 @@
+package nomad
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultAPITimeout bounds connecting to, and the TLS handshake with, the
+// Nomad and Consul APIs.
+const DefaultAPITimeout = 10 * time.Second
+
+// DefaultDiscoveryTimeout bounds each Consul discovery query.
+const DefaultDiscoveryTimeout = 30 * time.Second
+
+// newTransport returns a pooled transport so connections to an API server are
+// reused across requests. There is deliberately no overall request timeout:
+// log streams and exec sessions stay open for the whole capture.
+func newTransport(timeout time.Duration) *http.Transport {
+	if timeout <= 0 {
+		timeout = DefaultAPITimeout
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// alloc exec uses websockets, which need HTTP/1.1
+		ForceAttemptHTTP2: false,
+	}
+}
+
+// newNomadHTTPClient returns the client shared by every Nomad API call.
+func newNomadHTTPClient(timeout time.Duration) *http.Client {
+	transport := newTransport(timeout)
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: transport}
+}
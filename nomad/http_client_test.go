@@ -0,0 +1,51 @@
+package nomad
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewTransportReusesConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: newTransport(time.Second)}
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if got := atomic.LoadInt32(&conns); got != 1 {
+		t.Errorf("opened %d connections, want 1", got)
+	}
+}
+
+func TestNewTransportTimeouts(t *testing.T) {
+	if got := newTransport(0).TLSHandshakeTimeout; got != DefaultAPITimeout {
+		t.Errorf("default TLSHandshakeTimeout = %v, want %v", got, DefaultAPITimeout)
+	}
+	if got := newTransport(3 * time.Second).TLSHandshakeTimeout; got != 3*time.Second {
+		t.Errorf("TLSHandshakeTimeout = %v, want 3s", got)
+	}
+	if client := newNomadHTTPClient(time.Second); client.Timeout != 0 {
+		t.Errorf("client Timeout = %v, want none so streams aren't cut off", client.Timeout)
+	}
+}
@@ -0,0 +1,329 @@
+package nomad
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// fakeCluster stands up httptest servers answering like a Nomad and a Consul
+// agent, so discovery and admin requests run through real nomadapi and
+// consulapi clients. Allocations are added with addConnectAlloc, which also
+// registers the sidecar proxy in the fake Consul catalog the way Nomad does.
+type fakeCluster struct {
+	t      *testing.T
+	nomad  *httptest.Server
+	consul *httptest.Server
+
+	mu       sync.Mutex
+	allocs   []*nomadapi.Allocation
+	proxies  map[string][]*consulapi.ServiceEntry // by destination service
+	requests []string                             // Nomad and Consul requests, as "METHOD /path?query"
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	t.Helper()
+	c := &fakeCluster{t: t, proxies: make(map[string][]*consulapi.ServiceEntry)}
+	c.nomad = httptest.NewServer(http.HandlerFunc(c.serveNomad))
+	t.Cleanup(c.nomad.Close)
+	c.consul = httptest.NewServer(http.HandlerFunc(c.serveConsul))
+	t.Cleanup(c.consul.Close)
+	return c
+}
+
+// service returns a NomadApiService wired to the fake agents.
+func (c *fakeCluster) service(namespace string) NomadApiService {
+	c.t.Helper()
+	nomadClient, err := nomadapi.NewClient(&nomadapi.Config{Address: c.nomad.URL})
+	if err != nil {
+		c.t.Fatalf("nomad NewClient: %v", err)
+	}
+	consulClient, err := consulapi.NewClient(&consulapi.Config{Address: strings.TrimPrefix(c.consul.URL, "http://")})
+	if err != nil {
+		c.t.Fatalf("consul NewClient: %v", err)
+	}
+	return NewNomadApiService(nomadClient, consulClient, namespace)
+}
+
+// fakeAlloc describes an allocation added to the cluster.
+type fakeAlloc struct {
+	id        string
+	namespace string
+	service   string
+	status    string            // Nomad client status; running when empty
+	checks    string            // sidecar check status in Consul; passing when empty
+	ports     map[string]string // group port label -> host address:port
+	// unregistered allocations are known to Nomad but not to Consul
+	unregistered bool
+}
+
+// addConnectAlloc adds a running allocation whose task group has a Connect
+// service and a connect-proxy-<service> sidecar task.
+func (c *fakeCluster) addConnectAlloc(a fakeAlloc) *nomadapi.Allocation {
+	group := a.service
+	status := a.status
+	if status == "" {
+		status = "running"
+	}
+	alloc := &nomadapi.Allocation{
+		ID:           a.id,
+		Name:         "job." + group + "[0]",
+		JobID:        "job",
+		Namespace:    a.namespace,
+		TaskGroup:    group,
+		ClientStatus: status,
+		TaskStates:   map[string]*nomadapi.TaskState{a.service: {}, "connect-proxy-" + a.service: {}},
+		Job: &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{{
+			Name:     &group,
+			Services: []*nomadapi.Service{{Name: a.service, Connect: &nomadapi.ConsulConnect{}}},
+		}}},
+	}
+	if len(a.ports) > 0 {
+		alloc.AllocatedResources = &nomadapi.AllocatedResources{}
+		for label, addr := range a.ports {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				c.t.Fatalf("port %s: %v", label, err)
+			}
+			value, _ := strconv.Atoi(port)
+			alloc.AllocatedResources.Shared.Ports = append(alloc.AllocatedResources.Shared.Ports, nomadapi.PortMapping{Label: label, HostIP: host, Value: value})
+		}
+	}
+
+	checks := a.checks
+	if checks == "" {
+		checks = consulapi.HealthPassing
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allocs = append(c.allocs, alloc)
+	if !a.unregistered {
+		c.proxies[a.service] = append(c.proxies[a.service], &consulapi.ServiceEntry{
+			Node: &consulapi.Node{Node: "client-1", Address: "10.0.0.1"},
+			Service: &consulapi.AgentService{
+				ID:      "_nomad-task-" + a.id + "-group-" + group + "-" + a.service + "-9090-sidecar-proxy",
+				Service: a.service + "-sidecar-proxy",
+				Kind:    consulapi.ServiceKindConnectProxy,
+				Proxy:   &consulapi.AgentServiceConnectProxyConfig{DestinationServiceName: a.service},
+			},
+			Checks: consulapi.HealthChecks{{Status: checks}},
+		})
+	}
+	return alloc
+}
+
+// nomadRequests returns the recorded requests to the fake Nomad agent whose
+// path starts with prefix.
+func (c *fakeCluster) nomadRequests(prefix string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var matched []string
+	for _, r := range c.requests {
+		if strings.HasPrefix(r, "nomad GET "+prefix) {
+			matched = append(matched, strings.TrimPrefix(r, "nomad GET "))
+		}
+	}
+	return matched
+}
+
+func (c *fakeCluster) record(agent string, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, agent+" "+r.Method+" "+r.URL.RequestURI())
+}
+
+func (c *fakeCluster) serveNomad(w http.ResponseWriter, r *http.Request) {
+	c.record("nomad", r)
+	c.mu.Lock()
+	allocs := append([]*nomadapi.Allocation(nil), c.allocs...)
+	c.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/allocations":
+		ns := r.URL.Query().Get("namespace")
+		stubs := []*nomadapi.AllocationListStub{}
+		for _, a := range allocs {
+			if NamespaceMatches(ns, a.Namespace) {
+				stubs = append(stubs, &nomadapi.AllocationListStub{ID: a.ID, Namespace: a.Namespace, TaskGroup: a.TaskGroup, ClientStatus: a.ClientStatus})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(stubs)
+	case strings.HasPrefix(r.URL.Path, "/v1/allocation/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/allocation/")
+		for _, a := range allocs {
+			if a.ID == id {
+				_ = json.NewEncoder(w).Encode(a)
+				return
+			}
+		}
+		http.Error(w, "alloc not found", http.StatusNotFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (c *fakeCluster) serveConsul(w http.ResponseWriter, r *http.Request) {
+	c.record("consul", r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	passing := r.URL.Query().Has("passing")
+	entries := func(list []*consulapi.ServiceEntry) []*consulapi.ServiceEntry {
+		kept := []*consulapi.ServiceEntry{}
+		for _, e := range list {
+			if !passing || e.Checks.AggregatedStatus() == consulapi.HealthPassing {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	}
+
+	switch {
+	case r.URL.Path == "/v1/catalog/services":
+		services := make(map[string][]string)
+		for svc := range c.proxies {
+			services[svc+"-sidecar-proxy"] = nil
+		}
+		_ = json.NewEncoder(w).Encode(services)
+	case strings.HasPrefix(r.URL.Path, "/v1/health/connect/"):
+		_ = json.NewEncoder(w).Encode(entries(c.proxies[strings.TrimPrefix(r.URL.Path, "/v1/health/connect/")]))
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		_ = json.NewEncoder(w).Encode(entries(c.proxies[strings.TrimSuffix(name, "-sidecar-proxy")]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func allocIDs(allocs []AllocationInfo) []string {
+	ids := make([]string, 0, len(allocs))
+	for _, a := range allocs {
+		ids = append(ids, a.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIntegrationFindConnectAllocationsByService(t *testing.T) {
+	c := newFakeCluster(t)
+	web1 := c.addConnectAlloc(fakeAlloc{id: "11111111-1111-1111-1111-111111111111", namespace: "default", service: "web"})
+	c.addConnectAlloc(fakeAlloc{id: "22222222-2222-2222-2222-222222222222", namespace: "default", service: "web", checks: consulapi.HealthCritical})
+	api := c.addConnectAlloc(fakeAlloc{id: "33333333-3333-3333-3333-333333333333", namespace: "prod", service: "api"})
+	billing := c.addConnectAlloc(fakeAlloc{id: "44444444-4444-4444-4444-444444444444", namespace: "prod", service: "billing", unregistered: true})
+	c.addConnectAlloc(fakeAlloc{id: "55555555-5555-5555-5555-555555555555", namespace: "prod", service: "billing", status: "complete", unregistered: true})
+
+	tests := []struct {
+		name      string
+		namespace string
+		service   string
+		want      []string
+		wantScan  bool
+	}{
+		{name: "healthy sidecars of a service", service: "web", want: []string{web1.ID}},
+		{name: "every service", want: []string{web1.ID, api.ID}},
+		{name: "namespace filters Consul results", namespace: "prod", want: []string{api.ID}},
+		{name: "list of namespaces", namespace: "default,prod", want: []string{web1.ID, api.ID}},
+		{name: "service unknown to Consul scans Nomad", namespace: "prod", service: "billing", want: []string{api.ID, billing.ID}, wantScan: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(c.nomadRequests("/v1/allocations"))
+			allocs, err := c.service(tt.namespace).FindConnectAllocationsByService(tt.namespace, tt.service)
+			if err != nil {
+				t.Fatalf("FindConnectAllocationsByService() error: %v", err)
+			}
+			if got := allocIDs(allocs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %v, want %v", got, tt.want)
+			}
+			if scanned := len(c.nomadRequests("/v1/allocations")) > before; scanned != tt.wantScan {
+				t.Errorf("scanned Nomad = %v, want %v", scanned, tt.wantScan)
+			}
+			for _, a := range allocs {
+				if a.SidecarTask != "connect-proxy-"+a.TaskGroup || !a.Connect {
+					t.Errorf("%s: sidecar = %q, connect = %v", a.ID, a.SidecarTask, a.Connect)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrationDuplicateProxiesAreDeduplicated(t *testing.T) {
+	c := newFakeCluster(t)
+	alloc := c.addConnectAlloc(fakeAlloc{id: "66666666-6666-6666-6666-666666666666", namespace: "default", service: "web"})
+	// A second sidecar registration backed by the same allocation, as for a
+	// task group with two Connect services
+	c.proxies["web"] = append(c.proxies["web"], c.proxies["web"][0])
+
+	allocs, err := c.service("").FindConnectAllocationsByService("", "web")
+	if err != nil {
+		t.Fatalf("FindConnectAllocationsByService() error: %v", err)
+	}
+	if got := allocIDs(allocs); !reflect.DeepEqual(got, []string{alloc.ID}) {
+		t.Errorf("allocations = %v, want [%s]", got, alloc.ID)
+	}
+	if got := c.nomadRequests("/v1/allocation/"); len(got) != 1 {
+		t.Errorf("allocation lookups = %v, want one", got)
+	}
+}
+
+func TestIntegrationEnvoyAdminGETDirect(t *testing.T) {
+	var gotAuth string
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		switch r.URL.RequestURI() {
+		case "/envoy/stats?filter=cluster":
+			_, _ = w.Write([]byte("cluster.web.upstream_cx_total: 3\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer envoy.Close()
+
+	c := newFakeCluster(t)
+	alloc := c.addConnectAlloc(fakeAlloc{
+		id:        "77777777-7777-7777-7777-777777777777",
+		namespace: "default",
+		service:   "web",
+		ports:     map[string]string{"envoy_admin": strings.TrimPrefix(envoy.URL, "http://")},
+	})
+	svc := c.service("")
+
+	info, err := svc.GetAllocation(alloc.ID)
+	if err != nil {
+		t.Fatalf("GetAllocation() error: %v", err)
+	}
+	strategy, err := DirectStrategy(*info, "envoy_admin", info.SidecarTask)
+	if err != nil {
+		t.Fatalf("DirectStrategy() error: %v", err)
+	}
+	strategy.PathPrefix = "/envoy"
+	strategy.Headers = []Header{{Name: "Authorization", Value: "Bearer s3cret"}}
+
+	body, err := svc.EnvoyAdminGET(alloc.ID, strategy, EnvoyAdminPort, "/stats?filter=cluster")
+	if err != nil {
+		t.Fatalf("EnvoyAdminGET() error: %v", err)
+	}
+	if string(body) != "cluster.web.upstream_cx_total: 3\n" {
+		t.Errorf("EnvoyAdminGET() = %q", body)
+	}
+	if gotAuth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+
+	_, err = svc.EnvoyAdminGET(alloc.ID, strategy, EnvoyAdminPort, "/missing")
+	var adminErr *AdminError
+	if !errors.As(err, &adminErr) || adminErr.Status != http.StatusNotFound {
+		t.Errorf("EnvoyAdminGET(/missing) error = %v, want a 404 AdminError", err)
+	}
+}
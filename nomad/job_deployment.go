@@ -0,0 +1,178 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// MaxJobEvaluations bounds how many of a job's evaluations, newest first,
+// GetJobDeployment returns
+const MaxJobEvaluations = 10
+
+// DeploymentGroup is the rollout state of one task group in a deployment
+type DeploymentGroup struct {
+	DesiredTotal    int
+	DesiredCanaries int
+	PlacedCanaries  int
+	Promoted        bool
+	PlacedAllocs    int
+	HealthyAllocs   int
+	UnhealthyAllocs int
+}
+
+// Deployment is the state of a job's deployment
+type Deployment struct {
+	ID                string
+	JobVersion        uint64
+	Status            string
+	StatusDescription string
+	TaskGroups        map[string]DeploymentGroup
+}
+
+// Evaluation is one scheduler evaluation of a job. FailedGroups maps each
+// task group that could not be placed to the reasons, e.g. "memory
+// exhausted on 3 nodes"
+type Evaluation struct {
+	ID                string
+	TriggeredBy       string
+	Status            string
+	StatusDescription string
+	CreateTime        time.Time
+	FailedGroups      map[string][]string
+}
+
+// JobDeployment is a job's latest deployment and recent evaluations, with
+// the API objects in DeploymentRaw and EvaluationsRaw
+type JobDeployment struct {
+	Namespace      string
+	JobID          string
+	Deployment     *Deployment // nil when the job has no deployment, e.g. system and batch jobs
+	Evaluations    []Evaluation
+	DeploymentRaw  []byte
+	EvaluationsRaw []byte
+}
+
+// GetJobDeployment returns the latest deployment of a job and its most
+// recent evaluations
+func (n *NomadApiServiceImpl) GetJobDeployment(namespace, jobID string) (*JobDeployment, error) {
+	q := n.queryOptions()
+	q.Namespace = namespace
+	deployment, _, err := n.nomadClient.Jobs().LatestDeployment(jobID, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest deployment: %w", err)
+	}
+	evals, _, err := n.nomadClient.Jobs().Evaluations(jobID, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evaluations: %w", err)
+	}
+	return newJobDeployment(namespace, jobID, deployment, evals)
+}
+
+func newJobDeployment(namespace, jobID string, deployment *nomadapi.Deployment, evals []*nomadapi.Evaluation) (*JobDeployment, error) {
+	jd := &JobDeployment{Namespace: namespace, JobID: jobID}
+	if deployment != nil {
+		raw, err := json.MarshalIndent(deployment, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode deployment: %w", err)
+		}
+		jd.DeploymentRaw = raw
+		d := &Deployment{
+			ID:                deployment.ID,
+			JobVersion:        deployment.JobVersion,
+			Status:            deployment.Status,
+			StatusDescription: deployment.StatusDescription,
+			TaskGroups:        make(map[string]DeploymentGroup, len(deployment.TaskGroups)),
+		}
+		for name, state := range deployment.TaskGroups {
+			if state == nil {
+				continue
+			}
+			d.TaskGroups[name] = DeploymentGroup{
+				DesiredTotal:    state.DesiredTotal,
+				DesiredCanaries: state.DesiredCanaries,
+				PlacedCanaries:  len(state.PlacedCanaries),
+				Promoted:        state.Promoted,
+				PlacedAllocs:    state.PlacedAllocs,
+				HealthyAllocs:   state.HealthyAllocs,
+				UnhealthyAllocs: state.UnhealthyAllocs,
+			}
+		}
+		jd.Deployment = d
+	}
+
+	recent := make([]*nomadapi.Evaluation, 0, len(evals))
+	for _, e := range evals {
+		if e != nil {
+			recent = append(recent, e)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].CreateIndex > recent[j].CreateIndex })
+	if len(recent) > MaxJobEvaluations {
+		recent = recent[:MaxJobEvaluations]
+	}
+	raw, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode evaluations: %w", err)
+	}
+	jd.EvaluationsRaw = raw
+	for _, e := range recent {
+		eval := Evaluation{
+			ID:                e.ID,
+			TriggeredBy:       e.TriggeredBy,
+			Status:            e.Status,
+			StatusDescription: e.StatusDescription,
+			CreateTime:        time.Unix(0, e.CreateTime),
+		}
+		for group, metric := range e.FailedTGAllocs {
+			if eval.FailedGroups == nil {
+				eval.FailedGroups = make(map[string][]string)
+			}
+			eval.FailedGroups[group] = placementFailures(metric)
+		}
+		jd.Evaluations = append(jd.Evaluations, eval)
+	}
+	return jd, nil
+}
+
+// placementFailures summarizes why the scheduler could not place a task
+// group, the way nomad job status does
+func placementFailures(m *nomadapi.AllocationMetric) []string {
+	if m == nil {
+		return nil
+	}
+	var reasons []string
+	if m.NodesEvaluated == 0 {
+		reasons = append(reasons, "no nodes were eligible for evaluation")
+	}
+	for _, pair := range sortedCounts(m.ClassFiltered) {
+		reasons = append(reasons, fmt.Sprintf("class %q filtered %d nodes", pair.key, pair.n))
+	}
+	for _, pair := range sortedCounts(m.ConstraintFiltered) {
+		reasons = append(reasons, fmt.Sprintf("constraint %q filtered %d nodes", pair.key, pair.n))
+	}
+	for _, pair := range sortedCounts(m.DimensionExhausted) {
+		reasons = append(reasons, fmt.Sprintf("%s exhausted on %d nodes", pair.key, pair.n))
+	}
+	for _, quota := range m.QuotaExhausted {
+		reasons = append(reasons, fmt.Sprintf("quota limit hit %q", quota))
+	}
+	return reasons
+}
+
+type keyCount struct {
+	key string
+	n   int
+}
+
+func sortedCounts(m map[string]int) []keyCount {
+	pairs := make([]keyCount, 0, len(m))
+	for k, n := range m {
+		pairs = append(pairs, keyCount{k, n})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].key < pairs[j].key })
+	return pairs
+}
@@ -0,0 +1,70 @@
+package nomad
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+func TestNewJobDeployment(t *testing.T) {
+	deployment := &nomadapi.Deployment{
+		ID:                "d1",
+		JobVersion:        7,
+		Status:            "failed",
+		StatusDescription: "Failed due to unhealthy allocations",
+		TaskGroups: map[string]*nomadapi.DeploymentState{
+			"web": {DesiredTotal: 3, DesiredCanaries: 1, PlacedCanaries: []string{"a1"}, PlacedAllocs: 1, UnhealthyAllocs: 1},
+			"old": nil,
+		},
+	}
+	var evals []*nomadapi.Evaluation
+	for i := 0; i < MaxJobEvaluations+2; i++ {
+		evals = append(evals, &nomadapi.Evaluation{ID: string(rune('a' + i)), Status: "complete", CreateIndex: uint64(i)})
+	}
+	evals = append(evals, nil, &nomadapi.Evaluation{
+		ID: "blocked", TriggeredBy: "job-register", Status: "blocked", CreateIndex: 100, CreateTime: 1700000000000000000,
+		FailedTGAllocs: map[string]*nomadapi.AllocationMetric{"web": {
+			NodesEvaluated:     4,
+			ConstraintFiltered: map[string]int{"${attr.kernel.name} = linux": 1},
+			DimensionExhausted: map[string]int{"memory": 3},
+		}},
+	})
+
+	jd, err := newJobDeployment("default", "web", deployment, evals)
+	if err != nil {
+		t.Fatalf("newJobDeployment() error: %v", err)
+	}
+	wantGroups := map[string]DeploymentGroup{"web": {DesiredTotal: 3, DesiredCanaries: 1, PlacedCanaries: 1, PlacedAllocs: 1, UnhealthyAllocs: 1}}
+	if jd.Deployment == nil || jd.Deployment.Status != "failed" || jd.Deployment.JobVersion != 7 || !reflect.DeepEqual(jd.Deployment.TaskGroups, wantGroups) {
+		t.Errorf("deployment = %+v", jd.Deployment)
+	}
+	if len(jd.Evaluations) != MaxJobEvaluations || jd.Evaluations[0].ID != "blocked" || jd.Evaluations[1].ID != "l" {
+		t.Fatalf("got %d evaluations starting %+v, want the %d newest", len(jd.Evaluations), jd.Evaluations[0], MaxJobEvaluations)
+	}
+	wantFailed := map[string][]string{"web": {`constraint "${attr.kernel.name} = linux" filtered 1 nodes`, "memory exhausted on 3 nodes"}}
+	if !reflect.DeepEqual(jd.Evaluations[0].FailedGroups, wantFailed) {
+		t.Errorf("failed groups = %q, want %q", jd.Evaluations[0].FailedGroups, wantFailed)
+	}
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(jd.EvaluationsRaw, &raw); err != nil || len(raw) != MaxJobEvaluations {
+		t.Errorf("EvaluationsRaw has %d evaluations (%v), want %d", len(raw), err, MaxJobEvaluations)
+	}
+
+	none, err := newJobDeployment("default", "batch", nil, nil)
+	if err != nil || none.Deployment != nil || none.DeploymentRaw != nil || len(none.Evaluations) != 0 {
+		t.Errorf("newJobDeployment() without a deployment = %+v, %v", none, err)
+	}
+}
+
+func TestPlacementFailures(t *testing.T) {
+	got := placementFailures(&nomadapi.AllocationMetric{QuotaExhausted: []string{"cpu"}})
+	want := []string{"no nodes were eligible for evaluation", `quota limit hit "cpu"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("placementFailures() = %q, want %q", got, want)
+	}
+	if placementFailures(nil) != nil {
+		t.Error("placementFailures(nil) should be empty")
+	}
+}
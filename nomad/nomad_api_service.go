@@ -3,10 +3,15 @@ package nomad
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -14,20 +19,106 @@ import (
 
 	consulapi "github.com/hashicorp/consul/api"
 	nomadapi "github.com/hashicorp/nomad/api"
+	"github.com/markcampv/xDSnap/consul"
 )
 
 const EnvoyAdminPort = 19001
 
+// EnvoyAdminAddr is the address Consul Connect binds Envoy admin to inside
+// the allocation (not 127.0.0.1)
+const EnvoyAdminAddr = "127.0.0.2"
+
+// consul-dataplane starts Envoy with its admin API on its own defaults
+// (-envoy-admin-bind-address and -envoy-admin-bind-port)
+const (
+	DataplaneAdminAddr = "127.0.0.1"
+	DataplaneAdminPort = 19000
+)
+
+// AllNamespaces is the Nomad namespace wildcard
+const AllNamespaces = "*"
+
+// Where FindConnectAllocationsByService looks for Connect allocations.
+const (
+	DiscoveryAuto   = "auto"   // Consul first, scanning Nomad when Consul finds nothing
+	DiscoveryConsul = "consul" // Consul only
+	DiscoveryNomad  = "nomad"  // Nomad allocation scan only, never querying Consul
+)
+
+var DiscoverySources = []string{DiscoveryAuto, DiscoveryConsul, DiscoveryNomad}
+
+// NamespaceMatches reports whether an allocation in namespace ns is selected
+// by a namespace filter. An empty filter and the wildcard select every
+// namespace; otherwise ns must exactly match one of the comma-separated
+// namespaces in the filter.
+func NamespaceMatches(filter, ns string) bool {
+	for _, f := range SplitNamespaces(filter) {
+		if f == "" || f == AllNamespaces || f == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitNamespaces splits a comma-separated namespace filter into its
+// distinct namespaces. A wildcard anywhere in the list selects every
+// namespace and is returned on its own; an empty filter yields [""].
+func SplitNamespaces(filter string) []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(filter, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == AllNamespaces {
+			return []string{AllNamespaces}
+		}
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	if len(namespaces) == 0 {
+		return []string{""}
+	}
+	return namespaces
+}
+
 // AllocationInfo contains information about a Nomad allocation running Consul Connect
 type AllocationInfo struct {
-	ID          string
-	Name        string
-	JobID       string
-	TaskGroup   string
-	Namespace   string
-	NodeID      string
-	Tasks       []string
-	SidecarTask string // detected envoy/connect-proxy task
+	ID           string
+	Name         string
+	JobID        string
+	TaskGroup    string
+	Namespace    string
+	NodeID       string
+	Tasks        []string
+	SidecarTask  string // detected envoy/connect-proxy task
+	Connect      bool   // task group has Consul Connect configured
+	ClientStatus string
+	Ports        map[string]string // port label -> host address:port Nomad mapped it to
+	JobMeta      map[string]string // meta of the job version the allocation runs
+}
+
+// NodeInfo contains the Nomad client node attributes used to select allocations
+type NodeInfo struct {
+	ID         string
+	Name       string
+	Datacenter string
+	NodeClass  string
+	NodePool   string
+	Meta       map[string]string
+}
+
+// NodeStatus is the client state of a Nomad node, with the full node as
+// returned by the API in Raw
+type NodeStatus struct {
+	ID                    string
+	Name                  string
+	Status                string
+	SchedulingEligibility string
+	Drain                 bool
+	Version               string // Nomad client version, from the nomad.version attribute
+	Raw                   []byte
 }
 
 // NomadApiService defines the interface for interacting with Nomad and Consul
@@ -42,10 +133,17 @@ type NomadApiService interface {
 	// Discovery
 	ListTasks(allocID string) ([]string, error)
 	GetAllocation(allocID string) (*AllocationInfo, error)
+	GetNode(nodeID string) (*NodeInfo, error)
+	GetNodeStatus(nodeID string) (*NodeStatus, error)
+	GetAllocationStats(allocID string) (*AllocResourceStats, error)
+	GetJobDeployment(namespace, jobID string) (*JobDeployment, error)
 
 	// Consul Integration
 	FindConnectAllocations(namespace string) ([]AllocationInfo, error)
 	FindConnectAllocationsByService(namespace, serviceName string) ([]AllocationInfo, error)
+	FindUpstreamAllocations(namespace, serviceName string) ([]AllocationInfo, error)
+	GetServiceIntentions(serviceName string) (*consul.ServiceIntentions, error)
+	GetServiceChecks(serviceName string) ([]consul.ServiceCheck, error)
 
 	// Exec-based Envoy admin access (via nomad alloc exec)
 	EnvoyAdminGETViaExec(allocID, task string, port int, path string) ([]byte, error)
@@ -58,24 +156,38 @@ type NomadApiService interface {
 
 // NomadApiServiceImpl implements NomadApiService
 type NomadApiServiceImpl struct {
-	nomadClient  *nomadapi.Client
-	consulClient *consulapi.Client
-	namespace    string
+	nomadClient *nomadapi.Client
+	discovery   consul.ConsulDiscovery
+	namespace   string
+	region      string // Nomad region queried; the agent's own region when empty
+	// filtered disables the Nomad scan fallback, which can't honor a Consul
+	// filter expression
+	filtered bool
+	source   string // one of DiscoverySources; DiscoveryAuto when empty
 }
 
 var _ NomadApiService = &NomadApiServiceImpl{}
 
 // NewNomadApiService creates a new NomadApiService
 func NewNomadApiService(nomadClient *nomadapi.Client, consulClient *consulapi.Client, namespace string) NomadApiService {
+	return NewNomadApiServiceWithDiscovery(nomadClient, consul.NewDiscovery(consulClient), namespace)
+}
+
+// NewNomadApiServiceWithDiscovery creates a NomadApiService that uses the given
+// ConsulDiscovery, allowing callers to substitute their own implementation
+func NewNomadApiServiceWithDiscovery(nomadClient *nomadapi.Client, discovery consul.ConsulDiscovery, namespace string) NomadApiService {
 	return &NomadApiServiceImpl{
-		nomadClient:  nomadClient,
-		consulClient: consulClient,
-		namespace:    namespace,
+		nomadClient: nomadClient,
+		discovery:   discovery,
+		namespace:   namespace,
 	}
 }
 
-// NewNomadApiServiceFromEnv creates a NomadApiService using environment variables
-func NewNomadApiServiceFromEnv(namespace string) (NomadApiService, error) {
+// NewNomadApiServiceFromEnv creates a NomadApiService using environment variables.
+// A non-empty region overrides NOMAD_REGION. source is one of DiscoverySources.
+// apiTimeout bounds dialing and TLS handshakes with Nomad and Consul; zero
+// uses DefaultAPITimeout. discoveryOpts configure the Consul discovery queries.
+func NewNomadApiServiceFromEnv(namespace, region, source string, apiTimeout time.Duration, discoveryOpts consul.DiscoveryOptions) (NomadApiService, error) {
 	// Create Nomad client
 	nomadConfig := nomadapi.DefaultConfig()
 	if addr := os.Getenv("NOMAD_ADDR"); addr != "" {
@@ -84,8 +196,17 @@ func NewNomadApiServiceFromEnv(namespace string) (NomadApiService, error) {
 	if token := os.Getenv("NOMAD_TOKEN"); token != "" {
 		nomadConfig.SecretID = token
 	}
-	if namespace != "" {
-		nomadConfig.Namespace = namespace
+	if region != "" {
+		nomadConfig.Region = region
+	}
+	// A list of namespaces is applied per query, not as the client default
+	if namespaces := SplitNamespaces(namespace); len(namespaces) == 1 && namespaces[0] != "" {
+		nomadConfig.Namespace = namespaces[0]
+	}
+	// A caller-supplied client skips the SDK's TLS setup, so apply it here
+	nomadConfig.HttpClient = newNomadHTTPClient(apiTimeout)
+	if err := nomadapi.ConfigureTLS(nomadConfig.HttpClient, nomadConfig.TLSConfig); err != nil {
+		return nil, fmt.Errorf("failed to configure Nomad TLS: %w", err)
 	}
 
 	nomadClient, err := nomadapi.NewClient(nomadConfig)
@@ -101,6 +222,7 @@ func NewNomadApiServiceFromEnv(namespace string) (NomadApiService, error) {
 	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
 		consulConfig.Token = token
 	}
+	consulConfig.Transport = newTransport(apiTimeout)
 
 	consulClient, err := consulapi.NewClient(consulConfig)
 	if err != nil {
@@ -108,26 +230,44 @@ func NewNomadApiServiceFromEnv(namespace string) (NomadApiService, error) {
 	}
 
 	return &NomadApiServiceImpl{
-		nomadClient:  nomadClient,
-		consulClient: consulClient,
-		namespace:    namespace,
+		nomadClient: nomadClient,
+		discovery:   consul.NewDiscoveryWithOptions(consulClient, discoveryOpts),
+		namespace:   namespace,
+		region:      nomadConfig.Region,
+		filtered:    discoveryOpts.Filter != "",
+		source:      source,
 	}, nil
 }
 
+// queryOptions returns the options of single-object lookups, scoped to the
+// configured region
+func (n *NomadApiServiceImpl) queryOptions() *nomadapi.QueryOptions {
+	return &nomadapi.QueryOptions{Region: n.region}
+}
+
 // ExecuteCommand executes a command in a task and returns the exit code
 func (n *NomadApiServiceImpl) ExecuteCommand(allocID, task string, command []string, stdout io.Writer) (int, error) {
 	return n.ExecuteCommandWithStderr(allocID, task, command, stdout, io.Discard)
 }
 
+// DefaultExecTimeout bounds each command run with nomad alloc exec
+const DefaultExecTimeout = 60 * time.Second
+
 // ExecuteCommandWithStderr executes a command in a task with separate stdout/stderr
 func (n *NomadApiServiceImpl) ExecuteCommandWithStderr(allocID, task string, command []string, stdout, stderr io.Writer) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	return n.executeWithTimeout(DefaultExecTimeout, allocID, task, command, stdout, stderr)
+}
+
+// executeWithTimeout runs a command like ExecuteCommandWithStderr, giving up
+// after timeout.
+func (n *NomadApiServiceImpl) executeWithTimeout(timeout time.Duration, allocID, task string, command []string, stdout, stderr io.Writer) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// Set up signal handling for resize (not used but required by API)
 	sizeCh := make(chan nomadapi.TerminalSize)
 
-	alloc, _, err := n.nomadClient.Allocations().Info(allocID, nil)
+	alloc, _, err := n.nomadClient.Allocations().Info(allocID, n.queryOptions())
 	if err != nil {
 		return -1, fmt.Errorf("failed to get allocation info: %w", err)
 	}
@@ -156,36 +296,14 @@ func (n *NomadApiServiceImpl) ExecuteCommandWithStderr(allocID, task string, com
 
 // FetchTaskLogs fetches logs from a task
 func (n *NomadApiServiceImpl) FetchTaskLogs(ctx context.Context, allocID, task string, logType string, follow bool, out io.Writer) error {
-	alloc, _, err := n.nomadClient.Allocations().Info(allocID, nil)
+	alloc, _, err := n.nomadClient.Allocations().Info(allocID, n.queryOptions())
 	if err != nil {
 		return fmt.Errorf("failed to get allocation info: %w", err)
 	}
 
-	// Create a cancel channel from context
-	cancel := make(chan struct{})
-	var closeOnce sync.Once
-	safeClose := func() {
-		closeOnce.Do(func() {
-			close(cancel)
-		})
-	}
-
-	go func() {
-		<-ctx.Done()
-		safeClose()
-	}()
-
-	// Also handle OS signals
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sigCh)
-	go func() {
-		select {
-		case <-sigCh:
-			safeClose()
-		case <-ctx.Done():
-		}
-	}()
+	// Close the cancel channel when the context ends or the process is interrupted
+	cancel, stop := watchCancellation(ctx)
+	defer stop()
 
 	frames, errCh := n.nomadClient.AllocFS().Logs(
 		alloc,
@@ -218,127 +336,375 @@ func (n *NomadApiServiceImpl) FetchTaskLogs(ctx context.Context, allocID, task s
 	}
 }
 
+// watchCancellation returns a channel that is closed once ctx is done or the
+// process receives SIGINT/SIGTERM. The returned stop func must be called to
+// release the signal handler and the watcher goroutine; it is safe to call
+// more than once.
+func watchCancellation(ctx context.Context) (<-chan struct{}, func()) {
+	cancel := make(chan struct{})
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		defer close(exited)
+		defer signal.Stop(sigCh)
+		select {
+		case <-ctx.Done():
+			close(cancel)
+		case <-sigCh:
+			close(cancel)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-exited
+	}
+	return cancel, stop
+}
+
 // ListTasks returns the list of tasks in an allocation
 func (n *NomadApiServiceImpl) ListTasks(allocID string) ([]string, error) {
-	alloc, _, err := n.nomadClient.Allocations().Info(allocID, nil)
+	alloc, _, err := n.nomadClient.Allocations().Info(allocID, n.queryOptions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get allocation info: %w", err)
 	}
 
-	var tasks []string
-	for taskName := range alloc.TaskStates {
-		tasks = append(tasks, taskName)
-	}
-	return tasks, nil
+	return allocationTasks(alloc), nil
 }
 
 // GetAllocation returns detailed information about an allocation
 func (n *NomadApiServiceImpl) GetAllocation(allocID string) (*AllocationInfo, error) {
-	alloc, _, err := n.nomadClient.Allocations().Info(allocID, nil)
+	alloc, _, err := n.nomadClient.Allocations().Info(allocID, n.queryOptions())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get allocation info: %w", err)
 	}
 
+	return newAllocationInfo(alloc), nil
+}
+
+// GetNode returns the attributes of a Nomad client node
+func (n *NomadApiServiceImpl) GetNode(nodeID string) (*NodeInfo, error) {
+	node, _, err := n.nomadClient.Nodes().Info(nodeID, n.queryOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node info: %w", err)
+	}
+
+	return &NodeInfo{
+		ID:         node.ID,
+		Name:       node.Name,
+		Datacenter: node.Datacenter,
+		NodeClass:  node.NodeClass,
+		NodePool:   node.NodePool,
+		Meta:       node.Meta,
+	}, nil
+}
+
+// GetNodeStatus returns the client status of a node along with the full node
+// info as indented JSON
+func (n *NomadApiServiceImpl) GetNodeStatus(nodeID string) (*NodeStatus, error) {
+	node, _, err := n.nomadClient.Nodes().Info(nodeID, n.queryOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node info: %w", err)
+	}
+	raw, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node info: %w", err)
+	}
+
+	return &NodeStatus{
+		ID:                    node.ID,
+		Name:                  node.Name,
+		Status:                node.Status,
+		SchedulingEligibility: node.SchedulingEligibility,
+		Drain:                 node.Drain || node.DrainStrategy != nil,
+		Version:               node.Attributes["nomad.version"],
+		Raw:                   raw,
+	}, nil
+}
+
+// newAllocationInfo builds an AllocationInfo from a Nomad allocation
+func newAllocationInfo(alloc *nomadapi.Allocation) *AllocationInfo {
 	info := &AllocationInfo{
-		ID:        alloc.ID,
-		Name:      alloc.Name,
-		JobID:     alloc.JobID,
-		TaskGroup: alloc.TaskGroup,
-		Namespace: alloc.Namespace,
-		NodeID:    alloc.NodeID,
+		ID:           alloc.ID,
+		Name:         alloc.Name,
+		JobID:        alloc.JobID,
+		TaskGroup:    alloc.TaskGroup,
+		Namespace:    alloc.Namespace,
+		NodeID:       alloc.NodeID,
+		Tasks:        allocationTasks(alloc),
+		ClientStatus: alloc.ClientStatus,
+	}
+
+	// Take the sidecar task from the job, guessing from task names only when
+	// the job doesn't say. Connect may still be enabled without a distinctly
+	// named proxy task (e.g. transparent proxy setups), in which case Envoy is
+	// reached through the application task's shared network namespace.
+	info.SidecarTask = jobSidecarTask(alloc, info.Tasks)
+	if info.SidecarTask == "" {
+		info.SidecarTask = detectSidecarTask(info.Tasks)
+	}
+	info.Connect = hasConnectSidecar(alloc)
+	info.Ports = allocationPorts(alloc)
+	if alloc.Job != nil {
+		info.JobMeta = alloc.Job.Meta
 	}
 
-	// Get tasks
+	return info
+}
+
+// allocationPorts returns the host address and port of every labelled port
+// of an allocation, from its group network port mappings or, for older
+// allocations, its group and task network resources.
+func allocationPorts(alloc *nomadapi.Allocation) map[string]string {
+	ports := make(map[string]string)
+	add := func(label, ip string, port int) {
+		if label == "" || ip == "" || port == 0 {
+			return
+		}
+		if _, ok := ports[label]; !ok {
+			ports[label] = net.JoinHostPort(ip, strconv.Itoa(port))
+		}
+	}
+	addNetworks := func(networks []*nomadapi.NetworkResource) {
+		for _, nw := range networks {
+			if nw == nil {
+				continue
+			}
+			for _, p := range append(append([]nomadapi.Port{}, nw.ReservedPorts...), nw.DynamicPorts...) {
+				add(p.Label, nw.IP, p.Value)
+			}
+		}
+	}
+
+	res := alloc.AllocatedResources
+	if res == nil {
+		return ports
+	}
+	for _, p := range res.Shared.Ports {
+		add(p.Label, p.HostIP, p.Value)
+	}
+	addNetworks(res.Shared.Networks)
+	tasks := make([]string, 0, len(res.Tasks))
+	for name := range res.Tasks {
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+	for _, name := range tasks {
+		if task := res.Tasks[name]; task != nil {
+			addNetworks(task.Networks)
+		}
+	}
+	return ports
+}
+
+// allocationTasks returns the sorted task names of an allocation. Allocations
+// that never started (e.g. failed placement) have no task states, in which
+// case the tasks are taken from the job's task group definition. The result
+// may still be empty.
+func allocationTasks(alloc *nomadapi.Allocation) []string {
+	var tasks []string
 	for taskName := range alloc.TaskStates {
-		info.Tasks = append(info.Tasks, taskName)
+		tasks = append(tasks, taskName)
 	}
 
-	// Detect sidecar task
-	info.SidecarTask = detectSidecarTask(info.Tasks)
+	if len(tasks) == 0 && alloc.Job != nil {
+		for _, tg := range alloc.Job.TaskGroups {
+			if tg.Name == nil || *tg.Name != alloc.TaskGroup {
+				continue
+			}
+			for _, task := range tg.Tasks {
+				tasks = append(tasks, task.Name)
+			}
+		}
+	}
 
-	return info, nil
+	sort.Strings(tasks)
+	return tasks
 }
 
-// FindConnectAllocations finds all allocations running Consul Connect sidecars
+// FindConnectAllocations finds all allocations running Consul Connect sidecars.
+// See FindConnectAllocationsByService for how namespace is applied.
 func (n *NomadApiServiceImpl) FindConnectAllocations(namespace string) ([]AllocationInfo, error) {
 	return n.FindConnectAllocationsByService(namespace, "")
 }
 
-// FindConnectAllocationsByService finds allocations for a specific Consul Connect service
+// FindConnectAllocationsByService finds allocations for a specific Consul Connect service.
+//
+// The Consul catalog is not partitioned by Nomad namespace (and not at all on
+// Consul OSS), so allocations found through Consul are filtered by their Nomad
+// namespace afterwards using NamespaceMatches: an empty namespace or "*"
+// keeps all of them, any other value keeps only that namespace. When nothing
+// is left, Nomad is scanned directly in the same namespace (every namespace
+// for "" or "*"), unless a Consul filter expression is in effect.
+//
+// With the DiscoveryConsul source there is no Nomad fallback; with
+// DiscoveryNomad, Consul is skipped and Nomad is scanned for allocations
+// whose task group has a Connect service named serviceName.
+//
+// A comma-separated list of namespaces is discovered one namespace at a
+// time, each with its own fallback, and the results are merged.
 func (n *NomadApiServiceImpl) FindConnectAllocationsByService(namespace, serviceName string) ([]AllocationInfo, error) {
+	namespaces := SplitNamespaces(namespace)
+	if len(namespaces) == 1 {
+		return n.findConnectAllocationsInNamespace(namespaces[0], serviceName)
+	}
+
+	var merged []AllocationInfo
+	seen := make(map[string]bool)
+	for _, ns := range namespaces {
+		allocs, err := n.findConnectAllocationsInNamespace(ns, serviceName)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		for _, alloc := range allocs {
+			if !seen[alloc.ID] {
+				seen[alloc.ID] = true
+				merged = append(merged, alloc)
+			}
+		}
+	}
+	return merged, nil
+}
+
+func (n *NomadApiServiceImpl) findConnectAllocationsInNamespace(namespace, serviceName string) ([]AllocationInfo, error) {
+	if n.source == DiscoveryNomad {
+		return n.scanNomadForConnectAllocations(namespace, serviceName)
+	}
+
 	var results []AllocationInfo
 
-	// Query Consul for services with sidecar proxies
-	services, _, err := n.consulClient.Catalog().Services(nil)
+	allocIDs, err := connectAllocIDs(n.discovery, serviceName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Consul services: %w", err)
+		return nil, err
 	}
 
-	// Find sidecar proxy services
-	var proxyServices []string
-	for svc := range services {
-		if strings.HasSuffix(svc, "-sidecar-proxy") {
-			// If filtering by service name, check if this matches
-			if serviceName != "" {
-				baseName := strings.TrimSuffix(svc, "-sidecar-proxy")
-				if baseName != serviceName {
-					continue
-				}
-			}
-			proxyServices = append(proxyServices, svc)
+	for _, allocID := range allocIDs {
+		// Get full allocation info from Nomad
+		allocInfo, err := n.GetAllocation(allocID)
+		if err != nil {
+			continue
+		}
+
+		if !NamespaceMatches(namespace, allocInfo.Namespace) {
+			continue
 		}
+
+		results = append(results, *allocInfo)
 	}
 
-	// For each proxy service, get the instances and map to Nomad allocations
-	for _, proxySvc := range proxyServices {
-		instances, _, err := n.consulClient.Health().Service(proxySvc, "", true, nil)
+	// Fallback: If no results from Consul, scan Nomad allocations directly.
+	// It has always kept every Connect allocation, whatever the service.
+	if len(results) == 0 && !n.filtered && n.source != DiscoveryConsul {
+		results, err = n.scanNomadForConnectAllocations(namespace, "")
 		if err != nil {
-			continue
+			return nil, err
 		}
+	}
 
-		for _, instance := range instances {
-			// Extract Nomad allocation ID from service metadata or ID
-			// Consul Connect services registered by Nomad have allocation info in metadata
-			allocID := extractAllocIDFromService(instance.Service)
-			if allocID == "" {
-				continue
-			}
+	return results, nil
+}
 
-			// Get full allocation info from Nomad
-			allocInfo, err := n.GetAllocation(allocID)
-			if err != nil {
+// FindUpstreamAllocations finds the allocations of the services that
+// serviceName's sidecars list as upstreams, one hop only. Unlike
+// FindConnectAllocationsByService there is no Nomad scan fallback, so an
+// upstream unknown to Consul can't expand the capture to the whole mesh.
+func (n *NomadApiServiceImpl) FindUpstreamAllocations(namespace, serviceName string) ([]AllocationInfo, error) {
+	upstreams, err := n.discovery.GetUpstreamServices(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query upstreams of %s: %w", serviceName, err)
+	}
+
+	var results []AllocationInfo
+	seen := make(map[string]bool)
+	for _, upstream := range upstreams {
+		if upstream == serviceName {
+			continue
+		}
+		allocIDs, err := connectAllocIDs(n.discovery, upstream)
+		if err != nil {
+			return nil, err
+		}
+		for _, allocID := range allocIDs {
+			if seen[allocID] {
 				continue
 			}
-
-			// Filter by namespace if specified
-			if namespace != "" && allocInfo.Namespace != namespace {
+			seen[allocID] = true
+			allocInfo, err := n.GetAllocation(allocID)
+			if err != nil || !NamespaceMatches(namespace, allocInfo.Namespace) {
 				continue
 			}
-
 			results = append(results, *allocInfo)
 		}
 	}
 
-	// Fallback: If no results from Consul, scan Nomad allocations directly
-	if len(results) == 0 {
-		results, err = n.scanNomadForConnectAllocations(namespace)
+	return results, nil
+}
+
+// GetServiceIntentions returns the Consul intentions matching traffic to and
+// from serviceName
+func (n *NomadApiServiceImpl) GetServiceIntentions(serviceName string) (*consul.ServiceIntentions, error) {
+	return n.discovery.GetServiceIntentions(serviceName)
+}
+
+// GetServiceChecks returns the Consul health checks, with their output, of
+// serviceName's instances and sidecar proxies
+func (n *NomadApiServiceImpl) GetServiceChecks(serviceName string) ([]consul.ServiceCheck, error) {
+	return n.discovery.GetServiceChecks(serviceName)
+}
+
+// connectAllocIDs returns the deduplicated Nomad allocation IDs backing the
+// healthy sidecar proxies of a Consul Connect service (or of every Connect
+// service when serviceName is empty)
+func connectAllocIDs(discovery consul.ConsulDiscovery, serviceName string) ([]string, error) {
+	// Query Consul for services with sidecar proxies
+	services, err := discovery.ListConnectServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Consul services: %w", err)
+	}
+
+	var allocIDs []string
+	seen := make(map[string]bool)
+	for _, svc := range services {
+		// If filtering by service name, check if this matches
+		if serviceName != "" && svc != serviceName {
+			continue
+		}
+
+		instances, err := discovery.GetConnectProxyInstances(svc, true)
 		if err != nil {
-			return nil, err
+			continue
+		}
+
+		for _, instance := range instances {
+			// Consul Connect services registered by Nomad carry the allocation
+			// ID in their metadata or service ID
+			if instance.AllocID == "" || seen[instance.AllocID] {
+				continue
+			}
+			seen[instance.AllocID] = true
+			allocIDs = append(allocIDs, instance.AllocID)
 		}
 	}
 
-	return results, nil
+	return allocIDs, nil
 }
 
-// scanNomadForConnectAllocations scans Nomad directly for Connect allocations
-func (n *NomadApiServiceImpl) scanNomadForConnectAllocations(namespace string) ([]AllocationInfo, error) {
+// scanNomadForConnectAllocations scans Nomad directly for Connect allocations,
+// of the Connect service serviceName when it is set
+func (n *NomadApiServiceImpl) scanNomadForConnectAllocations(namespace, serviceName string) ([]AllocationInfo, error) {
 	var results []AllocationInfo
 
-	queryOpts := &nomadapi.QueryOptions{}
-	if namespace != "" {
-		queryOpts.Namespace = namespace
-	} else {
-		queryOpts.Namespace = "*" // All namespaces
+	queryOpts := &nomadapi.QueryOptions{Namespace: namespace, Region: n.region}
+	if namespace == "" {
+		queryOpts.Namespace = AllNamespaces
 	}
 
 	allocs, _, err := n.nomadClient.Allocations().List(queryOpts)
@@ -353,7 +719,7 @@ func (n *NomadApiServiceImpl) scanNomadForConnectAllocations(namespace string) (
 		}
 
 		// Get full allocation info
-		alloc, _, err := n.nomadClient.Allocations().Info(allocStub.ID, nil)
+		alloc, _, err := n.nomadClient.Allocations().Info(allocStub.ID, n.queryOptions())
 		if err != nil {
 			continue
 		}
@@ -362,6 +728,9 @@ func (n *NomadApiServiceImpl) scanNomadForConnectAllocations(namespace string) (
 		if !hasConnectSidecar(alloc) {
 			continue
 		}
+		if serviceName != "" && !hasConnectService(alloc, serviceName) {
+			continue
+		}
 
 		allocInfo, err := n.GetAllocation(allocStub.ID)
 		if err != nil {
@@ -476,48 +845,118 @@ func (n *NomadApiServiceImpl) EnvoyAdminPOSTViaExec(allocID, task string, port i
 // For curl/wget the response is the body directly; for bash /dev/tcp we strip
 // HTTP headers and decode chunked transfer encoding.
 func (n *NomadApiServiceImpl) EnvoyAdminGET(allocID string, strategy *ExecStrategy, port int, path string) ([]byte, error) {
-	cmd := BuildGETCommand(strategy.Method, port, path)
+	if strategy.Method == MethodDirect {
+		return directAdminRequest(http.MethodGet, strategy, path)
+	}
+	cmd := BuildGETCommand(strategy.Method, strategy.Address, port, adminPath(strategy.PathPrefix, path), strategy.Headers...)
 	if cmd == nil {
 		return nil, fmt.Errorf("unsupported HTTP method: %v", strategy.Method)
 	}
 
 	var stdout, stderr bytes.Buffer
-	_, err := n.ExecuteCommandWithStderr(allocID, strategy.Task, cmd, &stdout, &stderr)
+	code, err := n.executeWithTimeout(strategy.timeout(), allocID, strategy.Task, cmd, &stdout, &stderr)
+	return adminResponse(strategy.Method, path, code, stdout.Bytes(), stderr.String(), err)
+}
+
+// adminResponse turns the result of an exec'd admin request into the
+// response body, or an *AdminError when the request failed.
+func adminResponse(method HTTPMethod, path string, code int, stdout []byte, stderr string, err error) ([]byte, error) {
 	if err != nil {
-		return nil, fmt.Errorf("exec failed: %w (stderr: %s)", err, stderr.String())
+		return nil, &AdminError{Method: method, Path: path, ExitCode: code, Stderr: stderr, Err: err}
 	}
 
-	body := stdout.Bytes()
+	body := stdout
 
 	// Only bash /dev/tcp returns raw HTTP with headers
-	if strategy.Method == MethodBashTCP {
+	if method == MethodBashTCP {
+		status := httpStatus(body)
 		if idx := bytes.Index(body, []byte("\r\n\r\n")); idx != -1 {
 			body = body[idx+4:]
 		}
 		body = decodeChunked(body)
+		if status >= 400 {
+			return nil, &AdminError{Method: method, Path: path, ExitCode: code, Status: status, Stderr: stderr}
+		}
 	}
 
+	if code != 0 {
+		return nil, &AdminError{Method: method, Path: path, ExitCode: code, Stderr: stderr}
+	}
 	return body, nil
 }
 
 // EnvoyAdminPOST makes a POST request to Envoy admin using the resolved strategy.
 func (n *NomadApiServiceImpl) EnvoyAdminPOST(allocID string, strategy *ExecStrategy, port int, path string) error {
-	cmd := BuildPOSTCommand(strategy.Method, port, path)
+	if strategy.Method == MethodDirect {
+		_, err := directAdminRequest(http.MethodPost, strategy, path)
+		return err
+	}
+	cmd := BuildPOSTCommand(strategy.Method, strategy.Address, port, adminPath(strategy.PathPrefix, path), strategy.Headers...)
 	if cmd == nil {
 		return fmt.Errorf("unsupported HTTP method: %v", strategy.Method)
 	}
 
 	var stdout, stderr bytes.Buffer
-	_, err := n.ExecuteCommandWithStderr(allocID, strategy.Task, cmd, &stdout, &stderr)
-	if err != nil {
-		return fmt.Errorf("exec failed: %w (stderr: %s)", err, stderr.String())
-	}
-
-	return nil
+	code, err := n.executeWithTimeout(strategy.timeout(), allocID, strategy.Task, cmd, &stdout, &stderr)
+	_, err = adminResponse(strategy.Method, path, code, stdout.Bytes(), stderr.String(), err)
+	return err
 }
 
 // Helper functions
 
+// connectProxyKinds are the kind prefixes Nomad gives the Envoy tasks it
+// injects for Connect sidecars and gateways, e.g. connect-proxy:web.
+var connectProxyKinds = []string{"connect-proxy:", "connect-ingress:", "connect-terminating:", "connect-mesh:"}
+
+// isConnectProxyKind reports whether a task kind marks a Nomad-injected
+// Envoy task.
+func isConnectProxyKind(kind string) bool {
+	for _, prefix := range connectProxyKinds {
+		if strings.HasPrefix(kind, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobSidecarTask returns the Envoy task the allocation's job defines for its
+// task group: the first task, by name, whose kind marks it as a Connect proxy
+// or gateway, or else the name set by a Connect service's sidecar_task
+// block. It returns "" when the job doesn't say or names a task the
+// allocation doesn't run.
+func jobSidecarTask(alloc *nomadapi.Allocation, tasks []string) string {
+	if alloc.Job == nil {
+		return ""
+	}
+	var named []string
+	for _, tg := range alloc.Job.TaskGroups {
+		if tg.Name == nil || *tg.Name != alloc.TaskGroup {
+			continue
+		}
+		for _, task := range tg.Tasks {
+			if isConnectProxyKind(task.Kind) {
+				named = append(named, task.Name)
+			}
+		}
+		if len(named) == 0 {
+			for _, svc := range tg.Services {
+				if svc.Connect != nil && svc.Connect.SidecarTask != nil && svc.Connect.SidecarTask.Name != "" {
+					named = append(named, svc.Connect.SidecarTask.Name)
+				}
+			}
+		}
+	}
+	sort.Strings(named)
+	for _, name := range named {
+		for _, task := range tasks {
+			if task == name {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
 // detectSidecarTask identifies the Envoy/Connect sidecar task from a list of tasks
 func detectSidecarTask(tasks []string) string {
 	// Common sidecar task name patterns
@@ -550,34 +989,29 @@ func detectSidecarTask(tasks []string) string {
 	return ""
 }
 
-// extractAllocIDFromService extracts the Nomad allocation ID from a Consul service
-func extractAllocIDFromService(svc *consulapi.AgentService) string {
-	// Check service metadata for allocation ID
-	if svc.Meta != nil {
-		if allocID, ok := svc.Meta["alloc_id"]; ok {
-			return allocID
-		}
-	}
-
-	// Try to extract from service ID (format: _nomad-task-<alloc_id>-...)
-	if strings.HasPrefix(svc.ID, "_nomad-task-") {
-		parts := strings.Split(svc.ID, "-")
-		if len(parts) >= 3 {
-			// The allocation ID is a UUID, which is 36 characters (8-4-4-4-12)
-			// Find the UUID in the parts
-			for i := 2; i < len(parts); i++ {
-				// Try to find a sequence that forms a UUID
-				if len(parts[i]) == 8 && i+4 < len(parts) {
-					potentialUUID := strings.Join(parts[i:i+5], "-")
-					if len(potentialUUID) == 36 {
-						return potentialUUID
-					}
-				}
+// IsDataplaneTask reports whether a sidecar task runs consul-dataplane
+// rather than a standalone Envoy
+func IsDataplaneTask(task string) bool {
+	return strings.Contains(strings.ToLower(task), "dataplane")
+}
+
+// hasConnectService reports whether the allocation's task group registers a
+// Connect-enabled service named serviceName.
+func hasConnectService(alloc *nomadapi.Allocation, serviceName string) bool {
+	if alloc.Job == nil {
+		return false
+	}
+	for _, tg := range alloc.Job.TaskGroups {
+		if tg.Name == nil || *tg.Name != alloc.TaskGroup {
+			continue
+		}
+		for _, svc := range tg.Services {
+			if svc.Connect != nil && svc.Name == serviceName {
+				return true
 			}
 		}
 	}
-
-	return ""
+	return false
 }
 
 // hasConnectSidecar checks if an allocation has Consul Connect enabled
@@ -605,7 +1039,7 @@ func hasConnectSidecar(alloc *nomadapi.Allocation) bool {
 
 		// Check for sidecar tasks
 		for _, task := range tg.Tasks {
-			if strings.HasPrefix(task.Name, "connect-proxy-") {
+			if strings.HasPrefix(task.Name, "connect-proxy-") || isConnectProxyKind(task.Kind) {
 				return true
 			}
 		}
@@ -0,0 +1,718 @@
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+	"github.com/markcampv/xDSnap/consul"
+)
+
+// fakeDiscovery implements consul.ConsulDiscovery for testing.
+// proxies maps a service name to its sidecar proxy instances.
+type fakeDiscovery struct {
+	proxies   map[string][]consul.ServiceInstance
+	upstreams map[string][]string
+	listErr   error
+}
+
+var _ consul.ConsulDiscovery = &fakeDiscovery{}
+
+func (f *fakeDiscovery) ListConnectServices() ([]string, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	var names []string
+	for name := range f.proxies {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeDiscovery) GetServiceInstances(serviceName string, healthyOnly bool) ([]consul.ServiceInstance, error) {
+	return nil, nil
+}
+
+func (f *fakeDiscovery) GetConnectProxyInstances(serviceName string, healthyOnly bool) ([]consul.ServiceInstance, error) {
+	return f.proxies[serviceName], nil
+}
+
+func (f *fakeDiscovery) GetAllConnectProxyInstances(healthyOnly bool) ([]consul.ServiceInstance, error) {
+	return nil, nil
+}
+
+func (f *fakeDiscovery) GetUpstreamServices(serviceName string) ([]string, error) {
+	return f.upstreams[serviceName], nil
+}
+
+func (f *fakeDiscovery) GetServiceIntentions(serviceName string) (*consul.ServiceIntentions, error) {
+	return &consul.ServiceIntentions{Service: serviceName}, nil
+}
+
+func (f *fakeDiscovery) GetServiceChecks(serviceName string) ([]consul.ServiceCheck, error) {
+	return nil, nil
+}
+
+func (f *fakeDiscovery) GetEnvoyAdminPort(instance consul.ServiceInstance) int {
+	return 19000
+}
+
+func TestConnectAllocIDs(t *testing.T) {
+	discovery := &fakeDiscovery{
+		proxies: map[string][]consul.ServiceInstance{
+			"web": {
+				{ServiceName: "web-sidecar-proxy", AllocID: "11111111-1111-1111-1111-111111111111"},
+				{ServiceName: "web-sidecar-proxy", AllocID: "22222222-2222-2222-2222-222222222222"},
+			},
+			"api": {
+				{ServiceName: "api-sidecar-proxy", AllocID: "33333333-3333-3333-3333-333333333333"},
+				{ServiceName: "api-sidecar-proxy", AllocID: ""},
+				{ServiceName: "api-sidecar-proxy", AllocID: "33333333-3333-3333-3333-333333333333"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		serviceName string
+		want        []string
+	}{
+		{
+			name:        "single service",
+			serviceName: "web",
+			want:        []string{"11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"},
+		},
+		{
+			name:        "deduplicates and skips instances without alloc ID",
+			serviceName: "api",
+			want:        []string{"33333333-3333-3333-3333-333333333333"},
+		},
+		{
+			name:        "unknown service",
+			serviceName: "redis",
+			want:        nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := connectAllocIDs(discovery, tt.serviceName)
+			if err != nil {
+				t.Fatalf("connectAllocIDs() unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("connectAllocIDs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("connectAllocIDs()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("all services", func(t *testing.T) {
+		got, err := connectAllocIDs(discovery, "")
+		if err != nil {
+			t.Fatalf("connectAllocIDs() unexpected error: %v", err)
+		}
+		if len(got) != 3 {
+			t.Errorf("connectAllocIDs() = %v, want 3 allocations", got)
+		}
+	})
+}
+
+func TestConnectAllocIDsListError(t *testing.T) {
+	discovery := &fakeDiscovery{listErr: fmt.Errorf("connection refused")}
+	if _, err := connectAllocIDs(discovery, ""); err == nil {
+		t.Fatal("connectAllocIDs() expected error, got nil")
+	}
+}
+
+func TestWatchCancellationNoLeak(t *testing.T) {
+	// The first signal.Notify starts the runtime's signal loop goroutine,
+	// which lives for the rest of the process
+	_, stop := watchCancellation(context.Background())
+	stop()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		_, stop := watchCancellation(context.Background())
+		stop()
+		stop() // must be safe to call twice
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: before=%d after=%d", before, after)
+	}
+}
+
+func TestWatchCancellationContextDone(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancel, stop := watchCancellation(ctx)
+	defer stop()
+
+	cancelCtx()
+	select {
+	case <-cancel:
+	case <-time.After(time.Second):
+		t.Fatal("cancel channel not closed after context was cancelled")
+	}
+}
+
+func TestNewAllocationInfoEmptyTaskStates(t *testing.T) {
+	group := "web"
+	tests := []struct {
+		name        string
+		alloc       *nomadapi.Allocation
+		wantTasks   []string
+		wantSidecar string
+		wantConnect bool
+		wantJobMeta map[string]string
+	}{
+		{
+			name: "no task states and no job",
+			alloc: &nomadapi.Allocation{
+				ID:        "abcdef12-3456-7890-abcd-ef1234567890",
+				TaskGroup: group,
+			},
+			wantTasks:   nil,
+			wantSidecar: "",
+		},
+		{
+			name: "no task states falls back to job definition",
+			alloc: &nomadapi.Allocation{
+				ID:        "abcdef12-3456-7890-abcd-ef1234567890",
+				TaskGroup: group,
+				Job: &nomadapi.Job{
+					Meta: map[string]string{"team": "payments"},
+					TaskGroups: []*nomadapi.TaskGroup{{
+						Name: &group,
+						Tasks: []*nomadapi.Task{
+							{Name: "web"},
+							{Name: "connect-proxy-web"},
+						},
+					}},
+				},
+			},
+			wantTasks:   []string{"connect-proxy-web", "web"},
+			wantSidecar: "connect-proxy-web",
+			wantConnect: true,
+			wantJobMeta: map[string]string{"team": "payments"},
+		},
+		{
+			name: "task states are sorted",
+			alloc: &nomadapi.Allocation{
+				ID:        "abcdef12-3456-7890-abcd-ef1234567890",
+				TaskGroup: group,
+				TaskStates: map[string]*nomadapi.TaskState{
+					"web":               {},
+					"connect-proxy-web": {},
+				},
+			},
+			wantTasks:   []string{"connect-proxy-web", "web"},
+			wantSidecar: "connect-proxy-web",
+		},
+		{
+			name: "connect without a named sidecar task",
+			alloc: &nomadapi.Allocation{
+				ID:         "abcdef12-3456-7890-abcd-ef1234567890",
+				TaskGroup:  group,
+				TaskStates: map[string]*nomadapi.TaskState{"web": {}},
+				Job: &nomadapi.Job{
+					TaskGroups: []*nomadapi.TaskGroup{{
+						Name:     &group,
+						Tasks:    []*nomadapi.Task{{Name: "web"}},
+						Services: []*nomadapi.Service{{Name: "web", Connect: &nomadapi.ConsulConnect{Native: false}}},
+					}},
+				},
+			},
+			wantTasks:   []string{"web"},
+			wantSidecar: "",
+			wantConnect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := newAllocationInfo(tt.alloc)
+			if len(info.Tasks) != len(tt.wantTasks) {
+				t.Fatalf("Tasks = %v, want %v", info.Tasks, tt.wantTasks)
+			}
+			for i := range info.Tasks {
+				if info.Tasks[i] != tt.wantTasks[i] {
+					t.Errorf("Tasks[%d] = %q, want %q", i, info.Tasks[i], tt.wantTasks[i])
+				}
+			}
+			if info.SidecarTask != tt.wantSidecar {
+				t.Errorf("SidecarTask = %q, want %q", info.SidecarTask, tt.wantSidecar)
+			}
+			if info.Connect != tt.wantConnect {
+				t.Errorf("Connect = %v, want %v", info.Connect, tt.wantConnect)
+			}
+			if !reflect.DeepEqual(info.JobMeta, tt.wantJobMeta) {
+				t.Errorf("JobMeta = %v, want %v", info.JobMeta, tt.wantJobMeta)
+			}
+		})
+	}
+}
+
+func TestJobSidecarTask(t *testing.T) {
+	group := "web"
+	allocWith := func(tasks []*nomadapi.Task, services []*nomadapi.Service) *nomadapi.Allocation {
+		states := make(map[string]*nomadapi.TaskState)
+		for _, task := range tasks {
+			states[task.Name] = &nomadapi.TaskState{}
+		}
+		return &nomadapi.Allocation{
+			ID:         "abcdef12-3456-7890-abcd-ef1234567890",
+			TaskGroup:  group,
+			TaskStates: states,
+			Job: &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{{
+				Name:     &group,
+				Tasks:    tasks,
+				Services: services,
+			}}},
+		}
+	}
+	connect := func(sidecarName string) []*nomadapi.Service {
+		c := &nomadapi.ConsulConnect{SidecarService: &nomadapi.ConsulSidecarService{}}
+		if sidecarName != "" {
+			c.SidecarTask = &nomadapi.SidecarTask{Name: sidecarName}
+		}
+		return []*nomadapi.Service{{Name: "web", Connect: c}}
+	}
+
+	tests := []struct {
+		name        string
+		alloc       *nomadapi.Allocation
+		wantJob     string
+		wantSidecar string
+	}{
+		{
+			name:        "task kind names an unconventional sidecar",
+			alloc:       allocWith([]*nomadapi.Task{{Name: "web"}, {Name: "mesh", Kind: "connect-proxy:web"}, {Name: "log-shipper-proxy"}}, connect("")),
+			wantJob:     "mesh",
+			wantSidecar: "mesh",
+		},
+		{
+			name:        "gateway task kind",
+			alloc:       allocWith([]*nomadapi.Task{{Name: "ingress", Kind: "connect-ingress:ingress"}}, nil),
+			wantJob:     "ingress",
+			wantSidecar: "ingress",
+		},
+		{
+			name:        "sidecar_task name without a task kind",
+			alloc:       allocWith([]*nomadapi.Task{{Name: "web"}, {Name: "edge"}}, connect("edge")),
+			wantJob:     "edge",
+			wantSidecar: "edge",
+		},
+		{
+			name:        "sidecar_task naming a task the allocation doesn't run",
+			alloc:       allocWith([]*nomadapi.Task{{Name: "web"}, {Name: "connect-proxy-web"}}, connect("edge")),
+			wantSidecar: "connect-proxy-web",
+		},
+		{
+			name:        "no job metadata falls back to the heuristic",
+			alloc:       &nomadapi.Allocation{TaskGroup: group, TaskStates: map[string]*nomadapi.TaskState{"web": {}, "envoy-sidecar": {}}},
+			wantSidecar: "envoy-sidecar",
+		},
+		{
+			name:        "no sidecar task",
+			alloc:       allocWith([]*nomadapi.Task{{Name: "web"}}, nil),
+			wantSidecar: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := newAllocationInfo(tt.alloc)
+			if got := jobSidecarTask(tt.alloc, info.Tasks); got != tt.wantJob {
+				t.Errorf("jobSidecarTask() = %q, want %q", got, tt.wantJob)
+			}
+			if info.SidecarTask != tt.wantSidecar {
+				t.Errorf("SidecarTask = %q, want %q", info.SidecarTask, tt.wantSidecar)
+			}
+		})
+	}
+}
+
+func TestNamespaceMatches(t *testing.T) {
+	tests := []struct {
+		filter, ns string
+		want       bool
+	}{
+		{"", "default", true},
+		{"", "prod", true},
+		{AllNamespaces, "prod", true},
+		{"prod", "prod", true},
+		{"prod", "default", false},
+		{"prod,staging", "staging", true},
+		{"prod, staging", "default", false},
+		{"prod,*", "default", true},
+	}
+	for _, tt := range tests {
+		if got := NamespaceMatches(tt.filter, tt.ns); got != tt.want {
+			t.Errorf("NamespaceMatches(%q, %q) = %v, want %v", tt.filter, tt.ns, got, tt.want)
+		}
+	}
+}
+
+func TestSplitNamespaces(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{""}},
+		{"prod", []string{"prod"}},
+		{AllNamespaces, []string{AllNamespaces}},
+		{"prod, staging,prod", []string{"prod", "staging"}},
+		{"prod,,", []string{"prod"}},
+		{"prod,*", []string{AllNamespaces}},
+	}
+	for _, tt := range tests {
+		if got := SplitNamespaces(tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitNamespaces(%q) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+// newFakeNomad serves allocation info and listing for the given allocations
+// and records the namespace each listing was requested for.
+func newFakeNomad(t *testing.T, allocs []*nomadapi.Allocation, listed *[]string) *nomadapi.Client {
+	t.Helper()
+	byID := make(map[string]*nomadapi.Allocation)
+	for _, a := range allocs {
+		byID[a.ID] = a
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/allocations":
+			ns := r.URL.Query().Get("namespace")
+			*listed = append(*listed, ns)
+			var stubs []*nomadapi.AllocationListStub
+			for _, a := range allocs {
+				if NamespaceMatches(ns, a.Namespace) {
+					stubs = append(stubs, &nomadapi.AllocationListStub{ID: a.ID, Namespace: a.Namespace, ClientStatus: a.ClientStatus})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(stubs)
+		case strings.HasPrefix(r.URL.Path, "/v1/allocation/"):
+			a, ok := byID[strings.TrimPrefix(r.URL.Path, "/v1/allocation/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(a)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := nomadapi.NewClient(&nomadapi.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestFindConnectAllocationsNamespaces(t *testing.T) {
+	group := "web"
+	connectAlloc := func(id, ns string) *nomadapi.Allocation {
+		return &nomadapi.Allocation{
+			ID:           id,
+			Namespace:    ns,
+			TaskGroup:    group,
+			ClientStatus: "running",
+			TaskStates:   map[string]*nomadapi.TaskState{"web": {}, "connect-proxy-web": {}},
+			Job: &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{{
+				Name:     &group,
+				Services: []*nomadapi.Service{{Name: "web", Connect: &nomadapi.ConsulConnect{}}},
+			}}},
+		}
+	}
+	defaultAlloc := connectAlloc("11111111-1111-1111-1111-111111111111", "default")
+	prodAlloc := connectAlloc("22222222-2222-2222-2222-222222222222", "prod")
+	// Registered in Nomad but not (yet) visible in Consul
+	stagingAlloc := connectAlloc("33333333-3333-3333-3333-333333333333", "staging")
+
+	discovery := &fakeDiscovery{proxies: map[string][]consul.ServiceInstance{
+		"web": {{AllocID: defaultAlloc.ID}, {AllocID: prodAlloc.ID}},
+	}}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		want       []string
+		wantListed []string
+	}{
+		{name: "empty selects every namespace", namespace: "", want: []string{defaultAlloc.ID, prodAlloc.ID}},
+		{name: "wildcard selects every namespace", namespace: AllNamespaces, want: []string{defaultAlloc.ID, prodAlloc.ID}},
+		{name: "specific namespace filters Consul results", namespace: "prod", want: []string{prodAlloc.ID}},
+		{name: "falls back to scanning the namespace", namespace: "staging", want: []string{stagingAlloc.ID}, wantListed: []string{"staging"}},
+		{name: "list of namespaces", namespace: "default,prod", want: []string{defaultAlloc.ID, prodAlloc.ID}},
+		{name: "each listed namespace falls back on its own", namespace: "prod,staging", want: []string{prodAlloc.ID, stagingAlloc.ID}, wantListed: []string{"staging"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listed []string
+			client := newFakeNomad(t, []*nomadapi.Allocation{defaultAlloc, prodAlloc, stagingAlloc}, &listed)
+			svc := NewNomadApiServiceWithDiscovery(client, discovery, tt.namespace)
+
+			allocs, err := svc.FindConnectAllocations(tt.namespace)
+			if err != nil {
+				t.Fatalf("FindConnectAllocations: %v", err)
+			}
+			var got []string
+			for _, a := range allocs {
+				got = append(got, a.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(listed, tt.wantListed) {
+				t.Errorf("listed namespaces = %v, want %v", listed, tt.wantListed)
+			}
+		})
+	}
+}
+
+func TestScanNomadForConnectAllocationsWildcard(t *testing.T) {
+	var listed []string
+	client := newFakeNomad(t, nil, &listed)
+	svc := &NomadApiServiceImpl{nomadClient: client, discovery: &fakeDiscovery{}}
+
+	for _, ns := range []string{"", AllNamespaces, "prod"} {
+		if _, err := svc.scanNomadForConnectAllocations(ns, ""); err != nil {
+			t.Fatalf("scanNomadForConnectAllocations(%q): %v", ns, err)
+		}
+	}
+	want := []string{AllNamespaces, AllNamespaces, "prod"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("listed namespaces = %v, want %v", listed, want)
+	}
+}
+
+func TestFindUpstreamAllocations(t *testing.T) {
+	group := "api"
+	alloc := func(id, ns string) *nomadapi.Allocation {
+		return &nomadapi.Allocation{
+			ID:         id,
+			Namespace:  ns,
+			TaskGroup:  group,
+			TaskStates: map[string]*nomadapi.TaskState{"api": {}, "connect-proxy-api": {}},
+		}
+	}
+	apiAlloc := alloc("11111111-1111-1111-1111-111111111111", "default")
+	dbAlloc := alloc("22222222-2222-2222-2222-222222222222", "prod")
+
+	discovery := &fakeDiscovery{
+		proxies: map[string][]consul.ServiceInstance{
+			"web": {{AllocID: "99999999-9999-9999-9999-999999999999"}},
+			"api": {{AllocID: apiAlloc.ID}},
+			"db":  {{AllocID: dbAlloc.ID}},
+		},
+		upstreams: map[string][]string{
+			"web": {"api", "db", "cache"},
+			"api": {"db"}, // second hop, not followed
+		},
+	}
+
+	var listed []string
+	client := newFakeNomad(t, []*nomadapi.Allocation{apiAlloc, dbAlloc}, &listed)
+	svc := NewNomadApiServiceWithDiscovery(client, discovery, "")
+
+	tests := []struct {
+		namespace string
+		want      []string
+	}{
+		{"", []string{apiAlloc.ID, dbAlloc.ID}},
+		{"prod", []string{dbAlloc.ID}},
+	}
+	for _, tt := range tests {
+		allocs, err := svc.FindUpstreamAllocations(tt.namespace, "web")
+		if err != nil {
+			t.Fatalf("FindUpstreamAllocations: %v", err)
+		}
+		var got []string
+		for _, a := range allocs {
+			got = append(got, a.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("namespace %q: got %v, want %v", tt.namespace, got, tt.want)
+		}
+	}
+	if len(listed) != 0 {
+		t.Errorf("upstream lookup scanned Nomad (%v); it must not fall back", listed)
+	}
+}
+
+func TestAllocationPorts(t *testing.T) {
+	alloc := &nomadapi.Allocation{
+		AllocatedResources: &nomadapi.AllocatedResources{
+			Shared: nomadapi.AllocatedSharedResources{
+				Ports: []nomadapi.PortMapping{
+					{Label: "envoy_admin", Value: 24567, To: 19000, HostIP: "10.0.0.5"},
+				},
+				Networks: []*nomadapi.NetworkResource{{
+					IP:           "10.0.0.5",
+					DynamicPorts: []nomadapi.Port{{Label: "envoy_admin", Value: 1}, {Label: "metrics", Value: 25000}},
+				}},
+			},
+			Tasks: map[string]*nomadapi.AllocatedTaskResources{
+				"web": {Networks: []*nomadapi.NetworkResource{{
+					IP:            "10.0.0.6",
+					ReservedPorts: []nomadapi.Port{{Label: "http", Value: 8080}},
+					DynamicPorts:  []nomadapi.Port{{Label: "unset"}},
+				}}},
+			},
+		},
+	}
+	want := map[string]string{
+		"envoy_admin": "10.0.0.5:24567",
+		"metrics":     "10.0.0.5:25000",
+		"http":        "10.0.0.6:8080",
+	}
+	if got := allocationPorts(alloc); !reflect.DeepEqual(got, want) {
+		t.Errorf("allocationPorts() = %v, want %v", got, want)
+	}
+	if got := allocationPorts(&nomadapi.Allocation{}); len(got) != 0 {
+		t.Errorf("allocationPorts() without resources = %v, want empty", got)
+	}
+}
+
+func TestRegionIsSentWithQueries(t *testing.T) {
+	group := "web"
+	alloc := &nomadapi.Allocation{
+		ID:           "44444444-4444-4444-4444-444444444444",
+		Namespace:    "default",
+		TaskGroup:    group,
+		ClientStatus: "running",
+		TaskStates:   map[string]*nomadapi.TaskState{"web": {}, "connect-proxy-web": {}},
+		Job: &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{{
+			Name:     &group,
+			Services: []*nomadapi.Service{{Name: "web", Connect: &nomadapi.ConsulConnect{}}},
+		}}},
+	}
+	var regions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		regions = append(regions, r.URL.Path+"?region="+r.URL.Query().Get("region"))
+		switch r.URL.Path {
+		case "/v1/allocations":
+			_ = json.NewEncoder(w).Encode([]*nomadapi.AllocationListStub{{ID: alloc.ID, ClientStatus: "running"}})
+		case "/v1/allocation/" + alloc.ID:
+			_ = json.NewEncoder(w).Encode(alloc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client, err := nomadapi.NewClient(&nomadapi.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &NomadApiServiceImpl{nomadClient: client, discovery: &fakeDiscovery{}, region: "eu-west"}
+	allocs, err := svc.scanNomadForConnectAllocations("", "")
+	if err != nil || len(allocs) != 1 {
+		t.Fatalf("scanNomadForConnectAllocations() = %v, %v", allocs, err)
+	}
+	for _, got := range regions {
+		if !strings.HasSuffix(got, "?region=eu-west") {
+			t.Errorf("request %s not scoped to the region", got)
+		}
+	}
+}
+
+func TestFindConnectAllocationsDiscoverySource(t *testing.T) {
+	connectAlloc := func(id, group string) *nomadapi.Allocation {
+		return &nomadapi.Allocation{
+			ID:           id,
+			Namespace:    "default",
+			TaskGroup:    group,
+			ClientStatus: "running",
+			TaskStates:   map[string]*nomadapi.TaskState{group: {}, "connect-proxy-" + group: {}},
+			Job: &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{{
+				Name:     &group,
+				Services: []*nomadapi.Service{{Name: group, Connect: &nomadapi.ConsulConnect{}}},
+			}}},
+		}
+	}
+	web := connectAlloc("11111111-1111-1111-1111-111111111111", "web")
+	api := connectAlloc("22222222-2222-2222-2222-222222222222", "api")
+
+	tests := []struct {
+		name       string
+		source     string
+		discovery  *fakeDiscovery
+		service    string
+		want       []string
+		wantListed []string
+		wantErr    bool
+	}{
+		{
+			name:       "nomad never queries Consul",
+			source:     DiscoveryNomad,
+			discovery:  &fakeDiscovery{listErr: fmt.Errorf("403 Permission denied")},
+			want:       []string{web.ID, api.ID},
+			wantListed: []string{AllNamespaces},
+		},
+		{
+			name:       "nomad filters the scan by service",
+			source:     DiscoveryNomad,
+			discovery:  &fakeDiscovery{listErr: fmt.Errorf("403 Permission denied")},
+			service:    "api",
+			want:       []string{api.ID},
+			wantListed: []string{AllNamespaces},
+		},
+		{
+			name:      "consul has no Nomad fallback",
+			source:    DiscoveryConsul,
+			discovery: &fakeDiscovery{},
+			service:   "api",
+		},
+		{
+			name:      "consul errors are returned",
+			source:    DiscoveryConsul,
+			discovery: &fakeDiscovery{listErr: fmt.Errorf("403 Permission denied")},
+			wantErr:   true,
+		},
+		{
+			name:       "auto falls back to Nomad",
+			source:     DiscoveryAuto,
+			discovery:  &fakeDiscovery{},
+			want:       []string{web.ID, api.ID},
+			wantListed: []string{AllNamespaces},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listed []string
+			client := newFakeNomad(t, []*nomadapi.Allocation{web, api}, &listed)
+			svc := &NomadApiServiceImpl{nomadClient: client, discovery: tt.discovery, source: tt.source}
+
+			allocs, err := svc.FindConnectAllocationsByService("", tt.service)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindConnectAllocationsByService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, a := range allocs {
+				got = append(got, a.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(listed, tt.wantListed) {
+				t.Errorf("listed namespaces = %v, want %v", listed, tt.wantListed)
+			}
+		})
+	}
+}
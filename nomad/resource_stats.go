@@ -0,0 +1,119 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// TaskResourceStats is a task's resource usage as measured by its Nomad
+// client, next to the resources the allocation reserves for it
+type TaskResourceStats struct {
+	CPUTotalTicks       float64 `json:"cpu_total_ticks"` // MHz in use
+	CPUPercent          float64 `json:"cpu_percent"`
+	CPUThrottledPeriods uint64  `json:"cpu_throttled_periods"`
+	CPUThrottledTime    uint64  `json:"cpu_throttled_time_ns"`
+	CPUMHz              int64   `json:"cpu_mhz"` // reserved
+	MemoryRSS           uint64  `json:"memory_rss_bytes"`
+	MemoryUsage         uint64  `json:"memory_usage_bytes"`
+	MemoryMaxUsage      uint64  `json:"memory_max_usage_bytes"`
+	MemoryMB            int64   `json:"memory_mb"`     // reserved
+	MemoryMaxMB         int64   `json:"memory_max_mb"` // hard limit with memory oversubscription, else 0
+}
+
+// MemoryLimit returns the memory limit the task is killed at, in bytes.
+func (s TaskResourceStats) MemoryLimit() uint64 {
+	if s.MemoryMaxMB > s.MemoryMB {
+		return uint64(s.MemoryMaxMB) << 20
+	}
+	return uint64(s.MemoryMB) << 20
+}
+
+// MemoryUsed returns the task's resident memory, or its total usage where
+// the client can't measure RSS (cgroups v2).
+func (s TaskResourceStats) MemoryUsed() uint64 {
+	if s.MemoryRSS > 0 {
+		return s.MemoryRSS
+	}
+	return s.MemoryUsage
+}
+
+// AllocResourceStats is the resource usage of an allocation's tasks, with the
+// client's full response in Raw
+type AllocResourceStats struct {
+	Timestamp time.Time
+	Tasks     map[string]TaskResourceStats
+	Raw       []byte
+}
+
+// GetAllocationStats returns the current resource usage of an allocation's
+// tasks from the Nomad client running it
+func (n *NomadApiServiceImpl) GetAllocationStats(allocID string) (*AllocResourceStats, error) {
+	alloc, _, err := n.nomadClient.Allocations().Info(allocID, n.queryOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocation info: %w", err)
+	}
+	usage, err := n.nomadClient.Allocations().Stats(alloc, n.queryOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocation stats: %w", err)
+	}
+	return newAllocResourceStats(alloc, usage)
+}
+
+func newAllocResourceStats(alloc *nomadapi.Allocation, usage *nomadapi.AllocResourceUsage) (*AllocResourceStats, error) {
+	raw, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode allocation stats: %w", err)
+	}
+	stats := &AllocResourceStats{
+		Timestamp: time.Unix(0, usage.Timestamp),
+		Tasks:     make(map[string]TaskResourceStats, len(usage.Tasks)),
+		Raw:       raw,
+	}
+	for task, tu := range usage.Tasks {
+		s := allocatedTaskResources(alloc, task)
+		if tu != nil && tu.ResourceUsage != nil {
+			if cpu := tu.ResourceUsage.CpuStats; cpu != nil {
+				s.CPUTotalTicks = cpu.TotalTicks
+				s.CPUPercent = cpu.Percent
+				s.CPUThrottledPeriods = cpu.ThrottledPeriods
+				s.CPUThrottledTime = cpu.ThrottledTime
+			}
+			if mem := tu.ResourceUsage.MemoryStats; mem != nil {
+				s.MemoryRSS = mem.RSS
+				s.MemoryUsage = mem.Usage
+				s.MemoryMaxUsage = mem.MaxUsage
+			}
+		}
+		stats.Tasks[task] = s
+	}
+	return stats, nil
+}
+
+// allocatedTaskResources returns the CPU and memory reserved for task,
+// falling back to the pre-0.9 TaskResources of older allocations.
+func allocatedTaskResources(alloc *nomadapi.Allocation, task string) TaskResourceStats {
+	var s TaskResourceStats
+	if alloc.AllocatedResources != nil {
+		if r, ok := alloc.AllocatedResources.Tasks[task]; ok && r != nil {
+			s.CPUMHz = r.Cpu.CpuShares
+			s.MemoryMB = r.Memory.MemoryMB
+			s.MemoryMaxMB = r.Memory.MemoryMaxMB
+			return s
+		}
+	}
+	if r, ok := alloc.TaskResources[task]; ok && r != nil {
+		if r.CPU != nil {
+			s.CPUMHz = int64(*r.CPU)
+		}
+		if r.MemoryMB != nil {
+			s.MemoryMB = int64(*r.MemoryMB)
+		}
+		if r.MemoryMaxMB != nil {
+			s.MemoryMaxMB = int64(*r.MemoryMaxMB)
+		}
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+func TestNewAllocResourceStats(t *testing.T) {
+	cpu, mem := 500, 256
+	alloc := &nomadapi.Allocation{
+		AllocatedResources: &nomadapi.AllocatedResources{Tasks: map[string]*nomadapi.AllocatedTaskResources{
+			"connect-proxy-web": {
+				Cpu:    nomadapi.AllocatedCpuResources{CpuShares: 250},
+				Memory: nomadapi.AllocatedMemoryResources{MemoryMB: 128, MemoryMaxMB: 192},
+			},
+		}},
+		// Allocations from before 0.9 only have TaskResources
+		TaskResources: map[string]*nomadapi.Resources{"web": {CPU: &cpu, MemoryMB: &mem}},
+	}
+	usage := &nomadapi.AllocResourceUsage{
+		Timestamp: 1700000000000000000,
+		Tasks: map[string]*nomadapi.TaskResourceUsage{
+			"connect-proxy-web": {ResourceUsage: &nomadapi.ResourceUsage{
+				CpuStats:    &nomadapi.CpuStats{TotalTicks: 240.5, Percent: 9.6, ThrottledPeriods: 12, ThrottledTime: 3000},
+				MemoryStats: &nomadapi.MemoryStats{Usage: 150 << 20, MaxUsage: 190 << 20},
+			}},
+			"web": {ResourceUsage: &nomadapi.ResourceUsage{
+				MemoryStats: &nomadapi.MemoryStats{RSS: 64 << 20, Usage: 100 << 20},
+			}},
+			"init": nil,
+		},
+	}
+
+	stats, err := newAllocResourceStats(alloc, usage)
+	if err != nil {
+		t.Fatalf("newAllocResourceStats() error: %v", err)
+	}
+	want := map[string]TaskResourceStats{
+		"connect-proxy-web": {
+			CPUTotalTicks: 240.5, CPUPercent: 9.6, CPUThrottledPeriods: 12, CPUThrottledTime: 3000, CPUMHz: 250,
+			MemoryUsage: 150 << 20, MemoryMaxUsage: 190 << 20, MemoryMB: 128, MemoryMaxMB: 192,
+		},
+		"web":  {CPUMHz: 500, MemoryRSS: 64 << 20, MemoryUsage: 100 << 20, MemoryMB: 256},
+		"init": {},
+	}
+	if !reflect.DeepEqual(stats.Tasks, want) {
+		t.Errorf("Tasks = %+v, want %+v", stats.Tasks, want)
+	}
+	if got := stats.Timestamp.Unix(); got != 1700000000 {
+		t.Errorf("Timestamp = %d, want 1700000000", got)
+	}
+	var raw nomadapi.AllocResourceUsage
+	if err := json.Unmarshal(stats.Raw, &raw); err != nil || len(raw.Tasks) != 3 {
+		t.Errorf("Raw = %s (%v), want the client response", stats.Raw, err)
+	}
+
+	sidecar := stats.Tasks["connect-proxy-web"]
+	if got := sidecar.MemoryLimit(); got != 192<<20 {
+		t.Errorf("MemoryLimit() = %d, want the memory_max limit", got)
+	}
+	if got := sidecar.MemoryUsed(); got != 150<<20 {
+		t.Errorf("MemoryUsed() = %d, want the usage when RSS is not measured", got)
+	}
+	if got := stats.Tasks["web"].MemoryUsed(); got != 64<<20 {
+		t.Errorf("MemoryUsed() = %d, want the RSS", got)
+	}
+}
+
+func TestGetAllocationStats(t *testing.T) {
+	const allocID = "55555555-5555-5555-5555-555555555555"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/allocation/" + allocID:
+			_ = json.NewEncoder(w).Encode(&nomadapi.Allocation{ID: allocID})
+		case "/v1/client/allocation/" + allocID + "/stats":
+			_ = json.NewEncoder(w).Encode(&nomadapi.AllocResourceUsage{Tasks: map[string]*nomadapi.TaskResourceUsage{
+				"connect-proxy-web": {ResourceUsage: &nomadapi.ResourceUsage{CpuStats: &nomadapi.CpuStats{TotalTicks: 10}}},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client, err := nomadapi.NewClient(&nomadapi.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &NomadApiServiceImpl{nomadClient: client}
+
+	stats, err := svc.GetAllocationStats(allocID)
+	if err != nil {
+		t.Fatalf("GetAllocationStats() error: %v", err)
+	}
+	if got := stats.Tasks["connect-proxy-web"].CPUTotalTicks; got != 10 {
+		t.Errorf("CPUTotalTicks = %v, want 10", got)
+	}
+	if _, err := svc.GetAllocationStats("66666666-6666-6666-6666-666666666666"); err == nil {
+		t.Error("GetAllocationStats() of an unknown allocation succeeded")
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// adminEndpoint is one entry of the Envoy admin index.
+type adminEndpoint struct {
+	path        string
+	description string
+	post        bool // listed as a POST form, i.e. it acts on the proxy
+}
+
+var (
+	indexRow    = regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	indexTarget = regexp.MustCompile(`(?i)(?:href|action)=['"]([^'"]*)['"]`)
+	indexCell   = regexp.MustCompile(`(?is)<td[^>]*>(.*?)</td>`)
+	indexPost   = regexp.MustCompile(`(?i)<form[^>]*method=['"]post['"]`)
+	htmlTag     = regexp.MustCompile(`(?s)<[^>]*>`)
+	helpLine    = regexp.MustCompile(`^\s+(/\S*):\s*(.*)$`)
+	// indexPath is what an endpoint scraped from the index may look like;
+	// anything else is dropped, since the path ends up in an exec command
+	indexPath = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+)
+
+// parseAdminIndex extracts the endpoints listed on the admin home page (/).
+// Each table row holds a link (GET endpoints) or a form (POST endpoints)
+// followed by a description cell; parameter rows have no target and are
+// skipped, and so are paths indexPath doesn't match.
+func parseAdminIndex(page []byte) []adminEndpoint {
+	var endpoints []adminEndpoint
+	seen := make(map[string]bool)
+	for _, row := range indexRow.FindAllStringSubmatch(string(page), -1) {
+		target := indexTarget.FindStringSubmatch(row[1])
+		if target == nil {
+			continue
+		}
+		path, _, _ := strings.Cut(html.UnescapeString(target[1]), "?")
+		path = "/" + strings.TrimPrefix(path, "/")
+		if !indexPath.MatchString(path) || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		var description string
+		if cells := indexCell.FindAllStringSubmatch(row[1], -1); len(cells) > 1 {
+			description = cellText(cells[len(cells)-1][1])
+		}
+		endpoints = append(endpoints, adminEndpoint{path: path, description: description, post: indexPost.MatchString(row[1])})
+	}
+	return endpoints
+}
+
+func cellText(cell string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(cell, " "))), " ")
+}
+
+// parseAdminHelp extracts the endpoints from the plain-text /help listing
+// ("  /certs: print certs on machine"), skipping paths indexPath doesn't
+// match.
+func parseAdminHelp(text []byte) []adminEndpoint {
+	var endpoints []adminEndpoint
+	for _, line := range strings.Split(string(text), "\n") {
+		m := helpLine.FindStringSubmatch(line)
+		if m == nil || !indexPath.MatchString(m[1]) {
+			continue
+		}
+		endpoints = append(endpoints, adminEndpoint{path: m[1], description: strings.TrimSpace(m[2])})
+	}
+	return endpoints
+}
+
+// formatAdminEndpoints renders one endpoint per line with aligned descriptions.
+func formatAdminEndpoints(endpoints []adminEndpoint) string {
+	width := 0
+	for _, e := range endpoints {
+		if len(e.path) > width {
+			width = len(e.path)
+		}
+	}
+	var b strings.Builder
+	for _, e := range endpoints {
+		if e.description == "" {
+			fmt.Fprintln(&b, e.path)
+			continue
+		}
+		fmt.Fprintf(&b, "%-*s  %s\n", width, e.path, e.description)
+	}
+	return b.String()
+}
+
+// readAdminIndex fetches the endpoints listed on the admin home page, or on
+// /help for builds whose home page can't be parsed.
+func readAdminIndex(nomadService nomad.NomadApiService, config SnapshotConfig) ([]adminEndpoint, error) {
+	page, err := fetchEnvoyEndpoint(nomadService, config, "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch admin index: %w", err)
+	}
+	endpoints := parseAdminIndex(page)
+	if len(endpoints) == 0 {
+		help, err := fetchEnvoyEndpoint(nomadService, config, "/help")
+		if err != nil {
+			return nil, fmt.Errorf("admin index lists no endpoints and /help failed: %w", err)
+		}
+		endpoints = parseAdminHelp(help)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints found in admin index or /help")
+	}
+	return endpoints, nil
+}
+
+// indexedEndpoints returns configured followed by every endpoint on the
+// admin index not already among them, leaving out POST endpoints,
+// destructive ones and those allowlist rejects. skipped says why each
+// endpoint was left out.
+func indexedEndpoints(index []adminEndpoint, configured []string, allowlist endpointAllowlist) (endpoints, skipped []string) {
+	endpoints = append([]string(nil), configured...)
+	have := make(map[string]bool)
+	for _, endpoint := range configured {
+		path, _, _ := strings.Cut(endpoint, "?")
+		have[path] = true
+	}
+	for _, e := range index {
+		switch effect, destructive := destructiveEndpoint(e.path); {
+		case have[e.path]:
+		case destructive:
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", e.path, effect))
+		case e.post:
+			skipped = append(skipped, fmt.Sprintf("%s (POST only)", e.path))
+		case !allowlist.allows(e.path):
+			skipped = append(skipped, fmt.Sprintf("%s (not in %s)", e.path, allowedEndpointsKey))
+		default:
+			endpoints = append(endpoints, e.path)
+		}
+		have[e.path] = true
+	}
+	return endpoints, skipped
+}
+
+// allAdminEndpoints adds every readable endpoint on the proxy's admin index
+// to the configured ones, keeping just those when the index can't be read.
+func allAdminEndpoints(nomadService nomad.NomadApiService, config SnapshotConfig) []string {
+	index, err := readAdminIndex(nomadService, config)
+	if err != nil {
+		log.Printf("--all-endpoints: %v; capturing the configured endpoints only", err)
+		return config.Endpoints
+	}
+	endpoints, skipped := indexedEndpoints(index, config.Endpoints, config.Allowlist)
+	for _, s := range skipped {
+		log.Printf("--all-endpoints: skipping %s for alloc %s", s, config.AllocID[:8])
+	}
+	log.Printf("--all-endpoints: capturing %d endpoints (%d from the admin index) for alloc %s",
+		len(endpoints), len(endpoints)-len(config.Endpoints), config.AllocID[:8])
+	return endpoints
+}
+
+// captureAdminIndex fetches the admin home page and writes the endpoints it
+// lists to path. Builds whose home page can't be parsed are read from /help.
+func captureAdminIndex(nomadService nomad.NomadApiService, config SnapshotConfig, path string) error {
+	endpoints, err := readAdminIndex(nomadService, config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(formatAdminEndpoints(endpoints)), 0644)
+}
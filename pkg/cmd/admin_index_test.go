@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAdminIndex(t *testing.T) {
+	page := `<html><body><table class='home-table'>
+<thead><th>Command</th><th>Description</th></thead>
+<tbody>
+<tr class='vert-space'><td></td><td></td></tr>
+<tr class='home-row'><td class='home-data'><a href='certs'>certs</a></td><td class='home-data'>print certs on machine</td></tr>
+<tr class='home-row'><td class='home-data'><form action='logging' method='post' id='logging' class='home-form'><button class='button-as-link'>logging</button></form></td><td class='home-data'>query/change logging levels</td></tr>
+<tr class='home-row'><td class='option'><input type='text' name='level' form='logging'/></td><td class='home-data'>Sets the level</td></tr>
+<tr class='home-row'><td class='home-data'><a href='stats?usedonly'>stats</a></td><td class='home-data'>print server stats &amp; more</td></tr>
+<tr class='home-row'><td class='home-data'><a href='/stats/prometheus'>stats/prometheus</a></td><td class='home-data'>print server stats in prometheus format</td></tr>
+<tr class='home-row'><td class='home-data'><a href='stats$(id)'>evil</a></td><td class='home-data'>runs a command</td></tr>
+<tr class='home-row'><td class='home-data'><a href='a&quot;b'>quote</a></td><td class='home-data'>breaks a literal</td></tr>
+</tbody></table></body></html>`
+
+	want := []adminEndpoint{
+		{"/certs", "print certs on machine", false},
+		{"/logging", "query/change logging levels", true},
+		{"/stats", "print server stats & more", false},
+		{"/stats/prometheus", "print server stats in prometheus format", false},
+	}
+	if got := parseAdminIndex([]byte(page)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAdminIndex() = %v, want %v", got, want)
+	}
+	if got := parseAdminIndex([]byte("not html")); got != nil {
+		t.Errorf("parseAdminIndex(text) = %v, want nil", got)
+	}
+}
+
+func TestParseAdminHelp(t *testing.T) {
+	help := "admin commands are:\n  /: Admin home page\n  /certs: print certs on machine\n  /ready: print server state, return 200 if LIVE, otherwise return 503\n  /x`id`: runs a command\n"
+	want := []adminEndpoint{
+		{"/certs", "print certs on machine", false},
+		{"/ready", "print server state, return 200 if LIVE, otherwise return 503", false},
+	}
+	if got := parseAdminHelp([]byte(help)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAdminHelp() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAdminEndpoints(t *testing.T) {
+	got := formatAdminEndpoints([]adminEndpoint{{"/certs", "print certs", false}, {"/stats/prometheus", "prometheus stats", false}, {"/x", "", false}})
+	want := "/certs             print certs\n/stats/prometheus  prometheus stats\n/x\n"
+	if got != want {
+		t.Errorf("formatAdminEndpoints() = %q, want %q", got, want)
+	}
+}
+
+func TestIndexedEndpoints(t *testing.T) {
+	index := []adminEndpoint{
+		{path: "/certs"},
+		{path: "/clusters"},
+		{path: "/hot_restart_version"},
+		{path: "/logging", post: true},
+		{path: "/quitquitquit", post: true},
+		{path: "/healthcheck/fail"},
+		{path: "/runtime"},
+		{path: "/stats"},
+		{path: "/stats/prometheus"},
+	}
+	tests := []struct {
+		name        string
+		allowlist   endpointAllowlist
+		wantEPs     []string
+		wantSkipped []string
+	}{
+		{
+			name:    "everything readable",
+			wantEPs: []string{"/stats?usedonly", "/clusters", "/certs", "/hot_restart_version", "/runtime", "/stats/prometheus"},
+			wantSkipped: []string{
+				"/logging (POST only)",
+				"/quitquitquit (shuts Envoy down)",
+				"/healthcheck/fail (fails Envoy's health check, taking it out of service)",
+			},
+		},
+		{
+			name:      "allowlist",
+			allowlist: endpointAllowlist{"/stats", "/clusters", "/certs"},
+			wantEPs:   []string{"/stats?usedonly", "/clusters", "/certs"},
+			wantSkipped: []string{
+				"/hot_restart_version (not in allowed-endpoints)",
+				"/logging (POST only)",
+				"/quitquitquit (shuts Envoy down)",
+				"/healthcheck/fail (fails Envoy's health check, taking it out of service)",
+				"/runtime (not in allowed-endpoints)",
+				"/stats/prometheus (not in allowed-endpoints)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped := indexedEndpoints(index, []string{"/stats?usedonly", "/clusters"}, tt.allowlist)
+			if !reflect.DeepEqual(got, tt.wantEPs) {
+				t.Errorf("indexedEndpoints() = %q, want %q", got, tt.wantEPs)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("indexedEndpoints() skipped = %q, want %q", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// validateAdminPorts checks the --envoy-admin-port values. Each port must be
+// a valid TCP port and may only be given once.
+func validateAdminPorts(ports []int) error {
+	seen := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("--envoy-admin-port %d is not a valid port", port)
+		}
+		if seen[port] {
+			return fmt.Errorf("--envoy-admin-port %d given more than once", port)
+		}
+		seen[port] = true
+	}
+	return nil
+}
+
+// adminTarget is the address and ports an allocation's Envoy admin API is
+// reached on.
+type adminTarget struct {
+	addr  string
+	ports []int
+	// portLabel names the Nomad port the admin API is fetched from directly,
+	// without exec, when set
+	portLabel string
+	timeouts  endpointTimeouts
+}
+
+// resolveAdminStrategy returns how to reach an allocation's Envoy admin API:
+// directly over the host port Nomad mapped to target.portLabel, or else
+// through the exec strategy probed in its tasks.
+func resolveAdminStrategy(nomadService nomad.NomadApiService, alloc nomad.AllocationInfo, target adminTarget) (*nomad.ExecStrategy, error) {
+	taskOrder := buildTaskOrder(alloc.SidecarTask, "", alloc.Tasks)
+	if target.portLabel == "" {
+		return nomad.ResolveExecStrategy(nomadService, alloc.ID, taskOrder)
+	}
+	task := ""
+	if len(taskOrder) > 0 {
+		task = taskOrder[0]
+	}
+	return nomad.DirectStrategy(alloc, target.portLabel, task)
+}
+
+// allocAdminTarget returns where to reach an allocation's Envoy admin API.
+// consul-dataplane sidecars listen on nomad.DataplaneAdminAddr and
+// nomad.DataplaneAdminPort, which replace the Connect defaults unless the
+// address or ports were set explicitly.
+func allocAdminTarget(sidecarTask string, def adminTarget, addrSet, portsSet bool) adminTarget {
+	if !nomad.IsDataplaneTask(sidecarTask) {
+		return def
+	}
+	target := def
+	if !addrSet {
+		target.addr = nomad.DataplaneAdminAddr
+	}
+	if !portsSet {
+		target.ports = []int{nomad.DataplaneAdminPort}
+	}
+	return target
+}
+
+// adminPort returns the Envoy admin port this config talks to.
+func (c SnapshotConfig) adminPort() int {
+	if c.AdminPort == 0 {
+		return nomad.EnvoyAdminPort
+	}
+	return c.AdminPort
+}
+
+// adminPorts returns every Envoy admin port to capture from. It is the
+// single adminPort unless AdminPorts lists more.
+func (c SnapshotConfig) adminPorts() []int {
+	if len(c.AdminPorts) == 0 {
+		return []int{c.adminPort()}
+	}
+	return c.AdminPorts
+}
+
+// adminPortDir returns where captures from port are staged. With a single
+// port the layout is unchanged; with several each port gets its own
+// port_<n> subdirectory.
+func adminPortDir(tempDir string, port int, multi bool) string {
+	if !multi {
+		return tempDir
+	}
+	return filepath.Join(tempDir, fmt.Sprintf("port_%d", port))
+}
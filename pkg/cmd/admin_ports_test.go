@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestValidateAdminPorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		ports   []int
+		wantErr bool
+	}{
+		{"default", []int{19001}, false},
+		{"several", []int{19001, 19002}, false},
+		{"zero", []int{0}, true},
+		{"too large", []int{70000}, true},
+		{"duplicate", []int{19001, 19001}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAdminPorts(tt.ports); (err != nil) != tt.wantErr {
+				t.Errorf("validateAdminPorts(%v) error = %v, wantErr %v", tt.ports, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllocAdminTarget(t *testing.T) {
+	def := adminTarget{ports: []int{19001}}
+	tests := []struct {
+		name     string
+		sidecar  string
+		def      adminTarget
+		addrSet  bool
+		portsSet bool
+		want     adminTarget
+	}{
+		{"connect proxy", "connect-proxy-web", def, false, false, def},
+		{"dataplane defaults", "consul-dataplane", def, false, false, adminTarget{addr: "127.0.0.1", ports: []int{19000}}},
+		{"dataplane explicit port", "consul-dataplane-web", adminTarget{ports: []int{19005}}, false, true, adminTarget{addr: "127.0.0.1", ports: []int{19005}}},
+		{"dataplane explicit address", "consul-dataplane", adminTarget{addr: "10.0.0.5", ports: []int{19001}}, true, false, adminTarget{addr: "10.0.0.5", ports: []int{19000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allocAdminTarget(tt.sidecar, tt.def, tt.addrSet, tt.portsSet); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocAdminTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config SnapshotConfig
+		want   []int
+	}{
+		{"unset", SnapshotConfig{}, []int{19001}},
+		{"single", SnapshotConfig{AdminPort: 19100}, []int{19100}},
+		{"several", SnapshotConfig{AdminPorts: []int{19001, 19002}}, []int{19001, 19002}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.adminPorts()
+			if len(got) != len(tt.want) {
+				t.Fatalf("adminPorts() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("adminPorts()[%d] = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAdminPortDir(t *testing.T) {
+	if got := adminPortDir("/tmp/snap", 19001, false); got != "/tmp/snap" {
+		t.Errorf("single port dir = %q, want /tmp/snap", got)
+	}
+	if got, want := adminPortDir("/tmp/snap", 19002, true), filepath.Join("/tmp/snap", "port_19002"); got != want {
+		t.Errorf("multi port dir = %q, want %q", got, want)
+	}
+}
+
+func TestResolveAdminStrategyPortLabel(t *testing.T) {
+	alloc := nomad.AllocationInfo{
+		ID:          "abcdef12-3456-7890-abcd-ef1234567890",
+		SidecarTask: "connect-proxy-web",
+		Tasks:       []string{"connect-proxy-web", "web"},
+		Ports:       map[string]string{"envoy_admin": "10.0.0.5:24567"},
+	}
+	// No exec probing happens with a port label, so no Nomad service is needed
+	strategy, err := resolveAdminStrategy(nil, alloc, adminTarget{portLabel: "envoy_admin"})
+	if err != nil {
+		t.Fatalf("resolveAdminStrategy() error = %v", err)
+	}
+	want := &nomad.ExecStrategy{Task: "connect-proxy-web", Method: nomad.MethodDirect, HostPort: "10.0.0.5:24567"}
+	if !reflect.DeepEqual(strategy, want) {
+		t.Errorf("resolveAdminStrategy() = %+v, want %+v", strategy, want)
+	}
+	if _, err := resolveAdminStrategy(nil, alloc, adminTarget{portLabel: "admin"}); err == nil {
+		t.Error("resolveAdminStrategy() with an unmapped label succeeded")
+	}
+}
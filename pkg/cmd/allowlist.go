@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// allowedEndpointsKey is the config file key listing the only Envoy admin
+// endpoints capture may request.
+const allowedEndpointsKey = "allowed-endpoints"
+
+// endpointAllowlist restricts the Envoy admin endpoints capture requests. An
+// entry without a query allows its path with any query string, an entry
+// with one only that exact endpoint. A nil list allows every endpoint.
+type endpointAllowlist []string
+
+// loadEndpointAllowlist reads allowed-endpoints from the loaded config files.
+func loadEndpointAllowlist() (endpointAllowlist, error) {
+	if !viper.IsSet(allowedEndpointsKey) {
+		return nil, nil
+	}
+	list := viper.GetStringSlice(allowedEndpointsKey)
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s in config file is empty; remove it to allow every endpoint", allowedEndpointsKey)
+	}
+	for _, entry := range list {
+		if !strings.HasPrefix(entry, "/") {
+			return nil, fmt.Errorf("%s entry %q must start with /", allowedEndpointsKey, entry)
+		}
+	}
+	return endpointAllowlist(list), nil
+}
+
+func (a endpointAllowlist) allows(endpoint string) bool {
+	if a == nil {
+		return true
+	}
+	path, _, _ := strings.Cut(endpoint, "?")
+	for _, entry := range a {
+		if entry == endpoint || (!strings.Contains(entry, "?") && entry == path) {
+			return true
+		}
+	}
+	return false
+}
+
+// errNotAllowed is returned for an admin request the allowlist rejects.
+var errNotAllowed = errors.New("not permitted by " + allowedEndpointsKey)
+
+// permit returns an error wrapping errNotAllowed unless endpoint is allowed.
+func (a endpointAllowlist) permit(endpoint string) error {
+	if a.allows(endpoint) {
+		return nil
+	}
+	return fmt.Errorf("%s %w", endpoint, errNotAllowed)
+}
+
+// requiredBy returns an error when flag needs admin paths the allowlist
+// rejects, so it can be refused before anything is contacted.
+func (a endpointAllowlist) requiredBy(flag string, paths ...string) error {
+	var rejected []string
+	for _, p := range paths {
+		if !a.allows(p) {
+			rejected = append(rejected, p)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s reads %s, which %s does not permit", flag, strings.Join(rejected, " and "), allowedEndpointsKey)
+}
+
+// check returns an error naming every endpoint the allowlist rejects.
+func (a endpointAllowlist) check(endpoints []string) error {
+	var rejected []string
+	for _, endpoint := range endpoints {
+		if !a.allows(endpoint) && !containsString(rejected, endpoint) {
+			rejected = append(rejected, endpoint)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s not permitted by %s in the config file (allowed: %s)",
+		strings.Join(rejected, ", "), allowedEndpointsKey, strings.Join(a, ", "))
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadEndpointAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    endpointAllowlist
+		wantErr bool
+	}{
+		{name: "unset allows everything"},
+		{name: "list", value: []string{"/stats", "/config_dump"}, want: endpointAllowlist{"/stats", "/config_dump"}},
+		{name: "empty", value: []string{}, wantErr: true},
+		{name: "not a path", value: []string{"stats"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer viper.Reset()
+			if tt.value != nil {
+				viper.Set(allowedEndpointsKey, tt.value)
+			}
+			got, err := loadEndpointAllowlist()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadEndpointAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || (got == nil) != (tt.want == nil) {
+				t.Errorf("loadEndpointAllowlist() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointAllowlistAllows(t *testing.T) {
+	allowlist := endpointAllowlist{"/stats", "/config_dump?include_eds", "/clusters"}
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"/stats", true},
+		{"/stats?filter=cluster.api", true},
+		{"/config_dump?include_eds", true},
+		{"/config_dump", false},
+		{"/config_dump?resource=dynamic_active_clusters", false},
+		{"/quitquitquit", false},
+		{"/drain_listeners?graceful", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.allows(tt.endpoint); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+	if !endpointAllowlist(nil).allows("/quitquitquit") {
+		t.Error("a nil allowlist rejected an endpoint")
+	}
+}
+
+func TestEndpointAllowlistCheck(t *testing.T) {
+	allowlist := endpointAllowlist{"/stats", "/clusters"}
+	if err := allowlist.check([]string{"/stats?usedonly", "/clusters"}); err != nil {
+		t.Errorf("check() of allowed endpoints: %v", err)
+	}
+	err := allowlist.check([]string{"/stats", "/quitquitquit", "/drain_listeners", "/quitquitquit"})
+	if err == nil {
+		t.Fatal("check() accepted /quitquitquit")
+	}
+	want := "/quitquitquit, /drain_listeners not permitted by allowed-endpoints in the config file (allowed: /stats, /clusters)"
+	if err.Error() != want {
+		t.Errorf("check() = %q, want %q", err, want)
+	}
+}
+
+func TestEndpointAllowlistRequiredBy(t *testing.T) {
+	allowlist := endpointAllowlist{"/stats", "/config_dump?include_eds"}
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"allowed", []string{"/stats"}, ""},
+		{"query-only entry", []string{"/stats", "/config_dump"}, "--focus-cluster reads /config_dump, which allowed-endpoints does not permit"},
+		{"several", []string{"/clusters", "/config_dump"}, "--focus-cluster reads /clusters and /config_dump, which allowed-endpoints does not permit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := allowlist.requiredBy("--focus-cluster", tt.paths...)
+			if got := fmt.Sprint(err); (err == nil) != (tt.want == "") || (err != nil && got != tt.want) {
+				t.Errorf("requiredBy() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if err := endpointAllowlist(nil).requiredBy("--dns", "/config_dump"); err != nil {
+		t.Errorf("nil allowlist requiredBy() = %v", err)
+	}
+}
+
+func TestAdminRequestsRespectAllowlist(t *testing.T) {
+	svc := &probeService{responses: map[string]string{
+		"/server_info":         `{"version":"abc/1.27.2/Clean/RELEASE/BoringSSL","hot_restart_version":"11.104"}`,
+		"/hot_restart_version": "11.200",
+	}}
+	config := SnapshotConfig{AllocID: "abcdef12-3456", Allowlist: endpointAllowlist{"/server_info"}}
+
+	if _, err := fetchEnvoyEndpoint(svc, config, "/config_dump"); !errors.Is(err, errNotAllowed) {
+		t.Errorf("fetchEnvoyEndpoint(/config_dump) error = %v, want errNotAllowed", err)
+	}
+	if err := setEnvoyLogLevel(svc, config, "debug"); !errors.Is(err, errNotAllowed) {
+		t.Errorf("setEnvoyLogLevel() error = %v, want errNotAllowed", err)
+	}
+	// The refused /hot_restart_version falls back to /server_info's field
+	info, err := captureRestartInfo(svc, config, filepath.Join(t.TempDir(), "hot_restart.txt"))
+	if err != nil || info.HotRestartVersion != "11.104" {
+		t.Errorf("captureRestartInfo() = %+v, %v; want the /server_info hot restart version", info, err)
+	}
+}
@@ -1,59 +1,366 @@
-//go:build analyze
-// +build analyze
-
 package cmd
 
 import (
-	"errors"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
-	"github.com/spf13/cobra"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
-var analyzeCmd = &cobra.Command{
-	Use:   "analyze [snapshot.tar.gz]",
-	Short: "Analyze a captured snapshot using AI or local heuristics",
-	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		path := args[0]
+// NewAnalyzeCommand creates the analyze subcommand, which summarizes the
+// captured Envoy state of an existing snapshot without contacting the cluster.
+func NewAnalyzeCommand(streams IOStreams) *cobra.Command {
+	var listener string
+	var xdsDeltaOnly bool
+	var services bool
+	var listenerStats bool
+	var outliers bool
+	var statsSinks bool
+	var xdsStatusOnly bool
+	var workers bool
 
-		serviceType, _ := cmd.Flags().GetString("service-type")
-		useAI, _ := cmd.Flags().GetBool("ai")
-		apiKey := os.Getenv("OPENAI_API_KEY")
+	analyzeCmd := &cobra.Command{
+		Use:   "analyze <snapshot>",
+		Short: "Summarize the listener filter chains of a captured snapshot",
+		Long: `Summarize each listener's filter chains from the config_dump captured in a
+snapshot: the match criteria (SNI, ALPN, transport, source and destination),
+the terminal network filter and the clusters traffic is sent to.
 
-		fmt.Printf("🔍 Analyzing snapshot: %s\n", path)
-		if useAI && apiKey == "" {
-			return errors.New("AI analysis requested but OPENAI_API_KEY is not set")
-		}
+With --xds-delta, list instead the clusters, listeners and route
+configurations the control plane delivered over xDS, separated from the
+static bootstrap, with their versions and any that are still warming.
+
+With --services, map every Envoy cluster in the captured /clusters output
+back to the Consul service it stands for, with its endpoint count and
+health.
+
+With --listener-stats, join each listener in the captured /listeners output
+with its listener.<address>.* counters from the /stats captured next to it:
+active and total downstream connections, connection errors, and TLS
+handshakes and failures.
+
+With --outliers, show the outlier-detection state of every cluster in the
+captured /clusters output: which endpoints are ejected, with their error
+and request counts and success rate, and the cluster's ejections by cause
+from /stats.
+
+With --stats-sinks, show where each proxy exports its metrics: the stats
+sinks (statsd, dogstatsd, hystrix, metrics service, OpenTelemetry) and
+Prometheus listeners of the config_dump bootstrap, with the flush interval
+and any stats matcher.
+
+With --xds-status, report whether each proxy is connected to the control
+plane over ADS and, per xDS type, its resource count, most recent update
+and the update_success, update_rejected and update_failure counters from
+the /stats captured next to the config dump.
+
+With --workers, break the captured /stats down by Envoy thread: each
+worker's active and total downstream connections and the watchdog misses of
+every thread, flagging a worker that holds far more connections than the
+others.
+
+<snapshot> is a snapshot archive (.tar.gz, .tar or .zip), a snapshot
+directory, or a config_dump file. Every config dump found is summarized.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var modes []string
+			for flag, set := range map[string]bool{"--xds-delta": xdsDeltaOnly, "--services": services, "--listener-stats": listenerStats, "--outliers": outliers, "--stats-sinks": statsSinks, "--xds-status": xdsStatusOnly, "--workers": workers} {
+				if set {
+					modes = append(modes, flag)
+				}
+			}
+			if len(modes) > 1 {
+				sort.Strings(modes)
+				return exitErrorf(ExitUsage, "%s cannot be combined", strings.Join(modes, " and "))
+			}
+			cmd.SilenceUsage = true
+			if services {
+				return analyzeServices(streams.Out, args[0])
+			}
+			if listenerStats {
+				return analyzeListenerStats(streams.Out, args[0], listener)
+			}
+			if outliers {
+				return analyzeOutliers(streams.Out, args[0])
+			}
+			if xdsStatusOnly {
+				return analyzeXDSStatus(streams.Out, args[0])
+			}
+			if workers {
+				return analyzeWorkers(streams.Out, args[0])
+			}
 
-		tempDir, err := os.MkdirTemp("", "xdsnap-analysis")
+			dumps, err := readConfigDumps(args[0])
+			if err != nil {
+				return exitErrorf(ExitNoData, "%w", err)
+			}
+			if len(dumps) == 0 {
+				return exitErrorf(ExitNoData, "no config_dump found in %s", args[0])
+			}
+			for i, dump := range dumps {
+				if i > 0 {
+					fmt.Fprintln(streams.Out)
+				}
+				fmt.Fprintf(streams.Out, "== %s ==\n", dump.name)
+				if xdsDeltaOnly {
+					delta, err := summarizeXDSDelta(dump.data)
+					if err != nil {
+						return exitErrorf(ExitNoData, "%s: %w", dump.name, err)
+					}
+					printXDSDelta(streams.Out, delta)
+					continue
+				}
+				if statsSinks {
+					cfg, err := summarizeStatsSinks(dump.data)
+					if err != nil {
+						return exitErrorf(ExitNoData, "%s: %w", dump.name, err)
+					}
+					printStatsSinks(streams.Out, cfg)
+					continue
+				}
+				listeners, err := summarizeFilterChains(dump.data, listener)
+				if err != nil {
+					return exitErrorf(ExitNoData, "%s: %w", dump.name, err)
+				}
+				if len(listeners) == 0 {
+					fmt.Fprintln(streams.Out, "no listeners")
+					continue
+				}
+				printFilterChains(streams.Out, listeners)
+			}
+			return nil
+		},
+	}
+
+	analyzeCmd.Flags().StringVar(&listener, "listener", "", "Only show listeners whose name contains this string")
+	analyzeCmd.Flags().BoolVar(&xdsDeltaOnly, "xds-delta", false, "List the clusters, listeners and routes delivered over xDS on top of the bootstrap instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&services, "services", false, "Map the captured Envoy clusters to Consul services with their endpoint count and health instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&listenerStats, "listener-stats", false, "Show each listener's address with its active connections, connection errors and TLS failures from /stats instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&outliers, "outliers", false, "Show the clusters with outlier-detection ejections and the state of their endpoints instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&statsSinks, "stats-sinks", false, "Show the stats sinks, metrics service and Prometheus listeners the proxy exports metrics to instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&xdsStatusOnly, "xds-status", false, "Show the ADS connection state and, per xDS type, the last update and rejected or failed updates instead of filter chains")
+	analyzeCmd.Flags().BoolVar(&workers, "workers", false, "Show each Envoy worker thread's connections and watchdog misses from /stats, flagging hot workers, instead of filter chains")
+	return analyzeCmd
+}
+
+// analyzeServices prints the service to cluster table for every /clusters
+// response in snapshot, using the config dump captured next to it for
+// SPIFFE IDs.
+func analyzeServices(w io.Writer, snapshot string) error {
+	clusters, err := readSnapshotFiles(snapshot, isClustersFile)
+	if err != nil {
+		return exitErrorf(ExitNoData, "%w", err)
+	}
+	if len(clusters) == 0 {
+		return exitErrorf(ExitNoData, "no /clusters output found in %s", snapshot)
+	}
+	dumps := make(map[string][]byte)
+	if !isClustersFile(snapshot) {
+		found, err := readConfigDumps(snapshot)
 		if err != nil {
-			return err
+			return exitErrorf(ExitNoData, "%w", err)
 		}
-		defer os.RemoveAll(tempDir)
-
-		if err := extractTarGz(path, tempDir); err != nil {
-			return fmt.Errorf("failed to extract snapshot: %w", err)
+		for _, d := range found {
+			dumps[path.Dir(d.name)] = d.data
+		}
+	}
+	for i, c := range clusters {
+		if i > 0 {
+			fmt.Fprintln(w)
 		}
+		fmt.Fprintf(w, "== %s ==\n", c.name)
+		rows, err := correlateClusters(c.data, dumps[path.Dir(c.name)])
+		if err != nil {
+			return exitErrorf(ExitNoData, "%s: %w", c.name, err)
+		}
+		if len(rows) == 0 {
+			fmt.Fprintln(w, "no clusters")
+			continue
+		}
+		printServiceClusters(w, rows)
+	}
+	return nil
+}
+
+// namedDump is a config dump read from a snapshot, named by its path there.
+type namedDump struct {
+	name string
+	data []byte
+}
+
+// isConfigDumpFile reports whether a snapshot entry holds a config dump,
+// in any of the formats capture writes it in.
+func isConfigDumpFile(name string) bool {
+	switch path.Base(filepath.ToSlash(name)) {
+	case "config_dump.json", "config_dump.json.gz", "config_dump.yaml", "config_dump.yaml.gz":
+		return true
+	}
+	return false
+}
+
+// isClustersFile reports whether a snapshot entry holds a /clusters response.
+func isClustersFile(name string) bool {
+	switch path.Base(filepath.ToSlash(name)) {
+	case "clusters.json", "clusters.json.gz", "clusters.yaml", "clusters.yaml.gz":
+		return true
+	}
+	return false
+}
+
+// readConfigDumps returns every config dump in a snapshot archive, snapshot
+// directory or single config dump file, as JSON.
+func readConfigDumps(snapshot string) ([]namedDump, error) {
+	return readSnapshotFiles(snapshot, isConfigDumpFile)
+}
 
-		logPath := filepath.Join(tempDir, "consul-dataplane-logs.txt")
-		logs, err := os.ReadFile(logPath)
+// readSnapshotFiles returns every entry of a snapshot archive or directory
+// for which match is true, or snapshot itself when it is such a file,
+// decoded like a config dump.
+func readSnapshotFiles(snapshot string, match func(string) bool) ([]namedDump, error) {
+	fi, err := os.Stat(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var dumps []namedDump
+	add := func(name string, r io.Reader) error {
+		data, err := decodeConfigDump(name, r)
 		if err != nil {
-			return fmt.Errorf("failed to read logs: %w", err)
+			return fmt.Errorf("failed to read %s: %w", name, err)
 		}
+		dumps = append(dumps, namedDump{name: name, data: data})
+		return nil
+	}
 
-		prompt := buildPrompt(string(logs), serviceType)
-		if useAI {
-			resp, err := callOpenAI(prompt, apiKey)
+	switch {
+	case fi.IsDir():
+		err = filepath.Walk(snapshot, func(file string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.Mode().IsRegular() || !match(file) {
+				return err
+			}
+			rel, err := filepath.Rel(snapshot, file)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(file)
 			if err != nil {
 				return err
 			}
-			fmt.Println("\n🤖 AI Summary:\n" + resp)
-		} else {
-			fmt.Println("🧠 Local analysis not yet implemented. Use --ai for OpenAI-based insight.")
+			defer f.Close()
+			return add(filepath.ToSlash(rel), f)
+		})
+	case match(snapshot):
+		var f *os.File
+		if f, err = os.Open(snapshot); err == nil {
+			defer f.Close()
+			err = add(filepath.Base(snapshot), f)
 		}
+	case strings.HasSuffix(snapshot, ".zip"):
+		err = readZipFiles(snapshot, match, add)
+	case strings.HasSuffix(snapshot, ".tar.gz"), strings.HasSuffix(snapshot, ".tgz"), strings.HasSuffix(snapshot, ".tar"):
+		err = readTarFiles(snapshot, match, add)
+	default:
+		return nil, fmt.Errorf("%s is not a snapshot archive, directory or config dump", snapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].name < dumps[j].name })
+	return dumps, nil
+}
 
-		return nil
-	},
+func readTarFiles(archive string, match func(string) bool, add func(string, io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(archive, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && match(header.Name) {
+			if err := add(header.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readZipFiles(archive string, match func(string) bool, add func(string, io.Reader) error) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !match(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = add(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeConfigDump reads a config dump or /clusters response saved by
+// capture, undoing --gzip-files-over compression and --config-format yaml
+// conversion.
+func decodeConfigDump(name string, r io.Reader) ([]byte, error) {
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || !strings.HasSuffix(name, ".yaml") {
+		return data, err
+	}
+	return yamlToJSON(data)
+}
+
+// yamlToJSON reverses jsonToYAML.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigDumps(t *testing.T) {
+	staged := t.TempDir()
+	writeTree(t, staged, map[string]string{
+		"abcdef12/config_dump.json":   `{"configs":[]}`,
+		"abcdef12/stats.json":         "stats",
+		"port_19002/config_dump.yaml": "configs: []\n",
+	})
+	if err := gzipLargeFiles(filepath.Join(staged, "abcdef12"), 4); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "abcdef12_snapshot.tar.gz")
+	sink, err := newTarGzFileSink(archive, "", false)
+	bundleStaged(t, sink, err, staged)
+
+	for _, snapshot := range []string{staged, archive} {
+		t.Run(filepath.Base(snapshot), func(t *testing.T) {
+			dumps, err := readConfigDumps(snapshot)
+			if err != nil {
+				t.Fatalf("readConfigDumps() error: %v", err)
+			}
+			if len(dumps) != 2 {
+				t.Fatalf("readConfigDumps() = %d dumps, want 2", len(dumps))
+			}
+			for _, d := range dumps {
+				var v struct {
+					Configs []json.RawMessage `json:"configs"`
+				}
+				if err := json.Unmarshal(d.data, &v); err != nil || v.Configs == nil {
+					t.Errorf("%s: not decoded to JSON: %q (%v)", d.name, d.data, err)
+				}
+			}
+		})
+	}
+
+	if _, err := readConfigDumps(filepath.Join(staged, "abcdef12", "stats.json.gz")); err == nil {
+		t.Error("readConfigDumps() accepted a file that is not a config dump")
+	}
+}
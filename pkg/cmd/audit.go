@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// Version is the xdsnap release, set at build time with
+// -ldflags "-X github.com/markcampv/xDSnap/pkg/cmd.Version=<version>".
+var Version = "dev"
+
+// RunIDHeader carries the ID of the xdsnap run on every Envoy admin
+// request. Envoy's default access log format includes it.
+const RunIDHeader = "X-Request-Id"
+
+// newRunID returns a random ID for one xdsnap run, e.g.
+// xdsnap-3f9a0c1d2b4e5f60.
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("xdsnap-%x", time.Now().UnixNano())
+	}
+	return "xdsnap-" + hex.EncodeToString(b)
+}
+
+// auditHeaders identify xdsnap and the run to the proxy, so admin requests
+// in its access log can be traced back to the run that made them.
+func auditHeaders(runID string) []nomad.Header {
+	return []nomad.Header{
+		{Name: "User-Agent", Value: "xDSnap/" + Version},
+		{Name: RunIDHeader, Value: runID},
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestNewRunID(t *testing.T) {
+	a, b := newRunID(), newRunID()
+	if !regexp.MustCompile(`^xdsnap-[0-9a-f]{16}$`).MatchString(a) {
+		t.Errorf("newRunID() = %q", a)
+	}
+	if a == b {
+		t.Errorf("newRunID() returned %q twice", a)
+	}
+}
+
+func TestAuditHeaders(t *testing.T) {
+	got := auditHeaders("xdsnap-0123456789abcdef")
+	want := []nomad.Header{
+		{Name: "User-Agent", Value: "xDSnap/dev"},
+		{Name: "X-Request-Id", Value: "xdsnap-0123456789abcdef"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("auditHeaders() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package cmd
+
+// failureBreaker trips after a run of consecutive allocation failures so a
+// struggling cluster isn't hammered with captures that are bound to fail.
+// A threshold of zero disables the breaker.
+type failureBreaker struct {
+	threshold   int
+	consecutive int
+	lastErr     error
+}
+
+// success resets the consecutive failure count.
+func (b *failureBreaker) success() {
+	b.consecutive = 0
+	b.lastErr = nil
+}
+
+// failure records a failed allocation and reports whether the breaker tripped.
+func (b *failureBreaker) failure(err error) bool {
+	b.consecutive++
+	b.lastErr = err
+	return b.tripped()
+}
+
+func (b *failureBreaker) tripped() bool {
+	return b.threshold > 0 && b.consecutive >= b.threshold
+}
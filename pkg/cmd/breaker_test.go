@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFailureBreaker(t *testing.T) {
+	errFail := errors.New("exec failed")
+
+	b := &failureBreaker{threshold: 3}
+	if b.failure(errFail) || b.failure(errFail) {
+		t.Fatal("breaker tripped before reaching threshold")
+	}
+	b.success()
+	if b.failure(errFail) || b.failure(errFail) {
+		t.Fatal("success did not reset the consecutive count")
+	}
+	if !b.failure(errFail) {
+		t.Fatal("breaker did not trip at threshold")
+	}
+	if b.lastErr != errFail {
+		t.Errorf("lastErr = %v, want %v", b.lastErr, errFail)
+	}
+
+	disabled := &failureBreaker{threshold: 0}
+	for i := 0; i < 10; i++ {
+		if disabled.failure(errFail) {
+			t.Fatal("breaker with zero threshold should never trip")
+		}
+	}
+}
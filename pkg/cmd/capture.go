@@ -1,23 +1,35 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/markcampv/xDSnap/consul"
 	"github.com/markcampv/xDSnap/nomad"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// minInterval is the shortest --sleep between captures.
+const minInterval = 5
+
 func NewCaptureCommand(streams IOStreams) *cobra.Command {
-	var allocID, taskName, namespace, serviceName string
-	var endpoints []string
-	var outputDir string
-	var interval, duration, repeat int
-	var enableTrace, tcpdumpEnabled bool
+	var allocID, allocFile, resumeFile, taskName, namespace, region, profile, adminAuth, adminPathPrefix, adminAddr, adminPortLabel, minEnvoyVersion, nomadTokenVault, consulTokenVault, consulFilter, discoverySource, nodeClass string
+	var endpoints, extraEndpoints, focusClusters, focusListeners, nodeMeta, jobMetaFlags, endpointTimeoutFlags, webhookHeaders []string
+	var outputDir, tempDir, archiveInto, watchStatName, maxLogBytes, tcpdumpMaxSize, tcpdumpInterface, logKeep, outputFormat, configFormat, logGrep, gzipOver, webhookURL string
+	var watchInterval, watchDuration, apiTimeout, discoveryTimeout time.Duration
+	var interval, duration, repeat, maxFailures, memoryWarnMB, logContext, tcpdumpFiles int
+	var adminPorts []int
+	var serviceNames []string
+	var enableTrace, tcpdumpEnabled, preserveMetadata, logsOnly, untilHealthy, sidecarEnv, withUpstreams, noLogLevelChange, envoyVersionGate, minEnvoyVersionWarn, nodeInfo, resourceStats, allowDestructive, preflight, listeningSockets, mergeStderr, compressLogs, latestLink, timings, adminIndex, allEndpoints, tailLogs, captureDNSState, trustBundle, deploymentInfo, dedup bool
 
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -38,44 +50,379 @@ This tool discovers Consul Connect allocations and captures:
 Environment variables:
   NOMAD_ADDR         Nomad API address (default: http://127.0.0.1:4646)
   NOMAD_TOKEN        Nomad ACL token (optional)
+  NOMAD_REGION       Nomad region (default: the agent's region)
   CONSUL_HTTP_ADDR   Consul API address (default: http://127.0.0.1:8500)
-  CONSUL_HTTP_TOKEN  Consul ACL token (optional)`,
-		Run: func(cmd *cobra.Command, args []string) {
+  CONSUL_HTTP_TOKEN  Consul ACL token (optional)
+  VAULT_ADDR         Vault address for --nomad-token-vault/--consul-token-vault
+  VAULT_TOKEN        Vault token (default: ~/.vault-token)`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Flags parsed fine; further errors are not usage mistakes
+			cmd.SilenceUsage = true
+
+			var err error
+			// --namespace wins over NOMAD_NAMESPACE (bound via viper below); an
+			// empty namespace or "*" captures from every namespace
+			namespace = viper.GetString("namespace")
+
+			serviceNames = normalizeServiceNames(serviceNames)
+			if withUpstreams && len(serviceNames) == 0 {
+				return exitErrorf(ExitUsage, "--with-upstreams requires --service")
+			}
+			if !containsString(nomad.DiscoverySources, discoverySource) {
+				return exitErrorf(ExitUsage, "--discovery-source must be one of %s", strings.Join(nomad.DiscoverySources, ", "))
+			}
+			if discoverySource == nomad.DiscoveryNomad && (consulFilter != "" || withUpstreams) {
+				// Both are answered by the Consul catalog
+				return exitErrorf(ExitUsage, "--discovery-source nomad cannot be combined with --consul-filter or --with-upstreams")
+			}
+
+			nodes := nodeFilter{class: nodeClass}
+			if nodes.meta, err = parseMeta("--node-meta", nodeMeta); err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+			jobMeta, err := parseMeta("--job-meta", jobMetaFlags)
+			if err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+
+			if err := validateAdminPorts(adminPorts); err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+			if len(adminPorts) == 0 {
+				adminPorts = []int{nomad.EnvoyAdminPort}
+			}
+
+			if preflight && logsOnly {
+				return exitErrorf(ExitUsage, "--preflight checks Envoy admin access and cannot be combined with --logs-only")
+			}
+
+			if !containsString(OutputFormats, outputFormat) {
+				return exitErrorf(ExitUsage, "--output-format must be one of %s", strings.Join(OutputFormats, ", "))
+			}
+			if !containsString(ConfigFormats, configFormat) {
+				return exitErrorf(ExitUsage, "--config-format must be one of %s", strings.Join(ConfigFormats, ", "))
+			}
+			gzipOverBytes, err := parseByteSize(gzipOver)
+			if err != nil {
+				return exitErrorf(ExitUsage, "invalid --gzip-files-over: %w", err)
+			}
+			if gzipOverBytes > 0 && outputFormat != FormatTar && outputFormat != FormatDir {
+				// Compressing entries inside a tar.gz or zip only costs CPU
+				return exitErrorf(ExitUsage, "--gzip-files-over requires --output-format %s or %s", FormatTar, FormatDir)
+			}
+			var hook *webhook
+			if webhookURL != "" {
+				if outputFormat == FormatDir || outputFormat == FormatStdout || archiveInto != "" {
+					return exitErrorf(ExitUsage, "--webhook uploads per-capture archives and can't be combined with --output-format %s, %s or --archive-into", FormatDir, FormatStdout)
+				}
+				if hook, err = newWebhook(webhookURL, webhookHeaders); err != nil {
+					return exitErrorf(ExitUsage, "--webhook: %w", err)
+				}
+			}
+			if archiveInto != "" && outputFormat != FormatTarGz {
+				return exitErrorf(ExitUsage, "--archive-into only supports --output-format %s", FormatTarGz)
+			}
+			if latestLink && (outputFormat == FormatStdout || archiveInto != "") {
+				return exitErrorf(ExitUsage, "--latest-link needs per-run snapshot directories and can't be combined with --output-format %s or --archive-into", FormatStdout)
+			}
+			if untilHealthy && outputFormat == FormatStdout {
+				return exitErrorf(ExitUsage, "--until-healthy cannot be combined with --output-format %s", FormatStdout)
+			}
+			if outputFormat == FormatFlat && (latestLink || untilHealthy || webhookURL != "" || dedup) {
+				// Flat output has no per-run directory to link to, prune,
+				// upload or point unchanged markers at
+				return exitErrorf(ExitUsage, "--output-format %s writes into --output-dir directly and can't be combined with --latest-link, --until-healthy, --webhook or --dedup", FormatFlat)
+			}
+
+			// With stdout output the archive owns stdout, so reports and
+			// progress go to stderr
+			report := streams.Out
+			var progress io.Writer
+			if outputFormat == FormatStdout {
+				report, progress = streams.ErrOut, streams.ErrOut
+			}
+			var tail *lineMux
+			if tailLogs {
+				tail = &lineMux{w: report}
+			}
+
+			// The sleep only matters between captures, so a single capture
+			// accepts any value
+			if interval < minInterval && repeat != 1 {
+				log.Printf("WARNING: --sleep %ds is below the %ds minimum, using %ds", interval, minInterval, minInterval)
+				interval = minInterval
+			}
+
+			if watchStatName != "" && watchInterval <= 0 {
+				return exitErrorf(ExitUsage, "--watch-interval must be positive")
+			}
+
+			if untilHealthy {
+				if repeat <= 0 {
+					return exitErrorf(ExitUsage, "--until-healthy requires --repeat to bound the number of captures")
+				}
+				if logsOnly || archiveInto != "" {
+					return exitErrorf(ExitUsage, "--until-healthy cannot be combined with --logs-only or --archive-into")
+				}
+				if dedup {
+					// Pruned captures may hold the full copies markers refer to
+					return exitErrorf(ExitUsage, "--dedup cannot be combined with --until-healthy")
+				}
+			}
+
+			rotation := tcpdumpRotation{files: tcpdumpFiles}
+			if rotation.maxBytes, err = parseByteSize(tcpdumpMaxSize); err != nil {
+				return exitErrorf(ExitUsage, "invalid --tcpdump-max-size: %w", err)
+			}
+			if (rotation.maxBytes > 0 || cmd.Flags().Changed("tcpdump-files")) && !tcpdumpEnabled {
+				return exitErrorf(ExitUsage, "--tcpdump-max-size and --tcpdump-files require --tcpdump")
+			}
+			if cmd.Flags().Changed("tcpdump-files") && rotation.maxBytes == 0 {
+				return exitErrorf(ExitUsage, "--tcpdump-files requires --tcpdump-max-size")
+			}
+			if cmd.Flags().Changed("tcpdump-interface") && !tcpdumpEnabled {
+				return exitErrorf(ExitUsage, "--tcpdump-interface requires --tcpdump")
+			}
+			if !tcpdumpInterfaceName.MatchString(tcpdumpInterface) {
+				return exitErrorf(ExitUsage, "invalid --tcpdump-interface %q: expected an interface name such as eth0 or any", tcpdumpInterface)
+			}
+			if tcpdumpFiles < 1 {
+				return exitErrorf(ExitUsage, "--tcpdump-files must be at least 1")
+			}
+
+			limit := logLimit{keep: logKeep}
+			if limit.maxBytes, err = parseByteSize(maxLogBytes); err != nil {
+				return exitErrorf(ExitUsage, "invalid --max-log-bytes: %w", err)
+			}
+			if logKeep != LogKeepHead && logKeep != LogKeepTail {
+				return exitErrorf(ExitUsage, "--log-keep must be %q or %q", LogKeepHead, LogKeepTail)
+			}
+
+			filter := logFilter{context: logContext}
+			if logGrep != "" {
+				if filter.pattern, err = regexp.Compile(logGrep); err != nil {
+					return exitErrorf(ExitUsage, "invalid --log-grep: %w", err)
+				}
+			}
+			if logContext < 0 {
+				return exitErrorf(ExitUsage, "--log-context must not be negative")
+			}
+
+			if outputDir, err = expandEnv(outputDir); err != nil {
+				return exitErrorf(ExitUsage, "invalid --output-dir: %w", err)
+			}
+			if archiveInto, err = expandEnv(archiveInto); err != nil {
+				return exitErrorf(ExitUsage, "invalid --archive-into: %w", err)
+			}
+			if tempDir != "" {
+				if tempDir, err = expandEnv(tempDir); err != nil {
+					return exitErrorf(ExitUsage, "invalid --temp-dir: %w", err)
+				}
+				if info, err := os.Stat(tempDir); err != nil {
+					return exitErrorf(ExitUsage, "invalid --temp-dir: %w", err)
+				} else if !info.IsDir() {
+					return exitErrorf(ExitUsage, "invalid --temp-dir: %s is not a directory", tempDir)
+				}
+			}
+
+			if len(endpoints) == 0 {
+				resolved, err := resolveProfile(profile)
+				if err != nil {
+					return exitErrorf(ExitUsage, "%w", err)
+				}
+				endpoints = append([]string(nil), resolved...)
+			}
+			endpoints = appendEndpoints(endpoints, extraEndpoints)
+			for i, endpoint := range endpoints {
+				if endpoints[i], err = expandEnv(endpoint); err != nil {
+					return exitErrorf(ExitUsage, "invalid endpoint: %w", err)
+				}
+			}
+			allowlist, err := loadEndpointAllowlist()
+			if err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+			if !logsOnly {
+				if err := allowlist.check(endpoints); err != nil {
+					return exitErrorf(ExitUsage, "%w", err)
+				}
+				if !noLogLevelChange && !allowlist.allows("/logging") {
+					return exitErrorf(ExitUsage, "capture raises the Envoy log level through /logging, which %s does not permit; add it or pass --no-log-level-change", allowedEndpointsKey)
+				}
+				if destructive := destructiveRequests(endpoints); len(destructive) > 0 {
+					if !allowDestructive {
+						return exitErrorf(ExitUsage, "refusing to request destructive Envoy admin endpoints: %s; pass --allow-destructive if this is intended", strings.Join(destructive, ", "))
+					}
+					for _, d := range destructive {
+						log.Printf("WARNING: --allow-destructive: requesting %s on every captured proxy", d)
+					}
+				}
+			}
+			if allEndpoints && logsOnly {
+				return exitErrorf(ExitUsage, "--all-endpoints cannot be combined with --logs-only")
+			}
+			if trustBundle && logsOnly {
+				return exitErrorf(ExitUsage, "--trust-bundle cannot be combined with --logs-only")
+			}
+			// Lookups made on behalf of a flag rather than for --endpoints
+			for _, need := range []struct {
+				set   bool
+				flag  string
+				paths []string
+			}{
+				{trustBundle, "--trust-bundle", []string{"/config_dump"}},
+				{watchStatName != "", "--watch-stat", []string{"/stats"}},
+				{captureDNSState, "--dns", []string{"/config_dump"}},
+				{len(focusClusters) > 0, "--focus-cluster", []string{"/stats", "/clusters", "/config_dump"}},
+				{len(focusListeners) > 0, "--focus-listener", []string{"/stats", "/listeners", "/config_dump"}},
+				{envoyVersionGate, "--envoy-version-gate", []string{"/server_info"}},
+				{minEnvoyVersion != "", "--min-envoy-version", []string{"/server_info"}},
+				{untilHealthy, "--until-healthy", []string{"/ready"}},
+				{preflight, "--preflight", []string{"/ready"}},
+				{adminIndex, "--admin-index", []string{"/"}},
+				{allEndpoints, "--all-endpoints", []string{"/"}},
+			} {
+				if !need.set {
+					continue
+				}
+				if err := allowlist.requiredBy(need.flag, need.paths...); err != nil {
+					return exitErrorf(ExitUsage, "%w", err)
+				}
+			}
+
+			runID := newRunID()
+			adminHeaders := auditHeaders(runID)
+			if adminAuth != "" {
+				header, err := nomad.ParseAdminAuth(adminAuth)
+				if err != nil {
+					return exitErrorf(ExitUsage, "%w", err)
+				}
+				adminHeaders = append(adminHeaders, header)
+			}
+			if err := nomad.ValidatePathPrefix(adminPathPrefix); err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+			if err := nomad.ValidateAdminAddr(adminAddr); err != nil {
+				return exitErrorf(ExitUsage, "%w", err)
+			}
+			for _, ref := range [][2]string{{"--nomad-token-vault", nomadTokenVault}, {"--consul-token-vault", consulTokenVault}} {
+				if ref[1] == "" {
+					continue
+				}
+				if _, err := parseVaultRef(ref[1]); err != nil {
+					return exitErrorf(ExitUsage, "%s: %w", ref[0], err)
+				}
+			}
+			timeouts, err := parseEndpointTimeouts(endpointTimeoutFlags)
+			if err != nil {
+				return exitErrorf(ExitUsage, "--endpoint-timeout: %w", err)
+			}
+			var minVersion envoyVersion
+			if minEnvoyVersion != "" {
+				if minVersion, err = parseEnvoyVersion(minEnvoyVersion); err != nil {
+					return exitErrorf(ExitUsage, "--min-envoy-version: %w", err)
+				}
+			}
+			if adminPortLabel != "" && (cmd.Flags().Changed("envoy-admin-ip") || cmd.Flags().Changed("envoy-admin-port")) {
+				return exitErrorf(ExitUsage, "--admin-port-label can't be combined with --envoy-admin-ip or --envoy-admin-port; the port label decides where the admin API is reached")
+			}
+
+			if err := loadVaultTokens(nomadTokenVault, consulTokenVault, apiTimeout); err != nil {
+				return exitErrorf(ExitConnectivity, "failed to read tokens from Vault: %w", err)
+			}
+
 			// Create Nomad API service
-			nomadService, err := nomad.NewNomadApiServiceFromEnv(namespace)
+			nomadService, err := nomad.NewNomadApiServiceFromEnv(namespace, region, discoverySource, apiTimeout, consul.DiscoveryOptions{
+				Timeout: discoveryTimeout,
+				Filter:  consulFilter,
+			})
 			if err != nil {
-				log.Fatalf("Error creating Nomad client: %v", err)
+				return exitErrorf(ExitConnectivity, "failed to create Nomad client: %w", err)
+			}
+
+			log.Printf("xDSnap %s run %s: Envoy admin requests carry %s: %s", Version, runID, RunIDHeader, runID)
+
+			var runTimings *captureTimings
+			if timings {
+				runTimings = &captureTimings{}
 			}
+			stopDiscovery := runTimings.start("", "discovery")
 
 			// Determine which allocations to capture
 			var allocsToCapture []nomad.AllocationInfo
-
-			if allocID != "" {
+			var allocServices map[string]string // service each allocation was discovered under
+			skips := newSkipReport()
+
+			if allocFile != "" || resumeFile != "" {
+				// Precomputed list of allocations, or the failures of an
+				// earlier run
+				source := allocFile
+				var ids []string
+				if resumeFile != "" {
+					source = resumeFile
+					if ids, err = readFailedAllocIDs(resumeFile); err != nil {
+						return exitErrorf(ExitUsage, "failed to read --resume file: %w", err)
+					}
+					if len(ids) == 0 {
+						return exitErrorf(ExitNoData, "%s lists no failed allocations", resumeFile)
+					}
+					log.Printf("Resuming %d allocation(s) listed in %s", len(ids), resumeFile)
+				} else if ids, err = readAllocIDs(allocFile); err != nil {
+					return exitErrorf(ExitUsage, "failed to read allocation file: %w", err)
+				}
+				for _, id := range ids {
+					allocInfo, err := nomadService.GetAllocation(id)
+					if err != nil {
+						log.Printf("WARNING: skipping allocation %s from %s: %v", id, source, err)
+						skips.add(id, SkipLookupFailed, err.Error())
+						continue
+					}
+					allocsToCapture = append(allocsToCapture, *allocInfo)
+				}
+			} else if allocID != "" {
 				// Single allocation specified
 				allocInfo, err := nomadService.GetAllocation(allocID)
 				if err != nil {
-					log.Fatalf("Error getting allocation %s: %v", allocID, err)
+					return apiErrorf(err, "failed to get allocation %s", allocID)
 				}
 				allocsToCapture = append(allocsToCapture, *allocInfo)
-			} else if serviceName != "" {
-				// Discover by service name
-				allocs, err := nomadService.FindConnectAllocationsByService(namespace, serviceName)
-				if err != nil {
-					log.Fatalf("Error discovering allocations for service %s: %v", serviceName, err)
+			} else if len(serviceNames) > 0 {
+				// Discover by service name, capturing every service in one run
+				if allocsToCapture, allocServices, err = discoverServices(nomadService, namespace, serviceNames, withUpstreams); err != nil {
+					return err
 				}
-				allocsToCapture = allocs
 			} else {
 				// Discover all Connect allocations
 				allocs, err := nomadService.FindConnectAllocations(namespace)
 				if err != nil {
-					log.Fatalf("Error discovering Connect allocations: %v", err)
+					return apiErrorf(err, "failed to discover Connect allocations")
 				}
 				allocsToCapture = allocs
 			}
 
+			// Drop allocations that can't be captured, recording why
+			var eligible []nomad.AllocationInfo
+			for _, alloc := range allocsToCapture {
+				if reason, detail, skip := classifySkip(alloc, namespace); skip {
+					log.Printf("Skipping allocation %s: %s", alloc.ID[:8], reason)
+					skips.add(alloc.ID, reason, detail)
+					continue
+				}
+				eligible = append(eligible, alloc)
+			}
+			allocsToCapture = eligible
+
+			if len(jobMeta) > 0 {
+				allocsToCapture = filterByJobMeta(allocsToCapture, jobMeta, skips)
+			}
+			if nodes.active() {
+				allocsToCapture = filterByNode(nomadService, allocsToCapture, nodes, skips)
+			}
+
+			stopDiscovery()
 			if len(allocsToCapture) == 0 {
-				log.Println("No Consul Connect allocations found")
-				return
+				skips.print(report)
+				return exitErrorf(ExitNoData, "no Consul Connect allocations found")
 			}
 
 			log.Printf("Found %d allocation(s) to capture", len(allocsToCapture))
@@ -83,28 +430,126 @@ Environment variables:
 				log.Printf("  - %s (job: %s, group: %s, sidecar: %s)", alloc.ID[:8], alloc.JobID, alloc.TaskGroup, alloc.SidecarTask)
 			}
 
-			if interval < 5 {
-				log.Fatalf("Interval must be at least 5 seconds")
+			targets := make(map[string]adminTarget, len(allocsToCapture))
+			defaultTarget := adminTarget{addr: adminAddr, ports: adminPorts, portLabel: adminPortLabel, timeouts: timeouts}
+			for _, alloc := range allocsToCapture {
+				target := allocAdminTarget(alloc.SidecarTask, defaultTarget,
+					cmd.Flags().Changed("envoy-admin-ip"), cmd.Flags().Changed("envoy-admin-port"))
+				if nomad.IsDataplaneTask(alloc.SidecarTask) && !logsOnly && adminPortLabel == "" {
+					log.Printf("Sidecar %q of %s runs consul-dataplane; using Envoy admin at %s port(s) %v",
+						alloc.SidecarTask, alloc.ID[:8], target.addr, target.ports)
+				}
+				targets[alloc.ID] = target
+			}
+
+			if preflight {
+				features := preflightFeatures{LogLevel: !noLogLevelChange, Tcpdump: tcpdumpEnabled, TcpdumpInterface: tcpdumpInterface, TaskName: taskName}
+				results := preflightAllocs(nomadService, allocsToCapture, adminHeaders, adminPathPrefix, targets, features)
+				printPreflight(report, results)
+				skips.print(report)
+				return preflightError(results)
+			}
+
+			// Intentions and health checks come from Consul, which
+			// --discovery-source nomad is meant to avoid
+			useConsul := discoverySource != nomad.DiscoveryNomad
+
+			// Node state is looked up once per node, not per allocation
+			var nodeStatuses map[string]*nomad.NodeStatus
+			if nodeInfo {
+				nodeStatuses = lookupNodeStatuses(nomadService, allocsToCapture)
+			}
+
+			breaker := &failureBreaker{threshold: maxFailures}
+			epochs := &epochTracker{}
+			var dedupState *dedupTracker
+			if dedup {
+				dedupState = &dedupTracker{}
 			}
 
 			// Resolve exec strategy once per allocation (reused across repeat iterations)
 			strategyCache := make(map[string]*nomad.ExecStrategy)
+			var reachable []nomad.AllocationInfo
 			for _, alloc := range allocsToCapture {
-				if alloc.SidecarTask == "" {
+				if logsOnly {
+					reachable = append(reachable, alloc)
 					continue
 				}
-				taskOrder := []string{alloc.SidecarTask}
-				for _, t := range alloc.Tasks {
-					if t != alloc.SidecarTask {
-						taskOrder = append(taskOrder, t)
-					}
+				// Without a sidecar task, Envoy is reached from the app tasks'
+				// shared network namespace
+				if alloc.SidecarTask == "" {
+					log.Printf("No sidecar task found in %s but Connect is enabled; probing application tasks", alloc.ID[:8])
 				}
-				strategy, err := nomad.ResolveExecStrategy(nomadService, alloc.ID, taskOrder)
+				stop := runTimings.start(alloc.ID, "exec strategy")
+				strategy, err := resolveAdminStrategy(nomadService, alloc, targets[alloc.ID])
+				stop()
 				if err != nil {
 					log.Printf("WARNING: %v", err)
+					reason := SkipNoHTTPTool
+					if adminPortLabel != "" {
+						reason = SkipNoAdminPort
+					}
+					skips.add(alloc.ID, reason, "")
+					if breaker.failure(err) {
+						skips.print(report)
+						return exitErrorf(ExitNoData, "aborting: %d consecutive allocations failed exec probing; the cluster may be unhealthy (last error: %v)",
+							breaker.consecutive, breaker.lastErr)
+					}
 					continue
 				}
+				breaker.success()
+				if strategy.Method == nomad.MethodDirect {
+					log.Printf("Fetching Envoy admin of %s directly from %s (port %q)", alloc.ID[:8], strategy.HostPort, adminPortLabel)
+				}
+				strategy.Headers = adminHeaders
+				strategy.PathPrefix = adminPathPrefix
+				strategy.Address = targets[alloc.ID].addr
+				strategy.Timeout = timeouts.fallback
+				if minEnvoyVersion != "" {
+					serverInfo, err := nomadService.EnvoyAdminGET(alloc.ID, timeouts.apply(strategy, "/server_info"), targets[alloc.ID].ports[0], "/server_info")
+					version, tooOld, verr := checkMinEnvoyVersion(serverInfo, minVersion)
+					switch {
+					case err != nil:
+						log.Printf("WARNING: can't check the Envoy version of %s, /server_info failed: %v", alloc.ID[:8], err)
+					case verr != nil:
+						log.Printf("WARNING: can't check the Envoy version of %s: %v", alloc.ID[:8], verr)
+					case tooOld && minEnvoyVersionWarn:
+						log.Printf("WARNING: %s runs Envoy %s, older than --min-envoy-version %s; its captures may be incomplete", alloc.ID[:8], version, minVersion)
+					case tooOld:
+						log.Printf("ERROR: %s runs Envoy %s, older than --min-envoy-version %s; not capturing it (use --min-envoy-version-warn to capture anyway)", alloc.ID[:8], version, minVersion)
+						skips.add(alloc.ID, SkipEnvoyTooOld, fmt.Sprintf("Envoy %s < %s", version, minVersion))
+						continue
+					}
+				}
 				strategyCache[alloc.ID] = strategy
+				reachable = append(reachable, alloc)
+			}
+			allocsToCapture = reachable
+
+			// Allocations that weren't fully captured are saved for --resume
+			failures := newFailureLog()
+			saveFailures := func() {
+				failures.addSkips(skips, SkipLookupFailed, SkipNoHTTPTool, SkipNoAdminPort, SkipEnvoyTooOld)
+				path := filepath.Join(outputDir, FailuresFile)
+				if saved, err := failures.save(path); err != nil {
+					log.Printf("WARNING: %v", err)
+				} else if saved && len(failures.order) > 0 {
+					fmt.Fprintf(report, "%d allocation(s) not fully captured are listed in %s; re-capture them with --resume %s\n", len(failures.order), path, path)
+				}
+			}
+
+			if len(allocsToCapture) == 0 {
+				skips.print(report)
+				saveFailures()
+				return exitErrorf(ExitNoData, "no allocations with a usable Envoy admin access path")
+			}
+
+			if outputFormat == FormatFlat {
+				release, err := claimFlatDir(outputDir)
+				if err != nil {
+					return exitErrorf(ExitUsage, "--output-format %s: %w", FormatFlat, err)
+				}
+				defer release()
 			}
 
 			if repeat > 0 {
@@ -115,10 +560,29 @@ Environment variables:
 					interval, duration, enableTrace, tcpdumpEnabled, outputDir)
 			}
 
+			var sharedSink ArtifactSink
+			if outputFormat == FormatStdout {
+				sharedSink = newTarGzSink(nopWriteCloser{streams.Out}, "", preserveMetadata)
+			}
+
+			var outcome captureOutcome
+			// Allocations that could not be looked up or probed count as failed
+			outcome.failed = skips.count(SkipLookupFailed, SkipNoHTTPTool, SkipNoAdminPort, SkipEnvoyTooOld)
 			captures := 0
 			var startTime time.Time
+			var snapshotDirs []string
 
+			// From here on the first Ctrl-C archives what was captured so far
+			interrupt := newInterruptHandler()
+			defer interrupt.stop()
+
+		captureLoop:
 			for {
+				if interrupt.interrupted() {
+					log.Printf("Capture interrupted after %d cycle(s)", captures)
+					outcome.interrupted = true
+					break
+				}
 				if repeat > 0 && captures >= repeat {
 					log.Println("Repeat count reached, stopping capture")
 					break
@@ -133,52 +597,111 @@ Environment variables:
 				timestamp := time.Now().Format("20060102_150405")
 				snapshotDir := fmt.Sprintf("%s/snapshot_%s", outputDir, timestamp)
 
-				if err := os.MkdirAll(snapshotDir, 0755); err != nil {
-					log.Printf("Failed to create snapshot directory: %v", err)
-					continue
+				if outputFormat == FormatFlat {
+					// Later cycles replace the files of earlier ones
+					snapshotDir = outputDir
+				} else if archiveInto == "" && sharedSink == nil {
+					if snapshotDir, err = createSnapshotDir(snapshotDir); err != nil {
+						log.Printf("Failed to create snapshot directory: %v", err)
+						continue
+					}
 				}
 
-				for _, alloc := range allocsToCapture {
-					// Determine which task to use
-					targetTask := taskName
-					if targetTask == "" {
-						// Use detected sidecar or first non-sidecar task
-						if alloc.SidecarTask != "" {
-							// Find a non-sidecar task for the application logs
-							for _, t := range alloc.Tasks {
-								if t != alloc.SidecarTask {
-									targetTask = t
-									break
-								}
-							}
-						}
-						if targetTask == "" && len(alloc.Tasks) > 0 {
-							targetTask = alloc.Tasks[0]
+				// Intentions are per service, so they are looked up once per
+				// cycle and included in every snapshot of the service's
+				// allocations, each of which re-checks them when it ends
+				intentions := make(map[string]*consul.ServiceIntentions)
+				intentionsAt := time.Now()
+				if useConsul && !logsOnly {
+					for _, service := range serviceNames {
+						if intentions[service], err = nomadService.GetServiceIntentions(service); err != nil {
+							log.Printf("WARNING: not capturing intentions of %s: %v", service, err)
 						}
 					}
+				}
 
-					if alloc.SidecarTask == "" {
-						log.Printf("No sidecar task found in allocation %s, skipping", alloc.ID[:8])
-						continue
+				// Deployments change as a rollout progresses, so they are
+				// looked up once per cycle and job
+				var deployments map[string]*nomad.JobDeployment
+				if deploymentInfo {
+					deployments = lookupJobDeployments(nomadService, allocsToCapture)
+				}
+
+				for i, alloc := range allocsToCapture {
+					if interrupt.interrupted() {
+						break
 					}
+					targetTask := logTask(alloc, taskName)
 
-					finalReset := repeat == 0 || captures == repeat-1
+					// The last cycle isn't known in advance when waiting for recovery
+					finalReset := repeat == 0 || captures == repeat-1 || untilHealthy
 
 					log.Printf("Capturing allocation: %s | task: %s | sidecar: %s | trace: %v | tcpdump: %v",
 						alloc.ID[:8], targetTask, alloc.SidecarTask, enableTrace, tcpdumpEnabled)
 
+					var checkService string
+					if useConsul {
+						checkService = allocServices[alloc.ID]
+					}
 					snapshotConfig := SnapshotConfig{
 						AllocID:           alloc.ID,
 						TaskName:          targetTask,
 						SidecarTask:       alloc.SidecarTask,
 						Endpoints:         endpoints,
 						OutputDir:         snapshotDir,
+						TempDir:           tempDir,
 						ExtraLogs:         []string{alloc.SidecarTask},
 						EnableTrace:       enableTrace,
 						TcpdumpEnabled:    tcpdumpEnabled,
+						TcpdumpInterface:  tcpdumpInterface,
+						TcpdumpRotation:   rotation,
 						Duration:          time.Duration(duration) * time.Second,
 						SkipLogLevelReset: !finalReset,
+						PreserveMetadata:  preserveMetadata,
+						ArchiveInto:       archiveInto,
+						WatchStat:         watchStatName,
+						WatchInterval:     watchInterval,
+						WatchDuration:     watchDuration,
+						LogsOnly:          logsOnly,
+						NoLogLevelChange:  noLogLevelChange,
+						VersionGate:       envoyVersionGate,
+						AllEndpoints:      allEndpoints,
+						Allowlist:         allowlist,
+						AdminHeaders:      adminHeaders,
+						AdminPathPrefix:   adminPathPrefix,
+						AdminAddr:         targets[alloc.ID].addr,
+						AdminPorts:        targets[alloc.ID].ports,
+						EndpointTimeouts:  timeouts,
 						ExecStrategy:      strategyCache[alloc.ID],
+						MemoryThreshold:   int64(memoryWarnMB) << 20,
+						FocusClusters:     focusClusters,
+						FocusListeners:    focusListeners,
+						SidecarEnv:        sidecarEnv,
+						ListeningSockets:  listeningSockets,
+						DNS:               captureDNSState,
+						TrustBundle:       trustBundle,
+						AdminIndex:        adminIndex,
+						LogLimit:          limit,
+						LogFilter:         filter,
+						MergeStderr:       mergeStderr,
+						CompressLogs:      compressLogs,
+						Dedup:             dedupState,
+						Epochs:            epochs,
+						Tail:              tail,
+						Interrupt:         interrupt,
+						Intentions:        intentions[allocServices[alloc.ID]],
+						IntentionsAt:      intentionsAt,
+						CheckService:      checkService, // check output changes, so it is looked up per snapshot
+						NodeStatus:        nodeStatuses[alloc.NodeID],
+						Deployment:        deployments[jobKey(alloc)],
+						ResourceStats:     resourceStats,
+						OutputFormat:      outputFormat,
+						GzipOver:          gzipOverBytes,
+						ConfigFormat:      configFormat,
+						Sink:              sharedSink,
+						Webhook:           hook,
+						Progress:          progress,
+						Timings:           runTimings,
 					}
 
 					// Start timer here *after* setup begins
@@ -186,37 +709,168 @@ Environment variables:
 						startTime = time.Now()
 					}
 
-					if err := CaptureSnapshot(nomadService, snapshotConfig); err != nil {
+					_, err := CaptureSnapshot(nomadService, snapshotConfig)
+					var partial *PartialCaptureError
+					if errors.As(err, &partial) {
+						log.Printf("WARNING: %v", err)
+						failures.add(alloc.ID, "partial", err.Error())
+						outcome.partial++
+						breaker.success()
+						continue
+					}
+					if err != nil {
+						outcome.failed++
+						failures.add(alloc.ID, "failed", err.Error())
 						log.Printf("Error capturing snapshot for allocation %s: %v", alloc.ID[:8], err)
+						if breaker.failure(err) {
+							log.Printf("Aborting capture: %d consecutive allocation captures failed; the cluster may be unhealthy (last error: %v)",
+								breaker.consecutive, breaker.lastErr)
+							log.Printf("Hint: resolve the cluster issue or raise --max-consecutive-failures (0 disables this check)")
+							for _, rest := range allocsToCapture[i+1:] {
+								failures.add(rest.ID, "aborted", "not captured after too many consecutive failures")
+							}
+							break captureLoop
+						}
+						continue
 					}
+					outcome.succeeded++
+					breaker.success()
 				}
 
 				captures++
 
+				if latestLink && archiveInto == "" && sharedSink == nil {
+					if err := updateLatestLink(outputDir, snapshotDir); err != nil {
+						log.Printf("WARNING: %v", err)
+					}
+				}
+
+				if untilHealthy {
+					// Keep the last unhealthy capture and the first healthy one
+					snapshotDirs = append(snapshotDirs, snapshotDir)
+					if snapshotDirs, err = keepLatest(snapshotDirs, 2); err != nil {
+						log.Printf("WARNING: %v", err)
+					}
+					if interrupt.interrupted() {
+						continue
+					}
+					unready := unreadyAllocs(nomadService, allocsToCapture, strategyCache, targets)
+					if len(unready) == 0 {
+						log.Printf("All sidecars report LIVE after %d capture(s), stopping", captures)
+						break
+					}
+					log.Printf("Sidecars not ready yet: %s", strings.Join(unready, ", "))
+					if captures >= repeat {
+						log.Printf("WARNING: sidecars still not ready after %d capture(s)", captures)
+					}
+				}
+
 				if repeat > 0 && captures < repeat {
 					log.Printf("Sleeping %ds before next snapshot (repeat mode)", interval)
-					time.Sleep(time.Duration(interval) * time.Second)
+					interrupt.sleep(time.Duration(interval) * time.Second)
 				} else if repeat == 0 {
-					time.Sleep(time.Duration(interval) * time.Second)
+					interrupt.sleep(time.Duration(interval) * time.Second)
+				}
+			}
+
+			if sharedSink != nil {
+				if err := sharedSink.Finalize(); err != nil {
+					log.Printf("Failed to finish output: %v", err)
+					outcome.failed++
 				}
 			}
+
+			skips.print(report)
+			saveFailures()
+			return outcome.err()
 		},
 	}
 
 	// Nomad-specific flags
 	captureCmd.Flags().StringVar(&allocID, "alloc", "", "Allocation ID (optional; defaults to all Connect allocations)")
+	captureCmd.Flags().StringVar(&allocFile, "alloc-file", "", "File with one allocation ID per line to capture")
+	captureCmd.Flags().StringVar(&resumeFile, "resume", "", "Re-capture only the allocations listed in a previous run's "+FailuresFile)
 	captureCmd.Flags().StringVar(&taskName, "task", "", "Task name for application logs (auto-detected if not specified)")
-	captureCmd.Flags().StringVar(&serviceName, "service", "", "Consul service name to filter allocations")
-	captureCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Nomad namespace (optional)")
+	captureCmd.Flags().StringSliceVar(&serviceNames, "service", nil, "Consul service name to filter allocations; repeatable or comma-separated to capture several services in one run")
+	captureCmd.Flags().StringVar(&consulFilter, "consul-filter", "", "Consul filter expression applied server-side to proxy health entries during discovery (e.g. 'Service.Meta.team == \"payments\"')")
+	captureCmd.Flags().StringVar(&discoverySource, "discovery-source", nomad.DiscoveryAuto, "Where to discover Connect allocations: auto (Consul, then a Nomad scan when it finds nothing), consul, or nomad (skip Consul)")
+	captureCmd.Flags().StringVar(&nodeClass, "node-class", "", "Only capture allocations on Nomad client nodes of this node class")
+	captureCmd.Flags().StringArrayVar(&jobMetaFlags, "job-meta", nil, "Only capture allocations whose job has this key=value meta (repeatable; all must match)")
+	captureCmd.Flags().StringArrayVar(&nodeMeta, "node-meta", nil, "Only capture allocations on nodes with this key=value metadata (repeatable; all must match)")
+	captureCmd.Flags().BoolVar(&withUpstreams, "with-upstreams", false, "Also capture the allocations of the --service's Connect upstreams (one hop)")
+	captureCmd.Flags().StringVar(&region, "region", "", "Nomad region to capture from in a multi-region cluster (default: $NOMAD_REGION, or the agent's region)")
+	captureCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Nomad namespace(s) to capture from, comma-separated (default: $NOMAD_NAMESPACE, or all namespaces; \"*\" for all)")
+	captureCmd.Flags().StringVar(&nomadTokenVault, "nomad-token-vault", "", "Read the Nomad token from this Vault secret field (<path>#<field>, e.g. secret/data/nomad#token) instead of NOMAD_TOKEN")
+	captureCmd.Flags().StringVar(&consulTokenVault, "consul-token-vault", "", "Read the Consul token from this Vault secret field (<path>#<field>) instead of CONSUL_HTTP_TOKEN")
+	captureCmd.Flags().StringSliceVar(&endpointTimeoutFlags, "endpoint-timeout", nil, "Timeout of individual Envoy admin requests as <endpoint>=<duration>, e.g. /config_dump=30s,/ready=2s; default=<duration> sets the rest (default 60s through exec, 30s with --admin-port-label)")
+	captureCmd.Flags().DurationVar(&apiTimeout, "api-timeout", nomad.DefaultAPITimeout, "Timeout for connecting to the Nomad and Consul APIs")
+	captureCmd.Flags().DurationVar(&discoveryTimeout, "discovery-timeout", nomad.DefaultDiscoveryTimeout, "Maximum time to wait for each Consul discovery query (0 waits indefinitely)")
 
 	// Capture options
-	captureCmd.Flags().StringSliceVar(&endpoints, "endpoints", []string{}, "Envoy endpoints to capture")
+	captureCmd.Flags().StringSliceVar(&endpoints, "endpoints", []string{}, "Envoy endpoints to capture, replacing the profile's endpoints")
+	captureCmd.Flags().BoolVar(&preflight, "preflight", false, "Only check that each allocation's Envoy admin API is reachable via exec (one /ready fetch) and that the requested features (task logs, log level changes, --tcpdump) have the permissions they need, then exit without capturing")
+	captureCmd.Flags().BoolVar(&allEndpoints, "all-endpoints", false, "Also capture every GET endpoint listed on each proxy's admin index (/), except destructive ones")
+	captureCmd.Flags().BoolVar(&adminIndex, "admin-index", false, "Save the endpoints listed on the Envoy admin index (/) to available_endpoints.txt")
+	captureCmd.Flags().StringVar(&minEnvoyVersion, "min-envoy-version", "", "Read /server_info first and refuse to capture sidecars running an older Envoy, e.g. 1.26")
+	captureCmd.Flags().BoolVar(&minEnvoyVersionWarn, "min-envoy-version-warn", false, "With --min-envoy-version, only warn about older sidecars and capture them anyway")
+	captureCmd.Flags().BoolVar(&envoyVersionGate, "envoy-version-gate", false, "Read /server_info first and skip endpoints the running Envoy version does not support")
+	captureCmd.Flags().StringSliceVar(&extraEndpoints, "extra-endpoints", []string{}, "Envoy endpoints to capture in addition to the profile's endpoints (e.g. "+strings.Join(OptionalEndpoints, ", ")+")")
+	captureCmd.Flags().StringVar(&profile, "profile", DefaultProfile, "Named endpoint profile to capture (built-in: default, connectivity, tls, perf)")
 	captureCmd.Flags().StringVar(&outputDir, "output-dir", outputDir, "Directory to save snapshots")
-	captureCmd.Flags().IntVar(&interval, "sleep", 5, "Sleep duration between captures in seconds (minimum 5s)")
+	captureCmd.Flags().StringVar(&tempDir, "temp-dir", "", "Directory to stage each capture in before it is archived, e.g. a larger volume than a small tmpfs (default: the system temp dir)")
+	captureCmd.Flags().BoolVar(&latestLink, "latest-link", false, "After each capture, point <output-dir>/latest at the newest snapshot_<timestamp> directory (latest.txt holding its path on Windows)")
+	captureCmd.Flags().StringVar(&outputFormat, "output-format", FormatTarGz, "Snapshot output: "+strings.Join(OutputFormats, ", ")+" (flat writes <alloc>_<file> into --output-dir, stdout streams one tar.gz of the whole run)")
+	captureCmd.Flags().StringVar(&gzipOver, "gzip-files-over", "0", "With --output-format tar or dir, gzip each file larger than this size, e.g. 10MiB (0 disables)")
+	captureCmd.Flags().StringVar(&configFormat, "config-format", ConfigFormatJSON, "Format for saved /config_dump, /clusters and /listeners JSON: "+strings.Join(ConfigFormats, ", "))
+	captureCmd.Flags().StringVar(&webhookURL, "webhook", "", "Also POST each snapshot archive to this URL, with the capture described in X-Xdsnap-* headers")
+	captureCmd.Flags().StringArrayVar(&webhookHeaders, "webhook-header", nil, "Header sent with --webhook uploads, as \"Name: value\" (e.g. an Authorization header); repeatable")
+	captureCmd.Flags().StringVar(&archiveInto, "archive-into", "", "Append captures to this .tar.gz (created if missing) instead of writing per-run archives")
+	captureCmd.Flags().IntVar(&interval, "sleep", 5, "Sleep duration between captures in seconds (values below 5 are raised to 5)")
 	captureCmd.Flags().IntVar(&duration, "duration", 60, "Total capture duration in seconds")
 	captureCmd.Flags().IntVar(&repeat, "repeat", 0, "Number of snapshot repetitions (takes precedence over duration)")
+	captureCmd.Flags().BoolVar(&dedup, "dedup", false, "In repeat mode, replace endpoint responses unchanged since the previous capture with a small <file>.unchanged marker")
+	captureCmd.Flags().BoolVar(&untilHealthy, "until-healthy", false, "In repeat mode, stop once every sidecar's /ready reports LIVE, keeping the last two captures")
+	captureCmd.Flags().IntVar(&maxFailures, "max-consecutive-failures", 5, "Abort after this many consecutive allocation failures (0 disables)")
 	captureCmd.Flags().BoolVar(&enableTrace, "enable-trace", false, "Enable Envoy trace log level")
+	captureCmd.Flags().BoolVar(&noLogLevelChange, "no-log-level-change", false, "Never change the Envoy log level; capture at the level the proxy is already running")
 	captureCmd.Flags().BoolVar(&tcpdumpEnabled, "tcpdump", false, "Enable tcpdump capture (requires tcpdump in sidecar image)")
+	captureCmd.Flags().StringVar(&tcpdumpInterface, "tcpdump-interface", DefaultTcpdumpInterface, "Network interface tcpdump captures on inside the task, e.g. eth0; checked with a quick test capture before the full one")
+	captureCmd.Flags().StringVar(&tcpdumpMaxSize, "tcpdump-max-size", "0", "Rotate the tcpdump capture inside the task into files of at most this size, e.g. 50MB, keeping only the newest --tcpdump-files (0 streams one unbounded capture)")
+	captureCmd.Flags().IntVar(&tcpdumpFiles, "tcpdump-files", DefaultTcpdumpFiles, "Number of rotated tcpdump files kept with --tcpdump-max-size")
+	captureCmd.Flags().BoolVar(&mergeStderr, "merge-stderr", false, "Write each task's stdout and stderr interleaved into one <task>.log instead of separate files")
+	captureCmd.Flags().BoolVar(&compressLogs, "compress-logs", false, "Gzip task logs as they stream, saving <task>-stdout.log.gz and <task>-stderr.log.gz")
+	captureCmd.Flags().BoolVar(&timings, "timings", false, "Log how long discovery, exec probing, each endpoint fetch, log streaming and archiving took, and save the breakdown to timings.txt")
+	captureCmd.Flags().BoolVar(&tailLogs, "tail", false, "Also print streamed task log lines to the console, prefixed with allocation and task")
+	captureCmd.Flags().StringVar(&logGrep, "log-grep", "", "Only keep task log lines matching this regular expression")
+	captureCmd.Flags().IntVar(&logContext, "log-context", 0, "Lines of context to keep before and after each --log-grep match")
+	captureCmd.Flags().StringVar(&maxLogBytes, "max-log-bytes", "0", "Cap each task log stream at this size, e.g. 50MiB (0 means unlimited)")
+	captureCmd.Flags().StringVar(&logKeep, "log-keep", LogKeepTail, "Which end of a log to keep when --max-log-bytes is reached: head or tail")
+	captureCmd.Flags().BoolVar(&listeningSockets, "listening-sockets", false, "Save the sidecar network namespace's listening TCP sockets (ss -tlnp, or netstat -tlnp) to listening_sockets.txt")
+	captureCmd.Flags().BoolVar(&trustBundle, "trust-bundle", false, "Save the CA certificates the proxy trusts, from /config_dump, to trust_bundle.pem with a decoded summary (subject, expiry, SPIFFE trust domain) in trust_bundle.txt")
+	captureCmd.Flags().BoolVar(&captureDNSState, "dns", false, "Save /etc/resolv.conf and lookups of DNS-resolved upstreams from the sidecar network namespace to dns.txt")
+	captureCmd.Flags().BoolVar(&allowDestructive, "allow-destructive", false, "Allow endpoints that change or stop Envoy, such as /quitquitquit, /drain_listeners, /healthcheck/fail and /reset_counters")
+	captureCmd.Flags().BoolVar(&resourceStats, "resource-stats", false, "Save each task's CPU and memory usage from Nomad, with its reserved CPU and memory limit, to resource_stats.json")
+	captureCmd.Flags().BoolVar(&deploymentInfo, "deployment", false, "Save the latest Nomad deployment and recent evaluations of each allocation's job to deployment.json and evaluations.json")
+	captureCmd.Flags().BoolVar(&nodeInfo, "node-info", false, "Save the Nomad node info (status, drain, eligibility, client version, meta) of each allocation's node to node.json")
+	captureCmd.Flags().BoolVar(&sidecarEnv, "sidecar-env", false, "Save the sidecar process environment and command line (secrets redacted) to sidecar_env.txt")
+	captureCmd.Flags().BoolVar(&preserveMetadata, "preserve-metadata", false, "Keep file timestamps and ownership in the archive (archives are reproducible by default)")
+
+	captureCmd.Flags().StringSliceVar(&focusClusters, "focus-cluster", []string{}, "Also capture stats, /clusters entries and config for this cluster into focus_<name>/")
+	captureCmd.Flags().StringSliceVar(&focusListeners, "focus-listener", []string{}, "Also capture stats, /listeners entries and config for this listener into focus_<name>/")
+	captureCmd.Flags().IntVar(&memoryWarnMB, "memory-warn-mb", 256, "Warn in the summary when /memory shows more than this many MiB allocated (0 disables)")
+	captureCmd.Flags().IntSliceVar(&adminPorts, "envoy-admin-port", []int{nomad.EnvoyAdminPort}, "Envoy admin port(s) inside the allocation (19000 for consul-dataplane sidecars); with several, each proxy is captured into port_<n>/")
+	captureCmd.Flags().StringVar(&adminAddr, "envoy-admin-ip", "", "IP the Envoy admin API listens on inside the allocation, e.g. a host-network address (default "+nomad.EnvoyAdminAddr+", or "+nomad.DataplaneAdminAddr+" for consul-dataplane sidecars)")
+	captureCmd.Flags().StringVar(&adminPortLabel, "admin-port-label", "", "Fetch the Envoy admin API directly from the node address Nomad mapped this port label to, instead of through nomad alloc exec")
+	captureCmd.Flags().StringVar(&adminPathPrefix, "admin-path-prefix", "", "Path prefix the Envoy admin API is served under (e.g. /admin); output files keep their usual names")
+	captureCmd.Flags().StringVar(&adminAuth, "admin-auth", "", "Credentials for a secured Envoy admin API: basic:user:pass or bearer:token")
+	captureCmd.Flags().BoolVar(&logsOnly, "logs-only", false, "Only stream task logs; skip Envoy endpoints, log level changes and tcpdump")
+	captureCmd.Flags().StringVar(&watchStatName, "watch-stat", "", "Sample this Envoy stat repeatedly and save it as a CSV time series")
+	captureCmd.Flags().DurationVar(&watchInterval, "watch-interval", 5*time.Second, "Interval between --watch-stat samples")
+	captureCmd.Flags().DurationVar(&watchDuration, "watch-duration", 5*time.Minute, "How long to sample --watch-stat for")
+
+	captureCmd.MarkFlagsMutuallyExclusive("endpoints", "profile")
+	captureCmd.MarkFlagsMutuallyExclusive("enable-trace", "no-log-level-change")
+	captureCmd.MarkFlagsMutuallyExclusive("alloc", "alloc-file", "service", "resume")
 
 	_ = viper.BindEnv("namespace", "NOMAD_NAMESPACE")
 	_ = viper.BindPFlag("namespace", captureCmd.Flags().Lookup("namespace"))
@@ -224,6 +878,126 @@ Environment variables:
 	return captureCmd
 }
 
+// logTask returns the task whose logs are captured from alloc: taskName when
+// set, else the first task that isn't the sidecar, else the first task.
+func logTask(alloc nomad.AllocationInfo, taskName string) string {
+	if taskName != "" {
+		return taskName
+	}
+	if alloc.SidecarTask != "" {
+		for _, t := range alloc.Tasks {
+			if t != alloc.SidecarTask {
+				return t
+			}
+		}
+	}
+	if len(alloc.Tasks) > 0 {
+		return alloc.Tasks[0]
+	}
+	return ""
+}
+
+// normalizeServiceNames trims the --service values and drops empty and
+// repeated names.
+func normalizeServiceNames(names []string) []string {
+	var services []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" && !containsString(services, name) {
+			services = append(services, name)
+		}
+	}
+	return services
+}
+
+// discoverServices finds the Connect allocations of every service and, with
+// withUpstreams, of their upstreams, merged without duplicates. It also
+// returns the service each allocation was first found under.
+func discoverServices(nomadService nomad.NomadApiService, namespace string, services []string, withUpstreams bool) ([]nomad.AllocationInfo, map[string]string, error) {
+	var allocs []nomad.AllocationInfo
+	allocServices := make(map[string]string)
+	add := func(service string, found []nomad.AllocationInfo) {
+		for _, alloc := range found {
+			if _, ok := allocServices[alloc.ID]; !ok {
+				allocServices[alloc.ID] = service
+			}
+		}
+		allocs = appendNewAllocations(allocs, found)
+	}
+	for _, service := range services {
+		found, err := nomadService.FindConnectAllocationsByService(namespace, service)
+		if err != nil {
+			return nil, nil, apiErrorf(err, "failed to discover allocations for service %s", service)
+		}
+		add(service, found)
+	}
+	if withUpstreams {
+		// After every service, so an upstream that was also selected keeps
+		// its own service
+		for _, service := range services {
+			upstreamAllocs, err := nomadService.FindUpstreamAllocations(namespace, service)
+			if err != nil {
+				log.Printf("WARNING: not capturing upstreams of %s: %v", service, err)
+			}
+			add(service, upstreamAllocs)
+		}
+	}
+	return allocs, allocServices, nil
+}
+
+// appendNewAllocations adds the allocations in extra that aren't already in
+// allocs.
+func appendNewAllocations(allocs, extra []nomad.AllocationInfo) []nomad.AllocationInfo {
+	seen := make(map[string]bool, len(allocs))
+	for _, alloc := range allocs {
+		seen[alloc.ID] = true
+	}
+	for _, alloc := range extra {
+		if !seen[alloc.ID] {
+			seen[alloc.ID] = true
+			allocs = append(allocs, alloc)
+		}
+	}
+	return allocs
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readAllocIDs reads allocation IDs from a file, one per line. Blank lines and
+// lines starting with '#' are ignored, and duplicates are dropped.
+func readAllocIDs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no allocation IDs found in %s", path)
+	}
+	return ids, nil
+}
+
 // IOStreams provides standard I/O streams
 type IOStreams struct {
 	In     io.Reader
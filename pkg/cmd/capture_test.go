@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestReadAllocIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "allocs.txt")
+	content := `# incident 1234
+abcdef12-3456-7890-abcd-ef1234567890
+
+  11111111-2222-3333-4444-555555555555
+abcdef12-3456-7890-abcd-ef1234567890
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readAllocIDs(path)
+	if err != nil {
+		t.Fatalf("readAllocIDs() unexpected error: %v", err)
+	}
+	want := []string{"abcdef12-3456-7890-abcd-ef1234567890", "11111111-2222-3333-4444-555555555555"}
+	if len(got) != len(want) {
+		t.Fatalf("readAllocIDs() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("readAllocIDs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAllocIDs(empty); err == nil {
+		t.Error("readAllocIDs() expected error for file without IDs")
+	}
+	if _, err := readAllocIDs(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("readAllocIDs() expected error for missing file")
+	}
+}
+
+func TestClassifySkip(t *testing.T) {
+	base := nomad.AllocationInfo{
+		ID:           "abcdef12-3456-7890-abcd-ef1234567890",
+		Namespace:    "default",
+		Tasks:        []string{"connect-proxy-web", "web"},
+		SidecarTask:  "connect-proxy-web",
+		ClientStatus: "running",
+	}
+
+	tests := []struct {
+		name      string
+		mutate    func(a *nomad.AllocationInfo)
+		namespace string
+		want      SkipReason
+		wantSkip  bool
+	}{
+		{name: "eligible", mutate: func(a *nomad.AllocationInfo) {}},
+		{name: "not running", mutate: func(a *nomad.AllocationInfo) { a.ClientStatus = "failed" }, want: SkipNotRunning, wantSkip: true},
+		{name: "other namespace", mutate: func(a *nomad.AllocationInfo) {}, namespace: "prod", want: SkipExcludedByFilter, wantSkip: true},
+		{name: "wildcard namespace", mutate: func(a *nomad.AllocationInfo) {}, namespace: "*"},
+		{name: "no tasks", mutate: func(a *nomad.AllocationInfo) { a.Tasks = nil; a.SidecarTask = "" }, want: SkipNoTasks, wantSkip: true},
+		{name: "no sidecar", mutate: func(a *nomad.AllocationInfo) { a.SidecarTask = "" }, want: SkipNoSidecar, wantSkip: true},
+		{name: "connect without sidecar task", mutate: func(a *nomad.AllocationInfo) { a.SidecarTask = ""; a.Connect = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alloc := base
+			tt.mutate(&alloc)
+			reason, _, skip := classifySkip(alloc, tt.namespace)
+			if skip != tt.wantSkip || reason != tt.want {
+				t.Errorf("classifySkip() = (%q, %v), want (%q, %v)", reason, skip, tt.want, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestSkipReportPrint(t *testing.T) {
+	r := newSkipReport()
+	r.add("bbbbbbbb-0000-0000-0000-000000000000", SkipNoSidecar, "")
+	r.add("aaaaaaaa-0000-0000-0000-000000000000", SkipNotRunning, "client status failed")
+
+	var out bytes.Buffer
+	r.print(&out)
+	got := out.String()
+	if !strings.Contains(got, "Skipped 2 allocation(s)") {
+		t.Errorf("missing header in %q", got)
+	}
+	if strings.Index(got, string(SkipNoSidecar)) > strings.Index(got, string(SkipNotRunning)) {
+		t.Errorf("entries not grouped by reason: %q", got)
+	}
+
+	var empty bytes.Buffer
+	newSkipReport().print(&empty)
+	if empty.Len() != 0 {
+		t.Errorf("empty report printed %q", empty.String())
+	}
+}
+
+func TestAppendNewAllocations(t *testing.T) {
+	allocs := []nomad.AllocationInfo{{ID: "a"}, {ID: "b"}}
+	got := appendNewAllocations(allocs, []nomad.AllocationInfo{{ID: "b"}, {ID: "c"}, {ID: "c"}})
+	var ids []string
+	for _, a := range got {
+		ids = append(ids, a.ID)
+	}
+	if want := "a,b,c"; strings.Join(ids, ",") != want {
+		t.Errorf("got %v, want %s", ids, want)
+	}
+}
+
+func TestLogTask(t *testing.T) {
+	tests := []struct {
+		name     string
+		alloc    nomad.AllocationInfo
+		taskName string
+		want     string
+	}{
+		{"--task", nomad.AllocationInfo{SidecarTask: "connect-proxy-web", Tasks: []string{"web", "connect-proxy-web"}}, "worker", "worker"},
+		{"application task", nomad.AllocationInfo{SidecarTask: "connect-proxy-web", Tasks: []string{"connect-proxy-web", "web"}}, "", "web"},
+		{"no sidecar", nomad.AllocationInfo{Tasks: []string{"gateway"}}, "", "gateway"},
+		{"no tasks", nomad.AllocationInfo{}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logTask(tt.alloc, tt.taskName); got != tt.want {
+				t.Errorf("logTask() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeServiceNames(t *testing.T) {
+	got := normalizeServiceNames([]string{"frontend", " backend", "", "frontend", "db "})
+	if want := "frontend,backend,db"; strings.Join(got, ",") != want {
+		t.Errorf("normalizeServiceNames() = %v, want %s", got, want)
+	}
+}
+
+// serviceDiscovery answers service and upstream lookups from maps.
+type serviceDiscovery struct {
+	nomad.NomadApiService
+	services  map[string][]nomad.AllocationInfo
+	upstreams map[string][]nomad.AllocationInfo
+}
+
+func (s *serviceDiscovery) FindConnectAllocationsByService(namespace, service string) ([]nomad.AllocationInfo, error) {
+	allocs, ok := s.services[service]
+	if !ok {
+		return nil, errors.New("service not found")
+	}
+	return allocs, nil
+}
+
+func (s *serviceDiscovery) FindUpstreamAllocations(namespace, service string) ([]nomad.AllocationInfo, error) {
+	return s.upstreams[service], nil
+}
+
+func TestDiscoverServices(t *testing.T) {
+	svc := &serviceDiscovery{
+		services: map[string][]nomad.AllocationInfo{
+			"frontend": {{ID: "f1"}, {ID: "f2"}},
+			"backend":  {{ID: "b1"}, {ID: "f2"}},
+			"db":       {{ID: "d1"}},
+		},
+		upstreams: map[string][]nomad.AllocationInfo{
+			"frontend": {{ID: "b1"}, {ID: "d1"}},
+			"backend":  {{ID: "c1"}},
+		},
+	}
+	tests := []struct {
+		name          string
+		services      []string
+		withUpstreams bool
+		wantIDs       string
+		wantServices  map[string]string
+	}{
+		{
+			name:         "merged without duplicates",
+			services:     []string{"frontend", "backend"},
+			wantIDs:      "f1,f2,b1",
+			wantServices: map[string]string{"f1": "frontend", "f2": "frontend", "b1": "backend"},
+		},
+		{
+			name:          "selected upstream keeps its service",
+			services:      []string{"frontend", "db"},
+			withUpstreams: true,
+			wantIDs:       "f1,f2,d1,b1",
+			wantServices:  map[string]string{"f1": "frontend", "f2": "frontend", "d1": "db", "b1": "frontend"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocs, services, err := discoverServices(svc, "default", tt.services, tt.withUpstreams)
+			if err != nil {
+				t.Fatalf("discoverServices() error: %v", err)
+			}
+			var ids []string
+			for _, a := range allocs {
+				ids = append(ids, a.ID)
+			}
+			if strings.Join(ids, ",") != tt.wantIDs {
+				t.Errorf("allocations = %v, want %s", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(services, tt.wantServices) {
+				t.Errorf("services = %v, want %v", services, tt.wantServices)
+			}
+		})
+	}
+
+	if _, _, err := discoverServices(svc, "default", []string{"frontend", "missing"}, false); err == nil {
+		t.Error("discoverServices() ignored a failed lookup")
+	}
+}
@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// consulService is the Consul service an Envoy cluster sends traffic to, as
+// encoded in the cluster's name or SPIFFE identity.
+type consulService struct {
+	Name       string
+	Namespace  string
+	Partition  string
+	Datacenter string
+	Peer       string
+	Subset     string
+}
+
+// String renders the service name with the subset or peer it is reached
+// through, e.g. "api (subset v2)".
+func (s consulService) String() string {
+	var notes []string
+	if s.Subset != "" {
+		notes = append(notes, "subset "+s.Subset)
+	}
+	if s.Peer != "" {
+		notes = append(notes, "peer "+s.Peer)
+	}
+	if len(notes) == 0 {
+		return s.Name
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, strings.Join(notes, ", "))
+}
+
+// Clusters Consul Connect adds to every sidecar that aren't upstream services.
+var consulLocalClusters = map[string]string{
+	"local_app":          "(local app)",
+	"local_agent":        "(consul agent)",
+	"self_admin":         "(envoy admin)",
+	"prometheus_backend": "(envoy metrics)",
+}
+
+// parseConsulClusterName decodes Consul Connect's upstream cluster naming,
+// the SNI of the upstream service:
+//
+//	[subset.]service.namespace.datacenter.internal.<trust domain>.consul
+//	[subset.]service.namespace.partition.datacenter.internal-v1.<trust domain>.consul
+//	[subset.]service.namespace.partition.peer.external.<trust domain>.consul
+//
+// ok is false for any other cluster name.
+func parseConsulClusterName(name string) (svc consulService, ok bool) {
+	if !strings.HasSuffix(name, ".consul") {
+		return svc, false
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		var fields int
+		switch label {
+		case "internal":
+			fields = 3
+		case "internal-v1", "external":
+			fields = 4
+		default:
+			continue
+		}
+		parts := labels[:i]
+		if len(parts) == fields+1 {
+			svc.Subset, parts = parts[0], parts[1:]
+		}
+		if len(parts) != fields {
+			return consulService{}, false
+		}
+		svc.Name, svc.Namespace = parts[0], parts[1]
+		switch label {
+		case "internal":
+			svc.Datacenter = parts[2]
+		case "internal-v1":
+			svc.Partition, svc.Datacenter = parts[2], parts[3]
+		case "external":
+			svc.Partition, svc.Peer = parts[2], parts[3]
+		}
+		return svc, svc.Name != ""
+	}
+	return svc, false
+}
+
+var spiffeServiceRE = regexp.MustCompile(`spiffe://[^/"]+(?:/ap/([^/"]+))?/ns/([^/"]+)/dc/([^/"]+)/svc/([^/"?]+)`)
+
+// parseSPIFFEService decodes the first Consul service SPIFFE ID,
+// spiffe://<trust domain>/[ap/<partition>/]ns/<namespace>/dc/<dc>/svc/<service>,
+// found in s.
+func parseSPIFFEService(s string) (consulService, bool) {
+	m := spiffeServiceRE.FindStringSubmatch(s)
+	if m == nil {
+		return consulService{}, false
+	}
+	return consulService{Partition: m[1], Namespace: m[2], Datacenter: m[3], Name: m[4]}, true
+}
+
+// spiffeServices maps each cluster in an Envoy /config_dump to the service
+// named by the SPIFFE ID its upstream TLS context verifies, for clusters
+// whose names don't follow Consul's convention.
+func spiffeServices(configDump []byte) map[string]consulService {
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil
+	}
+	services := make(map[string]consulService)
+	for _, raw := range dump.Configs {
+		var section struct {
+			Type           string `json:"@type"`
+			StaticClusters []struct {
+				Cluster json.RawMessage `json:"cluster"`
+			} `json:"static_clusters"`
+			DynamicActiveClusters []struct {
+				Cluster json.RawMessage `json:"cluster"`
+			} `json:"dynamic_active_clusters"`
+		}
+		if err := json.Unmarshal(raw, &section); err != nil || !strings.HasSuffix(section.Type, ".ClustersConfigDump") {
+			continue
+		}
+		clusters := make([]json.RawMessage, 0, len(section.StaticClusters)+len(section.DynamicActiveClusters))
+		for _, c := range section.StaticClusters {
+			clusters = append(clusters, c.Cluster)
+		}
+		for _, c := range section.DynamicActiveClusters {
+			clusters = append(clusters, c.Cluster)
+		}
+		for _, c := range clusters {
+			var named namedResource
+			if err := json.Unmarshal(c, &named); err != nil || named.Name == "" {
+				continue
+			}
+			if svc, ok := parseSPIFFEService(string(c)); ok {
+				services[named.Name] = svc
+			}
+		}
+	}
+	return services
+}
+
+// clusterHealth counts a cluster's endpoints in Envoy's /clusters output.
+type clusterHealth struct {
+	Endpoints int
+	Healthy   int
+}
+
+// parseClusterHealth reads the endpoints of every cluster from a /clusters
+// response, in either the text or the ?format=json form.
+func parseClusterHealth(data []byte) (map[string]*clusterHealth, error) {
+	clusters := make(map[string]*clusterHealth)
+	get := func(name string) *clusterHealth {
+		if clusters[name] == nil {
+			clusters[name] = &clusterHealth{}
+		}
+		return clusters[name]
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc struct {
+			ClusterStatuses []struct {
+				Name         string `json:"name"`
+				HostStatuses []struct {
+					HealthStatus map[string]interface{} `json:"health_status"`
+				} `json:"host_statuses"`
+			} `json:"cluster_statuses"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse /clusters: %w", err)
+		}
+		for _, c := range doc.ClusterStatuses {
+			h := get(c.Name)
+			for _, host := range c.HostStatuses {
+				h.Endpoints++
+				if hostHealthy(host.HealthStatus) {
+					h.Healthy++
+				}
+			}
+		}
+		return clusters, nil
+	}
+
+	// text form: cluster::address::stat::value, one per line
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "::")
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		h := get(parts[0])
+		if len(parts) == 4 && parts[2] == "health_flags" {
+			h.Endpoints++
+			if parts[3] == "healthy" {
+				h.Healthy++
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// hostHealthy reports whether a /clusters?format=json host health_status
+// has no failure flags set and EDS doesn't report it unhealthy.
+func hostHealthy(status map[string]interface{}) bool {
+	for key, v := range status {
+		if key == "eds_health_status" {
+			if s, _ := v.(string); s != "" && s != "HEALTHY" {
+				return false
+			}
+		} else if b, _ := v.(bool); b {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceCluster is one row of the service to cluster correlation.
+type serviceCluster struct {
+	Service   string // Consul service, or a parenthesized role for local clusters
+	Cluster   string
+	Endpoints int
+	Healthy   int
+	consul    bool
+}
+
+// correlateClusters maps every cluster in a /clusters response to the Consul
+// service it stands for, using the cluster name and, failing that, the SPIFFE
+// ID in configDump (which may be nil). Consul services come first, sorted by
+// service; other clusters follow, named "-".
+func correlateClusters(clusters, configDump []byte) ([]serviceCluster, error) {
+	health, err := parseClusterHealth(clusters)
+	if err != nil {
+		return nil, err
+	}
+	var spiffe map[string]consulService
+	if configDump != nil {
+		spiffe = spiffeServices(configDump)
+	}
+
+	rows := make([]serviceCluster, 0, len(health))
+	for name, h := range health {
+		row := serviceCluster{Service: "-", Cluster: name, Endpoints: h.Endpoints, Healthy: h.Healthy}
+		if svc, ok := parseConsulClusterName(name); ok {
+			row.Service, row.consul = svc.String(), true
+		} else if svc, ok := spiffe[name]; ok {
+			row.Service, row.consul = svc.String(), true
+		} else if role, ok := consulLocalClusters[name]; ok {
+			row.Service = role
+		} else if strings.HasPrefix(name, "exposed_cluster_") {
+			row.Service = "(exposed path)"
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.consul != b.consul {
+			return a.consul
+		}
+		if a.consul && a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Cluster < b.Cluster
+	})
+	return rows, nil
+}
+
+// health renders the healthy share of the row's endpoints.
+func (r serviceCluster) health() string {
+	switch {
+	case r.Endpoints == 0:
+		return "no endpoints"
+	case r.Healthy == r.Endpoints:
+		return "healthy"
+	case r.Healthy == 0:
+		return "UNHEALTHY"
+	}
+	return fmt.Sprintf("DEGRADED (%d unhealthy)", r.Endpoints-r.Healthy)
+}
+
+// printServiceClusters writes the correlation as a table.
+func printServiceClusters(w io.Writer, rows []serviceCluster) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tCLUSTER\tENDPOINTS\tHEALTH")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%s\n", r.Service, r.Cluster, r.Healthy, r.Endpoints, r.health())
+	}
+	tw.Flush()
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConsulClusterName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   consulService
+		wantOK bool
+	}{
+		{
+			name:   "api.default.dc1.internal.0a1b2c3d-1111-2222-3333-444455556666.consul",
+			want:   consulService{Name: "api", Namespace: "default", Datacenter: "dc1"},
+			wantOK: true,
+		},
+		{
+			name:   "v2.api.default.dc1.internal.0a1b2c3d-1111-2222-3333-444455556666.consul",
+			want:   consulService{Name: "api", Namespace: "default", Datacenter: "dc1", Subset: "v2"},
+			wantOK: true,
+		},
+		{
+			name:   "db.team-a.part1.dc2.internal-v1.0a1b2c3d.consul",
+			want:   consulService{Name: "db", Namespace: "team-a", Partition: "part1", Datacenter: "dc2"},
+			wantOK: true,
+		},
+		{
+			name:   "billing.default.default.east.external.0a1b2c3d.consul",
+			want:   consulService{Name: "billing", Namespace: "default", Partition: "default", Peer: "east"},
+			wantOK: true,
+		},
+		{name: "local_app"},
+		{name: "passthrough~api.default.dc1.internal.0a1b2c3d.consul~1"},
+		{name: "too.many.labels.here.dc1.internal.0a1b2c3d.consul"},
+		{name: "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseConsulClusterName(tt.name)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("parseConsulClusterName() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseSPIFFEService(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   consulService
+		wantOK bool
+	}{
+		{
+			in:     `{"exact":"spiffe://0a1b2c3d.consul/ns/default/dc/dc1/svc/api"}`,
+			want:   consulService{Name: "api", Namespace: "default", Datacenter: "dc1"},
+			wantOK: true,
+		},
+		{
+			in:     "spiffe://0a1b2c3d.consul/ap/part1/ns/team-a/dc/dc2/svc/db",
+			want:   consulService{Name: "db", Namespace: "team-a", Partition: "part1", Datacenter: "dc2"},
+			wantOK: true,
+		},
+		{in: "spiffe://0a1b2c3d.consul/gateway/mesh/dc/dc1"},
+		{in: "no identity here"},
+	}
+	for _, tt := range tests {
+		got, ok := parseSPIFFEService(tt.in)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseSPIFFEService(%q) = %+v, %v, want %+v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseClusterHealth(t *testing.T) {
+	want := map[string]*clusterHealth{
+		"api.default.dc1.internal.td.consul": {Endpoints: 2, Healthy: 1},
+		"local_app":                          {Endpoints: 1, Healthy: 1},
+		"db.default.dc1.internal.td.consul":  {},
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "text",
+			data: `api.default.dc1.internal.td.consul::default_priority::max_connections::1024
+api.default.dc1.internal.td.consul::10.0.0.1:21000::cx_active::2
+api.default.dc1.internal.td.consul::10.0.0.1:21000::health_flags::healthy
+api.default.dc1.internal.td.consul::10.0.0.2:21000::health_flags::/failed_outlier_check
+local_app::127.0.0.1:8080::health_flags::healthy
+db.default.dc1.internal.td.consul::added_via_api::true
+`,
+		},
+		{
+			name: "json",
+			data: `{"cluster_statuses":[
+{"name":"api.default.dc1.internal.td.consul","host_statuses":[
+ {"health_status":{"eds_health_status":"HEALTHY"}},
+ {"health_status":{"eds_health_status":"HEALTHY","failed_outlier_check":true}}]},
+{"name":"local_app","host_statuses":[{"health_status":{}}]},
+{"name":"db.default.dc1.internal.td.consul"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClusterHealth([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseClusterHealth() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseClusterHealth() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := parseClusterHealth([]byte(`{"cluster_statuses":`)); err == nil {
+		t.Error("parseClusterHealth() accepted truncated JSON")
+	}
+}
+
+func TestCorrelateClusters(t *testing.T) {
+	clusters := []byte(`custom-upstream::10.0.0.9:21000::health_flags::/failed_active_hc
+local_app::127.0.0.1:8080::health_flags::healthy
+api.default.dc1.internal.td.consul::10.0.0.1:21000::health_flags::healthy
+self_admin::127.0.0.1:19000::health_flags::healthy
+original-destination::added_via_api::true
+`)
+	configDump := []byte(`{"configs":[{"@type":"type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+"dynamic_active_clusters":[{"cluster":{"name":"custom-upstream","transport_socket":{"typed_config":
+{"common_tls_context":{"validation_context":{"match_typed_subject_alt_names":[
+{"matcher":{"exact":"spiffe://td.consul/ns/default/dc/dc1/svc/billing"}}]}}}}}}]}]}`)
+
+	rows, err := correlateClusters(clusters, configDump)
+	if err != nil {
+		t.Fatalf("correlateClusters() error: %v", err)
+	}
+	want := []serviceCluster{
+		{Service: "api", Cluster: "api.default.dc1.internal.td.consul", Endpoints: 1, Healthy: 1, consul: true},
+		{Service: "billing", Cluster: "custom-upstream", Endpoints: 1, consul: true},
+		{Service: "(local app)", Cluster: "local_app", Endpoints: 1, Healthy: 1},
+		{Service: "-", Cluster: "original-destination"},
+		{Service: "(envoy admin)", Cluster: "self_admin", Endpoints: 1, Healthy: 1},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("correlateClusters() = %+v, want %+v", rows, want)
+	}
+
+	var out bytes.Buffer
+	printServiceClusters(&out, rows)
+	for _, line := range []string{
+		"SERVICE        CLUSTER                             ENDPOINTS  HEALTH",
+		"api            api.default.dc1.internal.td.consul  1/1        healthy",
+		"billing        custom-upstream                     0/1        UNHEALTHY",
+		"-              original-destination                0/0        no endpoints",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("table missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestServiceClusterHealth(t *testing.T) {
+	tests := []struct {
+		endpoints, healthy int
+		want               string
+	}{
+		{0, 0, "no endpoints"},
+		{3, 3, "healthy"},
+		{3, 0, "UNHEALTHY"},
+		{3, 1, "DEGRADED (2 unhealthy)"},
+	}
+	for _, tt := range tests {
+		if got := (serviceCluster{Endpoints: tt.endpoints, Healthy: tt.healthy}).health(); got != tt.want {
+			t.Errorf("health(%d/%d) = %q, want %q", tt.healthy, tt.endpoints, got, tt.want)
+		}
+	}
+}
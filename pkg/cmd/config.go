@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ProjectConfigFile is loaded from the working directory when present.
+const ProjectConfigFile = ".xdsnap.yaml"
+
+// defaultConfigFiles returns the config files loaded automatically, lowest
+// precedence first: the user's $XDG_CONFIG_HOME/xdsnap/config.yaml
+// (~/.config/xdsnap/config.yaml by default), then ./.xdsnap.yaml.
+func defaultConfigFiles() []string {
+	var files []string
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		files = append(files, filepath.Join(dir, "xdsnap", "config.yaml"))
+	}
+	return append(files, ProjectConfigFile)
+}
+
+// loadConfig merges every discovered file that exists, then the explicit
+// --config file (which must exist), so later files override earlier ones.
+func loadConfig(discovered []string, explicit string) error {
+	for _, file := range discovered {
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		viper.SetConfigFile(file)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %w", file, err)
+		}
+	}
+	if explicit != "" {
+		viper.SetConfigFile(explicit)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %w", explicit, err)
+		}
+	}
+	return nil
+}
+
+// mutuallyExclusiveAnnotation is the flag annotation cobra's
+// MarkFlagsMutuallyExclusive records each group under, as space-separated
+// flag names.
+const mutuallyExclusiveAnnotation = "cobra_annotation_mutually_exclusive"
+
+// configEnvOverrides maps flags whose environment variable, when set, wins
+// over the config files.
+var configEnvOverrides = map[string]string{"namespace": "NOMAD_NAMESPACE"}
+
+// applyConfigDefaults sets every flag that was not given on the command line
+// and has a top-level key of the same name in the loaded config, so config
+// files supply defaults that explicit flags override. A flag set this way
+// counts as Changed, so the checks on flags a user chose apply to config
+// values too. A config value is skipped when a flag it is mutually exclusive
+// with was given on the command line, so --profile drops a config endpoints
+// list, or when its environment variable in configEnvOverrides is set.
+func applyConfigDefaults(flags *pflag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *pflag.Flag) { explicit[f.Name] = true })
+
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || explicit[f.Name] || f.Name == "config" || !viper.InConfig(f.Name) {
+			return
+		}
+		if env, ok := configEnvOverrides[f.Name]; ok && os.Getenv(env) != "" {
+			return
+		}
+		for _, group := range f.Annotations[mutuallyExclusiveAnnotation] {
+			for _, name := range strings.Fields(group) {
+				if explicit[name] {
+					return
+				}
+			}
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(viper.GetStringSlice(f.Name))
+		} else {
+			err = f.Value.Set(viper.GetString(f.Name))
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid %s in config file: %w", f.Name, err)
+			return
+		}
+		f.Changed = true
+	})
+	return err
+}
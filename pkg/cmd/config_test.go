@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	user := writeConfig(t, dir, "user.yaml", "profile: tls\nnamespace: user-ns\nsleep: 10\n")
+	project := writeConfig(t, dir, "project.yaml", "namespace: project-ns\n")
+	explicit := writeConfig(t, dir, "explicit.yaml", "sleep: 30\n")
+
+	if err := loadConfig([]string{user, filepath.Join(dir, "missing.yaml"), project}, explicit); err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	for key, want := range map[string]string{"profile": "tls", "namespace": "project-ns", "sleep": "30"} {
+		if got := viper.GetString(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLoadConfigMissingExplicit(t *testing.T) {
+	defer viper.Reset()
+	if err := loadConfig(nil, filepath.Join(t.TempDir(), "nope.yaml")); err == nil {
+		t.Error("expected an error for a missing --config file")
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	cfg := writeConfig(t, dir, "config.yaml", "profile: perf\nsleep: 15\nextra-endpoints: [/memory, /init_dump]\noutput-dir: /from/config\n")
+	if err := loadConfig(nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	profile := flags.String("profile", DefaultProfile, "")
+	sleep := flags.Int("sleep", 5, "")
+	extra := flags.StringSlice("extra-endpoints", nil, "")
+	outputDir := flags.String("output-dir", ".", "")
+	trace := flags.Bool("enable-trace", false, "")
+	if err := flags.Parse([]string{"--output-dir", "/from/flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfigDefaults(flags); err != nil {
+		t.Fatalf("applyConfigDefaults() error: %v", err)
+	}
+	if *profile != "perf" || *sleep != 15 {
+		t.Errorf("profile = %q, sleep = %d; want perf, 15", *profile, *sleep)
+	}
+	if want := []string{"/memory", "/init_dump"}; !reflect.DeepEqual(*extra, want) {
+		t.Errorf("extra-endpoints = %v, want %v", *extra, want)
+	}
+	if *outputDir != "/from/flag" {
+		t.Errorf("output-dir = %q, explicit flag should win", *outputDir)
+	}
+	if *trace {
+		t.Error("enable-trace changed without a config key")
+	}
+	for _, name := range []string{"profile", "sleep", "extra-endpoints"} {
+		if !flags.Changed(name) {
+			t.Errorf("%s set from config but not marked as changed", name)
+		}
+	}
+	if flags.Changed("enable-trace") {
+		t.Error("enable-trace marked as changed without a config key")
+	}
+}
+
+func TestApplyConfigDefaultsAdminTarget(t *testing.T) {
+	defer viper.Reset()
+	cfg := writeConfig(t, t.TempDir(), "config.yaml", "envoy-admin-ip: 10.0.0.5\nenvoy-admin-port: [19001]\n")
+	if err := loadConfig(nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	addr := flags.String("envoy-admin-ip", "", "")
+	ports := flags.IntSlice("envoy-admin-port", []int{nomad.EnvoyAdminPort}, "")
+	if err := applyConfigDefaults(flags); err != nil {
+		t.Fatal(err)
+	}
+
+	def := adminTarget{addr: *addr, ports: *ports}
+	got := allocAdminTarget("connect-proxy-dataplane", def, flags.Changed("envoy-admin-ip"), flags.Changed("envoy-admin-port"))
+	if got.addr != "10.0.0.5" || !reflect.DeepEqual(got.ports, []int{19001}) {
+		t.Errorf("dataplane target = %s %v, want the config's 10.0.0.5 [19001]", got.addr, got.ports)
+	}
+}
+
+func TestApplyConfigDefaultsNamespaceEnv(t *testing.T) {
+	defer viper.Reset()
+	t.Setenv("NOMAD_NAMESPACE", "from-env")
+	cfg := writeConfig(t, t.TempDir(), "config.yaml", "namespace: from-config\n")
+	if err := loadConfig(nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("namespace", "", "")
+	if err := applyConfigDefaults(flags); err != nil {
+		t.Fatal(err)
+	}
+	if flags.Changed("namespace") {
+		t.Error("config namespace applied over NOMAD_NAMESPACE")
+	}
+}
+
+// TestCaptureConfigFlags runs capture with a config file and arguments that
+// fail validation before any Nomad request, checking that config values go
+// through the same checks as flags and lose to conflicting explicit flags.
+func TestCaptureConfigFlags(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "config tcpdump-interface needs tcpdump",
+			config:  "tcpdump-interface: eth1\n",
+			args:    []string{"--service", "web"},
+			wantErr: "--tcpdump-interface requires --tcpdump",
+		},
+		{
+			name:    "config tcpdump-files needs tcpdump",
+			config:  "tcpdump-files: 3\n",
+			args:    []string{"--service", "web"},
+			wantErr: "--tcpdump-max-size and --tcpdump-files require --tcpdump",
+		},
+		{
+			name:    "config envoy-admin-ip conflicts with --admin-port-label",
+			config:  "envoy-admin-ip: 10.0.0.5\n",
+			args:    []string{"--service", "web", "--admin-port-label", "envoy_admin", "--endpoint-timeout", "default=5s"},
+			wantErr: "--admin-port-label can't be combined",
+		},
+		{
+			// The allowlist rejects whatever endpoints were resolved
+			name:    "explicit --profile drops config endpoints",
+			config:  "endpoints: [/memory]\nallowed-endpoints: [/logging]\n",
+			args:    []string{"--service", "web", "--profile", "tls"},
+			wantErr: "/certs, /config_dump, /stats?filter=ssl not permitted",
+		},
+		{
+			name:    "explicit --endpoints drops config profile",
+			config:  "profile: tls\nallowed-endpoints: [/logging]\n",
+			args:    []string{"--service", "web", "--endpoints", "/memory"},
+			wantErr: "/memory not permitted",
+		},
+		{
+			name:    "config endpoints and profile together",
+			config:  "endpoints: [/memory]\nprofile: tls\n",
+			args:    []string{"--service", "web"},
+			wantErr: "[endpoints profile]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer viper.Reset()
+			cfg := writeConfig(t, t.TempDir(), "config.yaml", tt.config)
+			root := NewRootCommand(IOStreams{In: strings.NewReader(""), Out: io.Discard, ErrOut: io.Discard})
+			root.SetArgs(append([]string{"--config", cfg, "capture"}, tt.args...))
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+
+			err := root.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyConfigDefaultsInvalid(t *testing.T) {
+	defer viper.Reset()
+	cfg := writeConfig(t, t.TempDir(), "config.yaml", "sleep: soon\n")
+	if err := loadConfig(nil, cfg); err != nil {
+		t.Fatal(err)
+	}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("sleep", 5, "")
+	if err := applyConfigDefaults(flags); err == nil {
+		t.Error("expected an error for a non-integer sleep")
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats --config-format accepts for saved Envoy config.
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+)
+
+var ConfigFormats = []string{ConfigFormatJSON, ConfigFormatYAML}
+
+// yamlEndpoints are the admin paths whose JSON responses --config-format
+// yaml rewrites.
+var yamlEndpoints = map[string]bool{
+	"/config_dump": true,
+	"/clusters":    true,
+	"/listeners":   true,
+}
+
+// convertsToYAML reports whether endpoint's response is rewritten as YAML
+// under --config-format yaml.
+func convertsToYAML(endpoint string) bool {
+	path, _, _ := strings.Cut(endpoint, "?")
+	return yamlEndpoints[path]
+}
+
+// jsonToYAML re-encodes a JSON document as block-style YAML, keeping key
+// order. It fails when data is not JSON, e.g. the text form of /clusters.
+func jsonToYAML(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, fmt.Errorf("not a JSON document")
+	}
+	// JSON is valid YAML, so parsing keeps order and scalar types
+	var doc yaml.Node
+	if err := yaml.Unmarshal(trimmed, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	clearStyle(&doc)
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// clearStyle drops the flow and quoting styles carried over from JSON so the
+// encoder picks block style and only quotes where YAML needs it.
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		clearStyle(c)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import "testing"
+
+func TestJSONToYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "keeps order and types",
+			input: `{"name":"web","port":8080,"tls":true,"hosts":["a","b"],"empty":{},"version":"1.0"}`,
+			want:  "name: web\nport: 8080\ntls: true\nhosts:\n  - a\n  - b\nempty: {}\nversion: \"1.0\"\n",
+		},
+		{
+			name:  "nested objects",
+			input: `{"configs":[{"@type":"type.googleapis.com/envoy.admin.v3.ListenersConfigDump"}]}`,
+			want:  "configs:\n  - '@type': type.googleapis.com/envoy.admin.v3.ListenersConfigDump\n",
+		},
+		{name: "text clusters output", input: "local_agent::default_priority::max_connections::1024\n", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonToYAML([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jsonToYAML() error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("jsonToYAML() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertsToYAML(t *testing.T) {
+	tests := map[string]bool{
+		"/config_dump":                   true,
+		"/config_dump?include_eds":       true,
+		"/clusters?format=json":          true,
+		"/listeners":                     true,
+		"/stats":                         false,
+		"/config_dump_extra":             false,
+		"/stats?filter=cluster.listener": false,
+	}
+	for endpoint, want := range tests {
+		if got := convertsToYAML(endpoint); got != want {
+			t.Errorf("convertsToYAML(%q) = %v, want %v", endpoint, got, want)
+		}
+	}
+}
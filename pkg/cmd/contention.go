@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// contentionWarnCount is the number of contended mutex acquisitions above
+// which the summary calls out lock contention.
+const contentionWarnCount = 1000
+
+// contentionStats mirrors Envoy's /contention response. Envoy encodes the
+// 64-bit counters as JSON strings.
+type contentionStats struct {
+	NumContentions     uint64 `json:"num_contentions,string"`
+	CurrentWaitCycles  uint64 `json:"current_wait_cycles,string"`
+	LifetimeWaitCycles uint64 `json:"lifetime_wait_cycles,string"`
+}
+
+// parseContention parses a /contention response. ok is false when Envoy was
+// started without --enable-mutex-tracing, in which case it answers with an
+// explanatory message (or nothing) instead of JSON.
+func parseContention(data []byte) (stats contentionStats, ok bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return contentionStats{}, false
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return contentionStats{}, false
+	}
+	return stats, true
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseContention(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   contentionStats
+		wantOK bool
+	}{
+		{
+			name:   "enabled",
+			input:  `{"num_contentions":"1500","current_wait_cycles":"20","lifetime_wait_cycles":"90000"}`,
+			want:   contentionStats{NumContentions: 1500, CurrentWaitCycles: 20, LifetimeWaitCycles: 90000},
+			wantOK: true,
+		},
+		{
+			name:  "tracing disabled",
+			input: "Mutex contention tracing is not enabled. To enable, run Envoy with flag --enable-mutex-tracing\n",
+		},
+		{name: "empty", input: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseContention([]byte(tt.input))
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseContention() = (%+v, %v), want (%+v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSummarizeCaptureContention(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"significant", `{"num_contentions":"5000","current_wait_cycles":"0","lifetime_wait_cycles":"123456"}`, "5000 contended mutex acquisitions"},
+		{"low", `{"num_contentions":"3","current_wait_cycles":"0","lifetime_wait_cycles":"10"}`, ""},
+		{"disabled", "Mutex contention tracing is not enabled.", "--enable-mutex-tracing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := summarizeCapture(map[string][]byte{"/contention": []byte(tt.data)}, SnapshotConfig{})
+			if tt.want == "" {
+				if !summary.empty() {
+					t.Errorf("expected no findings, got %q", summary.String())
+				}
+				return
+			}
+			if !strings.Contains(summary.String(), tt.want) {
+				t.Errorf("summary %q does not mention %q", summary.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// dedupTracker remembers the content hash of each endpoint from the previous
+// repeat cycle, and the snapshot that holds the full copy, so unchanged
+// responses can be written as small markers.
+type dedupTracker struct {
+	mu   sync.Mutex
+	seen map[string]dedupEntry
+}
+
+type dedupEntry struct {
+	sum      [sha256.Size]byte
+	snapshot string // snapshot directory holding the full copy
+}
+
+// unchanged reports whether data matches what key held in the previous
+// cycle, returning the snapshot with the full copy. Otherwise data is
+// recorded as living in snapshot.
+func (t *dedupTracker) unchanged(key string, data []byte, snapshot string) (string, bool) {
+	sum := sha256.Sum256(data)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = make(map[string]dedupEntry)
+	}
+	if prev, ok := t.seen[key]; ok && prev.sum == sum {
+		return prev.snapshot, true
+	}
+	t.seen[key] = dedupEntry{sum: sum, snapshot: snapshot}
+	return "", false
+}
+
+// unchangedMarker is the content written in place of an unchanged file.
+func unchangedMarker(name, snapshot string, data []byte) []byte {
+	return []byte(fmt.Sprintf("unchanged: same content as %s in %s\nsha256: %x\n", name, snapshot, sha256.Sum256(data)))
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupTracker(t *testing.T) {
+	var tracker dedupTracker
+	steps := []struct {
+		key, data, snapshot string
+		wantSnapshot        string
+		wantUnchanged       bool
+	}{
+		{"a:/stats", "one", "snapshot_1", "", false},
+		{"a:/stats", "one", "snapshot_2", "snapshot_1", true},
+		{"b:/stats", "one", "snapshot_2", "", false},
+		{"a:/stats", "one", "snapshot_3", "snapshot_1", true},
+		{"a:/stats", "two", "snapshot_4", "", false},
+		{"a:/stats", "two", "snapshot_5", "snapshot_4", true},
+		{"a:/stats", "one", "snapshot_6", "", false},
+	}
+	for i, s := range steps {
+		snapshot, unchanged := tracker.unchanged(s.key, []byte(s.data), s.snapshot)
+		if snapshot != s.wantSnapshot || unchanged != s.wantUnchanged {
+			t.Errorf("step %d: unchanged(%q, %q) = (%q, %v), want (%q, %v)", i, s.key, s.data, snapshot, unchanged, s.wantSnapshot, s.wantUnchanged)
+		}
+	}
+}
+
+func TestUnchangedMarker(t *testing.T) {
+	got := string(unchangedMarker("config_dump.json", "snapshot_20240101_120000", []byte("x")))
+	for _, want := range []string{"config_dump.json", "snapshot_20240101_120000", "sha256: 2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("marker %q missing %q", got, want)
+		}
+	}
+}
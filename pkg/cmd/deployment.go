@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// jobKey identifies a job across namespaces.
+func jobKey(alloc nomad.AllocationInfo) string {
+	return alloc.Namespace + "/" + alloc.JobID
+}
+
+// lookupJobDeployments fetches the latest deployment and recent evaluations
+// of every job running one of allocs, once per job. Jobs that can't be
+// looked up are logged and left out.
+func lookupJobDeployments(nomadService nomad.NomadApiService, allocs []nomad.AllocationInfo) map[string]*nomad.JobDeployment {
+	deployments := make(map[string]*nomad.JobDeployment)
+	failed := make(map[string]bool)
+	for _, alloc := range allocs {
+		key := jobKey(alloc)
+		if alloc.JobID == "" || deployments[key] != nil || failed[key] {
+			continue
+		}
+		jd, err := nomadService.GetJobDeployment(alloc.Namespace, alloc.JobID)
+		if err != nil {
+			log.Printf("WARNING: not capturing the deployment of job %s: %v", alloc.JobID, err)
+			failed[key] = true
+			continue
+		}
+		deployments[key] = jd
+	}
+	return deployments
+}
+
+// deploymentFailedStatuses are the deployment states that stop a rollout.
+var deploymentFailedStatuses = map[string]bool{"failed": true, "cancelled": true, "blocked": true, "paused": true}
+
+// deploymentFindings describes a rollout that failed or is stuck, and the
+// most recent placement failures of the job.
+func deploymentFindings(jd *nomad.JobDeployment) []string {
+	if jd == nil {
+		return nil
+	}
+	var findings []string
+	if d := jd.Deployment; d != nil {
+		prefix := fmt.Sprintf("Nomad deployment %s of job %s (version %d)", shortID(d.ID), jd.JobID, d.JobVersion)
+		if deploymentFailedStatuses[d.Status] {
+			finding := fmt.Sprintf("%s is %s", prefix, d.Status)
+			if d.StatusDescription != "" {
+				finding += ": " + d.StatusDescription
+			}
+			findings = append(findings, finding)
+		}
+		groups := make([]string, 0, len(d.TaskGroups))
+		for name := range d.TaskGroups {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+		for _, name := range groups {
+			g := d.TaskGroups[name]
+			if g.UnhealthyAllocs > 0 {
+				findings = append(findings, fmt.Sprintf("%s: group %s has %d unhealthy allocation(s)", prefix, name, g.UnhealthyAllocs))
+			}
+			if d.Status == "running" && g.DesiredCanaries > 0 && !g.Promoted {
+				findings = append(findings, fmt.Sprintf("%s: group %s has %d of %d canaries placed, awaiting promotion", prefix, name, g.PlacedCanaries, g.DesiredCanaries))
+			}
+		}
+	}
+
+	// Evaluations are newest first; a later one that placed everything
+	// supersedes older placement failures
+	for _, e := range jd.Evaluations {
+		if len(e.FailedGroups) == 0 && e.Status != "failed" {
+			if e.Status == "complete" {
+				break
+			}
+			continue
+		}
+		prefix := fmt.Sprintf("Nomad evaluation %s of job %s (%s)", shortID(e.ID), jd.JobID, e.TriggeredBy)
+		if e.Status == "failed" {
+			finding := prefix + " failed"
+			if e.StatusDescription != "" {
+				finding += ": " + e.StatusDescription
+			}
+			findings = append(findings, finding)
+		}
+		groups := make([]string, 0, len(e.FailedGroups))
+		for name := range e.FailedGroups {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+		for _, name := range groups {
+			finding := fmt.Sprintf("%s could not place group %s", prefix, name)
+			if reasons := e.FailedGroups[name]; len(reasons) > 0 {
+				finding += ": " + strings.Join(reasons, "; ")
+			}
+			findings = append(findings, finding)
+		}
+		break
+	}
+	return findings
+}
+
+// shortID returns the first 8 characters of a Nomad ID.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// writeJobDeployment saves the deployment, when the job has one, as
+// deployment.json and the evaluations as evaluations.json in dir.
+func writeJobDeployment(jd *nomad.JobDeployment, dir string) error {
+	if jd.DeploymentRaw != nil {
+		if err := os.WriteFile(filepath.Join(dir, "deployment.json"), append(jd.DeploymentRaw, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "evaluations.json"), append(jd.EvaluationsRaw, '\n'), 0644)
+}
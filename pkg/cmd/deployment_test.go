@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestDeploymentFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		jd   *nomad.JobDeployment
+		want []string
+	}{
+		{"not looked up", nil, nil},
+		{
+			name: "healthy rollout",
+			jd: &nomad.JobDeployment{JobID: "web", Deployment: &nomad.Deployment{ID: "d1234567-89ab", JobVersion: 3, Status: "successful",
+				TaskGroups: map[string]nomad.DeploymentGroup{"web": {DesiredTotal: 2, PlacedAllocs: 2, HealthyAllocs: 2}}}},
+		},
+		{
+			name: "failed canary",
+			jd: &nomad.JobDeployment{JobID: "web", Deployment: &nomad.Deployment{ID: "d1234567-89ab", JobVersion: 4, Status: "failed", StatusDescription: "Failed due to unhealthy allocations",
+				TaskGroups: map[string]nomad.DeploymentGroup{"web": {DesiredTotal: 2, DesiredCanaries: 1, PlacedCanaries: 1, UnhealthyAllocs: 1}}}},
+			want: []string{
+				"Nomad deployment d1234567 of job web (version 4) is failed: Failed due to unhealthy allocations",
+				"Nomad deployment d1234567 of job web (version 4): group web has 1 unhealthy allocation(s)",
+			},
+		},
+		{
+			name: "awaiting promotion",
+			jd: &nomad.JobDeployment{JobID: "web", Deployment: &nomad.Deployment{ID: "d1234567", JobVersion: 5, Status: "running",
+				TaskGroups: map[string]nomad.DeploymentGroup{"web": {DesiredCanaries: 2, PlacedCanaries: 2}}}},
+			want: []string{"Nomad deployment d1234567 of job web (version 5): group web has 2 of 2 canaries placed, awaiting promotion"},
+		},
+		{
+			name: "placement failure",
+			jd: &nomad.JobDeployment{JobID: "web", Evaluations: []nomad.Evaluation{
+				{ID: "blocked-eval", TriggeredBy: "queued-allocs", Status: "blocked"},
+				{ID: "e1234567-89ab", TriggeredBy: "job-register", Status: "complete", FailedGroups: map[string][]string{
+					"web": {"memory exhausted on 3 nodes", `constraint "${node.class} = edge" filtered 1 nodes`},
+				}},
+				{ID: "older", TriggeredBy: "job-register", Status: "complete", FailedGroups: map[string][]string{"web": nil}},
+			}},
+			want: []string{`Nomad evaluation e1234567 of job web (job-register) could not place group web: memory exhausted on 3 nodes; constraint "${node.class} = edge" filtered 1 nodes`},
+		},
+		{
+			name: "placed since",
+			jd: &nomad.JobDeployment{JobID: "web", Evaluations: []nomad.Evaluation{
+				{ID: "latest", TriggeredBy: "node-update", Status: "complete"},
+				{ID: "e1234567", TriggeredBy: "job-register", Status: "complete", FailedGroups: map[string][]string{"web": {"memory exhausted on 3 nodes"}}},
+			}},
+		},
+		{
+			name: "failed evaluation",
+			jd: &nomad.JobDeployment{JobID: "web", Evaluations: []nomad.Evaluation{
+				{ID: "e1234567", TriggeredBy: "job-register", Status: "failed", StatusDescription: "maximum attempts reached (5)"},
+			}},
+			want: []string{"Nomad evaluation e1234567 of job web (job-register) failed: maximum attempts reached (5)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deploymentFindings(tt.jd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deploymentFindings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// deploymentService counts deployment lookups per job.
+type deploymentService struct {
+	nomad.NomadApiService
+	calls map[string]int
+}
+
+func (s *deploymentService) GetJobDeployment(namespace, jobID string) (*nomad.JobDeployment, error) {
+	s.calls[namespace+"/"+jobID]++
+	if jobID == "broken" {
+		return nil, errors.New("permission denied")
+	}
+	return &nomad.JobDeployment{Namespace: namespace, JobID: jobID}, nil
+}
+
+func TestLookupJobDeployments(t *testing.T) {
+	svc := &deploymentService{calls: make(map[string]int)}
+	allocs := []nomad.AllocationInfo{
+		{ID: "a1", Namespace: "default", JobID: "web"},
+		{ID: "a2", Namespace: "default", JobID: "web"},
+		{ID: "a3", Namespace: "staging", JobID: "web"},
+		{ID: "a4", Namespace: "default", JobID: "broken"},
+		{ID: "a5", Namespace: "default", JobID: "broken"},
+	}
+	got := lookupJobDeployments(svc, allocs)
+	if want := map[string]int{"default/web": 1, "staging/web": 1, "default/broken": 1}; !reflect.DeepEqual(svc.calls, want) {
+		t.Errorf("lookups = %v, want %v", svc.calls, want)
+	}
+	if len(got) != 2 || got["staging/web"].Namespace != "staging" || got[jobKey(allocs[3])] != nil {
+		t.Errorf("lookupJobDeployments() = %v", got)
+	}
+}
+
+func TestWriteJobDeployment(t *testing.T) {
+	dir := t.TempDir()
+	jd := &nomad.JobDeployment{DeploymentRaw: []byte(`{"ID":"d1"}`), EvaluationsRaw: []byte(`[{"ID":"e1"}]`)}
+	if err := writeJobDeployment(jd, dir); err != nil {
+		t.Fatalf("writeJobDeployment() error: %v", err)
+	}
+	for name, want := range map[string]string{"deployment.json": "{\"ID\":\"d1\"}\n", "evaluations.json": "[{\"ID\":\"e1\"}]\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	// System and batch jobs have no deployment
+	dir = t.TempDir()
+	if err := writeJobDeployment(&nomad.JobDeployment{EvaluationsRaw: []byte("[]")}, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "deployment.json")); !os.IsNotExist(err) {
+		t.Errorf("deployment.json written for a job without a deployment: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// destructiveEndpoints are the Envoy admin paths that change or stop the
+// proxy instead of reporting on it, with what they do.
+var destructiveEndpoints = map[string]string{
+	"/quitquitquit":                "shuts Envoy down",
+	"/drain_listeners":             "drains every listener",
+	"/healthcheck/fail":            "fails Envoy's health check, taking it out of service",
+	"/healthcheck/ok":              "overrides a failed health check",
+	"/reset_counters":              "resets every counter",
+	"/runtime_modify":              "changes runtime values",
+	"/cpuprofiler":                 "starts or stops the CPU profiler",
+	"/heapprofiler":                "starts or stops the heap profiler",
+	"/reopen_logs":                 "reopens the access logs",
+	"/stats/recentlookups/clear":   "clears the recent stat lookups",
+	"/stats/recentlookups/disable": "disables recent stat lookup tracking",
+	"/stats/recentlookups/enable":  "enables recent stat lookup tracking",
+}
+
+// destructiveEndpoint reports what endpoint would do to the proxy, if it is
+// destructive. /logging only lists log levels unless given a query.
+func destructiveEndpoint(endpoint string) (string, bool) {
+	path, query, _ := strings.Cut(endpoint, "?")
+	path = "/" + strings.Trim(path, "/")
+	if path == "/logging" && query != "" {
+		return "changes log levels", true
+	}
+	effect, ok := destructiveEndpoints[path]
+	return effect, ok
+}
+
+// destructiveRequests returns one description per destructive endpoint in
+// endpoints, e.g. "/quitquitquit (shuts Envoy down)".
+func destructiveRequests(endpoints []string) []string {
+	var found []string
+	for _, endpoint := range endpoints {
+		if effect, ok := destructiveEndpoint(endpoint); ok {
+			found = append(found, fmt.Sprintf("%s (%s)", endpoint, effect))
+		}
+	}
+	return found
+}
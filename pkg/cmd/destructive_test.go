@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDestructiveEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"/quitquitquit", true},
+		{"/drain_listeners?graceful&inboundonly", true},
+		{"/healthcheck/fail", true},
+		{"/healthcheck/fail/", true},
+		{"//reset_counters", true},
+		{"/logging?level=trace", true},
+		{"/logging", false},
+		{"/stats", false},
+		{"/stats/recentlookups", false},
+		{"/stats/recentlookups/clear", true},
+		{"/config_dump?include_eds", false},
+	}
+	for _, tt := range tests {
+		if _, got := destructiveEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("destructiveEndpoint(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestDestructiveRequests(t *testing.T) {
+	got := destructiveRequests([]string{"/stats", "/quitquitquit", "/clusters", "/reset_counters"})
+	want := []string{"/quitquitquit (shuts Envoy down)", "/reset_counters (resets every counter)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("destructiveRequests() = %q, want %q", got, want)
+	}
+	if got := destructiveRequests(DefaultEndpoints); got != nil {
+		t.Errorf("destructiveRequests(DefaultEndpoints) = %q, want none", got)
+	}
+}
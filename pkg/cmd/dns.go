@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// maxDNSLookups bounds how many upstream hostnames are resolved per capture.
+const maxDNSLookups = 20
+
+// lookupCommands resolve one hostname and are tried in order until one is
+// available in the task.
+var lookupCommands = [][]string{
+	{"getent", "hosts"},
+	{"nslookup"},
+}
+
+// clustersDump mirrors the parts of the ClustersConfigDump section of Envoy's
+// /config_dump that carry endpoint addresses.
+type clustersDump struct {
+	Type           string           `json:"@type"`
+	StaticClusters []clusterWrapper `json:"static_clusters"`
+	ActiveClusters []clusterWrapper `json:"dynamic_active_clusters"`
+}
+
+type clusterWrapper struct {
+	Cluster struct {
+		LoadAssignment struct {
+			Endpoints []struct {
+				LbEndpoints []struct {
+					Endpoint struct {
+						Address struct {
+							SocketAddress struct {
+								Address string `json:"address"`
+							} `json:"socket_address"`
+						} `json:"address"`
+					} `json:"endpoint"`
+				} `json:"lb_endpoints"`
+			} `json:"endpoints"`
+		} `json:"load_assignment"`
+	} `json:"cluster"`
+}
+
+// dnsHostnames returns the sorted, de-duplicated cluster endpoint addresses
+// in an Envoy /config_dump that are hostnames rather than IPs, i.e. the
+// upstreams Envoy resolves through DNS.
+func dnsHostnames(configDump []byte) []string {
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, raw := range dump.Configs {
+		var clusters clustersDump
+		if err := json.Unmarshal(raw, &clusters); err != nil || !strings.HasSuffix(clusters.Type, ".ClustersConfigDump") {
+			continue
+		}
+		for _, c := range append(clusters.StaticClusters, clusters.ActiveClusters...) {
+			for _, e := range c.Cluster.LoadAssignment.Endpoints {
+				for _, lb := range e.LbEndpoints {
+					addr := lb.Endpoint.Address.SocketAddress.Address
+					if addr != "" && net.ParseIP(addr) == nil {
+						seen[addr] = true
+					}
+				}
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// captureDNS records /etc/resolv.conf and a lookup of each host from the task
+// used for Envoy admin access, which shares the sidecar's network namespace,
+// and writes the results to path. Failed lookups are recorded, not returned.
+func captureDNS(nomadService nomad.NomadApiService, config SnapshotConfig, hosts []string, path string) error {
+	task := config.SidecarTask
+	if config.ExecStrategy != nil {
+		task = config.ExecStrategy.Task
+	}
+
+	var b bytes.Buffer
+	run := func(cmd []string) (missing bool) {
+		var stdout, stderr bytes.Buffer
+		code, err := nomadService.ExecuteCommandWithStderr(config.AllocID, task, cmd, &stdout, &stderr)
+		if commandMissing(code, err, stderr.String()) {
+			return true
+		}
+		fmt.Fprintf(&b, "# %s (task %s)\n", strings.Join(cmd, " "), task)
+		b.Write(stdout.Bytes())
+		b.Write(stderr.Bytes())
+		if err != nil {
+			fmt.Fprintf(&b, "error: %v\n", err)
+		} else if code != 0 {
+			fmt.Fprintf(&b, "exit code %d\n", code)
+		}
+		b.WriteString("\n")
+		return false
+	}
+
+	if run([]string{"cat", "/etc/resolv.conf"}) {
+		return fmt.Errorf("cannot read /etc/resolv.conf in task %s: cat not available", task)
+	}
+
+	if len(hosts) == 0 {
+		b.WriteString("# no DNS-resolved upstreams in /config_dump\n")
+	}
+	if len(hosts) > maxDNSLookups {
+		fmt.Fprintf(&b, "# resolving the first %d of %d upstream hostnames\n\n", maxDNSLookups, len(hosts))
+		hosts = hosts[:maxDNSLookups]
+	}
+	for _, host := range hosts {
+		resolved := false
+		for _, cmd := range lookupCommands {
+			if !run(append(append([]string{}, cmd...), host)) {
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			fmt.Fprintf(&b, "# %s: no lookup tool in task %s (tried: getent, nslookup)\n\n", host, task)
+		}
+	}
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
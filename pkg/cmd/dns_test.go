@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDNSHostnames(t *testing.T) {
+	dump := `{"configs":[
+		{"@type":"type.googleapis.com/envoy.admin.v3.BootstrapConfigDump"},
+		{"@type":"type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+		 "static_clusters":[{"cluster":{"name":"local_agent","load_assignment":{"endpoints":[{"lb_endpoints":[{"endpoint":{"address":{"socket_address":{"address":"127.0.0.1","port_value":8502}}}}]}]}}}],
+		 "dynamic_active_clusters":[
+			{"cluster":{"name":"billing","load_assignment":{"endpoints":[{"lb_endpoints":[
+				{"endpoint":{"address":{"socket_address":{"address":"billing.example.com","port_value":443}}}},
+				{"endpoint":{"address":{"socket_address":{"address":"10.0.0.7","port_value":443}}}}]}]}}},
+			{"cluster":{"name":"db","load_assignment":{"endpoints":[{"lb_endpoints":[
+				{"endpoint":{"address":{"socket_address":{"address":"db.service.consul","port_value":5432}}}},
+				{"endpoint":{"address":{"socket_address":{"address":"billing.example.com","port_value":443}}}}]}]}}},
+			{"cluster":{"name":"eds","type":"EDS"}}
+		 ]}
+	]}`
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"hostnames only, sorted and unique", dump, []string{"billing.example.com", "db.service.consul"}},
+		{"no clusters section", `{"configs":[]}`, []string{}},
+		{"invalid json", `not json`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dnsHostnames([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dnsHostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// endpointTimeouts holds the --endpoint-timeout values: a timeout per admin
+// endpoint and a fallback for the rest. The zero value keeps the default
+// exec and direct request timeouts.
+type endpointTimeouts struct {
+	byEndpoint map[string]time.Duration
+	fallback   time.Duration
+}
+
+// parseEndpointTimeouts parses --endpoint-timeout entries of the form
+// <endpoint>=<duration>, e.g. /config_dump=30s. The endpoint "default" sets
+// the timeout of every endpoint without an entry of its own.
+func parseEndpointTimeouts(entries []string) (endpointTimeouts, error) {
+	var t endpointTimeouts
+	for _, entry := range entries {
+		// Split on the last "=", since an endpoint's query may contain one
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return endpointTimeouts{}, fmt.Errorf("invalid endpoint timeout %q: expected <endpoint>=<duration>, e.g. /config_dump=30s", entry)
+		}
+		endpoint, value := entry[:i], entry[i+1:]
+		if endpoint != "default" && !strings.HasPrefix(endpoint, "/") {
+			return endpointTimeouts{}, fmt.Errorf("invalid endpoint timeout %q: expected <endpoint>=<duration>, e.g. /config_dump=30s", entry)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return endpointTimeouts{}, fmt.Errorf("invalid endpoint timeout %q: %q is not a positive duration", entry, value)
+		}
+		if endpoint == "default" {
+			t.fallback = d
+			continue
+		}
+		if t.byEndpoint == nil {
+			t.byEndpoint = make(map[string]time.Duration)
+		}
+		if _, dup := t.byEndpoint[endpoint]; dup {
+			return endpointTimeouts{}, fmt.Errorf("endpoint timeout for %s given more than once", endpoint)
+		}
+		t.byEndpoint[endpoint] = d
+	}
+	return t, nil
+}
+
+// lookup returns the timeout of an endpoint: its own entry, else the entry of
+// its path without the query string, else the fallback. Zero means the
+// default request timeout.
+func (t endpointTimeouts) lookup(endpoint string) time.Duration {
+	if d, ok := t.byEndpoint[endpoint]; ok {
+		return d
+	}
+	path, _, _ := strings.Cut(endpoint, "?")
+	if d, ok := t.byEndpoint[path]; ok {
+		return d
+	}
+	return t.fallback
+}
+
+// apply returns strategy with the timeout of endpoint set, copying it so a
+// strategy shared across requests isn't changed.
+func (t endpointTimeouts) apply(strategy *nomad.ExecStrategy, endpoint string) *nomad.ExecStrategy {
+	d := t.lookup(endpoint)
+	if strategy == nil || d == 0 || d == strategy.Timeout {
+		return strategy
+	}
+	s := *strategy
+	s.Timeout = d
+	return &s
+}
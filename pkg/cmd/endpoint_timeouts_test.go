@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestParseEndpointTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"paths and default", []string{"/config_dump=30s", "/ready=2s", "default=10s"}, false},
+		{"query", []string{"/stats?format=json=5s"}, false},
+		{"missing duration", []string{"/config_dump"}, true},
+		{"not a path", []string{"config_dump=30s"}, true},
+		{"bad duration", []string{"/ready=soon"}, true},
+		{"zero duration", []string{"/ready=0s"}, true},
+		{"duplicate", []string{"/ready=2s", "/ready=3s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseEndpointTimeouts(tt.entries); (err != nil) != tt.wantErr {
+				t.Errorf("parseEndpointTimeouts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndpointTimeoutsLookup(t *testing.T) {
+	timeouts, err := parseEndpointTimeouts([]string{"/config_dump=30s", "/stats?format=json=5s", "/stats=3s", "default=10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		endpoint string
+		want     time.Duration
+	}{
+		{"/config_dump", 30 * time.Second},
+		{"/config_dump?include_eds", 30 * time.Second},
+		{"/stats?format=json", 5 * time.Second},
+		{"/stats?format=prometheus", 3 * time.Second},
+		{"/clusters", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := timeouts.lookup(tt.endpoint); got != tt.want {
+			t.Errorf("lookup(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+	if got := (endpointTimeouts{}).lookup("/clusters"); got != 0 {
+		t.Errorf("zero value lookup = %v, want 0", got)
+	}
+}
+
+func TestEndpointTimeoutsApply(t *testing.T) {
+	timeouts, _ := parseEndpointTimeouts([]string{"/config_dump=30s"})
+	shared := &nomad.ExecStrategy{Task: "web", Method: nomad.MethodCurl}
+
+	got := timeouts.apply(shared, "/config_dump")
+	if got == shared || got.Timeout != 30*time.Second || got.Task != "web" {
+		t.Errorf("apply() = %+v, want a copy with a 30s timeout", got)
+	}
+	if shared.Timeout != 0 {
+		t.Errorf("apply() changed the shared strategy: %+v", shared)
+	}
+	if got := timeouts.apply(shared, "/clusters"); got != shared {
+		t.Errorf("apply() without an entry = %+v, want the strategy unchanged", got)
+	}
+	if got := timeouts.apply(nil, "/config_dump"); got != nil {
+		t.Errorf("apply(nil) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// envoyVersion is a parsed Envoy release version.
+type envoyVersion struct {
+	major, minor, patch int
+}
+
+func (v envoyVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+func (v envoyVersion) less(o envoyVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	return v.patch < o.patch
+}
+
+var envoyVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseServerInfoVersion extracts the release from a /server_info response,
+// whose version looks like "<sha>/1.27.2/Clean/RELEASE/BoringSSL".
+func parseServerInfoVersion(data []byte) (envoyVersion, error) {
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return envoyVersion{}, fmt.Errorf("failed to parse server_info: %w", err)
+	}
+	for _, part := range strings.Split(info.Version, "/") {
+		m := envoyVersionPattern.FindStringSubmatch(part)
+		if m == nil {
+			continue
+		}
+		var v envoyVersion
+		v.major, _ = strconv.Atoi(m[1])
+		v.minor, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			v.patch, _ = strconv.Atoi(m[3])
+		}
+		return v, nil
+	}
+	return envoyVersion{}, fmt.Errorf("no release version in %q", info.Version)
+}
+
+// parseEnvoyVersion parses a --min-envoy-version value such as 1.26 or
+// 1.26.3.
+func parseEnvoyVersion(s string) (envoyVersion, error) {
+	m := envoyVersionPattern.FindStringSubmatch(strings.TrimPrefix(s, "v"))
+	if m == nil || len(m[0]) != len(strings.TrimPrefix(s, "v")) {
+		return envoyVersion{}, fmt.Errorf("invalid Envoy version %q: expected <major>.<minor>[.<patch>]", s)
+	}
+	var v envoyVersion
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.patch, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// checkMinEnvoyVersion compares the version in a /server_info response with
+// min. It returns the running version and whether it is older than min.
+func checkMinEnvoyVersion(serverInfo []byte, min envoyVersion) (envoyVersion, bool, error) {
+	version, err := parseServerInfoVersion(serverInfo)
+	if err != nil {
+		return envoyVersion{}, false, err
+	}
+	return version, version.less(min), nil
+}
+
+// endpointRequirement is the first Envoy release that serves an admin path,
+// or a query parameter on it when param is set.
+type endpointRequirement struct {
+	path  string
+	param string
+	since envoyVersion
+}
+
+// endpointRequirements lists admin features newer than the oldest Envoy
+// releases still run with Consul.
+var endpointRequirements = []endpointRequirement{
+	{path: "/stats/recentlookups", since: envoyVersion{1, 14, 0}},
+	{path: "/init_dump", since: envoyVersion{1, 17, 0}},
+	{path: "/stats", param: "histogram_buckets", since: envoyVersion{1, 19, 0}},
+}
+
+// gateEndpoints splits endpoints into those the running Envoy version serves
+// and a description of each one it does not.
+func gateEndpoints(endpoints []string, version envoyVersion) (supported, skipped []string) {
+	for _, endpoint := range endpoints {
+		if req, ok := unmetRequirement(endpoint, version); ok {
+			feature := req.path
+			if req.param != "" {
+				feature = fmt.Sprintf("%s?%s", req.path, req.param)
+			}
+			skipped = append(skipped, fmt.Sprintf("%s (%s requires Envoy %s, running %s)", endpoint, feature, req.since, version))
+			continue
+		}
+		supported = append(supported, endpoint)
+	}
+	return supported, skipped
+}
+
+func unmetRequirement(endpoint string, version envoyVersion) (endpointRequirement, bool) {
+	path, rawQuery, _ := strings.Cut(endpoint, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	for _, req := range endpointRequirements {
+		if req.path != path || !version.less(req.since) {
+			continue
+		}
+		if req.param == "" {
+			return req, true
+		}
+		if _, ok := query[req.param]; ok {
+			return req, true
+		}
+	}
+	return endpointRequirement{}, false
+}
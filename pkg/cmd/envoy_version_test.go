@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServerInfoVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    envoyVersion
+		wantErr bool
+	}{
+		{"release", `{"version":"e3616ca/1.27.2/Clean/RELEASE/BoringSSL"}`, envoyVersion{1, 27, 2}, false},
+		{"dev build", `{"version":"a1b2c3/1.30.0-dev/Modified/DEBUG/BoringSSL"}`, envoyVersion{1, 30, 0}, false},
+		{"missing version", `{"state":"LIVE"}`, envoyVersion{}, true},
+		{"invalid json", `not json`, envoyVersion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseServerInfoVersion([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseServerInfoVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseServerInfoVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGateEndpoints(t *testing.T) {
+	endpoints := []string{"/stats", "/init_dump", "/stats?histogram_buckets=cumulative", "/stats/recentlookups", "/clusters"}
+	tests := []struct {
+		name        string
+		version     envoyVersion
+		wantKept    []string
+		wantSkipped int
+	}{
+		{"current", envoyVersion{1, 27, 2}, endpoints, 0},
+		{"no histogram buckets", envoyVersion{1, 18, 4}, []string{"/stats", "/init_dump", "/stats/recentlookups", "/clusters"}, 1},
+		{"old", envoyVersion{1, 13, 0}, []string{"/stats", "/clusters"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped := gateEndpoints(endpoints, tt.version)
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept = %v, want %v", kept, tt.wantKept)
+			}
+			if len(skipped) != tt.wantSkipped {
+				t.Errorf("skipped = %v, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+
+	_, skipped := gateEndpoints([]string{"/init_dump"}, envoyVersion{1, 16, 0})
+	if want := "/init_dump (/init_dump requires Envoy 1.17.0, running 1.16.0)"; len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("skipped = %q, want %q", skipped, want)
+	}
+}
+
+func TestParseEnvoyVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    envoyVersion
+		wantErr bool
+	}{
+		{"1.26", envoyVersion{1, 26, 0}, false},
+		{"1.26.3", envoyVersion{1, 26, 3}, false},
+		{"v1.27.1", envoyVersion{1, 27, 1}, false},
+		{"1", envoyVersion{}, true},
+		{"1.26-dev", envoyVersion{}, true},
+		{"latest", envoyVersion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseEnvoyVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEnvoyVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseEnvoyVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMinEnvoyVersion(t *testing.T) {
+	min := envoyVersion{1, 26, 0}
+	tests := []struct {
+		name       string
+		serverInfo string
+		wantOld    bool
+		wantErr    bool
+	}{
+		{"older", `{"version":"abc/1.25.9/Clean/RELEASE/BoringSSL"}`, true, false},
+		{"equal", `{"version":"abc/1.26.0/Clean/RELEASE/BoringSSL"}`, false, false},
+		{"newer", `{"version":"abc/1.28.1/Clean/RELEASE/BoringSSL"}`, false, false},
+		{"no version", `{"version":"unknown"}`, false, true},
+		{"not json", `<html>`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, old, err := checkMinEnvoyVersion([]byte(tt.serverInfo), min)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkMinEnvoyVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if old != tt.wantOld {
+				t.Errorf("checkMinEnvoyVersion() tooOld = %v, want %v", old, tt.wantOld)
+			}
+		})
+	}
+}
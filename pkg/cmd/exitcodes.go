@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/markcampv/xDSnap/consul"
+)
+
+// Process exit codes. Automation can rely on these to tell a complete
+// capture from a partial one, or from one that never reached the cluster.
+const (
+	ExitOK           = 0 // every allocation was captured in full
+	ExitUsage        = 1 // invalid flags or arguments
+	ExitPartial      = 2 // some allocations or endpoints failed
+	ExitNoData       = 3 // nothing was captured
+	ExitConnectivity = 4 // Nomad or Consul could not be reached or rejected the token
+)
+
+// ExitError carries the exit code a command failure should produce.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+func (e *ExitError) Unwrap() error { return e.Err }
+
+func exitErrorf(code int, format string, args ...interface{}) error {
+	return &ExitError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// ExitCode maps an error returned by a command to the process exit code.
+// Errors that don't carry a code come from cobra's flag handling.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitUsage
+}
+
+// apiErrorf wraps a Nomad or Consul API error, classifying it as a usage
+// error (a rejected --consul-filter), a connectivity/auth failure or no data.
+func apiErrorf(err error, format string, args ...interface{}) error {
+	code := ExitNoData
+	switch {
+	case errors.Is(err, consul.ErrInvalidFilter):
+		code = ExitUsage
+	case isConnectivityError(err):
+		code = ExitConnectivity
+	}
+	return &ExitError{Code: code, Err: fmt.Errorf(format+": %w", append(args, err)...)}
+}
+
+// isConnectivityError reports whether an API error means the server could not
+// be reached or refused our credentials.
+func isConnectivityError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection refused", "no such host", "Unexpected response code: 401", "Unexpected response code: 403", "Permission denied", "ACL not found", "ACL token not found"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// PartialCaptureError is returned by CaptureSnapshot when the snapshot was
+// written but some endpoints could not be captured, or it could not be
+// uploaded to the --webhook.
+type PartialCaptureError struct {
+	AllocID   string
+	Missing   []string
+	UploadErr error
+}
+
+func (e *PartialCaptureError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "is missing "+strings.Join(e.Missing, ", "))
+	}
+	if e.UploadErr != nil {
+		problems = append(problems, "was saved locally but not uploaded: "+e.UploadErr.Error())
+	}
+	return fmt.Sprintf("snapshot for %s %s", e.AllocID[:8], strings.Join(problems, " and "))
+}
+
+func (e *PartialCaptureError) Unwrap() error { return e.UploadErr }
+
+// captureOutcome tallies per-allocation capture results across all cycles.
+type captureOutcome struct {
+	succeeded   int
+	partial     int
+	failed      int
+	interrupted bool // the run was stopped with Ctrl-C
+}
+
+// err returns nil when everything was captured, or an ExitError with
+// ExitPartial or ExitNoData.
+func (o captureOutcome) err() error {
+	switch {
+	case o.succeeded+o.partial == 0:
+		return exitErrorf(ExitNoData, "no allocations were captured")
+	case o.interrupted:
+		return exitErrorf(ExitPartial, "capture interrupted after %d allocation capture(s)", o.succeeded+o.partial+o.failed)
+	case o.partial > 0 || o.failed > 0:
+		return exitErrorf(ExitPartial, "%d of %d allocation capture(s) incomplete (%d partial, %d failed)",
+			o.partial+o.failed, o.succeeded+o.partial+o.failed, o.partial, o.failed)
+	}
+	return nil
+}
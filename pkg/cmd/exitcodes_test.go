@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/markcampv/xDSnap/consul"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitOK},
+		{"flag error", errors.New("unknown flag: --bogus"), ExitUsage},
+		{"wrapped exit error", fmt.Errorf("outer: %w", exitErrorf(ExitPartial, "partial")), ExitPartial},
+		{"refused connection", apiErrorf(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "discover"), ExitConnectivity},
+		{"permission denied", apiErrorf(errors.New("Unexpected response code: 403 (Permission denied)"), "discover"), ExitConnectivity},
+		{"not found", apiErrorf(errors.New("Unexpected response code: 404 (alloc not found)"), "lookup"), ExitNoData},
+		{"rejected filter", apiErrorf(fmt.Errorf("list services: %w", consul.ErrInvalidFilter), "discover"), ExitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		outcome captureOutcome
+		want    int
+	}{
+		{"all succeeded", captureOutcome{succeeded: 3}, ExitOK},
+		{"some endpoints missing", captureOutcome{succeeded: 2, partial: 1}, ExitPartial},
+		{"some allocations failed", captureOutcome{succeeded: 1, failed: 2}, ExitPartial},
+		{"only partial captures", captureOutcome{partial: 1}, ExitPartial},
+		{"nothing captured", captureOutcome{failed: 2}, ExitNoData},
+		{"interrupted", captureOutcome{succeeded: 2, interrupted: true}, ExitPartial},
+		{"interrupted before any capture", captureOutcome{interrupted: true}, ExitNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.outcome.err()); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandEnv expands $VAR, ${VAR} and ${VAR:-default} references in s using
+// the process environment. Referencing an undefined variable without a
+// default is an error. "$$" produces a literal "$", and a "$" that does not
+// start a variable name (e.g. a regex anchor) is kept as is.
+func expandEnv(s string) (string, error) {
+	return expandWith(s, os.LookupEnv)
+}
+
+func expandWith(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			expr := s[i+2 : i+2+end]
+			name, def, hasDefault := strings.Cut(expr, ":-")
+			if !isEnvName(name) {
+				return "", fmt.Errorf("invalid variable name %q in %q", name, s)
+			}
+			value, ok := lookup(name)
+			if !ok || (hasDefault && value == "") {
+				if !hasDefault {
+					return "", fmt.Errorf("environment variable %s is not set (referenced in %q)", name, s)
+				}
+				value = def
+			}
+			b.WriteString(value)
+			i += 2 + end
+		case isEnvNameStart(next):
+			j := i + 1
+			for j < len(s) && isEnvNameChar(s[j]) {
+				j++
+			}
+			name := s[i+1 : j]
+			value, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set (referenced in %q)", name, s)
+			}
+			b.WriteString(value)
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+func isEnvName(name string) bool {
+	if name == "" || !isEnvNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isEnvNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isEnvNameChar(c byte) bool {
+	return isEnvNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import "testing"
+
+func TestExpandWith(t *testing.T) {
+	env := map[string]string{
+		"ENV":   "prod",
+		"DIR":   "/var/xdsnap",
+		"EMPTY": "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "no references", input: "/tmp/out", want: "/tmp/out"},
+		{name: "bare variable", input: "$DIR/$ENV", want: "/var/xdsnap/prod"},
+		{name: "braced variable", input: "${DIR}/snap-${ENV}", want: "/var/xdsnap/snap-prod"},
+		{name: "default used when unset", input: "${REGION:-us-east}", want: "us-east"},
+		{name: "default used when empty", input: "${EMPTY:-fallback}", want: "fallback"},
+		{name: "default ignored when set", input: "${ENV:-dev}", want: "prod"},
+		{name: "escaped dollar", input: "cost$$5", want: "cost$5"},
+		{name: "regex anchor kept", input: "/stats?filter=^http.*active$", want: "/stats?filter=^http.*active$"},
+		{name: "undefined bare variable", input: "$MISSING/x", wantErr: true},
+		{name: "undefined braced variable", input: "${MISSING}", wantErr: true},
+		{name: "unterminated", input: "${DIR", wantErr: true},
+		{name: "invalid name", input: "${1X}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandWith(tt.input, lookup)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expandWith(%q) expected error, got %q", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandWith(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("expandWith(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// Categories of Envoy admin fetch failures, each pointing at a different
+// layer to fix.
+const (
+	FailureNoTool            = "no-tool"            // the HTTP tool is missing from the task image
+	FailureConnectionRefused = "connection-refused" // nothing listens on the admin port: Envoy is down or in another netns
+	FailureHTTPError         = "http-error"         // Envoy answered with an HTTP error
+	FailureEmptyResponse     = "empty-response"     // the request succeeded but returned nothing
+	FailureExecError         = "exec-error"         // nomad alloc exec itself failed, or anything unrecognized
+	FailureInterrupted       = "interrupted"        // the capture was interrupted before the endpoint was fetched
+	FailureNetworkError      = "network-error"      // a direct request to the mapped admin port failed
+)
+
+var failureHints = map[string]string{
+	FailureNoTool:            "the HTTP tool is missing from the task image",
+	FailureConnectionRefused: "Envoy is not listening on the admin port; it may be down or the task may not share its network namespace",
+	FailureHTTPError:         "Envoy rejected the request; check the endpoint path and admin credentials",
+	FailureEmptyResponse:     "Envoy returned an empty response",
+	FailureExecError:         "nomad alloc exec failed; check the allocation state and ACLs",
+	FailureInterrupted:       "the capture was interrupted before this endpoint was fetched",
+	FailureNetworkError:      "the mapped admin port could not be reached from this host; check the port label and firewall",
+}
+
+// classifyFetchFailure returns the failure category of an admin fetch that
+// returned err (or no data when err is nil).
+func classifyFetchFailure(err error) string {
+	if err == nil {
+		return FailureEmptyResponse
+	}
+	var adminErr *nomad.AdminError
+	if !errors.As(err, &adminErr) {
+		return FailureExecError
+	}
+	if adminErr.Err != nil && adminErr.Method == nomad.MethodDirect {
+		if errors.Is(adminErr.Err, syscall.ECONNREFUSED) {
+			return FailureConnectionRefused
+		}
+		return FailureNetworkError
+	}
+	if adminErr.Err != nil {
+		if commandMissing(0, adminErr.Err, adminErr.Stderr) {
+			return FailureNoTool
+		}
+		return FailureExecError
+	}
+	if adminErr.Status >= 400 {
+		return FailureHTTPError
+	}
+	if commandMissing(adminErr.ExitCode, nil, adminErr.Stderr) {
+		return FailureNoTool
+	}
+
+	stderr := strings.ToLower(adminErr.Stderr)
+	switch {
+	case strings.Contains(stderr, "connection refused"),
+		adminErr.Method == nomad.MethodCurl && adminErr.ExitCode == 7,
+		adminErr.Method == nomad.MethodWget && adminErr.ExitCode == 4:
+		return FailureConnectionRefused
+	case strings.Contains(stderr, "http error"),
+		adminErr.Method == nomad.MethodCurl && adminErr.ExitCode == 22,
+		adminErr.Method == nomad.MethodWget && adminErr.ExitCode == 8:
+		return FailureHTTPError
+	}
+	return FailureExecError
+}
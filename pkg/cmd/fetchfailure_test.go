@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestClassifyFetchFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no data", nil, FailureEmptyResponse},
+		{"plain error", errors.New("boom"), FailureExecError},
+		{"exec failed", &nomad.AdminError{ExitCode: -1, Err: errors.New("task not running")}, FailureExecError},
+		{"binary missing", &nomad.AdminError{ExitCode: -1, Err: errors.New(`exec: "curl": executable file not found in $PATH`)}, FailureNoTool},
+		{"shell exit 127", &nomad.AdminError{Method: nomad.MethodBashTCP, ExitCode: 127}, FailureNoTool},
+		{"curl refused", &nomad.AdminError{Method: nomad.MethodCurl, ExitCode: 7}, FailureConnectionRefused},
+		{"bash refused", &nomad.AdminError{Method: nomad.MethodBashTCP, ExitCode: 1, Stderr: "bash: connect: Connection refused"}, FailureConnectionRefused},
+		{"wget network failure", &nomad.AdminError{Method: nomad.MethodWget, ExitCode: 4}, FailureConnectionRefused},
+		{"http status", &nomad.AdminError{Method: nomad.MethodBashTCP, Status: 404}, FailureHTTPError},
+		{"wget server error", &nomad.AdminError{Method: nomad.MethodWget, ExitCode: 8}, FailureHTTPError},
+		{"python http error", &nomad.AdminError{Method: nomad.MethodPython3, ExitCode: 1, Stderr: "urllib.error.HTTPError: HTTP Error 403: Forbidden"}, FailureHTTPError},
+		{"wrapped", fmt.Errorf("fetch: %w", &nomad.AdminError{Method: nomad.MethodCurl, ExitCode: 7}), FailureConnectionRefused},
+		{"unknown exit", &nomad.AdminError{Method: nomad.MethodNode, ExitCode: 1}, FailureExecError},
+		{"direct refused", &nomad.AdminError{Method: nomad.MethodDirect, Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, FailureConnectionRefused},
+		{"direct timeout", &nomad.AdminError{Method: nomad.MethodDirect, Err: errors.New("i/o timeout")}, FailureNetworkError},
+		{"direct http status", &nomad.AdminError{Method: nomad.MethodDirect, Status: 503}, FailureHTTPError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFetchFailure(tt.err); got != tt.want {
+				t.Errorf("classifyFetchFailure() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// listenerDump mirrors the listeners and route configurations of Envoy's
+// /config_dump that decide which filter chain, and so which upstream, a
+// connection is sent to.
+type listenerDump struct {
+	Type             string            `json:"@type"`
+	StaticListeners  []listenerWrapper `json:"static_listeners"`
+	DynamicListeners []struct {
+		Name        string           `json:"name"`
+		ActiveState *listenerWrapper `json:"active_state"`
+	} `json:"dynamic_listeners"`
+	StaticRouteConfigs  []routeConfigWrapper `json:"static_route_configs"`
+	DynamicRouteConfigs []routeConfigWrapper `json:"dynamic_route_configs"`
+}
+
+type listenerWrapper struct {
+	Listener envoyListener `json:"listener"`
+}
+
+type routeConfigWrapper struct {
+	RouteConfig routeConfig `json:"route_config"`
+}
+
+type envoyListener struct {
+	Name    string `json:"name"`
+	Address struct {
+		SocketAddress socketAddress `json:"socket_address"`
+	} `json:"address"`
+	FilterChains       []filterChain `json:"filter_chains"`
+	DefaultFilterChain *filterChain  `json:"default_filter_chain"`
+}
+
+type socketAddress struct {
+	Address   string `json:"address"`
+	PortValue int    `json:"port_value"`
+}
+
+type cidrRange struct {
+	AddressPrefix string `json:"address_prefix"`
+	PrefixLen     *int   `json:"prefix_len"`
+}
+
+func (c cidrRange) String() string {
+	if c.PrefixLen == nil {
+		return c.AddressPrefix
+	}
+	return fmt.Sprintf("%s/%d", c.AddressPrefix, *c.PrefixLen)
+}
+
+type filterChain struct {
+	Name  string `json:"name"`
+	Match struct {
+		ServerNames          []string    `json:"server_names"`
+		ApplicationProtocols []string    `json:"application_protocols"`
+		TransportProtocol    string      `json:"transport_protocol"`
+		DestinationPort      int         `json:"destination_port"`
+		PrefixRanges         []cidrRange `json:"prefix_ranges"`
+		SourcePrefixRanges   []cidrRange `json:"source_prefix_ranges"`
+		SourcePorts          []int       `json:"source_ports"`
+	} `json:"filter_chain_match"`
+	Filters []networkFilter `json:"filters"`
+}
+
+type networkFilter struct {
+	Name        string `json:"name"`
+	TypedConfig struct {
+		Cluster          string          `json:"cluster"`
+		WeightedClusters weightedCluster `json:"weighted_clusters"`
+		RDS              struct {
+			RouteConfigName string `json:"route_config_name"`
+		} `json:"rds"`
+		RouteConfig *routeConfig `json:"route_config"`
+	} `json:"typed_config"`
+}
+
+type weightedCluster struct {
+	Clusters []struct {
+		Name string `json:"name"`
+	} `json:"clusters"`
+}
+
+type routeConfig struct {
+	Name         string `json:"name"`
+	VirtualHosts []struct {
+		Routes []struct {
+			Route struct {
+				Cluster          string          `json:"cluster"`
+				WeightedClusters weightedCluster `json:"weighted_clusters"`
+			} `json:"route"`
+		} `json:"routes"`
+	} `json:"virtual_hosts"`
+}
+
+// clusters returns the sorted, de-duplicated clusters the routes point at.
+func (r routeConfig) clusters() []string {
+	var names []string
+	for _, vh := range r.VirtualHosts {
+		for _, route := range vh.Routes {
+			names = append(names, route.Route.Cluster)
+			for _, wc := range route.Route.WeightedClusters.Clusters {
+				names = append(names, wc.Name)
+			}
+		}
+	}
+	return sortedUnique(names)
+}
+
+// chainSummary is the distilled view of one filter chain.
+type chainSummary struct {
+	Name     string
+	Match    string   // match criteria, "any" when the chain matches everything
+	Filter   string   // terminal network filter
+	Route    string   // RDS or inline route configuration, for HTTP filters
+	Clusters []string // clusters the chain sends traffic to
+}
+
+// listenerSummary describes a listener and its filter chains in order, the
+// default chain last.
+type listenerSummary struct {
+	Name    string
+	Address string
+	Chains  []chainSummary
+}
+
+// summarizeFilterChains extracts every listener's filter chains from an
+// Envoy /config_dump. Listeners whose name doesn't contain filter are
+// skipped when filter is set.
+func summarizeFilterChains(configDump []byte, filter string) ([]listenerSummary, error) {
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse config dump: %w", err)
+	}
+
+	var listeners []envoyListener
+	routes := make(map[string]routeConfig)
+	for _, raw := range dump.Configs {
+		var section listenerDump
+		if err := json.Unmarshal(raw, &section); err != nil {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(section.Type, ".ListenersConfigDump"):
+			for _, l := range section.StaticListeners {
+				listeners = append(listeners, l.Listener)
+			}
+			for _, l := range section.DynamicListeners {
+				if l.ActiveState != nil {
+					listeners = append(listeners, l.ActiveState.Listener)
+				}
+			}
+		case strings.HasSuffix(section.Type, ".RoutesConfigDump"):
+			for _, r := range append(section.StaticRouteConfigs, section.DynamicRouteConfigs...) {
+				routes[r.RouteConfig.Name] = r.RouteConfig
+			}
+		}
+	}
+
+	var summaries []listenerSummary
+	for _, l := range listeners {
+		if filter != "" && !strings.Contains(l.Name, filter) {
+			continue
+		}
+		s := listenerSummary{Name: l.Name}
+		if sa := l.Address.SocketAddress; sa.Address != "" {
+			s.Address = fmt.Sprintf("%s:%d", sa.Address, sa.PortValue)
+		}
+		for _, fc := range l.FilterChains {
+			s.Chains = append(s.Chains, summarizeChain(fc, routes))
+		}
+		if l.DefaultFilterChain != nil {
+			chain := summarizeChain(*l.DefaultFilterChain, routes)
+			chain.Match = "default (no other chain matched)"
+			s.Chains = append(s.Chains, chain)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+func summarizeChain(fc filterChain, routes map[string]routeConfig) chainSummary {
+	s := chainSummary{Name: fc.Name, Match: chainMatch(fc)}
+	if len(fc.Filters) == 0 {
+		return s
+	}
+	terminal := fc.Filters[len(fc.Filters)-1]
+	s.Filter = terminal.Name
+	cfg := terminal.TypedConfig
+	var clusters []string
+	if cfg.Cluster != "" {
+		clusters = append(clusters, cfg.Cluster)
+	}
+	for _, wc := range cfg.WeightedClusters.Clusters {
+		clusters = append(clusters, wc.Name)
+	}
+	switch {
+	case cfg.RouteConfig != nil:
+		s.Route = "inline"
+		if cfg.RouteConfig.Name != "" {
+			s.Route = cfg.RouteConfig.Name + " (inline)"
+		}
+		clusters = append(clusters, cfg.RouteConfig.clusters()...)
+	case cfg.RDS.RouteConfigName != "":
+		s.Route = cfg.RDS.RouteConfigName
+		if rc, ok := routes[cfg.RDS.RouteConfigName]; ok {
+			clusters = append(clusters, rc.clusters()...)
+		} else {
+			s.Route += " (not in config dump)"
+		}
+	}
+	s.Clusters = sortedUnique(clusters)
+	return s
+}
+
+// chainMatch renders a filter chain's match criteria.
+func chainMatch(fc filterChain) string {
+	m := fc.Match
+	var parts []string
+	if len(m.ServerNames) > 0 {
+		parts = append(parts, "sni="+strings.Join(m.ServerNames, ","))
+	}
+	if len(m.ApplicationProtocols) > 0 {
+		parts = append(parts, "alpn="+strings.Join(m.ApplicationProtocols, ","))
+	}
+	if m.TransportProtocol != "" {
+		parts = append(parts, "transport="+m.TransportProtocol)
+	}
+	if len(m.PrefixRanges) > 0 {
+		parts = append(parts, "dst="+joinRanges(m.PrefixRanges))
+	}
+	if m.DestinationPort != 0 {
+		parts = append(parts, fmt.Sprintf("dst_port=%d", m.DestinationPort))
+	}
+	if len(m.SourcePrefixRanges) > 0 {
+		parts = append(parts, "src="+joinRanges(m.SourcePrefixRanges))
+	}
+	if len(m.SourcePorts) > 0 {
+		ports := make([]string, len(m.SourcePorts))
+		for i, p := range m.SourcePorts {
+			ports[i] = fmt.Sprint(p)
+		}
+		parts = append(parts, "src_port="+strings.Join(ports, ","))
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, " ")
+}
+
+func joinRanges(ranges []cidrRange) string {
+	s := make([]string, len(ranges))
+	for i, r := range ranges {
+		s[i] = r.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func sortedUnique(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, n := range names {
+		if n != "" && !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// printFilterChains writes one block per listener with a line per filter
+// chain giving its match, terminal filter and target clusters.
+func printFilterChains(w io.Writer, listeners []listenerSummary) {
+	for i, l := range listeners {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if l.Address != "" {
+			fmt.Fprintf(w, "Listener %s (%s)\n", l.Name, l.Address)
+		} else {
+			fmt.Fprintf(w, "Listener %s\n", l.Name)
+		}
+		for j, c := range l.Chains {
+			name := ""
+			if c.Name != "" {
+				name = " " + c.Name
+			}
+			fmt.Fprintf(w, "  chain %d%s\n", j, name)
+			fmt.Fprintf(w, "    match:   %s\n", c.Match)
+			if c.Filter != "" {
+				fmt.Fprintf(w, "    filter:  %s\n", c.Filter)
+			}
+			if c.Route != "" {
+				fmt.Fprintf(w, "    route:   %s\n", c.Route)
+			}
+			if len(c.Clusters) > 0 {
+				fmt.Fprintf(w, "    cluster: %s\n", strings.Join(c.Clusters, ", "))
+			}
+		}
+	}
+}
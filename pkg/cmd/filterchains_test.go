@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const filterChainDump = `{"configs":[
+{"@type":"type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+ "dynamic_listeners":[
+  {"name":"public_listener:10.0.0.5:21000","active_state":{"listener":{
+   "name":"public_listener:10.0.0.5:21000",
+   "address":{"socket_address":{"address":"10.0.0.5","port_value":21000}},
+   "filter_chains":[
+    {"filter_chain_match":{"server_names":["web.default.dc1.internal.abc.consul"],"application_protocols":["h2","http/1.1"],"transport_protocol":"tls"},
+     "filters":[{"name":"envoy.filters.network.rbac"},{"name":"envoy.filters.network.tcp_proxy","typed_config":{"cluster":"local_app"}}]}
+   ]}}},
+  {"name":"outbound_listener:127.0.0.1:15001","active_state":{"listener":{
+   "name":"outbound_listener:127.0.0.1:15001",
+   "address":{"socket_address":{"address":"127.0.0.1","port_value":15001}},
+   "filter_chains":[
+    {"name":"api","filter_chain_match":{"prefix_ranges":[{"address_prefix":"10.1.0.0","prefix_len":16}],"destination_port":8080},
+     "filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{"rds":{"route_config_name":"api"}}}]},
+    {"filter_chain_match":{"source_prefix_ranges":[{"address_prefix":"192.168.0.1"}],"source_ports":[5000]},
+     "filters":[{"name":"envoy.filters.network.tcp_proxy","typed_config":{"weighted_clusters":{"clusters":[{"name":"db-v2"},{"name":"db-v1"}]}}}]}
+   ],
+   "default_filter_chain":{"filters":[{"name":"envoy.filters.network.tcp_proxy","typed_config":{"cluster":"original-destination"}}]}}}}
+ ]},
+{"@type":"type.googleapis.com/envoy.admin.v3.RoutesConfigDump",
+ "dynamic_route_configs":[{"route_config":{"name":"api","virtual_hosts":[{"routes":[
+  {"route":{"cluster":"api.default.dc1.internal.abc.consul"}},
+  {"route":{"weighted_clusters":{"clusters":[{"name":"api-canary"},{"name":"api.default.dc1.internal.abc.consul"}]}}}]}]}}]}
+]}`
+
+func TestSummarizeFilterChains(t *testing.T) {
+	listeners, err := summarizeFilterChains([]byte(filterChainDump), "")
+	if err != nil {
+		t.Fatalf("summarizeFilterChains() error: %v", err)
+	}
+	want := []listenerSummary{
+		{Name: "public_listener:10.0.0.5:21000", Address: "10.0.0.5:21000", Chains: []chainSummary{{
+			Match:    "sni=web.default.dc1.internal.abc.consul alpn=h2,http/1.1 transport=tls",
+			Filter:   "envoy.filters.network.tcp_proxy",
+			Clusters: []string{"local_app"},
+		}}},
+		{Name: "outbound_listener:127.0.0.1:15001", Address: "127.0.0.1:15001", Chains: []chainSummary{
+			{
+				Name:     "api",
+				Match:    "dst=10.1.0.0/16 dst_port=8080",
+				Filter:   "envoy.filters.network.http_connection_manager",
+				Route:    "api",
+				Clusters: []string{"api-canary", "api.default.dc1.internal.abc.consul"},
+			},
+			{
+				Match:    "src=192.168.0.1 src_port=5000",
+				Filter:   "envoy.filters.network.tcp_proxy",
+				Clusters: []string{"db-v1", "db-v2"},
+			},
+			{
+				Match:    "default (no other chain matched)",
+				Filter:   "envoy.filters.network.tcp_proxy",
+				Clusters: []string{"original-destination"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(listeners, want) {
+		t.Errorf("summarizeFilterChains() =\n%+v\nwant\n%+v", listeners, want)
+	}
+}
+
+func TestSummarizeFilterChainsFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   int
+	}{
+		{"", 2},
+		{"public", 1},
+		{"missing", 0},
+	}
+	for _, tt := range tests {
+		listeners, err := summarizeFilterChains([]byte(filterChainDump), tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listeners) != tt.want {
+			t.Errorf("filter %q: %d listeners, want %d", tt.filter, len(listeners), tt.want)
+		}
+	}
+}
+
+func TestSummarizeChainMissingRoute(t *testing.T) {
+	dump := `{"configs":[{"@type":"type.googleapis.com/envoy.admin.v3.ListenersConfigDump","static_listeners":[{"listener":{"name":"l",
+		"filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{"rds":{"route_config_name":"gone"}}}]}]}}]}]}`
+	listeners, err := summarizeFilterChains([]byte(dump), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listeners[0].Chains[0]; got.Match != "any" || got.Route != "gone (not in config dump)" || got.Clusters != nil {
+		t.Errorf("chain = %+v", got)
+	}
+}
+
+func TestPrintFilterChains(t *testing.T) {
+	listeners, err := summarizeFilterChains([]byte(filterChainDump), "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	printFilterChains(&b, listeners)
+	for _, want := range []string{
+		"Listener public_listener:10.0.0.5:21000 (10.0.0.5:21000)\n",
+		"  chain 0\n    match:   sni=web.default.dc1.internal.abc.consul",
+		"    filter:  envoy.filters.network.tcp_proxy\n    cluster: local_app\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// focusTarget is a single cluster or listener to capture a scoped bundle for.
+type focusTarget struct {
+	kind string // "cluster" or "listener"
+	name string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// dirName is the subdirectory the focused bundle is written to.
+func (f focusTarget) dirName() string {
+	return "focus_" + unsafeFileChars.ReplaceAllString(f.name, "_")
+}
+
+// listEndpoint is the admin endpoint listing every resource of the target's
+// kind in Envoy's "name::field::value" text format.
+func (f focusTarget) listEndpoint() string {
+	if f.kind == "listener" {
+		return "/listeners"
+	}
+	return "/clusters"
+}
+
+// focusTargets builds the targets requested with --focus-cluster and
+// --focus-listener.
+func focusTargets(clusters, listeners []string) []focusTarget {
+	var targets []focusTarget
+	for _, name := range clusters {
+		targets = append(targets, focusTarget{kind: "cluster", name: name})
+	}
+	for _, name := range listeners {
+		targets = append(targets, focusTarget{kind: "listener", name: name})
+	}
+	return targets
+}
+
+// captureFocus writes the stats, list entries and config dump for one
+// target, plus a short summary, into a focus_<name>/ directory under dir.
+func captureFocus(nomadService nomad.NomadApiService, config SnapshotConfig, dir string, target focusTarget) error {
+	focusDir := filepath.Join(dir, target.dirName())
+	if err := os.MkdirAll(focusDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", focusDir, err)
+	}
+
+	quoted := regexp.QuoteMeta(target.name)
+	files := []struct {
+		name     string
+		endpoint string
+		filter   func([]byte) []byte
+	}{
+		{"stats.txt", "/stats?filter=" + url.QueryEscape(quoted), nil},
+		{strings.TrimPrefix(target.listEndpoint(), "/") + ".txt", target.listEndpoint(), func(data []byte) []byte {
+			return filterEntries(data, target.name)
+		}},
+		{"config_dump.json", "/config_dump?name_regex=" + url.QueryEscape("^"+quoted+"$"), nil},
+	}
+
+	var entries []byte
+	for _, file := range files {
+		data, err := fetchEnvoyEndpoint(nomadService, config, file.endpoint)
+		if err != nil {
+			log.Printf("Error capturing %s for %s %s: %v", file.endpoint, target.kind, target.name, err)
+			continue
+		}
+		if file.filter != nil {
+			data = file.filter(data)
+			entries = data
+		}
+		if err := os.WriteFile(filepath.Join(focusDir, file.name), data, 0644); err != nil {
+			log.Printf("Failed to write %s for %s %s: %v", file.name, target.kind, target.name, err)
+		}
+	}
+
+	summary := summarizeFocus(target, entries)
+	summary.log(config.AllocID[:8])
+	return summary.write(filepath.Join(focusDir, "summary.txt"))
+}
+
+// filterEntries keeps the lines of a /clusters or /listeners text response
+// that belong to the named resource.
+func filterEntries(data []byte, name string) []byte {
+	var out bytes.Buffer
+	prefix := name + "::"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), prefix) {
+			out.WriteString(scanner.Text())
+			out.WriteString("\n")
+		}
+	}
+	return out.Bytes()
+}
+
+// summarizeFocus describes a focused resource from its filtered list entries.
+// For clusters it counts hosts and calls out any that are not healthy.
+func summarizeFocus(target focusTarget, entries []byte) *captureSummary {
+	summary := &captureSummary{}
+	if len(entries) == 0 {
+		summary.addf("%s %s not found", target.kind, target.name)
+		return summary
+	}
+
+	if target.kind == "listener" {
+		for _, line := range strings.Split(strings.TrimSpace(string(entries)), "\n") {
+			summary.addf("listener %s bound to %s", target.name, strings.TrimPrefix(line, target.name+"::"))
+		}
+		return summary
+	}
+
+	var hosts, unhealthy []string
+	for _, line := range strings.Split(strings.TrimSpace(string(entries)), "\n") {
+		// <cluster>::<host>::health_flags::<flags>
+		parts := strings.Split(line, "::")
+		if len(parts) != 4 || parts[2] != "health_flags" {
+			continue
+		}
+		hosts = append(hosts, parts[1])
+		if parts[3] != "healthy" {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", parts[1], parts[3]))
+		}
+	}
+	summary.addf("cluster %s has %d host(s), %d unhealthy", target.name, len(hosts), len(unhealthy))
+	for _, host := range unhealthy {
+		summary.addf("cluster %s host %s is not healthy", target.name, host)
+	}
+	return summary
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+const clustersText = `api.default.dc1.internal.consul::observability_name::api.default.dc1.internal.consul
+api.default.dc1.internal.consul::10.0.0.5:21000::cx_active::2
+api.default.dc1.internal.consul::10.0.0.5:21000::health_flags::healthy
+api.default.dc1.internal.consul::10.0.0.6:21000::health_flags::/failed_outlier_check
+db.default.dc1.internal.consul::10.0.0.7:21000::health_flags::healthy
+`
+
+func TestFocusDirName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"api.default.dc1.internal.consul", "focus_api.default.dc1.internal.consul"},
+		{"public_listener:0.0.0.0:21000", "focus_public_listener_0.0.0.0_21000"},
+	}
+	for _, tt := range tests {
+		if got := (focusTarget{name: tt.name}).dirName(); got != tt.want {
+			t.Errorf("dirName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterEntries(t *testing.T) {
+	got := string(filterEntries([]byte(clustersText), "api.default.dc1.internal.consul"))
+	if strings.Contains(got, "db.default") {
+		t.Errorf("entries for other clusters were kept: %q", got)
+	}
+	if n := strings.Count(got, "\n"); n != 4 {
+		t.Errorf("kept %d lines, want 4: %q", n, got)
+	}
+}
+
+func TestSummarizeFocus(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  focusTarget
+		entries string
+		want    []string
+	}{
+		{
+			name:    "cluster with unhealthy host",
+			target:  focusTarget{kind: "cluster", name: "api.default.dc1.internal.consul"},
+			entries: string(filterEntries([]byte(clustersText), "api.default.dc1.internal.consul")),
+			want:    []string{"has 2 host(s), 1 unhealthy", "10.0.0.6:21000 (/failed_outlier_check)"},
+		},
+		{
+			name:    "listener",
+			target:  focusTarget{kind: "listener", name: "public_listener:0.0.0.0:21000"},
+			entries: "public_listener:0.0.0.0:21000::0.0.0.0:21000\n",
+			want:    []string{"bound to 0.0.0.0:21000"},
+		},
+		{
+			name:   "missing",
+			target: focusTarget{kind: "cluster", name: "nope"},
+			want:   []string{"cluster nope not found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarizeFocus(tt.target, []byte(tt.entries)).String()
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("summary %q missing %q", got, want)
+				}
+			}
+		})
+	}
+}
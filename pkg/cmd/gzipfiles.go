@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipLargeFiles replaces every file under dir larger than threshold bytes
+// with a gzip-compressed <name>.gz, so single files can be pulled out of an
+// uncompressed archive without decompressing the rest. Files that are
+// already gzipped are left alone. The gzip header carries no name or
+// timestamp, keeping output reproducible.
+func gzipLargeFiles(dir string, threshold int64) error {
+	var large []string
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() && fi.Size() > threshold && !strings.HasSuffix(file, ".gz") {
+			large = append(large, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, file := range large {
+		if err := gzipFile(file); err != nil {
+			return fmt.Errorf("failed to compress %s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+func gzipFile(file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(file + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file + ".gz")
+		return err
+	}
+	// Keep the original timestamp for --preserve-metadata
+	if err := os.Chtimes(file+".gz", fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// createLogFile creates a task log file at path. With compress the log is
+// gzipped as it is written, so a chatty stream never sits uncompressed on
+// disk. Close flushes the gzip stream and closes the file.
+func createLogFile(path string, compress bool) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil || !compress {
+		return f, err
+	}
+	return &gzipFileWriter{Writer: gzip.NewWriter(f), file: f}, nil
+}
+
+type gzipFileWriter struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (g *gzipFileWriter) Close() error {
+	err := g.Writer.Close()
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGzipLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("cluster::outbound|8080 ", 200)
+	writeTree(t, dir, map[string]string{
+		"config_dump.json":     large,
+		"stats.json":           "small",
+		"logs/envoy.log.gz":    large,
+		"logs/task-stdout.log": large,
+	})
+
+	if err := gzipLargeFiles(dir, 1024); err != nil {
+		t.Fatalf("gzipLargeFiles() error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{"config_dump.json", false},
+		{"config_dump.json.gz", true},
+		{"stats.json", true},
+		{"stats.json.gz", false},
+		{"logs/envoy.log.gz", true},
+		{"logs/envoy.log.gz.gz", false},
+		{"logs/task-stdout.log.gz", true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tt.name)))
+		if got := err == nil; got != tt.exists {
+			t.Errorf("%s exists = %v, want %v", tt.name, got, tt.exists)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, "config_dump.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || string(data) != large {
+		t.Errorf("decompressed config_dump.json = %d bytes, %v; want %d bytes", len(data), err, len(large))
+	}
+}
+
+func TestCreateLogFile(t *testing.T) {
+	dir := t.TempDir()
+	line := "[trace][upstream] connecting to 10.0.0.1:21000\n"
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(dir, "envoy-stderr.log")
+		if compress {
+			path += ".gz"
+		}
+		w, err := createLogFile(path, compress)
+		if err != nil {
+			t.Fatalf("createLogFile() error: %v", err)
+		}
+		limited := logLimit{maxBytes: int64(len(line)), keep: LogKeepHead}.wrap(w)
+		for i := 0; i < 3; i++ {
+			if _, err := io.WriteString(limited, line); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := limited.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error: %v", err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if compress {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				f.Close()
+				t.Fatalf("%s is not gzipped: %v", path, err)
+			}
+			r = gz
+		}
+		data, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), line) || !strings.Contains(string(data), "dropped by --max-log-bytes") {
+			t.Errorf("compress=%v: log = %q", compress, data)
+		}
+	}
+}
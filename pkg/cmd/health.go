@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// envoyReady reports whether an Envoy /ready response means the proxy is
+// live. Envoy answers "LIVE" once initialized and a state such as
+// "PRE_INITIALIZING" or "DRAINING" otherwise.
+func envoyReady(body []byte) bool {
+	return strings.TrimSpace(string(body)) == "LIVE"
+}
+
+// unreadyAllocs queries /ready on every allocation's sidecar and returns the
+// allocations that are not live yet.
+func unreadyAllocs(nomadService nomad.NomadApiService, allocs []nomad.AllocationInfo, strategies map[string]*nomad.ExecStrategy, targets map[string]adminTarget) []string {
+	var unready []string
+	for _, alloc := range allocs {
+		target := targets[alloc.ID]
+		body, err := nomadService.EnvoyAdminGET(alloc.ID, target.timeouts.apply(strategies[alloc.ID], "/ready"), target.ports[0], "/ready")
+		if err != nil || !envoyReady(body) {
+			unready = append(unready, alloc.ID[:8])
+		}
+	}
+	return unready
+}
+
+// keepLatest removes all but the last n snapshot directories and returns the
+// ones kept.
+func keepLatest(dirs []string, n int) ([]string, error) {
+	if len(dirs) <= n {
+		return dirs, nil
+	}
+	for _, dir := range dirs[:len(dirs)-n] {
+		if err := os.RemoveAll(dir); err != nil {
+			return dirs, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+	}
+	return dirs[len(dirs)-n:], nil
+}
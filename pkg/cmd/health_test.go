@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvoyReady(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"LIVE\n", true},
+		{"LIVE", true},
+		{"PRE_INITIALIZING\n", false},
+		{"DRAINING\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := envoyReady([]byte(tt.body)); got != tt.want {
+			t.Errorf("envoyReady(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestKeepLatest(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for _, name := range []string{"snapshot_1", "snapshot_2", "snapshot_3"} {
+		dir := filepath.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	kept, err := keepLatest(dirs, 2)
+	if err != nil {
+		t.Fatalf("keepLatest: %v", err)
+	}
+	if !reflect.DeepEqual(kept, dirs[1:]) {
+		t.Errorf("kept = %v, want %v", kept, dirs[1:])
+	}
+	if _, err := os.Stat(dirs[0]); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", dirs[0])
+	}
+	for _, dir := range kept {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("expected %s to be kept: %v", dir, err)
+		}
+	}
+
+	kept, err = keepLatest(dirs[2:], 2)
+	if err != nil || len(kept) != 1 {
+		t.Errorf("keepLatest with fewer dirs = %v, %v", kept, err)
+	}
+}
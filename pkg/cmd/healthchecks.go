@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/markcampv/xDSnap/consul"
+)
+
+// allocChecks narrows a service's health checks to those registered for one
+// allocation, plus the node checks of the nodes it runs on. When no check
+// belongs to the allocation (e.g. the service was not registered by Nomad)
+// every check is kept.
+func allocChecks(checks []consul.ServiceCheck, allocID string) []consul.ServiceCheck {
+	nodes := make(map[string]bool)
+	for _, c := range checks {
+		if c.AllocID == allocID {
+			nodes[c.Node] = true
+		}
+	}
+	if len(nodes) == 0 {
+		return checks
+	}
+	var kept []consul.ServiceCheck
+	for _, c := range checks {
+		if c.AllocID == allocID || (c.ServiceID == "" && nodes[c.Node]) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// formatHealthChecks renders each check's status and its full output, which
+// usually says why a check is failing.
+func formatHealthChecks(checks []consul.ServiceCheck) string {
+	var b strings.Builder
+	for i, c := range checks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		target := "node " + c.Node
+		if c.ServiceID != "" {
+			target = fmt.Sprintf("%s (%s) on %s", c.ServiceName, c.ServiceID, c.Node)
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", c.Status, c.Name, target)
+		if c.Type != "" {
+			fmt.Fprintf(&b, "  type: %s\n", c.Type)
+		}
+		output := strings.TrimSpace(c.Output)
+		if output == "" {
+			output = "(no output)"
+		}
+		for _, line := range strings.Split(output, "\n") {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+func writeHealthChecks(checks []consul.ServiceCheck, path string) error {
+	return os.WriteFile(path, []byte(formatHealthChecks(checks)), 0644)
+}
+
+// failingChecks describes each critical check with the first line of its
+// output.
+func failingChecks(checks []consul.ServiceCheck) []string {
+	var failing []string
+	for _, c := range checks {
+		if c.Status != consulapi.HealthCritical {
+			continue
+		}
+		output, _, _ := strings.Cut(strings.TrimSpace(c.Output), "\n")
+		if output == "" {
+			output = "no output"
+		}
+		failing = append(failing, fmt.Sprintf("health check %q is critical: %s", c.Name, output))
+	}
+	return failing
+}
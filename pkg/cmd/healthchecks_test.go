@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/markcampv/xDSnap/consul"
+)
+
+const (
+	checkAlloc = "11111111-2222-3333-4444-555555555555"
+	otherAlloc = "66666666-7777-8888-9999-000000000000"
+)
+
+var serviceChecks = []consul.ServiceCheck{
+	{Node: "node1", CheckID: "serfHealth", Name: "Serf Health Status", Status: consulapi.HealthPassing},
+	{Node: "node1", ServiceID: "_nomad-task-" + checkAlloc + "-web", ServiceName: "web", AllocID: checkAlloc,
+		CheckID: "web-http", Name: "web http", Type: "http", Status: consulapi.HealthCritical,
+		Output: "HTTP GET http://10.0.0.1:8080/health: 503 Service Unavailable\nOutput: db unreachable"},
+	{Node: "node2", CheckID: "serfHealth", Name: "Serf Health Status", Status: consulapi.HealthPassing},
+	{Node: "node2", ServiceID: "_nomad-task-" + otherAlloc + "-web", ServiceName: "web", AllocID: otherAlloc,
+		CheckID: "web-http", Name: "web http", Type: "http", Status: consulapi.HealthPassing},
+}
+
+func TestAllocChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		allocID string
+		want    []string
+	}{
+		{"own and node checks", checkAlloc, []string{"node1/serfHealth", "node1/web-http"}},
+		{"other allocation", otherAlloc, []string{"node2/serfHealth", "node2/web-http"}},
+		{"unregistered allocation keeps all", "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee",
+			[]string{"node1/serfHealth", "node1/web-http", "node2/serfHealth", "node2/web-http"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range allocChecks(serviceChecks, tt.allocID) {
+				got = append(got, c.Node+"/"+c.CheckID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocChecks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatHealthChecks(t *testing.T) {
+	got := formatHealthChecks(serviceChecks[:2])
+	for _, want := range []string{
+		"[passing] Serf Health Status: node node1\n  (no output)\n",
+		"[critical] web http: web (_nomad-task-" + checkAlloc + "-web) on node1\n  type: http\n",
+		"  HTTP GET http://10.0.0.1:8080/health: 503 Service Unavailable\n  Output: db unreachable\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatHealthChecks() missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestSummarizeCaptureHealthChecks(t *testing.T) {
+	summary := summarizeCapture(nil, SnapshotConfig{HealthChecks: serviceChecks})
+	want := "- Consul health check \"web http\" is critical: HTTP GET http://10.0.0.1:8080/health: 503 Service Unavailable\n"
+	if got := summary.String(); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/markcampv/xDSnap/consul"
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// writeIntentions saves the service's matching intentions as JSON.
+func writeIntentions(intentions *consul.ServiceIntentions, path string) error {
+	data, err := json.MarshalIndent(intentions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode intentions: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// deniedIntentions describes each intention that denies traffic to or from
+// the service, either outright or through an L7 permission.
+func deniedIntentions(intentions *consul.ServiceIntentions) []string {
+	var denied []string
+	for _, group := range [][]*consulapi.Intention{intentions.Inbound, intentions.Outbound} {
+		for _, ixn := range group {
+			if ixn == nil {
+				continue
+			}
+			if ixn.Action == consulapi.IntentionActionDeny {
+				denied = append(denied, fmt.Sprintf("intention %s -> %s denies all traffic", ixn.SourceName, ixn.DestinationName))
+				continue
+			}
+			n := 0
+			for _, perm := range ixn.Permissions {
+				if perm != nil && perm.Action == consulapi.IntentionActionDeny {
+					n++
+				}
+			}
+			if n > 0 {
+				denied = append(denied, fmt.Sprintf("intention %s -> %s denies some requests (%d L7 permission(s))", ixn.SourceName, ixn.DestinationName, n))
+			}
+		}
+	}
+	return denied
+}
+
+// intentionKey identifies an intention by its source and destination,
+// including namespaces, partitions and peers.
+func intentionKey(ixn *consulapi.Intention) string {
+	return fmt.Sprintf("%s/%s/%s/%s -> %s/%s/%s", ixn.SourcePeer, ixn.SourcePartition, ixn.SourceNS, ixn.SourceName,
+		ixn.DestinationPartition, ixn.DestinationNS, ixn.DestinationName)
+}
+
+// intentionAction describes what an intention does: allow, deny, or the
+// number of L7 permissions it applies.
+func intentionAction(ixn *consulapi.Intention) string {
+	if len(ixn.Permissions) > 0 {
+		return fmt.Sprintf("%d L7 permission(s)", len(ixn.Permissions))
+	}
+	return string(ixn.Action)
+}
+
+// intentionChanges describes each intention added, removed or changed
+// between the before and after lookups of a service's intentions. since is
+// when the capture started; changes Consul timestamped after it say how far
+// into the capture they happened.
+func intentionChanges(before, after *consul.ServiceIntentions, since time.Time) []string {
+	index := func(intentions *consul.ServiceIntentions) map[string]*consulapi.Intention {
+		m := make(map[string]*consulapi.Intention)
+		for _, group := range [][]*consulapi.Intention{intentions.Inbound, intentions.Outbound} {
+			for _, ixn := range group {
+				if ixn != nil {
+					m[intentionKey(ixn)] = ixn
+				}
+			}
+		}
+		return m
+	}
+	old, cur := index(before), index(after)
+	into := func(ixn *consulapi.Intention) string {
+		at := ixn.UpdatedAt
+		if at.IsZero() {
+			at = ixn.CreatedAt
+		}
+		if at.IsZero() || !at.After(since) {
+			return ""
+		}
+		return fmt.Sprintf(", %s into the capture", at.Sub(since).Round(time.Second))
+	}
+
+	var keys []string
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range cur {
+		if old[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		was, now := old[key], cur[key]
+		switch {
+		case now == nil:
+			changes = append(changes, fmt.Sprintf("intention %s -> %s (%s) was removed during the capture",
+				was.SourceName, was.DestinationName, intentionAction(was)))
+		case was == nil:
+			changes = append(changes, fmt.Sprintf("intention %s -> %s (%s) was added during the capture%s",
+				now.SourceName, now.DestinationName, intentionAction(now), into(now)))
+		case was.Action == now.Action && intentionAction(was) == intentionAction(now) && !samePermissions(was, now):
+			changes = append(changes, fmt.Sprintf("intention %s -> %s had its L7 permissions changed during the capture%s",
+				now.SourceName, now.DestinationName, into(now)))
+		case was.Action != now.Action || !samePermissions(was, now):
+			changes = append(changes, fmt.Sprintf("intention %s -> %s changed during the capture: %s -> %s%s",
+				now.SourceName, now.DestinationName, intentionAction(was), intentionAction(now), into(now)))
+		}
+	}
+	return changes
+}
+
+// samePermissions reports whether two intentions have identical L7
+// permissions.
+func samePermissions(a, b *consulapi.Intention) bool {
+	ja, errA := json.Marshal(a.Permissions)
+	jb, errB := json.Marshal(b.Permissions)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// recheckIntentions looks the service's intentions up again at the end of a
+// capture. When they changed since config.Intentions was looked up, the new
+// set is saved to intentions_end.json in tempDir and the changes are added
+// to the summary in summaryDir.
+func recheckIntentions(nomadService nomad.NomadApiService, config SnapshotConfig, tempDir, summaryDir string) {
+	after, err := nomadService.GetServiceIntentions(config.Intentions.Service)
+	if err != nil {
+		log.Printf("Failed to re-check intentions of %s: %v", config.Intentions.Service, err)
+		return
+	}
+	changes := intentionChanges(config.Intentions, after, config.IntentionsAt)
+	if len(changes) == 0 {
+		return
+	}
+	if err := writeIntentions(after, filepath.Join(tempDir, "intentions_end.json")); err != nil {
+		log.Printf("Failed to write intentions: %v", err)
+	}
+	summary := &captureSummary{}
+	for _, change := range changes {
+		summary.addf("Consul %s", change)
+	}
+	summary.log(config.AllocID[:8])
+	if err := summary.appendTo(filepath.Join(summaryDir, "summary.txt")); err != nil {
+		log.Printf("Failed to write summary: %v", err)
+	}
+}
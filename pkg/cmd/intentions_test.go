@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/markcampv/xDSnap/consul"
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestDeniedIntentions(t *testing.T) {
+	tests := []struct {
+		name       string
+		intentions consul.ServiceIntentions
+		want       []string
+	}{
+		{
+			name: "allow only",
+			intentions: consul.ServiceIntentions{Inbound: []*consulapi.Intention{
+				{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionAllow},
+			}},
+			want: nil,
+		},
+		{
+			name: "inbound and outbound deny",
+			intentions: consul.ServiceIntentions{
+				Inbound:  []*consulapi.Intention{{SourceName: "*", DestinationName: "api", Action: consulapi.IntentionActionDeny}},
+				Outbound: []*consulapi.Intention{{SourceName: "api", DestinationName: "db", Action: consulapi.IntentionActionDeny}},
+			},
+			want: []string{"intention * -> api denies all traffic", "intention api -> db denies all traffic"},
+		},
+		{
+			name: "L7 deny permission",
+			intentions: consul.ServiceIntentions{Inbound: []*consulapi.Intention{{
+				SourceName:      "web",
+				DestinationName: "api",
+				Permissions: []*consulapi.IntentionPermission{
+					{Action: consulapi.IntentionActionAllow},
+					{Action: consulapi.IntentionActionDeny},
+				},
+			}}},
+			want: []string{"intention web -> api denies some requests (1 L7 permission(s))"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deniedIntentions(&tt.intentions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deniedIntentions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteIntentions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "intentions.json")
+	in := &consul.ServiceIntentions{
+		Service: "api",
+		Inbound: []*consulapi.Intention{{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionAllow}},
+	}
+	if err := writeIntentions(in, path); err != nil {
+		t.Fatalf("writeIntentions() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got consul.ServiceIntentions
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.Service != "api" || len(got.Inbound) != 1 || !strings.Contains(string(data), `"inbound"`) {
+		t.Errorf("unexpected intentions.json: %s", data)
+	}
+}
+
+func TestSummarizeCaptureIntentions(t *testing.T) {
+	config := SnapshotConfig{Intentions: &consul.ServiceIntentions{
+		Inbound: []*consulapi.Intention{{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionDeny}},
+	}}
+	summary := summarizeCapture(nil, config)
+	if !strings.Contains(summary.String(), "Consul intention web -> api denies all traffic") {
+		t.Errorf("unexpected summary: %q", summary.String())
+	}
+}
+
+func TestIntentionChanges(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	deny := &consulapi.Intention{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionDeny}
+	tests := []struct {
+		name          string
+		before, after consul.ServiceIntentions
+		want          []string
+	}{
+		{
+			name:   "unchanged",
+			before: consul.ServiceIntentions{Inbound: []*consulapi.Intention{deny}},
+			after:  consul.ServiceIntentions{Inbound: []*consulapi.Intention{deny}},
+			want:   nil,
+		},
+		{
+			name:   "removed",
+			before: consul.ServiceIntentions{Inbound: []*consulapi.Intention{deny}},
+			want:   []string{"intention web -> api (deny) was removed during the capture"},
+		},
+		{
+			name:   "changed",
+			before: consul.ServiceIntentions{Inbound: []*consulapi.Intention{deny}},
+			after: consul.ServiceIntentions{Inbound: []*consulapi.Intention{
+				{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionAllow, UpdatedAt: start.Add(20 * time.Second)},
+			}},
+			want: []string{"intention web -> api changed during the capture: deny -> allow, 20s into the capture"},
+		},
+		{
+			name: "added before the capture and in another namespace",
+			before: consul.ServiceIntentions{Outbound: []*consulapi.Intention{
+				{SourceName: "api", DestinationName: "db", DestinationNS: "default", Action: consulapi.IntentionActionAllow},
+			}},
+			after: consul.ServiceIntentions{Outbound: []*consulapi.Intention{
+				{SourceName: "api", DestinationName: "db", DestinationNS: "default", Action: consulapi.IntentionActionAllow},
+				{SourceName: "api", DestinationName: "db", DestinationNS: "billing", Action: consulapi.IntentionActionDeny, CreatedAt: start.Add(-time.Minute)},
+			}},
+			want: []string{"intention api -> db (deny) was added during the capture"},
+		},
+		{
+			name: "L7 permissions edited",
+			before: consul.ServiceIntentions{Inbound: []*consulapi.Intention{{SourceName: "web", DestinationName: "api",
+				Permissions: []*consulapi.IntentionPermission{{Action: consulapi.IntentionActionAllow}}}}},
+			after: consul.ServiceIntentions{Inbound: []*consulapi.Intention{{SourceName: "web", DestinationName: "api",
+				Permissions: []*consulapi.IntentionPermission{{Action: consulapi.IntentionActionDeny}}}}},
+			want: []string{"intention web -> api had its L7 permissions changed during the capture"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intentionChanges(&tt.before, &tt.after, start); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intentionChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// intentionsService answers GetServiceIntentions with a fixed result.
+type intentionsService struct {
+	nomad.NomadApiService
+	intentions *consul.ServiceIntentions
+}
+
+func (s *intentionsService) GetServiceIntentions(serviceName string) (*consul.ServiceIntentions, error) {
+	return s.intentions, nil
+}
+
+func TestRecheckIntentions(t *testing.T) {
+	dir := t.TempDir()
+	summaryPath := filepath.Join(dir, "summary.txt")
+	if err := os.WriteFile(summaryPath, []byte("- earlier finding\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := SnapshotConfig{
+		AllocID: "abcdef12-0000",
+		Intentions: &consul.ServiceIntentions{Service: "api", Inbound: []*consulapi.Intention{
+			{SourceName: "web", DestinationName: "api", Action: consulapi.IntentionActionDeny},
+		}},
+	}
+
+	recheckIntentions(&intentionsService{intentions: config.Intentions}, config, dir, dir)
+	if _, err := os.Stat(filepath.Join(dir, "intentions_end.json")); !os.IsNotExist(err) {
+		t.Errorf("intentions_end.json written for unchanged intentions: %v", err)
+	}
+
+	recheckIntentions(&intentionsService{intentions: &consul.ServiceIntentions{Service: "api"}}, config, dir, dir)
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- earlier finding\n- Consul intention web -> api (deny) was removed during the capture\n"; string(data) != want {
+		t.Errorf("summary.txt = %q, want %q", data, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "intentions_end.json")); err != nil {
+		t.Errorf("intentions_end.json not written: %v", err)
+	}
+}
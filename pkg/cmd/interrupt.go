@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ExitInterrupted is the exit code after a second Ctrl-C, as for a process
+// killed by SIGINT.
+const ExitInterrupted = 130
+
+// interruptHandler turns the first SIGINT or SIGTERM into a graceful stop:
+// captures stop fetching but still archive what they already have and reset
+// the log level. A second signal exits immediately. A nil handler is never
+// interrupted.
+type interruptHandler struct {
+	stopped chan struct{}
+	signals chan os.Signal
+}
+
+// newInterruptHandler starts handling SIGINT and SIGTERM until stop is
+// called.
+func newInterruptHandler() *interruptHandler {
+	h := &interruptHandler{stopped: make(chan struct{}), signals: make(chan os.Signal, 1)}
+	signal.Notify(h.signals, syscall.SIGINT, syscall.SIGTERM)
+	go h.watch(h.signals, os.Exit)
+	return h
+}
+
+func (h *interruptHandler) watch(signals <-chan os.Signal, exit func(int)) {
+	if _, ok := <-signals; !ok {
+		return
+	}
+	log.Printf("Interrupted: archiving what was captured so far (press Ctrl-C again to exit immediately)")
+	close(h.stopped)
+	if _, ok := <-signals; ok {
+		log.Printf("Interrupted again, exiting without archiving")
+		exit(ExitInterrupted)
+	}
+}
+
+// stop restores the default signal handling.
+func (h *interruptHandler) stop() {
+	signal.Stop(h.signals)
+	close(h.signals)
+}
+
+// done is closed on the first interrupt.
+func (h *interruptHandler) done() <-chan struct{} {
+	if h == nil {
+		return nil
+	}
+	return h.stopped
+}
+
+func (h *interruptHandler) interrupted() bool {
+	select {
+	case <-h.done():
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d and reports whether it did so without being
+// interrupted.
+func (h *interruptHandler) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-h.done():
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptHandler(t *testing.T) {
+	h := &interruptHandler{stopped: make(chan struct{})}
+	signals := make(chan os.Signal, 1)
+	exited := make(chan int, 1)
+	finished := make(chan struct{})
+	go func() {
+		h.watch(signals, func(code int) { exited <- code })
+		close(finished)
+	}()
+
+	if h.interrupted() {
+		t.Fatal("interrupted before any signal")
+	}
+	signals <- syscall.SIGINT
+	select {
+	case <-h.done():
+	case <-time.After(time.Second):
+		t.Fatal("first signal did not interrupt")
+	}
+	if h.sleep(time.Minute) {
+		t.Error("sleep() not cut short by the interrupt")
+	}
+	select {
+	case code := <-exited:
+		t.Fatalf("exited with %d on the first signal", code)
+	default:
+	}
+
+	signals <- syscall.SIGINT
+	select {
+	case code := <-exited:
+		if code != ExitInterrupted {
+			t.Errorf("exit code = %d, want %d", code, ExitInterrupted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not exit")
+	}
+	<-finished
+}
+
+func TestInterruptHandlerStop(t *testing.T) {
+	h := &interruptHandler{stopped: make(chan struct{})}
+	signals := make(chan os.Signal)
+	finished := make(chan struct{})
+	go func() {
+		h.watch(signals, func(int) { t.Error("exit called") })
+		close(finished)
+	}()
+	close(signals)
+	<-finished
+	if h.interrupted() {
+		t.Error("interrupted after stop")
+	}
+}
+
+func TestNilInterruptHandler(t *testing.T) {
+	var h *interruptHandler
+	if h.interrupted() {
+		t.Error("nil handler interrupted")
+	}
+	if !h.sleep(time.Millisecond) {
+		t.Error("nil handler cut sleep short")
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// jobMetaMismatch describes why the allocation's job doesn't carry all of
+// meta, or returns "" when it does.
+func jobMetaMismatch(alloc nomad.AllocationInfo, meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := alloc.JobMeta[k]; !ok || v != meta[k] {
+			return fmt.Sprintf("job %s does not have meta %s=%s", alloc.JobID, k, meta[k])
+		}
+	}
+	return ""
+}
+
+// filterByJobMeta keeps the allocations whose job meta matches, using the job
+// embedded in each allocation. Other allocations are recorded as excluded by
+// the filter.
+func filterByJobMeta(allocs []nomad.AllocationInfo, meta map[string]string, skips *skipReport) []nomad.AllocationInfo {
+	var kept []nomad.AllocationInfo
+	for _, alloc := range allocs {
+		if detail := jobMetaMismatch(alloc, meta); detail != "" {
+			log.Printf("Skipping allocation %s: %s", alloc.ID[:8], detail)
+			skips.add(alloc.ID, SkipExcludedByFilter, detail)
+			continue
+		}
+		kept = append(kept, alloc)
+	}
+	return kept
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestJobMetaMismatch(t *testing.T) {
+	alloc := nomad.AllocationInfo{JobID: "web", JobMeta: map[string]string{"team": "payments", "tier": "1"}}
+	tests := []struct {
+		name string
+		meta map[string]string
+		want string
+	}{
+		{"all match", map[string]string{"team": "payments", "tier": "1"}, ""},
+		{"wrong value", map[string]string{"team": "search"}, "job web does not have meta team=search"},
+		{"missing key", map[string]string{"criticality": "high", "team": "payments"}, "job web does not have meta criticality=high"},
+		{"empty value needs the key", map[string]string{"owner": ""}, "job web does not have meta owner="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobMetaMismatch(alloc, tt.meta); got != tt.want {
+				t.Errorf("jobMetaMismatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterByJobMeta(t *testing.T) {
+	allocs := []nomad.AllocationInfo{
+		{ID: "aaaaaaaa-1", JobID: "web", JobMeta: map[string]string{"team": "payments"}},
+		{ID: "bbbbbbbb-1", JobID: "api", JobMeta: map[string]string{"team": "search"}},
+		{ID: "cccccccc-1", JobID: "db"},
+	}
+	skips := newSkipReport()
+	kept := filterByJobMeta(allocs, map[string]string{"team": "payments"}, skips)
+	if len(kept) != 1 || kept[0].ID != "aaaaaaaa-1" {
+		t.Errorf("filterByJobMeta() kept %v", kept)
+	}
+	if n := skips.count(SkipExcludedByFilter); n != 2 {
+		t.Errorf("excluded-by-filter skips = %d, want 2", n)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// updateLatestLink points <outputDir>/latest at snapshotDir, the newest
+// capture. On Windows, where symlinks need extra privileges, the path is
+// written to <outputDir>/latest.txt instead.
+func updateLatestLink(outputDir, snapshotDir string) error {
+	return writeLatest(outputDir, snapshotDir, runtime.GOOS != "windows")
+}
+
+// writeLatest records snapshotDir as the newest capture in outputDir, as a
+// latest symlink when symlink is set and as latest.txt otherwise. Both are
+// replaced atomically, so readers never see a missing or partial entry.
+func writeLatest(outputDir, snapshotDir string, symlink bool) error {
+	if !symlink {
+		abs, err := filepath.Abs(snapshotDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", snapshotDir, err)
+		}
+		tmp := filepath.Join(outputDir, fmt.Sprintf(".latest.txt.%d", os.Getpid()))
+		if err := os.WriteFile(tmp, []byte(abs+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write latest.txt: %w", err)
+		}
+		if err := os.Rename(tmp, filepath.Join(outputDir, "latest.txt")); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write latest.txt: %w", err)
+		}
+		return nil
+	}
+
+	// Relative, so the link survives moving the output directory
+	target, err := filepath.Rel(outputDir, snapshotDir)
+	if err != nil {
+		target = snapshotDir
+	}
+	tmp := filepath.Join(outputDir, fmt.Sprintf(".latest.%d", os.Getpid()))
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("failed to create latest symlink: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(outputDir, "latest")); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to update latest symlink: %w", err)
+	}
+	return nil
+}
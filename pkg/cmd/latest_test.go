@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteLatest(t *testing.T) {
+	tests := []struct {
+		name    string
+		symlink bool
+	}{
+		{name: "symlink", symlink: true},
+		{name: "latest.txt", symlink: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.symlink && runtime.GOOS == "windows" {
+				t.Skip("symlinks need extra privileges on Windows")
+			}
+			out := t.TempDir()
+			for _, run := range []string{"snapshot_20260101_120000", "snapshot_20260101_120100"} {
+				dir := filepath.Join(out, run)
+				if err := os.Mkdir(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "marker"), []byte(run), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeLatest(out, dir, tt.symlink); err != nil {
+					t.Fatalf("writeLatest() error: %v", err)
+				}
+			}
+
+			want := "snapshot_20260101_120100"
+			if tt.symlink {
+				target, err := os.Readlink(filepath.Join(out, "latest"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if target != want {
+					t.Errorf("latest -> %q, want %q", target, want)
+				}
+				data, err := os.ReadFile(filepath.Join(out, "latest", "marker"))
+				if err != nil || string(data) != want {
+					t.Errorf("latest/marker = %q, %v", data, err)
+				}
+			} else {
+				data, err := os.ReadFile(filepath.Join(out, "latest.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.TrimSpace(string(data)); !filepath.IsAbs(got) || filepath.Base(got) != want {
+					t.Errorf("latest.txt = %q, want the absolute path of %s", got, want)
+				}
+			}
+
+			entries, err := os.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 3 {
+				t.Errorf("output dir has %d entries, want the two runs and latest", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/markcampv/xDSnap/consul"
+	"github.com/markcampv/xDSnap/nomad"
+	"github.com/spf13/cobra"
+)
+
+// listedAlloc is one Connect allocation in the list output. The Envoy
+// fields are only filled in by --probe.
+type listedAlloc struct {
+	AllocID      string `json:"alloc_id"`
+	Name         string `json:"name"`
+	Job          string `json:"job"`
+	TaskGroup    string `json:"task_group"`
+	Namespace    string `json:"namespace"`
+	NodeID       string `json:"node_id"`
+	SidecarTask  string `json:"sidecar_task"`
+	Service      string `json:"service,omitempty"`
+	EnvoyVersion string `json:"envoy_version,omitempty"`
+	Ready        string `json:"ready,omitempty"`
+	ProbeError   string `json:"probe_error,omitempty"`
+}
+
+// NewListCommand creates the list subcommand, which prints the Connect
+// allocations a capture would select.
+func NewListCommand(streams IOStreams) *cobra.Command {
+	var serviceNames []string
+	var namespace, region, discoverySource, adminAuth string
+	var apiTimeout time.Duration
+	var jsonOutput, probe bool
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the Consul Connect allocations xdsnap can capture",
+		Long: `List the running Consul Connect allocations, or those of --service, with
+their job, task group, namespace, node and sidecar task.
+
+With --probe, each sidecar's Envoy admin API is also asked for its version
+(/server_info) and readiness (/ready) through nomad alloc exec. This is
+slower, one exec per request, but gives an inventory of which proxies run
+which Envoy release and whether they are ready.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if !cmd.Flags().Changed("namespace") {
+				namespace = os.Getenv("NOMAD_NAMESPACE")
+			}
+			serviceNames = normalizeServiceNames(serviceNames)
+			if !containsString(nomad.DiscoverySources, discoverySource) {
+				return exitErrorf(ExitUsage, "--discovery-source must be one of %s", strings.Join(nomad.DiscoverySources, ", "))
+			}
+			headers := auditHeaders(newRunID())
+			if adminAuth != "" {
+				if !probe {
+					return exitErrorf(ExitUsage, "--admin-auth requires --probe")
+				}
+				header, err := nomad.ParseAdminAuth(adminAuth)
+				if err != nil {
+					return exitErrorf(ExitUsage, "%w", err)
+				}
+				headers = append(headers, header)
+			}
+
+			nomadService, err := nomad.NewNomadApiServiceFromEnv(namespace, region, discoverySource, apiTimeout, consul.DiscoveryOptions{})
+			if err != nil {
+				return exitErrorf(ExitConnectivity, "failed to create Nomad client: %w", err)
+			}
+
+			var allocs []nomad.AllocationInfo
+			var allocServices map[string]string
+			if len(serviceNames) > 0 {
+				if allocs, allocServices, err = discoverServices(nomadService, namespace, serviceNames, false); err != nil {
+					return err
+				}
+			} else if allocs, err = nomadService.FindConnectAllocations(namespace); err != nil {
+				return apiErrorf(err, "failed to discover Connect allocations")
+			}
+
+			var listed []listedAlloc
+			probeFailures := 0
+			for _, alloc := range allocs {
+				if reason, _, skip := classifySkip(alloc, namespace); skip {
+					log.Printf("Skipping allocation %s: %s", alloc.ID[:8], reason)
+					continue
+				}
+				entry := listedAlloc{
+					AllocID:     alloc.ID,
+					Name:        alloc.Name,
+					Job:         alloc.JobID,
+					TaskGroup:   alloc.TaskGroup,
+					Namespace:   alloc.Namespace,
+					NodeID:      alloc.NodeID,
+					SidecarTask: alloc.SidecarTask,
+					Service:     allocServices[alloc.ID],
+				}
+				if probe {
+					probeAlloc(nomadService, alloc, headers, &entry)
+					if entry.ProbeError != "" {
+						probeFailures++
+					}
+				}
+				listed = append(listed, entry)
+			}
+			if len(listed) == 0 {
+				return exitErrorf(ExitNoData, "no Consul Connect allocations found")
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(streams.Out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(listed); err != nil {
+					return fmt.Errorf("failed to encode allocations: %w", err)
+				}
+			} else {
+				printAllocList(streams.Out, listed, probe)
+			}
+			if probeFailures > 0 {
+				return exitErrorf(ExitPartial, "%d of %d allocation(s) could not be probed", probeFailures, len(listed))
+			}
+			return nil
+		},
+	}
+
+	listCmd.Flags().StringSliceVar(&serviceNames, "service", nil, "Only list the allocations of this Consul service; repeatable or comma-separated")
+	listCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Nomad namespace(s) to list, comma-separated (default: $NOMAD_NAMESPACE, or all namespaces; \"*\" for all)")
+	listCmd.Flags().StringVar(&region, "region", "", "Nomad region to list in a multi-region cluster (default: $NOMAD_REGION, or the agent's region)")
+	listCmd.Flags().StringVar(&discoverySource, "discovery-source", nomad.DiscoveryAuto, "Where to discover Connect allocations: auto (Consul, then a Nomad scan when it finds nothing), consul, or nomad (skip Consul)")
+	listCmd.Flags().DurationVar(&apiTimeout, "api-timeout", nomad.DefaultAPITimeout, "Timeout for connecting to the Nomad and Consul APIs")
+	listCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the allocations as a JSON array instead of a table")
+	listCmd.Flags().BoolVar(&probe, "probe", false, "Also fetch each sidecar's Envoy version (/server_info) and readiness (/ready) through exec; slower")
+	listCmd.Flags().StringVar(&adminAuth, "admin-auth", "", "With --probe, credentials for a secured Envoy admin API: basic:user:pass or bearer:token")
+	return listCmd
+}
+
+// probeAlloc fills in the Envoy version and readiness of the allocation's
+// sidecar, or the reason they couldn't be read. Envoy answers /ready with
+// 503 until it is LIVE, so a /ready error with a body still reports it.
+func probeAlloc(nomadService nomad.NomadApiService, alloc nomad.AllocationInfo, headers []nomad.Header, entry *listedAlloc) {
+	target := allocAdminTarget(alloc.SidecarTask, adminTarget{ports: []int{nomad.EnvoyAdminPort}}, false, false)
+	strategy, err := resolveAdminStrategy(nomadService, alloc, target)
+	if err != nil {
+		entry.ProbeError = firstLine(err)
+		return
+	}
+	strategy.Headers = headers
+	strategy.Address = target.addr
+
+	info, err := nomadService.EnvoyAdminGET(alloc.ID, strategy, target.ports[0], "/server_info")
+	if err != nil {
+		entry.ProbeError = "/server_info: " + firstLine(err)
+		return
+	}
+	if version, err := parseServerInfoVersion(info); err != nil {
+		entry.ProbeError = firstLine(err)
+	} else {
+		entry.EnvoyVersion = version.String()
+	}
+
+	ready, err := nomadService.EnvoyAdminGET(alloc.ID, strategy, target.ports[0], "/ready")
+	if state := strings.TrimSpace(string(ready)); state != "" {
+		entry.Ready = state
+	} else if err != nil && entry.ProbeError == "" {
+		entry.ProbeError = "/ready: " + firstLine(err)
+	}
+}
+
+// printAllocList writes the allocations as a table, with the Envoy columns
+// when they were probed.
+func printAllocList(w io.Writer, listed []listedAlloc, probed bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "ALLOC\tJOB\tGROUP\tNAMESPACE\tNODE\tSIDECAR"
+	if probed {
+		header += "\tENVOY\tREADY"
+	}
+	fmt.Fprintln(tw, header)
+	for _, a := range listed {
+		node := a.NodeID
+		if len(node) > 8 {
+			node = node[:8]
+		}
+		cols := []string{a.AllocID[:8], a.Job, a.TaskGroup, a.Namespace, node, a.SidecarTask}
+		if probed {
+			version, ready := a.EnvoyVersion, a.Ready
+			if version == "" {
+				version = "-"
+			}
+			if ready == "" {
+				ready = "-"
+			}
+			if a.ProbeError != "" {
+				ready += " (" + a.ProbeError + ")"
+			}
+			cols = append(cols, version, ready)
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// probeService answers exec probes successfully and Envoy admin requests
+// from a map by path.
+type probeService struct {
+	nomad.NomadApiService
+	responses map[string]string
+	errs      map[string]error
+}
+
+func (s *probeService) ExecuteCommandWithStderr(allocID, task string, command []string, stdout, stderr io.Writer) (int, error) {
+	return 0, nil
+}
+
+func (s *probeService) EnvoyAdminGET(allocID string, strategy *nomad.ExecStrategy, port int, path string) ([]byte, error) {
+	return []byte(s.responses[path]), s.errs[path]
+}
+
+func TestProbeAlloc(t *testing.T) {
+	alloc := nomad.AllocationInfo{ID: "aaaaaaaa-0000", SidecarTask: "connect-proxy-web", Tasks: []string{"web", "connect-proxy-web"}}
+	serverInfo := `{"version":"abc123/1.27.2/Clean/RELEASE/BoringSSL"}`
+	tests := []struct {
+		name      string
+		svc       *probeService
+		wantEntry listedAlloc
+	}{
+		{
+			name:      "live",
+			svc:       &probeService{responses: map[string]string{"/server_info": serverInfo, "/ready": "LIVE\n"}},
+			wantEntry: listedAlloc{EnvoyVersion: "1.27.2", Ready: "LIVE"},
+		},
+		{
+			name: "not ready yet",
+			svc: &probeService{
+				responses: map[string]string{"/server_info": serverInfo, "/ready": "PRE_INITIALIZING"},
+				errs:      map[string]error{"/ready": errors.New("HTTP 503")},
+			},
+			wantEntry: listedAlloc{EnvoyVersion: "1.27.2", Ready: "PRE_INITIALIZING"},
+		},
+		{
+			name:      "unreachable",
+			svc:       &probeService{errs: map[string]error{"/server_info": errors.New("connection refused\nmore detail")}},
+			wantEntry: listedAlloc{ProbeError: "/server_info: connection refused"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry listedAlloc
+			probeAlloc(tt.svc, alloc, nil, &entry)
+			if entry != tt.wantEntry {
+				t.Errorf("probeAlloc() = %+v, want %+v", entry, tt.wantEntry)
+			}
+		})
+	}
+}
+
+func TestPrintAllocList(t *testing.T) {
+	listed := []listedAlloc{
+		{AllocID: "aaaaaaaa-0000", Job: "web", TaskGroup: "web", Namespace: "default", NodeID: "11111111-2222", SidecarTask: "connect-proxy-web", EnvoyVersion: "1.27.2", Ready: "LIVE"},
+		{AllocID: "bbbbbbbb-0000", Job: "api", TaskGroup: "api", Namespace: "default", NodeID: "33333333-4444", SidecarTask: "connect-proxy-api", ProbeError: "no HTTP tool found"},
+	}
+
+	var out bytes.Buffer
+	printAllocList(&out, listed, false)
+	if want := "ALLOC     JOB  GROUP  NAMESPACE  NODE      SIDECAR\naaaaaaaa  web  web    default    11111111  connect-proxy-web\n"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("printAllocList() = %q, want prefix %q", out.String(), want)
+	}
+
+	out.Reset()
+	printAllocList(&out, listed, true)
+	for _, want := range []string{
+		"connect-proxy-web  1.27.2  LIVE\n",
+		"connect-proxy-api  -       - (no HTTP tool found)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printAllocList() with probe missing %q:\n%s", want, out.String())
+		}
+	}
+
+	data, err := json.Marshal(listed[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"alloc_id":"bbbbbbbb-0000"`; !strings.Contains(string(data), want) || strings.Contains(string(data), "envoy_version") {
+		t.Errorf("JSON record = %s", data)
+	}
+}
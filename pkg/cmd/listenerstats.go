@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// boundListener is one listener in Envoy's /listeners output, with the
+// address it is bound to.
+type boundListener struct {
+	Name    string
+	Address string
+}
+
+// statPrefix returns the scope of the listener's listener.<prefix>.* stats:
+// its address with colons replaced, e.g. 0.0.0.0_21000.
+func (l boundListener) statPrefix() string {
+	return strings.ReplaceAll(l.Address, ":", "_")
+}
+
+// parseListeners reads a /listeners response in the text form
+// (name::address per line), the ?format=json form, or the address list
+// printed by Envoy before 1.12.
+func parseListeners(data []byte) ([]boundListener, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var addresses []string
+		if err := json.Unmarshal(trimmed, &addresses); err != nil {
+			return nil, fmt.Errorf("failed to parse /listeners: %w", err)
+		}
+		listeners := make([]boundListener, 0, len(addresses))
+		for _, a := range addresses {
+			listeners = append(listeners, boundListener{Name: a, Address: a})
+		}
+		return listeners, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var doc struct {
+			ListenerStatuses []struct {
+				Name         string `json:"name"`
+				LocalAddress struct {
+					SocketAddress *socketAddress `json:"socket_address"`
+					Pipe          *struct {
+						Path string `json:"path"`
+					} `json:"pipe"`
+				} `json:"local_address"`
+			} `json:"listener_statuses"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse /listeners: %w", err)
+		}
+		listeners := make([]boundListener, 0, len(doc.ListenerStatuses))
+		for _, s := range doc.ListenerStatuses {
+			l := boundListener{Name: s.Name}
+			if sa := s.LocalAddress.SocketAddress; sa != nil {
+				host := sa.Address
+				if strings.Contains(host, ":") {
+					host = "[" + host + "]"
+				}
+				l.Address = fmt.Sprintf("%s:%d", host, sa.PortValue)
+			} else if p := s.LocalAddress.Pipe; p != nil {
+				l.Address = p.Path
+			}
+			listeners = append(listeners, l)
+		}
+		return listeners, nil
+	}
+
+	var listeners []boundListener
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		name, address, ok := strings.Cut(strings.TrimSpace(line), "::")
+		if ok && name != "" {
+			listeners = append(listeners, boundListener{Name: name, Address: address})
+		}
+	}
+	return listeners, nil
+}
+
+// parseStatCounters reads every counter and gauge from a /stats response in
+// the text form or the ?format=json form. Histograms are skipped.
+func parseStatCounters(data []byte) (map[string]uint64, error) {
+	stats := make(map[string]uint64)
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc struct {
+			Stats []struct {
+				Name  string      `json:"name"`
+				Value json.Number `json:"value"`
+			} `json:"stats"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse /stats: %w", err)
+		}
+		for _, s := range doc.Stats {
+			if v, err := strconv.ParseUint(s.Value.String(), 10, 64); err == nil && s.Name != "" {
+				stats[s.Name] = v
+			}
+		}
+		return stats, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ": ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			stats[name] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read /stats: %w", err)
+	}
+	return stats, nil
+}
+
+// listenerErrorStats are the listener.<prefix>.* counters of connections the
+// listener rejected or dropped before a filter chain handled them.
+var listenerErrorStats = []string{
+	"downstream_cx_overflow",
+	"downstream_cx_overload_reject",
+	"downstream_global_cx_overflow",
+	"downstream_listener_filter_error",
+	"downstream_pre_cx_timeout",
+	"no_filter_chain_match",
+}
+
+// listenerStats is one row of the per-listener summary.
+type listenerStats struct {
+	Name    string
+	Address string
+	// HasStats is false when none of the listener's stats were captured.
+	HasStats bool
+	Active   uint64
+	Total    uint64
+	Errors   uint64
+	// TLS is false when the listener has no ssl.* stats, i.e. no TLS
+	// filter chain.
+	TLS           bool
+	TLSHandshakes uint64
+	TLSFailures   uint64
+}
+
+// joinListenerStats looks up the connection, error and TLS counters of each
+// listener in stats, under its address or, failing that, its name.
+func joinListenerStats(listeners []boundListener, stats map[string]uint64) []listenerStats {
+	rows := make([]listenerStats, 0, len(listeners))
+	for _, l := range listeners {
+		row := listenerStats{Name: l.Name, Address: l.Address}
+		for _, p := range []string{l.statPrefix(), l.Name} {
+			prefix := "listener." + p + "."
+			get := func(stat string) (uint64, bool) {
+				v, ok := stats[prefix+stat]
+				return v, ok
+			}
+			if _, ok := get("downstream_cx_total"); !ok {
+				continue
+			}
+			row.HasStats = true
+			row.Active, _ = get("downstream_cx_active")
+			row.Total, _ = get("downstream_cx_total")
+			for _, stat := range listenerErrorStats {
+				v, _ := get(stat)
+				row.Errors += v
+			}
+			row.TLSHandshakes, row.TLS = get("ssl.handshake")
+			row.TLSFailures, _ = get("ssl.connection_error")
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// note flags listeners that received nothing or whose TLS handshakes fail.
+func (r listenerStats) note() string {
+	switch {
+	case !r.HasStats:
+		return "no stats captured"
+	case r.Total == 0:
+		return "no connections"
+	case r.TLS && r.TLSHandshakes == 0 && r.TLSFailures > 0:
+		return "TLS FAILING"
+	case r.TLSFailures > 0:
+		return "some TLS failures"
+	}
+	return ""
+}
+
+// printListenerStats writes the per-listener summary as a table.
+func printListenerStats(w io.Writer, rows []listenerStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTENER\tADDRESS\tACTIVE\tTOTAL\tERRORS\tTLS HANDSHAKES\tTLS FAILURES\tNOTE")
+	for _, r := range rows {
+		cols := []string{r.Name, r.Address, "-", "-", "-", "-", "-", r.note()}
+		if r.HasStats {
+			cols[2] = strconv.FormatUint(r.Active, 10)
+			cols[3] = strconv.FormatUint(r.Total, 10)
+			cols[4] = strconv.FormatUint(r.Errors, 10)
+			if r.TLS {
+				cols[5] = strconv.FormatUint(r.TLSHandshakes, 10)
+				cols[6] = strconv.FormatUint(r.TLSFailures, 10)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	tw.Flush()
+}
+
+// isListenersFile reports whether a snapshot entry holds a /listeners
+// response.
+func isListenersFile(name string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	base = strings.TrimSuffix(base, ".gz")
+	if !strings.HasSuffix(base, ".json") && !strings.HasSuffix(base, ".yaml") {
+		return false
+	}
+	stem := strings.TrimSuffix(strings.TrimSuffix(base, ".json"), ".yaml")
+	return stem == "listeners" || strings.HasPrefix(stem, "listeners_")
+}
+
+// isStatsFile reports whether a snapshot entry holds a /stats response in
+// the text or JSON form, as opposed to /stats/prometheus or
+// /stats/recentlookups.
+func isStatsFile(name string) bool {
+	base := strings.TrimSuffix(path.Base(filepath.ToSlash(name)), ".gz")
+	if !strings.HasSuffix(base, ".json") {
+		return false
+	}
+	stem := strings.TrimSuffix(base, ".json")
+	if stem != "stats" && !strings.HasPrefix(stem, "stats_") {
+		return false
+	}
+	return !strings.HasPrefix(stem, "stats_prometheus") && !strings.HasPrefix(stem, "stats_recentlookups")
+}
+
+// analyzeListenerStats prints the per-listener summary for every /listeners
+// response in snapshot, joined with the /stats captured next to it. Only
+// listeners whose name contains filter are shown.
+func analyzeListenerStats(w io.Writer, snapshot, filter string) error {
+	listenerFiles, err := readSnapshotFiles(snapshot, isListenersFile)
+	if err != nil {
+		return exitErrorf(ExitNoData, "%w", err)
+	}
+	if len(listenerFiles) == 0 {
+		return exitErrorf(ExitNoData, "no /listeners output found in %s", snapshot)
+	}
+	stats := make(map[string]map[string]uint64)
+	if !isListenersFile(snapshot) {
+		if stats, err = readStatCounters(snapshot); err != nil {
+			return exitErrorf(ExitNoData, "%w", err)
+		}
+	}
+
+	for i, f := range listenerFiles {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", f.name)
+		listeners, err := parseListeners(f.data)
+		if err != nil {
+			return exitErrorf(ExitNoData, "%s: %w", f.name, err)
+		}
+		var kept []boundListener
+		for _, l := range listeners {
+			if strings.Contains(l.Name, filter) {
+				kept = append(kept, l)
+			}
+		}
+		if len(kept) == 0 {
+			fmt.Fprintln(w, "no listeners")
+			continue
+		}
+		dirStats := stats[path.Dir(f.name)]
+		if dirStats == nil {
+			fmt.Fprintln(w, "no /stats captured next to it; showing listeners only")
+		}
+		printListenerStats(w, joinListenerStats(kept, dirStats))
+	}
+	return nil
+}
+
+// readStatCounters parses every /stats response in snapshot and merges the
+// counters of each snapshot directory, keyed by the directory.
+func readStatCounters(snapshot string) (map[string]map[string]uint64, error) {
+	files, err := readSnapshotFiles(snapshot, isStatsFile)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]map[string]uint64)
+	for _, f := range files {
+		parsed, err := parseStatCounters(f.data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		dir := path.Dir(f.name)
+		if stats[dir] == nil {
+			stats[dir] = make(map[string]uint64)
+		}
+		for name, v := range parsed {
+			stats[dir][name] = v
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	want := []boundListener{
+		{Name: "public_listener:0.0.0.0:21000", Address: "0.0.0.0:21000"},
+		{Name: "outbound", Address: "[::]:15001"},
+	}
+	tests := []struct {
+		name string
+		data string
+		want []boundListener
+	}{
+		{
+			name: "text",
+			data: "public_listener:0.0.0.0:21000::0.0.0.0:21000\noutbound::[::]:15001\n",
+			want: want,
+		},
+		{
+			name: "json",
+			data: `{"listener_statuses":[
+{"name":"public_listener:0.0.0.0:21000","local_address":{"socket_address":{"address":"0.0.0.0","port_value":21000}}},
+{"name":"outbound","local_address":{"socket_address":{"address":"::","port_value":15001}}}]}`,
+			want: want,
+		},
+		{
+			name: "address list",
+			data: `["0.0.0.0:21000"]`,
+			want: []boundListener{{Name: "0.0.0.0:21000", Address: "0.0.0.0:21000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListeners([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseListeners() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListeners() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatCounters(t *testing.T) {
+	want := map[string]uint64{
+		"listener.0.0.0.0_21000.downstream_cx_active": 3,
+		"listener.0.0.0.0_21000.downstream_cx_total":  40,
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "text",
+			data: "listener.0.0.0.0_21000.downstream_cx_active: 3\nlistener.0.0.0.0_21000.downstream_cx_total: 40\n" +
+				"listener.0.0.0.0_21000.downstream_cx_length_ms: P0(nan,1) P25(nan,2)\n",
+		},
+		{
+			name: "json",
+			data: `{"stats":[{"name":"listener.0.0.0.0_21000.downstream_cx_active","value":3},
+{"name":"listener.0.0.0.0_21000.downstream_cx_total","value":40},{"histograms":{}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStatCounters([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseStatCounters() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseStatCounters() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestJoinListenerStats(t *testing.T) {
+	listeners := []boundListener{
+		{Name: "public_listener:0.0.0.0:21000", Address: "0.0.0.0:21000"},
+		{Name: "outbound", Address: "[::]:15001"},
+		{Name: "envoy_prometheus_metrics_listener", Address: "0.0.0.0:20200"},
+		{Name: "unused", Address: "127.0.0.1:9000"},
+	}
+	stats := map[string]uint64{
+		"listener.0.0.0.0_21000.downstream_cx_active":                    2,
+		"listener.0.0.0.0_21000.downstream_cx_total":                     10,
+		"listener.0.0.0.0_21000.no_filter_chain_match":                   1,
+		"listener.0.0.0.0_21000.downstream_cx_overflow":                  2,
+		"listener.0.0.0.0_21000.ssl.handshake":                           8,
+		"listener.0.0.0.0_21000.ssl.connection_error":                    1,
+		"listener.[__]_15001.downstream_cx_total":                        5,
+		"listener.[__]_15001.ssl.handshake":                              0,
+		"listener.[__]_15001.ssl.connection_error":                       5,
+		"listener.envoy_prometheus_metrics_listener.downstream_cx_total": 0,
+	}
+	want := []listenerStats{
+		{Name: "public_listener:0.0.0.0:21000", Address: "0.0.0.0:21000", HasStats: true, Active: 2, Total: 10, Errors: 3, TLS: true, TLSHandshakes: 8, TLSFailures: 1},
+		{Name: "outbound", Address: "[::]:15001", HasStats: true, Total: 5, TLS: true, TLSFailures: 5},
+		{Name: "envoy_prometheus_metrics_listener", Address: "0.0.0.0:20200", HasStats: true},
+		{Name: "unused", Address: "127.0.0.1:9000"},
+	}
+	got := joinListenerStats(listeners, stats)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("joinListenerStats() = %+v, want %+v", got, want)
+	}
+
+	notes := []string{"some TLS failures", "TLS FAILING", "no connections", "no stats captured"}
+	for i, row := range got {
+		if row.note() != notes[i] {
+			t.Errorf("%s note() = %q, want %q", row.Name, row.note(), notes[i])
+		}
+	}
+
+	var out bytes.Buffer
+	printListenerStats(&out, got[2:])
+	for _, line := range []string{
+		"LISTENER                           ADDRESS         ACTIVE  TOTAL  ERRORS  TLS HANDSHAKES  TLS FAILURES  NOTE",
+		"envoy_prometheus_metrics_listener  0.0.0.0:20200   0       0      0       -               -             no connections",
+		"unused                             127.0.0.1:9000  -       -      -       -               -             no stats captured",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("printListenerStats() output missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestAnalyzeListenerStats(t *testing.T) {
+	staged := t.TempDir()
+	writeTree(t, staged, map[string]string{
+		"abcdef12/listeners.json":               "public_listener:0.0.0.0:21000::0.0.0.0:21000\n",
+		"abcdef12/stats.json":                   "listener.0.0.0.0_21000.downstream_cx_active: 4\nlistener.0.0.0.0_21000.downstream_cx_total: 9\n",
+		"abcdef12/stats_prometheus.json":        "envoy_listener_downstream_cx_total{} 9\n",
+		"abcdef12/stats_recentlookups.json":     "Lookup: count\n",
+		"port_19002/listeners_format_json.json": `{"listener_statuses":[{"name":"other","local_address":{"socket_address":{"address":"10.0.0.1","port_value":21001}}}]}`,
+	})
+
+	var out bytes.Buffer
+	if err := analyzeListenerStats(&out, staged, ""); err != nil {
+		t.Fatalf("analyzeListenerStats() error: %v", err)
+	}
+	for _, want := range []string{
+		"== abcdef12/listeners.json ==",
+		"public_listener:0.0.0.0:21000  0.0.0.0:21000  4       9",
+		"== port_19002/listeners_format_json.json ==\nno /stats captured next to it",
+		"other     10.0.0.1:21001",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("analyzeListenerStats() output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := analyzeListenerStats(&out, staged, "nomatch"); err != nil {
+		t.Fatalf("analyzeListenerStats() error: %v", err)
+	}
+	if strings.Count(out.String(), "no listeners") != 2 {
+		t.Errorf("analyzeListenerStats() with a filter = %q", out.String())
+	}
+
+	if err := analyzeListenerStats(&out, filepath.Join(staged, "abcdef12", "stats.json"), ""); err == nil {
+		t.Error("analyzeListenerStats() accepted a snapshot without /listeners")
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// acquireLock creates the lock file path holding this process's PID, so
+// only one run at a time writes what it guards. A lock left by a process
+// that no longer runs, e.g. one killed with a second Ctrl-C, is taken over.
+// what describes the guarded output in the error returned while another run
+// holds the lock. release removes the lock and may be called more than once.
+func acquireLock(path, what string) (release func(), err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			pid, alive := lockHolder(path)
+			if alive {
+				return nil, fmt.Errorf("another capture (PID %d) is writing to %s; if none is running, remove %s", pid, what, path)
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		released := false
+		return func() {
+			if !released {
+				released = true
+				os.Remove(path)
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("another capture keeps claiming %s (lock %s)", what, path)
+}
+
+// lockHolder returns the PID recorded in the lock file at path and whether
+// that process still runs. An unreadable lock is treated as held, since it
+// may be in the middle of being written.
+func lockHolder(path string) (pid int, alive bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, !errors.Is(err, fs.ErrNotExist)
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, len(data) == 0
+	}
+	return pid, processAlive(pid)
+}
+
+// processAlive reports whether a process with pid exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess only succeeds for a running process
+		p.Release()
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.lock")
+	release, err := acquireLock(path, "out")
+	if err != nil {
+		t.Fatalf("acquireLock() error: %v", err)
+	}
+	if _, err := acquireLock(path, "out"); err == nil || !strings.Contains(err.Error(), "another capture (PID "+strconv.Itoa(os.Getpid())+") is writing to out") {
+		t.Errorf("second acquireLock() error = %v, want the lock reported as held", err)
+	}
+	release()
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock left after release: %v", err)
+	}
+
+	// A lock whose process has exited is taken over
+	writeStaleLock(t, path)
+	release, err = acquireLock(path, "out")
+	if err != nil {
+		t.Fatalf("acquireLock() over a stale lock error: %v", err)
+	}
+	release()
+}
+
+// writeStaleLock writes a lock at path held by a process that has exited.
+func writeStaleLock(t *testing.T, path string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.ProcessState.Pid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
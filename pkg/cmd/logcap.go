@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Which end of an oversized log to keep.
+const (
+	LogKeepHead = "head"
+	LogKeepTail = "tail"
+)
+
+// logLimit caps how much of each task log stream is written to disk.
+type logLimit struct {
+	maxBytes int64  // 0 means unlimited
+	keep     string // LogKeepHead or LogKeepTail
+}
+
+// wrap returns a writer enforcing the limit on w. Close must be called once
+// the stream ends; for tail mode that is when the kept bytes are written.
+func (l logLimit) wrap(w io.Writer) io.WriteCloser {
+	switch {
+	case l.maxBytes <= 0:
+		return nopWriteCloser{w}
+	case l.keep == LogKeepHead:
+		return &headWriter{w: w, limit: l.maxBytes}
+	default:
+		return &tailWriter{w: w, limit: l.maxBytes}
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// headWriter passes through the first limit bytes and discards the rest.
+type headWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+	dropped int64
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	if room := h.limit - h.written; n > room {
+		h.dropped += n - room
+		p = p[:room]
+	}
+	if len(p) > 0 {
+		if _, err := h.w.Write(p); err != nil {
+			return 0, err
+		}
+		h.written += int64(len(p))
+	}
+	// Report everything as consumed so the log stream keeps draining
+	return int(n), nil
+}
+
+func (h *headWriter) Close() error {
+	if h.dropped == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(h.w, "\n[xdsnap: log truncated, %d further bytes dropped by --max-log-bytes]\n", h.dropped)
+	return err
+}
+
+// tailWriter keeps only the last limit bytes in memory and writes them on
+// Close.
+type tailWriter struct {
+	w     io.Writer
+	limit int64
+	buf   []byte
+	total int64
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.total += int64(len(p))
+	t.buf = append(t.buf, p...)
+	// Compact occasionally rather than on every write
+	if int64(len(t.buf)) > 2*t.limit {
+		t.buf = append(t.buf[:0], t.buf[int64(len(t.buf))-t.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) Close() error {
+	kept := t.buf
+	if int64(len(kept)) > t.limit {
+		kept = kept[int64(len(kept))-t.limit:]
+	}
+	if dropped := t.total - int64(len(kept)); dropped > 0 {
+		if _, err := fmt.Fprintf(t.w, "[xdsnap: log truncated, %d earlier bytes dropped by --max-log-bytes]\n", dropped); err != nil {
+			return err
+		}
+	}
+	_, err := t.w.Write(kept)
+	return err
+}
+
+// parseByteSize parses a size such as "1048576", "512K", "50MiB" or "1G".
+// Units are binary (K = 1024).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GiB", 1 << 30}, {"GB", 1 << 30}, {"G", 1 << 30},
+		{"MiB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+		{"KiB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	mult := int64(1)
+	upper := strings.ToUpper(s)
+	for _, u := range units {
+		if strings.HasSuffix(upper, strings.ToUpper(u.suffix)) {
+			mult = u.mult
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func writeChunks(t *testing.T, limit logLimit, chunks ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	w := limit.wrap(&out)
+	for _, c := range chunks {
+		n, err := w.Write([]byte(c))
+		if err != nil || n != len(c) {
+			t.Fatalf("Write(%q) = %d, %v", c, n, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return out.String()
+}
+
+func TestLogLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  logLimit
+		chunks []string
+		want   string
+	}{
+		{"unlimited", logLimit{}, []string{"abc", "def"}, "abcdef"},
+		{"head under limit", logLimit{maxBytes: 10, keep: LogKeepHead}, []string{"abc", "def"}, "abcdef"},
+		{"head over limit", logLimit{maxBytes: 4, keep: LogKeepHead}, []string{"abc", "def", "ghi"}, "abcd\n[xdsnap: log truncated, 5 further bytes dropped by --max-log-bytes]\n"},
+		{"tail under limit", logLimit{maxBytes: 10, keep: LogKeepTail}, []string{"abc", "def"}, "abcdef"},
+		{"tail over limit", logLimit{maxBytes: 4, keep: LogKeepTail}, []string{"abc", "def", "ghi", "jkl"}, "[xdsnap: log truncated, 8 earlier bytes dropped by --max-log-bytes]\nijkl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeChunks(t, tt.limit, tt.chunks...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailWriterBoundsMemory(t *testing.T) {
+	var out bytes.Buffer
+	w := logLimit{maxBytes: 16, keep: LogKeepTail}.wrap(&out).(*tailWriter)
+	for i := 0; i < 1000; i++ {
+		_, _ = w.Write([]byte(strings.Repeat("x", 7)))
+		if len(w.buf) > 2*16+7 {
+			t.Fatalf("buffer grew to %d bytes", len(w.buf))
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1048576", 1 << 20, false},
+		{"512K", 512 << 10, false},
+		{"50MiB", 50 << 20, false},
+		{"50mb", 50 << 20, false},
+		{"1G", 1 << 30, false},
+		{"1.5G", 0, true},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
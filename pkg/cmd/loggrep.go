@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// logFilter keeps only log lines matching pattern, plus context lines before
+// and after each match, grep-style. Non-adjacent groups are separated by a
+// "--" line.
+type logFilter struct {
+	pattern *regexp.Regexp // nil keeps everything
+	context int
+}
+
+// wrap returns a writer that applies the filter to w line by line. Close
+// flushes a trailing line without a newline and closes w when it is a
+// Closer.
+func (f logFilter) wrap(w io.WriteCloser) io.WriteCloser {
+	if f.pattern == nil {
+		return w
+	}
+	return &grepWriter{w: w, filter: f}
+}
+
+type grepWriter struct {
+	w       io.WriteCloser
+	filter  logFilter
+	partial []byte
+	before  [][]byte // up to context lines preceding the next match
+	after   int      // lines still to print after the last match
+	printed bool     // whether any line has been written
+	gap     bool     // whether lines were skipped since the last written one
+}
+
+func (g *grepWriter) Write(p []byte) (int, error) {
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			g.partial = append(g.partial, data...)
+			return len(p), nil
+		}
+		line := append(g.partial, data[:i+1]...)
+		g.partial = nil
+		if err := g.line(line); err != nil {
+			return 0, err
+		}
+		data = data[i+1:]
+	}
+}
+
+func (g *grepWriter) line(line []byte) error {
+	switch {
+	case g.filter.pattern.Match(line):
+		if g.gap && g.printed {
+			if _, err := g.w.Write([]byte("--\n")); err != nil {
+				return err
+			}
+		}
+		for _, b := range g.before {
+			if _, err := g.w.Write(b); err != nil {
+				return err
+			}
+		}
+		g.before = nil
+		g.after = g.filter.context
+		g.gap = false
+		g.printed = true
+		_, err := g.w.Write(line)
+		return err
+	case g.after > 0:
+		g.after--
+		_, err := g.w.Write(line)
+		return err
+	case g.filter.context > 0:
+		if len(g.before) == g.filter.context {
+			g.before = g.before[1:]
+			g.gap = true
+		}
+		g.before = append(g.before, append([]byte(nil), line...))
+	default:
+		g.gap = true
+	}
+	return nil
+}
+
+func (g *grepWriter) Close() error {
+	var err error
+	if len(g.partial) > 0 {
+		err = g.line(g.partial)
+		g.partial = nil
+	}
+	if closeErr := g.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
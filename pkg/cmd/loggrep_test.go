@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestLogFilter(t *testing.T) {
+	input := "a1\nb1\nERR one\nc1\nc2\nc3\nc4\nERR two\nd1\nERR three"
+	tests := []struct {
+		name    string
+		pattern string
+		context int
+		want    string
+	}{
+		{"no pattern", "", 0, input},
+		{"matches only", "ERR", 0, "ERR one\n--\nERR two\n--\nERR three"},
+		{"with context", "ERR", 1, "b1\nERR one\nc1\n--\nc4\nERR two\nd1\nERR three"},
+		{"wide context merges groups", "ERR", 2, "a1\nb1\nERR one\nc1\nc2\nc3\nc4\nERR two\nd1\nERR three"},
+		{"no matches", "nope", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			filter := logFilter{context: tt.context}
+			if tt.pattern != "" {
+				filter.pattern = regexp.MustCompile(tt.pattern)
+			}
+			w := filter.wrap(nopWriteCloser{&out})
+			// Split writes mid-line to exercise partial line handling
+			for i := 0; i < len(input); i += 5 {
+				end := i + 5
+				if end > len(input) {
+					end = len(input)
+				}
+				if _, err := w.Write([]byte(input[i:end])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// lineMux lets several streams write to one destination without tearing
+// lines: each stream gets a lineWriter that buffers until a newline and then
+// writes the whole line under the mux's lock. Lines appear in the order they
+// were completed, so streams are interleaved by arrival rather than by any
+// timestamp in the lines.
+type lineMux struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (m *lineMux) write(p []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.w.Write(p)
+	return err
+}
+
+// stream returns a writer for one source. Closing it flushes a trailing
+// partial line but leaves the destination open.
+func (m *lineMux) stream() io.WriteCloser {
+	return &lineWriter{mux: m}
+}
+
+// prefixed is like stream but starts every line with prefix.
+func (m *lineMux) prefixed(prefix string) io.WriteCloser {
+	return &lineWriter{mux: m, prefix: []byte(prefix)}
+}
+
+type lineWriter struct {
+	mux     *lineMux
+	prefix  []byte
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			l.partial = append(l.partial, p...)
+			break
+		}
+		line := append(append(l.prefix[:len(l.prefix):len(l.prefix)], l.partial...), p[:i+1]...)
+		l.partial = nil
+		if err := l.mux.write(line); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (l *lineWriter) Close() error {
+	if len(l.partial) == 0 {
+		return nil
+	}
+	line := append(append(l.prefix[:len(l.prefix):len(l.prefix)], l.partial...), '\n')
+	l.partial = nil
+	return l.mux.write(line)
+}
+
+// teeWriter copies every write to two writers and closes both.
+type teeWriter struct {
+	a, b io.WriteCloser
+}
+
+func (t teeWriter) Write(p []byte) (int, error) {
+	if _, err := t.a.Write(p); err != nil {
+		return 0, err
+	}
+	if _, err := t.b.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t teeWriter) Close() error {
+	err := t.a.Close()
+	if bErr := t.b.Close(); err == nil {
+		err = bErr
+	}
+	return err
+}
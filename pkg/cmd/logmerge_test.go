@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type muxWrite struct {
+	stream int
+	data   string
+}
+
+func TestLineMux(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []muxWrite
+		want   string
+	}{
+		{
+			name: "interleaves complete lines in arrival order",
+			writes: []muxWrite{
+				{0, "out one\n"}, {1, "err one\n"}, {0, "out two\n"},
+			},
+			want: "out one\nerr one\nout two\n",
+		},
+		{
+			name: "partial lines are held until complete",
+			writes: []muxWrite{
+				{0, "out "}, {1, "err one\n"}, {0, "one\nout tw"}, {1, "err two"},
+			},
+			want: "err one\nout one\nout tw\nerr two\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			mux := &lineMux{w: &out}
+			streams := []io.WriteCloser{mux.stream(), mux.stream()}
+			for _, w := range tt.writes {
+				if _, err := streams[w.stream].Write([]byte(w.data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, s := range streams {
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineMuxConcurrent(t *testing.T) {
+	var out bytes.Buffer
+	mux := &lineMux{w: &out}
+	var wg sync.WaitGroup
+	for _, name := range []string{"stdout", "stderr"} {
+		w := mux.stream()
+		name := name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				// Split every line across two writes
+				w.Write([]byte(name + " li"))
+				w.Write([]byte("ne\n"))
+			}
+			w.Close()
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	sort.Strings(lines)
+	if len(lines) != 200 || lines[0] != "stderr line" || lines[199] != "stdout line" {
+		t.Fatalf("lines were torn or lost: %d lines", len(lines))
+	}
+	for _, l := range lines {
+		if l != "stderr line" && l != "stdout line" {
+			t.Fatalf("torn line %q", l)
+		}
+	}
+}
+
+func TestLineMuxPrefixed(t *testing.T) {
+	var out bytes.Buffer
+	mux := &lineMux{w: &out}
+	a, b := mux.prefixed("[a] "), mux.prefixed("[b] ")
+	a.Write([]byte("one\ntw"))
+	b.Write([]byte("three\n"))
+	a.Write([]byte("o\n"))
+	b.Write([]byte("partial"))
+	a.Close()
+	b.Close()
+
+	want := "[a] one\n[b] three\n[a] two\n[b] partial\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTeeWriter(t *testing.T) {
+	var file, console bytes.Buffer
+	mux := &lineMux{w: &console}
+	w := teeWriter{a: nopWriteCloser{&file}, b: mux.prefixed("[web] ")}
+	if _, err := w.Write([]byte("hello\nworld")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := file.String(); got != "hello\nworld" {
+		t.Errorf("file = %q, want unprefixed copy", got)
+	}
+	if got, want := console.String(), "[web] hello\n[web] world\n"; got != want {
+		t.Errorf("console = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// nodeFilter selects allocations by the class and metadata of the Nomad
+// client node they run on.
+type nodeFilter struct {
+	class string
+	meta  map[string]string
+}
+
+func (f nodeFilter) active() bool {
+	return f.class != "" || len(f.meta) > 0
+}
+
+// parseMeta parses the repeated key=value values of flag.
+func parseMeta(flag string, pairs []string) (map[string]string, error) {
+	meta := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected key=value", flag, pair)
+		}
+		meta[k] = v
+	}
+	return meta, nil
+}
+
+// mismatch describes why node doesn't match, or returns "" when it does.
+func (f nodeFilter) mismatch(node *nomad.NodeInfo) string {
+	if f.class != "" && node.NodeClass != f.class {
+		return fmt.Sprintf("node %s has class %q", node.Name, node.NodeClass)
+	}
+	keys := make([]string, 0, len(f.meta))
+	for k := range f.meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := node.Meta[k]; !ok || v != f.meta[k] {
+			return fmt.Sprintf("node %s does not have meta %s=%s", node.Name, k, f.meta[k])
+		}
+	}
+	return ""
+}
+
+// filterByNode keeps the allocations running on matching nodes. Each node is
+// looked up once; allocations on other nodes are recorded as excluded by the
+// filter, and those whose node can't be looked up as lookup failures.
+func filterByNode(nomadService nomad.NomadApiService, allocs []nomad.AllocationInfo, f nodeFilter, skips *skipReport) []nomad.AllocationInfo {
+	type result struct {
+		detail string
+		err    error
+	}
+	nodes := make(map[string]result)
+
+	var kept []nomad.AllocationInfo
+	for _, alloc := range allocs {
+		r, ok := nodes[alloc.NodeID]
+		if !ok {
+			node, err := nomadService.GetNode(alloc.NodeID)
+			if err != nil {
+				r = result{err: err}
+			} else {
+				r = result{detail: f.mismatch(node)}
+			}
+			nodes[alloc.NodeID] = r
+		}
+		switch {
+		case r.err != nil:
+			log.Printf("Skipping allocation %s: node lookup failed: %v", alloc.ID[:8], r.err)
+			skips.add(alloc.ID, SkipLookupFailed, r.err.Error())
+		case r.detail != "":
+			log.Printf("Skipping allocation %s: %s", alloc.ID[:8], r.detail)
+			skips.add(alloc.ID, SkipExcludedByFilter, r.detail)
+		default:
+			kept = append(kept, alloc)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestParseMeta(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", nil, map[string]string{}, false},
+		{"pairs", []string{"pool=gpu", "rack=r1=a"}, map[string]string{"pool": "gpu", "rack": "r1=a"}, false},
+		{"empty value", []string{"spot="}, map[string]string{"spot": ""}, false},
+		{"missing separator", []string{"gpu"}, nil, true},
+		{"missing key", []string{"=gpu"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMeta("--node-meta", tt.pairs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMeta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMeta() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeFilterMismatch(t *testing.T) {
+	node := &nomad.NodeInfo{Name: "client-1", NodeClass: "gpu", Meta: map[string]string{"rack": "r1"}}
+	tests := []struct {
+		name   string
+		filter nodeFilter
+		want   string
+	}{
+		{"matching class", nodeFilter{class: "gpu"}, ""},
+		{"other class", nodeFilter{class: "batch"}, `node client-1 has class "gpu"`},
+		{"matching meta", nodeFilter{meta: map[string]string{"rack": "r1"}}, ""},
+		{"other meta value", nodeFilter{meta: map[string]string{"rack": "r2"}}, "node client-1 does not have meta rack=r2"},
+		{"missing meta key", nodeFilter{class: "gpu", meta: map[string]string{"zone": ""}}, "node client-1 does not have meta zone="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.mismatch(node); got != tt.want {
+				t.Errorf("mismatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// lookupNodeStatuses fetches the status of every node running one of allocs,
+// once per node. Nodes that can't be looked up are logged and left out.
+func lookupNodeStatuses(nomadService nomad.NomadApiService, allocs []nomad.AllocationInfo) map[string]*nomad.NodeStatus {
+	statuses := make(map[string]*nomad.NodeStatus)
+	failed := make(map[string]bool)
+	for _, alloc := range allocs {
+		if alloc.NodeID == "" || statuses[alloc.NodeID] != nil || failed[alloc.NodeID] {
+			continue
+		}
+		node, err := nomadService.GetNodeStatus(alloc.NodeID)
+		if err != nil {
+			log.Printf("WARNING: not capturing node info of %s: %v", alloc.NodeID, err)
+			failed[alloc.NodeID] = true
+			continue
+		}
+		statuses[alloc.NodeID] = node
+	}
+	return statuses
+}
+
+// nodeFindings describes the node states that explain problems with every
+// allocation on the node.
+func nodeFindings(node *nomad.NodeStatus) []string {
+	if node == nil {
+		return nil
+	}
+	var findings []string
+	if node.Status != "" && node.Status != "ready" {
+		findings = append(findings, fmt.Sprintf("Nomad node %s is %s", node.Name, node.Status))
+	}
+	if node.Drain {
+		findings = append(findings, fmt.Sprintf("Nomad node %s is draining", node.Name))
+	}
+	if node.SchedulingEligibility == "ineligible" {
+		findings = append(findings, fmt.Sprintf("Nomad node %s is ineligible for scheduling", node.Name))
+	}
+	return findings
+}
+
+func writeNodeStatus(node *nomad.NodeStatus, path string) error {
+	return os.WriteFile(path, append(node.Raw, '\n'), 0644)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestNodeFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		node *nomad.NodeStatus
+		want []string
+	}{
+		{"no node", nil, nil},
+		{"healthy", &nomad.NodeStatus{Name: "client-1", Status: "ready", SchedulingEligibility: "eligible"}, nil},
+		{"draining", &nomad.NodeStatus{Name: "client-1", Status: "ready", Drain: true, SchedulingEligibility: "ineligible"}, []string{
+			"Nomad node client-1 is draining",
+			"Nomad node client-1 is ineligible for scheduling",
+		}},
+		{"down", &nomad.NodeStatus{Name: "client-2", Status: "down", SchedulingEligibility: "eligible"}, []string{
+			"Nomad node client-2 is down",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeFindings(tt.node); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeFindings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// nodeStatusService answers GetNodeStatus from a map and counts lookups.
+type nodeStatusService struct {
+	nomad.NomadApiService
+	nodes   map[string]*nomad.NodeStatus
+	lookups map[string]int
+}
+
+func (s *nodeStatusService) GetNodeStatus(nodeID string) (*nomad.NodeStatus, error) {
+	s.lookups[nodeID]++
+	if node, ok := s.nodes[nodeID]; ok {
+		return node, nil
+	}
+	return nil, errors.New("node not found")
+}
+
+func TestLookupNodeStatuses(t *testing.T) {
+	svc := &nodeStatusService{
+		nodes:   map[string]*nomad.NodeStatus{"n1": {ID: "n1"}, "n2": {ID: "n2"}},
+		lookups: make(map[string]int),
+	}
+	allocs := []nomad.AllocationInfo{
+		{ID: "a1", NodeID: "n1"}, {ID: "a2", NodeID: "n1"}, {ID: "a3", NodeID: "n2"},
+		{ID: "a4", NodeID: "gone"}, {ID: "a5", NodeID: "gone"}, {ID: "a6"},
+	}
+	got := lookupNodeStatuses(svc, allocs)
+	if len(got) != 2 || got["n1"].ID != "n1" || got["n2"].ID != "n2" {
+		t.Errorf("lookupNodeStatuses() = %v", got)
+	}
+	want := map[string]int{"n1": 1, "n2": 1, "gone": 1}
+	if !reflect.DeepEqual(svc.lookups, want) {
+		t.Errorf("lookups = %v, want one per node %v", svc.lookups, want)
+	}
+}
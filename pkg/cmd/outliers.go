@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// outlierHost is one endpoint of a cluster in Envoy's /clusters output, with
+// the counters outlier detection acts on.
+type outlierHost struct {
+	Address     string
+	Ejected     bool // health flags include failed_outlier_check
+	Errors      uint64
+	Total       uint64
+	SuccessRate string // success rate outlier detection computed, "" when not computed
+}
+
+// outlierCluster is the outlier-detection state of one cluster.
+type outlierCluster struct {
+	Name  string
+	Hosts []outlierHost
+	// Stats are the cluster's outlier_detection.* counters from /stats, by
+	// name without the cluster.<name>.outlier_detection. prefix; nil when
+	// /stats wasn't captured.
+	Stats map[string]uint64
+}
+
+// ejected returns how many of the cluster's endpoints are currently ejected.
+func (c outlierCluster) ejected() int {
+	n := 0
+	for _, h := range c.Hosts {
+		if h.Ejected {
+			n++
+		}
+	}
+	return n
+}
+
+// hasEjections reports whether the cluster has an ejected endpoint or
+// /stats shows it ejected any before.
+func (c outlierCluster) hasEjections() bool {
+	return c.ejected() > 0 || c.Stats["ejections_active"] > 0 || c.Stats["ejections_enforced_total"] > 0
+}
+
+// parseOutlierHosts reads the endpoints of every cluster from a /clusters
+// response, in either the text or the ?format=json form.
+func parseOutlierHosts(data []byte) (map[string][]outlierHost, error) {
+	clusters := make(map[string][]outlierHost)
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc struct {
+			ClusterStatuses []struct {
+				Name         string `json:"name"`
+				HostStatuses []struct {
+					Address struct {
+						SocketAddress socketAddress `json:"socket_address"`
+					} `json:"address"`
+					Stats []struct {
+						Name  string      `json:"name"`
+						Value json.Number `json:"value"`
+					} `json:"stats"`
+					HealthStatus struct {
+						FailedOutlierCheck bool `json:"failed_outlier_check"`
+					} `json:"health_status"`
+					SuccessRate *struct {
+						Value float64 `json:"value"`
+					} `json:"success_rate"`
+				} `json:"host_statuses"`
+			} `json:"cluster_statuses"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse /clusters: %w", err)
+		}
+		for _, c := range doc.ClusterStatuses {
+			hosts := []outlierHost{}
+			for _, hs := range c.HostStatuses {
+				sa := hs.Address.SocketAddress
+				h := outlierHost{Address: fmt.Sprintf("%s:%d", sa.Address, sa.PortValue), Ejected: hs.HealthStatus.FailedOutlierCheck}
+				for _, s := range hs.Stats {
+					v, _ := strconv.ParseUint(s.Value.String(), 10, 64)
+					switch s.Name {
+					case "rq_error":
+						h.Errors = v
+					case "rq_total":
+						h.Total = v
+					}
+				}
+				if hs.SuccessRate != nil {
+					h.SuccessRate = strconv.FormatFloat(hs.SuccessRate.Value, 'f', -1, 64)
+				}
+				hosts = append(hosts, h)
+			}
+			clusters[c.Name] = hosts
+		}
+		return clusters, nil
+	}
+
+	// text form: cluster::address::stat::value, one per line, grouped by host
+	index := make(map[string]int)
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "::")
+		if len(parts) != 4 || parts[0] == "" || !strings.Contains(parts[1], ":") {
+			continue
+		}
+		name, addr, stat, value := parts[0], parts[1], parts[2], parts[3]
+		key := name + "::" + addr
+		i, ok := index[key]
+		if !ok {
+			i = len(clusters[name])
+			index[key] = i
+			clusters[name] = append(clusters[name], outlierHost{Address: addr})
+		}
+		h := &clusters[name][i]
+		switch stat {
+		case "health_flags":
+			h.Ejected = strings.Contains(value, "/failed_outlier_check")
+		case "rq_error":
+			h.Errors, _ = strconv.ParseUint(value, 10, 64)
+		case "rq_total":
+			h.Total, _ = strconv.ParseUint(value, 10, 64)
+		case "success_rate":
+			if value != "-1" {
+				h.SuccessRate = value
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// outlierClusters joins the endpoints of a /clusters response with the
+// cluster.<name>.outlier_detection.* counters in stats, which may be nil.
+// Clusters with ejections come first, most ejected endpoints first.
+func outlierClusters(clusters []byte, stats map[string]uint64) ([]outlierCluster, error) {
+	hosts, err := parseOutlierHosts(clusters)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]outlierCluster, 0, len(hosts))
+	for name, h := range hosts {
+		c := outlierCluster{Name: name, Hosts: h}
+		if stats != nil {
+			c.Stats = make(map[string]uint64)
+			prefix := "cluster." + name + ".outlier_detection."
+			for stat, v := range stats {
+				if strings.HasPrefix(stat, prefix) {
+					c.Stats[strings.TrimPrefix(stat, prefix)] = v
+				}
+			}
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.hasEjections() != b.hasEjections() {
+			return a.hasEjections()
+		}
+		if a.ejected() != b.ejected() {
+			return a.ejected() > b.ejected()
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+// ejectionCauses renders the enforced ejections of a cluster by cause, e.g.
+// "consecutive_5xx=9, success_rate=3".
+func (c outlierCluster) ejectionCauses() string {
+	const prefix = "ejections_enforced_"
+	var causes []string
+	for stat, v := range c.Stats {
+		if strings.HasPrefix(stat, prefix) && stat != prefix+"total" && v > 0 {
+			causes = append(causes, fmt.Sprintf("%s=%d", strings.TrimPrefix(stat, prefix), v))
+		}
+	}
+	sort.Strings(causes)
+	return strings.Join(causes, ", ")
+}
+
+// printOutliers writes a line per cluster with ejections and a table of its
+// endpoints. Clusters without ejections are only counted.
+func printOutliers(w io.Writer, clusters []outlierCluster) {
+	quiet := 0
+	for _, c := range clusters {
+		if !c.hasEjections() {
+			quiet++
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d of %d endpoints ejected", c.Name, c.ejected(), len(c.Hosts))
+		if c.Stats != nil {
+			fmt.Fprintf(w, " (ejections: %d active, %d enforced", c.Stats["ejections_active"], c.Stats["ejections_enforced_total"])
+			if causes := c.ejectionCauses(); causes != "" {
+				fmt.Fprintf(w, ": %s", causes)
+			}
+			fmt.Fprint(w, ")")
+		}
+		fmt.Fprintln(w)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ENDPOINT\tEJECTED\tERRORS\tREQUESTS\tSUCCESS RATE")
+		for _, h := range c.Hosts {
+			ejected, rate := "no", h.SuccessRate
+			if h.Ejected {
+				ejected = "EJECTED"
+			}
+			if rate == "" {
+				rate = "-"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\t%s\n", h.Address, ejected, h.Errors, h.Total, rate)
+		}
+		tw.Flush()
+	}
+	if quiet == len(clusters) {
+		fmt.Fprintf(w, "no outlier ejections in %d clusters\n", quiet)
+	} else if quiet > 0 {
+		fmt.Fprintf(w, "%d other clusters have no outlier ejections\n", quiet)
+	}
+}
+
+// analyzeOutliers prints the outlier-detection state of every /clusters
+// response in snapshot, joined with the /stats captured next to it.
+func analyzeOutliers(w io.Writer, snapshot string) error {
+	clusterFiles, err := readSnapshotFiles(snapshot, isClustersFile)
+	if err != nil {
+		return exitErrorf(ExitNoData, "%w", err)
+	}
+	if len(clusterFiles) == 0 {
+		return exitErrorf(ExitNoData, "no /clusters output found in %s", snapshot)
+	}
+	stats := make(map[string]map[string]uint64)
+	if !isClustersFile(snapshot) {
+		if stats, err = readStatCounters(snapshot); err != nil {
+			return exitErrorf(ExitNoData, "%w", err)
+		}
+	}
+
+	for i, f := range clusterFiles {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", f.name)
+		clusters, err := outlierClusters(f.data, stats[path.Dir(f.name)])
+		if err != nil {
+			return exitErrorf(ExitNoData, "%s: %w", f.name, err)
+		}
+		if len(clusters) == 0 {
+			fmt.Fprintln(w, "no clusters")
+			continue
+		}
+		printOutliers(w, clusters)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOutlierHosts(t *testing.T) {
+	want := map[string][]outlierHost{
+		"api": {
+			{Address: "10.0.0.1:21000", Ejected: true, Errors: 7, Total: 9, SuccessRate: "22.2"},
+			{Address: "10.0.0.2:21000", Total: 12},
+		},
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "text",
+			data: `api::outlier::success_rate_average::-1
+api::default_priority::max_connections::1024
+api::added_via_api::true
+api::10.0.0.1:21000::rq_error::7
+api::10.0.0.1:21000::rq_total::9
+api::10.0.0.1:21000::health_flags::/failed_outlier_check
+api::10.0.0.1:21000::success_rate::22.2
+api::10.0.0.2:21000::rq_error::0
+api::10.0.0.2:21000::rq_total::12
+api::10.0.0.2:21000::health_flags::healthy
+api::10.0.0.2:21000::success_rate::-1
+`,
+		},
+		{
+			name: "json",
+			data: `{"cluster_statuses":[{"name":"api","host_statuses":[
+{"address":{"socket_address":{"address":"10.0.0.1","port_value":21000}},
+ "stats":[{"name":"rq_error","value":"7"},{"name":"rq_total","value":"9"},{"name":"cx_active"}],
+ "health_status":{"failed_outlier_check":true,"eds_health_status":"HEALTHY"},"success_rate":{"value":22.2}},
+{"address":{"socket_address":{"address":"10.0.0.2","port_value":21000}},
+ "stats":[{"name":"rq_total","value":"12"}],"health_status":{"eds_health_status":"HEALTHY"}}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutlierHosts([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseOutlierHosts() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseOutlierHosts() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestOutlierClusters(t *testing.T) {
+	clusters := []byte(`web::10.0.0.5:21000::health_flags::healthy
+api::10.0.0.1:21000::health_flags::/failed_outlier_check
+api::10.0.0.2:21000::health_flags::/failed_active_hc/failed_outlier_check
+api::10.0.0.3:21000::health_flags::healthy
+db::10.0.0.9:21000::health_flags::healthy
+`)
+	stats := map[string]uint64{
+		"cluster.api.outlier_detection.ejections_active":                   2,
+		"cluster.api.outlier_detection.ejections_enforced_total":           12,
+		"cluster.api.outlier_detection.ejections_enforced_consecutive_5xx": 9,
+		"cluster.api.outlier_detection.ejections_enforced_success_rate":    3,
+		"cluster.api.outlier_detection.ejections_detected_consecutive_5xx": 10,
+		"cluster.db.outlier_detection.ejections_active":                    0,
+		"cluster.db.outlier_detection.ejections_enforced_total":            1,
+		"cluster.api.upstream_rq_503":                                      40,
+	}
+
+	got, err := outlierClusters(clusters, stats)
+	if err != nil {
+		t.Fatalf("outlierClusters() error: %v", err)
+	}
+	var names []string
+	for _, c := range got {
+		names = append(names, c.Name)
+	}
+	if want := []string{"api", "db", "web"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("cluster order = %v, want %v", names, want)
+	}
+	if got[0].ejected() != 2 || got[0].ejectionCauses() != "consecutive_5xx=9, success_rate=3" {
+		t.Errorf("api ejected = %d, causes = %q", got[0].ejected(), got[0].ejectionCauses())
+	}
+
+	var out bytes.Buffer
+	printOutliers(&out, got)
+	for _, want := range []string{
+		"api: 2 of 3 endpoints ejected (ejections: 2 active, 12 enforced: consecutive_5xx=9, success_rate=3)\n",
+		"  10.0.0.1:21000  EJECTED  0       0         -",
+		"  10.0.0.3:21000  no       0       0         -",
+		"db: 0 of 1 endpoints ejected (ejections: 0 active, 1 enforced)\n",
+		"1 other clusters have no outlier ejections\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printOutliers() output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	quiet, err := outlierClusters([]byte("web::10.0.0.5:21000::health_flags::healthy\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	printOutliers(&out, quiet)
+	if out.String() != "no outlier ejections in 1 clusters\n" {
+		t.Errorf("printOutliers() without ejections = %q", out.String())
+	}
+}
+
+func TestAnalyzeOutliers(t *testing.T) {
+	staged := t.TempDir()
+	writeTree(t, staged, map[string]string{
+		"abcdef12/clusters.json": "api::10.0.0.1:21000::health_flags::/failed_outlier_check\n",
+		"abcdef12/stats.json":    "cluster.api.outlier_detection.ejections_active: 1\ncluster.api.outlier_detection.ejections_enforced_total: 4\n",
+	})
+
+	var out bytes.Buffer
+	if err := analyzeOutliers(&out, staged); err != nil {
+		t.Fatalf("analyzeOutliers() error: %v", err)
+	}
+	if want := "== abcdef12/clusters.json ==\napi: 1 of 1 endpoints ejected (ejections: 1 active, 4 enforced)\n"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("analyzeOutliers() = %q, want prefix %q", out.String(), want)
+	}
+	if err := analyzeOutliers(&out, filepath.Join(staged, "abcdef12", "stats.json")); err == nil {
+		t.Error("analyzeOutliers() accepted a snapshot without /clusters")
+	}
+}
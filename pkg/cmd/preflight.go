@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// preflightResult records whether one allocation's Envoy admin API can be
+// reached through nomad alloc exec, and whether the requested features that
+// need more than that will work.
+type preflightResult struct {
+	AllocID  string
+	Strategy *nomad.ExecStrategy // nil when no task has a usable HTTP tool
+	Ready    string              // trimmed /ready body
+	Err      error
+	Features []featureCheck
+}
+
+// featureCheck is the outcome of probing one capture feature's permission
+// or capability.
+type featureCheck struct {
+	Name   string
+	Detail string // e.g. the task the feature will run in
+	Err    error  // nil when the feature is available
+}
+
+// preflightFeatures are the capture features to probe beyond admin access.
+type preflightFeatures struct {
+	LogLevel         bool // the capture changes the Envoy log level, a POST
+	Tcpdump          bool
+	TcpdumpInterface string
+	TaskName         string // --task, picks the task whose logs are read as for capture
+}
+
+// logProbeTimeout bounds the task log read that checks the read-logs
+// capability.
+const logProbeTimeout = 2 * time.Second
+
+func (r preflightResult) reachable() bool {
+	return r.Err == nil
+}
+
+// preflightAllocs resolves the exec strategy of every allocation and fetches
+// /ready once through it. Nothing is captured and the log level is not
+// touched.
+func preflightAllocs(nomadService nomad.NomadApiService, allocs []nomad.AllocationInfo, headers []nomad.Header, pathPrefix string, targets map[string]adminTarget, features preflightFeatures) []preflightResult {
+	results := make([]preflightResult, 0, len(allocs))
+	for _, alloc := range allocs {
+		result := preflightResult{AllocID: alloc.ID}
+		result.Features = append(result.Features, checkTaskLogs(nomadService, alloc, logTask(alloc, features.TaskName)))
+		target := targets[alloc.ID]
+		strategy, err := resolveAdminStrategy(nomadService, alloc, target)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		strategy.Headers = headers
+		strategy.PathPrefix = pathPrefix
+		strategy.Address = target.addr
+		strategy.Timeout = target.timeouts.fallback
+		result.Strategy = strategy
+
+		body, err := nomadService.EnvoyAdminGET(alloc.ID, target.timeouts.apply(strategy, "/ready"), target.ports[0], "/ready")
+		if err != nil {
+			result.Err = fmt.Errorf("/ready failed: %w", err)
+			results = append(results, result)
+			continue
+		}
+		result.Ready = strings.TrimSpace(string(body))
+
+		if features.LogLevel {
+			// POST /logging without a level only lists the loggers
+			check := featureCheck{Name: "log level change"}
+			if err := nomadService.EnvoyAdminPOST(alloc.ID, strategy, target.ports[0], "/logging"); err != nil {
+				check.Err = fmt.Errorf("POST /logging failed, the admin API may be read-only: %w", err)
+			}
+			result.Features = append(result.Features, check)
+		}
+		if features.Tcpdump {
+			iface := features.TcpdumpInterface
+			if iface == "" {
+				iface = DefaultTcpdumpInterface
+			}
+			check := featureCheck{Name: "tcpdump"}
+			task, err := checkTcpdump(nomadService, alloc.ID, buildTaskOrder(alloc.SidecarTask, "", alloc.Tasks), iface)
+			if err != nil {
+				check.Err = err
+			} else {
+				check.Detail = fmt.Sprintf("on %s in task %s", iface, task)
+			}
+			result.Features = append(result.Features, check)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkTaskLogs reads the logs of task, the one capture streams, briefly,
+// which needs the read-logs capability in the allocation's namespace.
+func checkTaskLogs(nomadService nomad.NomadApiService, alloc nomad.AllocationInfo, task string) featureCheck {
+	check := featureCheck{Name: "task logs"}
+	ctx, cancel := context.WithTimeout(context.Background(), logProbeTimeout)
+	defer cancel()
+	err := nomadService.FetchTaskLogs(ctx, alloc.ID, task, "stderr", false, io.Discard)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		check.Err = fmt.Errorf("reading logs of %s failed, the token may lack read-logs: %w", task, err)
+	}
+	return check
+}
+
+// unavailableFeatures counts the feature checks that failed.
+func unavailableFeatures(results []preflightResult) int {
+	n := 0
+	for _, r := range results {
+		for _, f := range r.Features {
+			if f.Err != nil {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// printPreflight writes one line per allocation and a reachable count.
+func printPreflight(w io.Writer, results []preflightResult) {
+	reachable := 0
+	fmt.Fprintln(w, "Preflight:")
+	for _, r := range results {
+		id := r.AllocID[:8]
+		switch {
+		case r.reachable():
+			reachable++
+			fmt.Fprintf(w, "  %s  reachable    %s in task %s, /ready: %s\n", id, r.Strategy.Method, r.Strategy.Task, r.Ready)
+		case r.Strategy != nil:
+			fmt.Fprintf(w, "  %s  unreachable  %s in task %s: %v\n", id, r.Strategy.Method, r.Strategy.Task, firstLine(r.Err))
+		default:
+			fmt.Fprintf(w, "  %s  unreachable  %v\n", id, firstLine(r.Err))
+		}
+		for _, f := range r.Features {
+			switch {
+			case f.Err != nil:
+				fmt.Fprintf(w, "            %-16s  unavailable: %s\n", f.Name, firstLine(f.Err))
+			case f.Detail != "":
+				fmt.Fprintf(w, "            %-16s  ok, %s\n", f.Name, f.Detail)
+			default:
+				fmt.Fprintf(w, "            %-16s  ok\n", f.Name)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d of %d allocation(s) reachable\n", reachable, len(results))
+	if n := unavailableFeatures(results); n > 0 {
+		fmt.Fprintf(w, "%d feature check(s) failed; a capture would run without those features\n", n)
+	}
+}
+
+// preflightError turns the results into the command's exit status: success
+// when every allocation is reachable with every requested feature, partial
+// when only some are or a feature is unavailable.
+func preflightError(results []preflightResult) error {
+	reachable := 0
+	for _, r := range results {
+		if r.reachable() {
+			reachable++
+		}
+	}
+	switch {
+	case reachable == len(results) && unavailableFeatures(results) > 0:
+		return exitErrorf(ExitPartial, "preflight: %d feature check(s) failed", unavailableFeatures(results))
+	case reachable == len(results):
+		return nil
+	case reachable == 0:
+		return exitErrorf(ExitNoData, "preflight: no allocation is reachable through exec")
+	default:
+		return exitErrorf(ExitPartial, "preflight: %d of %d allocation(s) unreachable", len(results)-reachable, len(results))
+	}
+}
+
+// firstLine returns the first line of an error message; exec strategy errors
+// carry multi-line hints.
+func firstLine(err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return msg
+}
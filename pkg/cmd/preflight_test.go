@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestPreflightReport(t *testing.T) {
+	ok := preflightResult{
+		AllocID:  "aaaaaaaa-0000-0000-0000-000000000000",
+		Strategy: &nomad.ExecStrategy{Task: "connect-proxy-web", Method: nomad.MethodWget},
+		Ready:    "LIVE",
+	}
+	noTool := preflightResult{
+		AllocID: "bbbbbbbb-0000-0000-0000-000000000000",
+		Err:     errors.New("no HTTP tool found in any task for allocation bbbbbbbb\n  Tried: web"),
+	}
+	readyFailed := preflightResult{
+		AllocID:  "cccccccc-0000-0000-0000-000000000000",
+		Strategy: &nomad.ExecStrategy{Task: "web", Method: nomad.MethodCurl},
+		Err:      errors.New("/ready failed: exec failed"),
+	}
+
+	tests := []struct {
+		name     string
+		results  []preflightResult
+		wantCode int
+		wantOut  []string
+	}{
+		{"all reachable", []preflightResult{ok}, ExitOK, []string{"aaaaaaaa  reachable    wget in task connect-proxy-web, /ready: LIVE", "1 of 1 allocation(s) reachable"}},
+		{"some unreachable", []preflightResult{ok, noTool, readyFailed}, ExitPartial, []string{"bbbbbbbb  unreachable  no HTTP tool found in any task for allocation bbbbbbbb\n", "cccccccc  unreachable  curl in task web: /ready failed", "1 of 3"}},
+		{"none reachable", []preflightResult{noTool}, ExitNoData, []string{"0 of 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printPreflight(&out, tt.results)
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report missing %q:\n%s", want, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "Tried:") {
+				t.Errorf("report should only show the first line of errors:\n%s", out.String())
+			}
+			if got := ExitCode(preflightError(tt.results)); got != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+// featureService is a probeService whose task logs, admin POSTs and tcpdump
+// check answer as configured.
+type featureService struct {
+	probeService
+	logsErr    error
+	postErr    error
+	tcpdumpOut string
+	tcpdumpIn  string // the only task tcpdump is installed in
+}
+
+func (s *featureService) FetchTaskLogs(ctx context.Context, allocID, task, logType string, follow bool, out io.Writer) error {
+	return s.logsErr
+}
+
+func (s *featureService) EnvoyAdminPOST(allocID string, strategy *nomad.ExecStrategy, port int, path string) error {
+	return s.postErr
+}
+
+func (s *featureService) ExecuteCommandWithStderr(allocID, task string, command []string, stdout, stderr io.Writer) (int, error) {
+	if len(command) == 3 && strings.Contains(command[2], tcpdumpCheckMarker) {
+		if task != s.tcpdumpIn {
+			return 127, nil
+		}
+		io.WriteString(stdout, s.tcpdumpOut)
+	}
+	return 0, nil
+}
+
+func TestPreflightFeatures(t *testing.T) {
+	alloc := nomad.AllocationInfo{ID: "aaaaaaaa-0000", SidecarTask: "connect-proxy-web", Tasks: []string{"web", "connect-proxy-web"}}
+	targets := map[string]adminTarget{alloc.ID: {ports: []int{nomad.EnvoyAdminPort}}}
+	ready := probeService{responses: map[string]string{"/ready": "LIVE"}}
+	all := preflightFeatures{LogLevel: true, Tcpdump: true}
+
+	tests := []struct {
+		name     string
+		svc      *featureService
+		features preflightFeatures
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "everything available",
+			svc:      &featureService{probeService: ready, tcpdumpIn: "web", tcpdumpOut: "==> open\n==> exit 124\n"},
+			features: all,
+			wantCode: ExitOK,
+			wantOut:  []string{"task logs         ok\n", "log level change  ok\n", "tcpdump           ok, on any in task web\n"},
+		},
+		{
+			name: "reduced privileges",
+			svc: &featureService{
+				probeService: ready,
+				logsErr:      errors.New("Permission denied"),
+				postErr:      errors.New("HTTP 403"),
+				tcpdumpIn:    "connect-proxy-web",
+				tcpdumpOut:   "==> open\ntcpdump: any: You don't have permission to capture on that device\n==> exit 1\n",
+			},
+			features: all,
+			wantCode: ExitPartial,
+			wantOut: []string{
+				"task logs         unavailable: reading logs of web failed, the token may lack read-logs: Permission denied\n",
+				"log level change  unavailable: POST /logging failed, the admin API may be read-only: HTTP 403\n",
+				`tcpdump           unavailable: not running tcpdump in task "connect-proxy-web": tcpdump lacks permission to capture on any`,
+				"1 of 1 allocation(s) reachable\n3 feature check(s) failed",
+			},
+		},
+		{
+			name:     "features not requested",
+			svc:      &featureService{probeService: ready},
+			wantCode: ExitOK,
+			wantOut:  []string{"task logs         ok\n1 of 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := preflightAllocs(tt.svc, []nomad.AllocationInfo{alloc}, nil, "", targets, tt.features)
+			var out bytes.Buffer
+			printPreflight(&out, results)
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report missing %q:\n%s", want, out.String())
+				}
+			}
+			if got := ExitCode(preflightError(results)); got != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
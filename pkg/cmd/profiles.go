@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultProfile is the endpoint profile used when neither --profile nor
+// --endpoints is given.
+const DefaultProfile = "default"
+
+// BuiltinProfiles are named endpoint sets for common investigations. Profiles
+// defined under "profiles" in the config file override these by name.
+var BuiltinProfiles = map[string][]string{
+	DefaultProfile: DefaultEndpoints,
+	"connectivity": {"/clusters", "/listeners", "/config_dump", "/stats?filter=(upstream_cx|upstream_rq|downstream_cx)"},
+	"tls":          {"/certs", "/config_dump", "/stats?filter=ssl"},
+	"perf":         {"/server_info", "/stats?usedonly", "/clusters"},
+}
+
+// resolveProfile returns the endpoints for the named profile, preferring a
+// profile from the loaded config file over a built-in one.
+func resolveProfile(name string) ([]string, error) {
+	key := "profiles." + name
+	if viper.IsSet(key) {
+		endpoints := viper.GetStringSlice(key)
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("profile %q in config file has no endpoints", name)
+		}
+		return endpoints, nil
+	}
+	if endpoints, ok := BuiltinProfiles[name]; ok {
+		return endpoints, nil
+	}
+	return nil, fmt.Errorf("unknown endpoint profile %q (available: %s)", name, strings.Join(profileNames(), ", "))
+}
+
+// profileNames lists every built-in and configured profile name, sorted.
+func profileNames() []string {
+	seen := make(map[string]bool)
+	for name := range BuiltinProfiles {
+		seen[name] = true
+	}
+	for name := range viper.GetStringMap("profiles") {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// appendEndpoints adds extra endpoints to base, skipping any already present.
+// base is never modified.
+func appendEndpoints(base, extra []string) []string {
+	merged := append([]string(nil), base...)
+	seen := make(map[string]bool, len(base))
+	for _, endpoint := range base {
+		seen[endpoint] = true
+	}
+	for _, endpoint := range extra {
+		if !seen[endpoint] {
+			merged = append(merged, endpoint)
+			seen[endpoint] = true
+		}
+	}
+	return merged
+}
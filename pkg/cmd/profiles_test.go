@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolveProfile(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("profiles", map[string]interface{}{
+		"mesh": []string{"/clusters", "/stats?filter=upstream"},
+		"tls":  []string{"/certs"},
+	})
+
+	tests := []struct {
+		name    string
+		profile string
+		want    []string
+		wantErr bool
+	}{
+		{name: "built-in default", profile: "default", want: DefaultEndpoints},
+		{name: "built-in connectivity", profile: "connectivity", want: BuiltinProfiles["connectivity"]},
+		{name: "config-defined profile", profile: "mesh", want: []string{"/clusters", "/stats?filter=upstream"}},
+		{name: "config overrides built-in", profile: "tls", want: []string{"/certs"}},
+		{name: "unknown profile", profile: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveProfile(tt.profile)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveProfile(%q) expected error, got %v", tt.profile, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveProfile(%q) unexpected error: %v", tt.profile, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("resolveProfile(%q) = %v, want %v", tt.profile, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("resolveProfile(%q)[%d] = %q, want %q", tt.profile, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAppendEndpoints(t *testing.T) {
+	base := []string{"/stats", "/config_dump"}
+	got := appendEndpoints(base, []string{"/init_dump", "/stats", "/init_dump"})
+	want := []string{"/stats", "/config_dump", "/init_dump"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("appendEndpoints = %v, want %v", got, want)
+	}
+	if len(base) != 2 {
+		t.Errorf("base was modified: %v", base)
+	}
+}
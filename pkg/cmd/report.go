@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// CaptureReportFile is the per-endpoint and per-log record saved into every
+// snapshot.
+const CaptureReportFile = "capture_report.json"
+
+// Statuses of a captured endpoint or log stream.
+const (
+	StatusCaptured  = "captured"  // fetched and saved
+	StatusUnchanged = "unchanged" // fetched, identical to an earlier snapshot, saved as a marker
+	StatusSkipped   = "skipped"   // fetched but not worth saving, e.g. /contention without mutex tracing
+	StatusFailed    = "failed"
+)
+
+// AccessMethod is how the Envoy admin API was reached: with an HTTP tool
+// through nomad alloc exec in a task, or directly from this host.
+type AccessMethod struct {
+	Kind    string `json:"kind"` // "exec" or "direct"
+	Tool    string `json:"tool,omitempty"`
+	Task    string `json:"task,omitempty"`
+	Address string `json:"address,omitempty"` // node address and port fetched with direct access
+}
+
+// accessMethod describes strategy, which is nil in --logs-only captures.
+func accessMethod(strategy *nomad.ExecStrategy) AccessMethod {
+	switch {
+	case strategy == nil:
+		return AccessMethod{}
+	case strategy.Method == nomad.MethodDirect:
+		return AccessMethod{Kind: "direct", Address: strategy.HostPort}
+	}
+	return AccessMethod{Kind: "exec", Tool: strategy.Method.String(), Task: strategy.Task}
+}
+
+// EndpointResult is the outcome of fetching one Envoy admin endpoint.
+type EndpointResult struct {
+	Endpoint   string       `json:"endpoint"`
+	AdminPort  int          `json:"admin_port"`
+	Access     AccessMethod `json:"access"`
+	File       string       `json:"file,omitempty"` // path in the snapshot
+	Bytes      int          `json:"bytes"`
+	Attempts   int          `json:"attempts"` // admin requests made
+	DurationMS int64        `json:"duration_ms"`
+	Status     string       `json:"status"`
+	Failure    string       `json:"failure,omitempty"` // failure category, e.g. no-tool
+	Error      string       `json:"error,omitempty"`
+}
+
+// LogResult is the outcome of streaming one task's logs.
+type LogResult struct {
+	Task     string   `json:"task"`
+	Files    []string `json:"files,omitempty"`
+	Bytes    int64    `json:"bytes"`
+	Attempts int      `json:"attempts"` // times the stream was opened
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// CaptureResult records what one capture of an allocation fetched, how and
+// with what outcome. It is saved as capture_report.json and returned by
+// CaptureSnapshot. A nil result records nothing.
+type CaptureResult struct {
+	AllocID     string           `json:"alloc_id"`
+	SidecarTask string           `json:"sidecar_task"`
+	Started     time.Time        `json:"started"`
+	Finished    time.Time        `json:"finished"`
+	Endpoints   []EndpointResult `json:"endpoints"`
+	Logs        []LogResult      `json:"logs"`
+
+	mu   sync.Mutex
+	root string // snapshot staging directory, File paths are relative to it
+}
+
+func newCaptureResult(config SnapshotConfig, root string, started time.Time) *CaptureResult {
+	return &CaptureResult{
+		AllocID:     config.AllocID,
+		SidecarTask: config.SidecarTask,
+		Started:     started,
+		Endpoints:   []EndpointResult{},
+		Logs:        []LogResult{},
+		root:        root,
+	}
+}
+
+// relPath returns path relative to the snapshot root, with forward slashes.
+func (r *CaptureResult) relPath(path string) string {
+	if rel, err := filepath.Rel(r.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+func (r *CaptureResult) addEndpoint(e EndpointResult) {
+	if r == nil {
+		return
+	}
+	if e.File != "" {
+		e.File = r.relPath(e.File)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Endpoints = append(r.Endpoints, e)
+}
+
+// addLog records the log stream of task into paths, which are the same
+// file when stdout and stderr are merged.
+func (r *CaptureResult) addLog(task string, paths []string, err error) {
+	if r == nil {
+		return
+	}
+	l := LogResult{Task: task, Attempts: 1, Status: StatusCaptured}
+	for i, p := range paths {
+		if i > 0 && p == paths[0] {
+			continue
+		}
+		if info, statErr := os.Stat(p); statErr == nil {
+			l.Bytes += info.Size()
+			l.Files = append(l.Files, r.relPath(p))
+		}
+	}
+	if err != nil {
+		l.Status, l.Error = StatusFailed, err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Logs = append(r.Logs, l)
+}
+
+// write saves the report into the snapshot root. Files gzipped by
+// --gzip-over since they were recorded are listed under their .gz name.
+func (r *CaptureResult) write(finished time.Time) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Finished = finished
+	gzipped := func(file string) string {
+		path := filepath.Join(r.root, filepath.FromSlash(file))
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if _, err := os.Stat(path + ".gz"); err == nil {
+				return file + ".gz"
+			}
+		}
+		return file
+	}
+	for i := range r.Endpoints {
+		if r.Endpoints[i].File != "" {
+			r.Endpoints[i].File = gzipped(r.Endpoints[i].File)
+		}
+	}
+	for i := range r.Logs {
+		for j := range r.Logs[i].Files {
+			r.Logs[i].Files[j] = gzipped(r.Logs[i].Files[j])
+		}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.root, CaptureReportFile), append(data, '\n'), 0644)
+}
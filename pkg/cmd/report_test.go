@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestAccessMethod(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *nomad.ExecStrategy
+		want     AccessMethod
+	}{
+		{"logs only", nil, AccessMethod{}},
+		{"exec", &nomad.ExecStrategy{Task: "connect-proxy-web", Method: nomad.MethodWget}, AccessMethod{Kind: "exec", Tool: "wget", Task: "connect-proxy-web"}},
+		{"direct", &nomad.ExecStrategy{Method: nomad.MethodDirect, HostPort: "10.0.0.5:28123"}, AccessMethod{Kind: "direct", Address: "10.0.0.5:28123"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accessMethod(tt.strategy); got != tt.want {
+				t.Errorf("accessMethod() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureEndpointsReport(t *testing.T) {
+	dir := t.TempDir()
+	config := SnapshotConfig{
+		AllocID:      "aaaaaaaa-0000",
+		Endpoints:    []string{"/stats", "/clusters", "/certs"},
+		ExecStrategy: &nomad.ExecStrategy{Task: "connect-proxy-web", Method: nomad.MethodCurl},
+	}
+	config.Report = newCaptureResult(config, dir, time.Now())
+	svc := &probeService{
+		responses: map[string]string{"/stats": "server.live: 1\n"},
+		errs:      map[string]error{"/clusters": errors.New("exec failed")},
+	}
+	captureEndpoints(svc, config, dir)
+
+	access := AccessMethod{Kind: "exec", Tool: "curl", Task: "connect-proxy-web"}
+	want := []EndpointResult{
+		{Endpoint: "/stats", AdminPort: nomad.EnvoyAdminPort, Access: access, File: "stats.json", Bytes: 15, Attempts: 1, Status: StatusCaptured},
+		{Endpoint: "/clusters", AdminPort: nomad.EnvoyAdminPort, Access: access, Attempts: 1, Status: StatusFailed, Failure: FailureExecError, Error: "exec failed"},
+		{Endpoint: "/certs", AdminPort: nomad.EnvoyAdminPort, Access: access, Attempts: 1, Status: StatusFailed, Failure: FailureEmptyResponse},
+	}
+	got := config.Report.Endpoints
+	for i := range got {
+		got[i].DurationMS = 0
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report endpoints = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestCaptureResultWrite(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"web-stdout.log":           "hello\n",
+		"web-stderr.log":           "",
+		"connect-proxy-web.log":    "merged\n",
+		"port_19001/stats.json.gz": "gz",
+	})
+
+	started := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	r := newCaptureResult(SnapshotConfig{AllocID: "aaaaaaaa-0000", SidecarTask: "connect-proxy-web"}, root, started)
+	r.addLog("web", []string{filepath.Join(root, "web-stdout.log"), filepath.Join(root, "web-stderr.log")}, nil)
+	merged := filepath.Join(root, "connect-proxy-web.log")
+	r.addLog("connect-proxy-web", []string{merged, merged}, errors.New("stream closed"))
+	r.addEndpoint(EndpointResult{Endpoint: "/stats", AdminPort: 19001, File: filepath.Join(root, "port_19001", "stats.json"), Status: StatusCaptured})
+	if err := r.write(started.Add(time.Minute)); err != nil {
+		t.Fatalf("write() error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, CaptureReportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got CaptureResult
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("%s is not valid JSON: %v", CaptureReportFile, err)
+	}
+	wantLogs := []LogResult{
+		{Task: "web", Files: []string{"web-stdout.log", "web-stderr.log"}, Bytes: 6, Attempts: 1, Status: StatusCaptured},
+		{Task: "connect-proxy-web", Files: []string{"connect-proxy-web.log"}, Bytes: 7, Attempts: 1, Status: StatusFailed, Error: "stream closed"},
+	}
+	if !reflect.DeepEqual(got.Logs, wantLogs) {
+		t.Errorf("logs = %+v\nwant %+v", got.Logs, wantLogs)
+	}
+	if len(got.Endpoints) != 1 || got.Endpoints[0].File != "port_19001/stats.json.gz" {
+		t.Errorf("endpoints = %+v, want the gzipped file name", got.Endpoints)
+	}
+	if !got.Finished.Equal(started.Add(time.Minute)) || got.AllocID != "aaaaaaaa-0000" {
+		t.Errorf("report header = %s %s", got.AllocID, got.Finished)
+	}
+
+	// A nil result records nothing
+	var none *CaptureResult
+	none.addEndpoint(EndpointResult{Endpoint: "/stats"})
+	none.addLog("web", nil, nil)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// memoryPressurePercent is the share of its memory limit a sidecar may use
+// before the summary warns it is close to being OOM-killed.
+const memoryPressurePercent = 90
+
+// resourceStatsFile is the layout of resource_stats.json: the distilled
+// usage and limits of every task, and the Nomad client's full response.
+type resourceStatsFile struct {
+	Timestamp   string                             `json:"timestamp"`
+	SidecarTask string                             `json:"sidecar_task,omitempty"`
+	Tasks       map[string]nomad.TaskResourceStats `json:"tasks"`
+	Nomad       json.RawMessage                    `json:"nomad"`
+}
+
+func writeResourceStats(stats *nomad.AllocResourceStats, sidecarTask, path string) error {
+	data, err := json.MarshalIndent(resourceStatsFile{
+		Timestamp:   stats.Timestamp.UTC().Format(time.RFC3339),
+		SidecarTask: sidecarTask,
+		Tasks:       stats.Tasks,
+		Nomad:       stats.Raw,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// resourceFindings reports the sidecar's memory pressure, CPU throttling and
+// CPU use beyond its reservation. Only the sidecar task is checked, or every
+// task when sidecarTask is unknown.
+func resourceFindings(stats *nomad.AllocResourceStats, sidecarTask string) []string {
+	if stats == nil {
+		return nil
+	}
+	var tasks []string
+	if _, ok := stats.Tasks[sidecarTask]; ok {
+		tasks = []string{sidecarTask}
+	} else {
+		for task := range stats.Tasks {
+			tasks = append(tasks, task)
+		}
+		sort.Strings(tasks)
+	}
+
+	var findings []string
+	for _, task := range tasks {
+		s := stats.Tasks[task]
+		if limit, used := s.MemoryLimit(), s.MemoryUsed(); limit > 0 && used*100 >= limit*memoryPressurePercent {
+			findings = append(findings, fmt.Sprintf("Task %s uses %s of its %s memory limit (%d%%)",
+				task, formatBytes(int64(used)), formatBytes(int64(limit)), used*100/limit))
+		}
+		if s.CPUThrottledPeriods > 0 {
+			findings = append(findings, fmt.Sprintf("Task %s was CPU throttled in %d periods (%s in total)",
+				task, s.CPUThrottledPeriods, time.Duration(s.CPUThrottledTime)))
+		}
+		if s.CPUMHz > 0 && s.CPUTotalTicks > float64(s.CPUMHz) {
+			findings = append(findings, fmt.Sprintf("Task %s uses %.0f MHz of CPU, above its %d MHz reservation",
+				task, s.CPUTotalTicks, s.CPUMHz))
+		}
+	}
+	return findings
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+func TestResourceFindings(t *testing.T) {
+	tests := []struct {
+		name    string
+		tasks   map[string]nomad.TaskResourceStats
+		sidecar string
+		want    []string
+	}{
+		{"within limits", map[string]nomad.TaskResourceStats{
+			"connect-proxy-web": {CPUTotalTicks: 50, CPUMHz: 250, MemoryRSS: 64 << 20, MemoryMB: 128},
+		}, "connect-proxy-web", nil},
+		{"memory pressure", map[string]nomad.TaskResourceStats{
+			"connect-proxy-web": {MemoryUsage: 120 << 20, MemoryMB: 128},
+		}, "connect-proxy-web", []string{
+			"Task connect-proxy-web uses 120.0 MiB of its 128.0 MiB memory limit (93%)",
+		}},
+		{"memory_max raises the limit", map[string]nomad.TaskResourceStats{
+			"connect-proxy-web": {MemoryUsage: 120 << 20, MemoryMB: 128, MemoryMaxMB: 256},
+		}, "connect-proxy-web", nil},
+		{"throttled and over the reservation", map[string]nomad.TaskResourceStats{
+			"connect-proxy-web": {CPUTotalTicks: 310, CPUMHz: 250, CPUThrottledPeriods: 40, CPUThrottledTime: 1500000000},
+		}, "connect-proxy-web", []string{
+			"Task connect-proxy-web was CPU throttled in 40 periods (1.5s in total)",
+			"Task connect-proxy-web uses 310 MHz of CPU, above its 250 MHz reservation",
+		}},
+		{"only the sidecar is checked", map[string]nomad.TaskResourceStats{
+			"connect-proxy-web": {},
+			"web":               {MemoryUsage: 128 << 20, MemoryMB: 128},
+		}, "connect-proxy-web", nil},
+		{"every task without a known sidecar", map[string]nomad.TaskResourceStats{
+			"web":   {MemoryUsage: 128 << 20, MemoryMB: 128},
+			"envoy": {CPUThrottledPeriods: 1, CPUThrottledTime: 1000},
+		}, "", []string{
+			"Task envoy was CPU throttled in 1 periods (1µs in total)",
+			"Task web uses 128.0 MiB of its 128.0 MiB memory limit (100%)",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resourceFindings(&nomad.AllocResourceStats{Tasks: tt.tasks}, tt.sidecar)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resourceFindings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := resourceFindings(nil, "connect-proxy-web"); got != nil {
+		t.Errorf("resourceFindings(nil) = %q, want none", got)
+	}
+}
+
+func TestWriteResourceStats(t *testing.T) {
+	stats := &nomad.AllocResourceStats{
+		Timestamp: time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC),
+		Tasks:     map[string]nomad.TaskResourceStats{"connect-proxy-web": {CPUTotalTicks: 12, MemoryMB: 128}},
+		Raw:       []byte(`{"Timestamp": 1}`),
+	}
+	path := filepath.Join(t.TempDir(), "resource_stats.json")
+	if err := writeResourceStats(stats, "connect-proxy-web", path); err != nil {
+		t.Fatalf("writeResourceStats() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got resourceStatsFile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("resource_stats.json is not JSON: %v\n%s", err, data)
+	}
+	var raw bytes.Buffer
+	if err := json.Compact(&raw, got.Nomad); err != nil {
+		t.Fatal(err)
+	}
+	if got.Timestamp != "2026-10-14T10:00:00Z" || got.SidecarTask != "connect-proxy-web" ||
+		!reflect.DeepEqual(got.Tasks, stats.Tasks) || raw.String() != `{"Timestamp":1}` {
+		t.Errorf("resource_stats.json = %s", data)
+	}
+}
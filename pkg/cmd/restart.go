@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// restartInfo is the hot-restart state of a running Envoy.
+type restartInfo struct {
+	HotRestartVersion  string
+	Epoch              int
+	UptimeCurrentEpoch string
+	UptimeAllEpochs    string
+}
+
+func (r restartInfo) String() string {
+	return fmt.Sprintf("hot_restart_version: %s\nrestart_epoch: %d\nuptime_current_epoch: %s\nuptime_all_epochs: %s\n",
+		r.HotRestartVersion, r.Epoch, r.UptimeCurrentEpoch, r.UptimeAllEpochs)
+}
+
+// parseRestartInfo reads the restart epoch and uptimes from a /server_info
+// response.
+func parseRestartInfo(serverInfo []byte) (restartInfo, error) {
+	var info struct {
+		HotRestartVersion  string `json:"hot_restart_version"`
+		UptimeCurrentEpoch string `json:"uptime_current_epoch"`
+		UptimeAllEpochs    string `json:"uptime_all_epochs"`
+		CommandLineOptions struct {
+			RestartEpoch int `json:"restart_epoch"`
+		} `json:"command_line_options"`
+	}
+	if err := json.Unmarshal(serverInfo, &info); err != nil {
+		return restartInfo{}, fmt.Errorf("failed to parse server_info: %w", err)
+	}
+	return restartInfo{
+		HotRestartVersion:  info.HotRestartVersion,
+		Epoch:              info.CommandLineOptions.RestartEpoch,
+		UptimeCurrentEpoch: info.UptimeCurrentEpoch,
+		UptimeAllEpochs:    info.UptimeAllEpochs,
+	}, nil
+}
+
+// captureRestartInfo fetches /hot_restart_version and /server_info and writes
+// the proxy's hot-restart state to path.
+func captureRestartInfo(nomadService nomad.NomadApiService, config SnapshotConfig, path string) (restartInfo, error) {
+	data, err := fetchEnvoyEndpoint(nomadService, config, "/server_info")
+	if err != nil {
+		return restartInfo{}, fmt.Errorf("/server_info failed: %w", err)
+	}
+	info, err := parseRestartInfo(data)
+	if err != nil {
+		return restartInfo{}, err
+	}
+	// Prefer the dedicated endpoint; older builds omit the field from /server_info
+	if version, err := fetchEnvoyEndpoint(nomadService, config, "/hot_restart_version"); err == nil {
+		info.HotRestartVersion = strings.TrimSpace(string(version))
+	}
+	return info, os.WriteFile(path, []byte(info.String()), 0644)
+}
+
+// epochTracker remembers the last restart epoch seen for each proxy across
+// repeat captures.
+type epochTracker struct {
+	mu     sync.Mutex
+	epochs map[string]int
+}
+
+// observe records epoch for key and returns the previous epoch and whether
+// it differs. The first observation of a key never counts as a change.
+func (t *epochTracker) observe(key string, epoch int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.epochs == nil {
+		t.epochs = make(map[string]int)
+	}
+	prev, seen := t.epochs[key]
+	t.epochs[key] = epoch
+	return prev, seen && prev != epoch
+}
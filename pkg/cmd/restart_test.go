@@ -0,0 +1,43 @@
+package cmd
+
+import "testing"
+
+func TestParseRestartInfo(t *testing.T) {
+	data := []byte(`{"version":"abc/1.27.2/Clean/RELEASE/BoringSSL","state":"LIVE","hot_restart_version":"11.104",
+		"command_line_options":{"restart_epoch":2,"drain_time":"600s"},
+		"uptime_current_epoch":"42s","uptime_all_epochs":"3600s"}`)
+	got, err := parseRestartInfo(data)
+	if err != nil {
+		t.Fatalf("parseRestartInfo() error: %v", err)
+	}
+	want := restartInfo{HotRestartVersion: "11.104", Epoch: 2, UptimeCurrentEpoch: "42s", UptimeAllEpochs: "3600s"}
+	if got != want {
+		t.Errorf("parseRestartInfo() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseRestartInfo([]byte("not json")); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
+
+func TestEpochTracker(t *testing.T) {
+	var tracker epochTracker
+	steps := []struct {
+		key         string
+		epoch       int
+		wantPrev    int
+		wantChanged bool
+	}{
+		{"a:19001", 0, 0, false},
+		{"a:19001", 0, 0, false},
+		{"b:19001", 3, 0, false},
+		{"a:19001", 1, 0, true},
+		{"a:19001", 1, 1, false},
+	}
+	for i, s := range steps {
+		prev, changed := tracker.observe(s.key, s.epoch)
+		if prev != s.wantPrev || changed != s.wantChanged {
+			t.Errorf("step %d: observe(%q, %d) = (%d, %v), want (%d, %v)", i, s.key, s.epoch, prev, changed, s.wantPrev, s.wantChanged)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FailuresFile is written to --output-dir, listing the allocations of a run
+// that weren't fully captured, for --resume.
+const FailuresFile = "failures.json"
+
+// failedAlloc is one allocation listed in failures.json.
+type failedAlloc struct {
+	AllocID string `json:"alloc_id"`
+	Reason  string `json:"reason"` // partial, failed, aborted, or the SkipReason of a lookup or probe failure
+	Error   string `json:"error,omitempty"`
+}
+
+// failureLog collects the allocations of a run that weren't fully captured,
+// in the order they first failed. A later failure of the same allocation
+// replaces the earlier one.
+type failureLog struct {
+	order []string
+	byID  map[string]failedAlloc
+}
+
+func newFailureLog() *failureLog {
+	return &failureLog{byID: make(map[string]failedAlloc)}
+}
+
+func (l *failureLog) add(allocID, reason, detail string) {
+	if _, ok := l.byID[allocID]; !ok {
+		l.order = append(l.order, allocID)
+	}
+	l.byID[allocID] = failedAlloc{AllocID: allocID, Reason: reason, Error: detail}
+}
+
+// addSkips adds the allocations skipped for any of the reasons, sorted by ID.
+func (l *failureLog) addSkips(r *skipReport, reasons ...SkipReason) {
+	var ids []string
+	for id, s := range r.skipped {
+		for _, reason := range reasons {
+			if s.Reason == reason {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		l.add(id, string(r.skipped[id].Reason), r.skipped[id].Detail)
+	}
+}
+
+func (l *failureLog) entries() []failedAlloc {
+	entries := make([]failedAlloc, 0, len(l.order))
+	for _, id := range l.order {
+		entries = append(entries, l.byID[id])
+	}
+	return entries
+}
+
+type failuresDoc struct {
+	Failures []failedAlloc `json:"failures"`
+}
+
+// save writes the failures to path. With no failures a previous file is
+// emptied, so resuming until everything succeeds ends with an empty list,
+// and no new file is created.
+func (l *failureLog) save(path string) (bool, error) {
+	if len(l.order) == 0 {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+	}
+	data, err := json.MarshalIndent(failuresDoc{Failures: l.entries()}, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// readFailedAllocIDs returns the allocation IDs listed in a failures.json,
+// without duplicates.
+func readFailedAllocIDs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc failuresDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, f := range doc.Failures {
+		if f.AllocID != "" && !seen[f.AllocID] {
+			seen[f.AllocID] = true
+			ids = append(ids, f.AllocID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFailureLog(t *testing.T) {
+	skips := newSkipReport()
+	skips.add("dddd", SkipNoHTTPTool, "")
+	skips.add("cccc", SkipLookupFailed, "alloc not found")
+	skips.add("eeee", SkipNotRunning, "client status complete")
+
+	failures := newFailureLog()
+	failures.add("aaaa", "partial", "missing /stats")
+	failures.add("bbbb", "failed", "exec timed out")
+	failures.add("aaaa", "failed", "exec timed out")
+	failures.addSkips(skips, SkipLookupFailed, SkipNoHTTPTool)
+
+	want := []failedAlloc{
+		{AllocID: "aaaa", Reason: "failed", Error: "exec timed out"},
+		{AllocID: "bbbb", Reason: "failed", Error: "exec timed out"},
+		{AllocID: "cccc", Reason: "lookup-failed", Error: "alloc not found"},
+		{AllocID: "dddd", Reason: "no-http-tool"},
+	}
+	if got := failures.entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFailureLogSaveAndResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", FailuresFile)
+
+	saved, err := newFailureLog().save(path)
+	if err != nil || saved {
+		t.Fatalf("save() without failures = %v, %v; want no file", saved, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("save() without failures created %s", path)
+	}
+
+	failures := newFailureLog()
+	failures.add("aaaa", "partial", "missing /stats")
+	failures.add("bbbb", "aborted", "")
+	if saved, err := failures.save(path); err != nil || !saved {
+		t.Fatalf("save() = %v, %v", saved, err)
+	}
+	ids, err := readFailedAllocIDs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aaaa", "bbbb"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("readFailedAllocIDs() = %v, want %v", ids, want)
+	}
+
+	// A resumed run that captures everything empties the list
+	if saved, err := newFailureLog().save(path); err != nil || !saved {
+		t.Fatalf("save() over a previous file = %v, %v", saved, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"failures": []`) {
+		t.Errorf("emptied %s = %s", FailuresFile, data)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFailedAllocIDs(path); err == nil {
+		t.Error("readFailedAllocIDs() accepted invalid JSON")
+	}
+}
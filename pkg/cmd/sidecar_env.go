@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// secretName matches environment variable and flag names whose values are
+// redacted from sidecar_env.txt. Names pointing at a file (CONSUL_HTTP_TOKEN_FILE,
+// -token-file) are kept since the path is useful and not itself a secret.
+var (
+	secretName = regexp.MustCompile(`(?i)(token|secret|password|passwd|credential|private_?key|api_?key|auth)`)
+	fileName   = regexp.MustCompile(`(?i)[_-](file|path)$`)
+)
+
+func isSecretName(name string) bool {
+	return secretName.MatchString(name) && !fileName.MatchString(name)
+}
+
+const redacted = "<redacted>"
+
+// captureSidecarEnv reads the environment and command line of the sidecar's
+// main process (PID 1 in the task) and writes them, with secrets redacted,
+// to path.
+func captureSidecarEnv(nomadService nomad.NomadApiService, config SnapshotConfig, path string) error {
+	if config.SidecarTask == "" {
+		return fmt.Errorf("allocation has no separate sidecar task")
+	}
+	environ, err := readProcFile(nomadService, config, "/proc/1/environ")
+	if err != nil {
+		return err
+	}
+	cmdline, err := readProcFile(nomadService, config, "/proc/1/cmdline")
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("# Environment (/proc/1/environ)\n")
+	for _, kv := range redactEnv(splitNUL(environ)) {
+		b.WriteString(kv)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n# Command line (/proc/1/cmdline)\n")
+	b.WriteString(strings.Join(redactArgs(splitNUL(cmdline)), " "))
+	b.WriteString("\n")
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func readProcFile(nomadService nomad.NomadApiService, config SnapshotConfig, file string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := nomadService.ExecuteCommandWithStderr(config.AllocID, config.SidecarTask, []string{"cat", file}, &stdout, &stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in task %s: %w (stderr: %s)", file, config.SidecarTask, err, stderr.String())
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("failed to read %s in task %s: exit code %d (stderr: %s)", file, config.SidecarTask, code, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// splitNUL splits a NUL-separated /proc file into its entries.
+func splitNUL(data []byte) []string {
+	var out []string
+	for _, part := range bytes.Split(data, []byte{0}) {
+		if len(part) > 0 {
+			out = append(out, string(part))
+		}
+	}
+	return out
+}
+
+// redactEnv replaces the values of secret-looking variables.
+func redactEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, found := strings.Cut(kv, "=")
+		if found && isSecretName(name) {
+			kv = name + "=" + redacted
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+// redactArgs replaces the values of secret-looking flags, given either as
+// "-flag=value" or as "-flag value".
+func redactArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	redactNext := false
+	for _, arg := range args {
+		if redactNext {
+			out = append(out, redacted)
+			redactNext = false
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			name, _, found := strings.Cut(arg, "=")
+			if isSecretName(name) {
+				if found {
+					arg = name + "=" + redacted
+				} else {
+					redactNext = true
+				}
+			}
+		}
+		out = append(out, arg)
+	}
+	return out
+}
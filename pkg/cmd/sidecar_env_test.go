@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitNUL(t *testing.T) {
+	got := splitNUL([]byte("envoy\x00-c\x00/secrets/envoy_bootstrap.json\x00"))
+	want := []string{"envoy", "-c", "/secrets/envoy_bootstrap.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitNUL = %q, want %q", got, want)
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	got := redactEnv([]string{
+		"PATH=/usr/bin",
+		"CONSUL_HTTP_TOKEN=abc",
+		"NOMAD_TOKEN=def",
+		"DB_PASSWORD=hunter2",
+		"CONSUL_GRPC_ADDR=unix:///alloc/tmp/consul_grpc.sock",
+		"CONSUL_HTTP_TOKEN_FILE=/secrets/token",
+		"NOVALUE",
+	})
+	want := []string{
+		"PATH=/usr/bin",
+		"CONSUL_HTTP_TOKEN=<redacted>",
+		"NOMAD_TOKEN=<redacted>",
+		"DB_PASSWORD=<redacted>",
+		"CONSUL_GRPC_ADDR=unix:///alloc/tmp/consul_grpc.sock",
+		"CONSUL_HTTP_TOKEN_FILE=/secrets/token",
+		"NOVALUE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactEnv = %q, want %q", got, want)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	got := redactArgs([]string{"consul", "connect", "envoy", "-token", "abc", "-sidecar-for", "web", "--token-file=/secrets/token", "-ca-file", "/secrets/ca.pem", "-admin-bind", "127.0.0.2:19001"})
+	want := []string{"consul", "connect", "envoy", "-token", "<redacted>", "-sidecar-for", "web", "--token-file=/secrets/token", "-ca-file", "/secrets/ca.pem", "-admin-bind", "127.0.0.2:19001"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactArgs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,510 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArtifactSink receives the files of a snapshot. Write is called once per
+// file with a slash-separated name relative to the snapshot root; Finalize
+// completes the output, or Abort discards it, and exactly one of them must
+// be called.
+type ArtifactSink interface {
+	Write(name string, r io.Reader) error
+	Finalize() error
+	Abort()
+}
+
+// createAtomic creates path + ".tmp" for writing. commit renames it to path
+// once it is complete and abort removes it, so path never holds a partially
+// written file, even if the process is killed mid-write.
+func createAtomic(path string) (f *os.File, commit func() error, abort func(), err error) {
+	tmpPath := path + ".tmp"
+	f, err = os.Create(tmpPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	commit = func() error {
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		return nil
+	}
+	abort = func() { os.Remove(tmpPath) }
+	return f, commit, abort, nil
+}
+
+// Output formats accepted by --output-format.
+const (
+	FormatTarGz  = "tar.gz"
+	FormatTar    = "tar"
+	FormatZip    = "zip"
+	FormatDir    = "dir"
+	FormatFlat   = "flat"
+	FormatStdout = "stdout"
+)
+
+// OutputFormats lists every supported output format.
+var OutputFormats = []string{FormatTarGz, FormatTar, FormatZip, FormatDir, FormatFlat, FormatStdout}
+
+// writeStagedFiles passes every regular file under dir to sink in sorted
+// order, so archives built from identical inputs are identical.
+func writeStagedFiles(sink ArtifactSink, dir string) error {
+	var files []string
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		err = sink.Write(filepath.ToSlash(rel), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// statReader is implemented by readers that know their file metadata, such
+// as *os.File; other readers are buffered to learn their size.
+type statReader interface {
+	io.Reader
+	Stat() (os.FileInfo, error)
+}
+
+// readerInfo returns the metadata for r, buffering it when r can't report
+// its own size.
+func readerInfo(name string, r io.Reader) (os.FileInfo, io.Reader, error) {
+	if sr, ok := r.(statReader); ok {
+		if fi, err := sr.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi, r, nil
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return memFileInfo{name: path.Base(name), size: int64(len(data)), modTime: time.Now()}, bytes.NewReader(data), nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (m memFileInfo) Name() string       { return m.name }
+func (m memFileInfo) Size() int64        { return m.size }
+func (m memFileInfo) Mode() os.FileMode  { return 0644 }
+func (m memFileInfo) ModTime() time.Time { return m.modTime }
+func (m memFileInfo) IsDir() bool        { return false }
+func (m memFileInfo) Sys() interface{}   { return nil }
+
+// tarGzSink writes a gzip-compressed tarball, nesting entries under prefix,
+// or a plain tarball when gz is nil. Unless preserveMetadata is set,
+// timestamps and ownership are zeroed so identical inputs produce
+// byte-identical archives.
+type tarGzSink struct {
+	out              io.WriteCloser
+	gz               *gzip.Writer
+	tw               *tar.Writer
+	prefix           string
+	preserveMetadata bool
+	// commit runs after the archive is closed, e.g. to move it into place;
+	// abort runs instead when the archive is discarded
+	commit func() error
+	abort  func()
+}
+
+func newTarGzSink(out io.WriteCloser, prefix string, preserveMetadata bool) *tarGzSink {
+	gz := gzip.NewWriter(out)
+	return &tarGzSink{
+		out:              out,
+		gz:               gz,
+		tw:               tar.NewWriter(gz),
+		prefix:           prefix,
+		preserveMetadata: preserveMetadata,
+	}
+}
+
+// newTarGzFileSink creates (or replaces) the tarball at archivePath. It is
+// written under a temporary name and only moved into place by Finalize.
+func newTarGzFileSink(archivePath, prefix string, preserveMetadata bool) (*tarGzSink, error) {
+	f, commit, abort, err := createAtomic(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	sink := newTarGzSink(f, prefix, preserveMetadata)
+	sink.commit, sink.abort = commit, abort
+	return sink, nil
+}
+
+// newTarFileSink is like newTarGzFileSink but writes an uncompressed tarball.
+func newTarFileSink(archivePath string, preserveMetadata bool) (*tarGzSink, error) {
+	f, commit, abort, err := createAtomic(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return &tarGzSink{out: f, tw: tar.NewWriter(f), preserveMetadata: preserveMetadata, commit: commit, abort: abort}, nil
+}
+
+// newAppendTarGzSink adds entries to the tarball at archivePath, creating it
+// if it does not exist yet. A gzip-compressed tarball cannot be appended to
+// in place, so the existing entries are streamed into a new archive which
+// replaces the original on Finalize; the cost of each append therefore grows
+// with the size of the archive. The append holds <archivePath>.lock, so a
+// concurrent run fails instead of replacing the archive without its entries.
+func newAppendTarGzSink(archivePath, prefix string, preserveMetadata bool) (*tarGzSink, error) {
+	release, err := acquireLock(archivePath+".lock", archivePath)
+	if err != nil {
+		return nil, err
+	}
+	f, commit, abort, err := createAtomic(archivePath)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	sink := newTarGzSink(f, prefix, preserveMetadata)
+	sink.commit = func() error {
+		defer release()
+		return commit()
+	}
+	sink.abort = func() {
+		abort()
+		release()
+	}
+	if err := copyTarGzEntries(sink.tw, archivePath); err != nil {
+		sink.Abort()
+		return nil, fmt.Errorf("failed to read existing archive: %w", err)
+	}
+	return sink, nil
+}
+
+func (s *tarGzSink) Write(name string, r io.Reader) error {
+	fi, r, err := readerInfo(name, r)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	header.Name = path.Join(s.prefix, name)
+	if !s.preserveMetadata {
+		normalizeTarHeader(header)
+	}
+	if err := s.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(s.tw, r)
+	return err
+}
+
+func (s *tarGzSink) Finalize() error {
+	err := s.tw.Close()
+	if s.gz != nil {
+		if gzErr := s.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := s.out.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err == nil && s.commit != nil:
+		err = s.commit()
+	case err != nil && s.abort != nil:
+		s.abort()
+	}
+	return err
+}
+
+func (s *tarGzSink) Abort() {
+	s.tw.Close()
+	if s.gz != nil {
+		s.gz.Close()
+	}
+	s.out.Close()
+	if s.abort != nil {
+		s.abort()
+	}
+}
+
+// zipEpoch is the timestamp used for zip entries when metadata is not
+// preserved; MS-DOS timestamps cannot represent the Unix epoch.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// zipSink writes a deflate-compressed zip archive.
+type zipSink struct {
+	out              io.WriteCloser
+	zw               *zip.Writer
+	preserveMetadata bool
+	commit           func() error
+	abort            func()
+}
+
+// newZipFileSink creates (or replaces) the zip archive at archivePath,
+// moving it into place only on Finalize.
+func newZipFileSink(archivePath string, preserveMetadata bool) (*zipSink, error) {
+	f, commit, abort, err := createAtomic(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return &zipSink{out: f, zw: zip.NewWriter(f), preserveMetadata: preserveMetadata, commit: commit, abort: abort}, nil
+}
+
+func (s *zipSink) Write(name string, r io.Reader) error {
+	fi, r, err := readerInfo(name, r)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	if !s.preserveMetadata {
+		header.Modified = zipEpoch
+		header.SetMode(0644)
+	}
+	w, err := s.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (s *zipSink) Finalize() error {
+	err := s.zw.Close()
+	if closeErr := s.out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.abort()
+		return err
+	}
+	return s.commit()
+}
+
+func (s *zipSink) Abort() {
+	s.zw.Close()
+	s.out.Close()
+	s.abort()
+}
+
+// dirSink writes files into a plain directory.
+type dirSink struct {
+	root             string
+	preserveMetadata bool
+}
+
+func newDirSink(root string, preserveMetadata bool) (*dirSink, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &dirSink{root: root, preserveMetadata: preserveMetadata}, nil
+}
+
+func (s *dirSink) Write(name string, r io.Reader) error {
+	target := filepath.Join(s.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if sr, ok := r.(statReader); ok && s.preserveMetadata {
+		if fi, err := sr.Stat(); err == nil {
+			return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+		}
+	}
+	return nil
+}
+
+func (s *dirSink) Finalize() error { return nil }
+
+// Abort leaves the files written so far; a directory has no single point at
+// which it becomes complete.
+func (s *dirSink) Abort() {}
+
+// flatLockFile marks an --output-dir a flat capture run is writing into.
+const flatLockFile = ".xdsnap-flat.lock"
+
+// claimFlatDir claims dir for one flat capture run, since runs sharing it
+// would replace and remove each other's files. A lock left by a run that no
+// longer runs is taken over. release drops the claim.
+func claimFlatDir(dir string) (release func(), err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return acquireLock(filepath.Join(dir, flatLockFile), dir)
+}
+
+// flatSink writes files straight into a directory shared with other
+// allocations, as <prefix>_<name> with the slashes of nested names replaced
+// by underscores. Each file is replaced atomically, so a repeat run never
+// leaves one half written while it is being read.
+type flatSink struct {
+	root             string
+	prefix           string
+	preserveMetadata bool
+}
+
+// newFlatSink removes the <prefix>_* files of an earlier capture from root,
+// so a file this capture doesn't write can't pass for a current one.
+func newFlatSink(root, prefix string, preserveMetadata bool) (*flatSink, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(root, prefix+"_*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range stale {
+		if fi, err := os.Lstat(file); err == nil && fi.Mode().IsRegular() {
+			if err := os.Remove(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &flatSink{root: root, prefix: prefix, preserveMetadata: preserveMetadata}, nil
+}
+
+// flatName is the file name of the entry name in a flat output.
+func flatName(prefix, name string) string {
+	return prefix + "_" + strings.ReplaceAll(name, "/", "_")
+}
+
+func (s *flatSink) Write(name string, r io.Reader) error {
+	target := filepath.Join(s.root, flatName(s.prefix, name))
+	f, commit, abort, err := createAtomic(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		abort()
+		return err
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+	if sr, ok := r.(statReader); ok && s.preserveMetadata {
+		if fi, err := sr.Stat(); err == nil {
+			return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+		}
+	}
+	return nil
+}
+
+func (s *flatSink) Finalize() error { return nil }
+
+// Abort leaves the files written so far, like dirSink.
+func (s *flatSink) Abort() {}
+
+// prefixSink nests every entry written through it under prefix. It is used
+// to share one sink across captures; Finalize is a no-op so the shared sink
+// is finalized once by its owner.
+type prefixSink struct {
+	sink   ArtifactSink
+	prefix string
+}
+
+func (p prefixSink) Write(name string, r io.Reader) error {
+	return p.sink.Write(path.Join(p.prefix, name), r)
+}
+
+func (p prefixSink) Finalize() error { return nil }
+
+// Abort is a no-op; the owner of the shared sink decides its fate.
+func (p prefixSink) Abort() {}
+
+// copyTarGzEntries copies every entry of an existing tar.gz into tarWriter.
+// A missing archive is treated as empty.
+func copyTarGzEntries(tarWriter *tar.Writer, archivePath string) error {
+	in, err := os.Open(archivePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// normalizeTarHeader strips host-specific metadata from a tar header.
+func normalizeTarHeader(header *tar.Header) {
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files, keyed by slash-separated path, under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeStagingTree returns a directory laid out like a staged snapshot.
+func writeStagingTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"stats.json":                   "stats",
+		"config_dump.json":             `{"configs":[]}`,
+		"focus_api/summary.txt":        "- ok\n",
+		"connect-proxy-web-stderr.log": "",
+	})
+	return dir
+}
+
+// bundleStaged writes every file under dir through sink, as bundleSnapshot
+// does, and finalizes it. err is the error creating sink.
+func bundleStaged(t *testing.T, sink ArtifactSink, err error, dir string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("creating sink: %v", err)
+	}
+	if err := writeStagedFiles(sink, dir); err != nil {
+		sink.Abort()
+		t.Fatalf("writeStagedFiles(%s): %v", dir, err)
+	}
+	if err := sink.Finalize(); err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+}
+
+var stagedNames = []string{"config_dump.json", "connect-proxy-web-stderr.log", "focus_api/summary.txt", "stats.json"}
+
+func TestZipSink(t *testing.T) {
+	staged := writeStagingTree(t)
+	archive := filepath.Join(t.TempDir(), "snap.zip")
+
+	sink, err := newZipFileSink(archive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedFiles(sink, staged); err != nil {
+		t.Fatalf("writeStagedFiles: %v", err)
+	}
+	if err := sink.Finalize(); err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if !f.Modified.Equal(zipEpoch) {
+			t.Errorf("%s: Modified = %v, want %v", f.Name, f.Modified, zipEpoch)
+		}
+	}
+	if !reflect.DeepEqual(names, stagedNames) {
+		t.Errorf("entries = %v, want %v", names, stagedNames)
+	}
+}
+
+func TestTarSink(t *testing.T) {
+	staged := writeStagingTree(t)
+	archive := filepath.Join(t.TempDir(), "snap.tar")
+
+	sink, err := newTarFileSink(archive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedFiles(sink, staged); err != nil {
+		t.Fatalf("writeStagedFiles: %v", err)
+	}
+	if err := sink.Finalize(); err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("archive is not an uncompressed tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if !reflect.DeepEqual(names, stagedNames) {
+		t.Errorf("entries = %v, want %v", names, stagedNames)
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	staged := writeStagingTree(t)
+	root := filepath.Join(t.TempDir(), "abcdef12")
+
+	sink, err := newDirSink(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedFiles(sink, staged); err != nil {
+		t.Fatalf("writeStagedFiles: %v", err)
+	}
+	if err := sink.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "focus_api", "summary.txt"))
+	if err != nil || string(data) != "- ok\n" {
+		t.Errorf("focus_api/summary.txt = %q, %v", data, err)
+	}
+}
+
+func TestFlatSink(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "out")
+	for _, alloc := range []string{"abcdef12", "12345678"} {
+		sink, err := newFlatSink(root, alloc, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeStagedFiles(sink, writeStagingTree(t)); err != nil {
+			t.Fatalf("writeStagedFiles: %v", err)
+		}
+		if err := sink.Finalize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{
+		"12345678_config_dump.json", "12345678_connect-proxy-web-stderr.log", "12345678_focus_api_summary.txt", "12345678_stats.json",
+		"abcdef12_config_dump.json", "abcdef12_connect-proxy-web-stderr.log", "abcdef12_focus_api_summary.txt", "abcdef12_stats.json",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("files = %v, want %v", names, want)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "abcdef12_focus_api_summary.txt"))
+	if err != nil || string(data) != "- ok\n" {
+		t.Errorf("abcdef12_focus_api_summary.txt = %q, %v", data, err)
+	}
+
+	// The next cycle drops the files this one doesn't write, of this
+	// allocation only
+	next := t.TempDir()
+	writeTree(t, next, map[string]string{"stats.json": "stats 2"})
+	sink, err := newFlatSink(root, "abcdef12", false)
+	bundleStaged(t, sink, err, next)
+	for name, want := range map[string]bool{"abcdef12_stats.json": true, "abcdef12_config_dump.json": false, "12345678_config_dump.json": true} {
+		if _, err := os.Stat(filepath.Join(root, name)); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestAppendTarGzSinkLock(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "debug.tar.gz")
+	first, err := newAppendTarGzSink(archive, "snapshot_1/abcdef12", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAppendTarGzSink(archive, "snapshot_2/abcdef12", false); err == nil || !strings.Contains(err.Error(), "is writing to "+archive) {
+		t.Errorf("concurrent append error = %v, want the archive reported as in use", err)
+	}
+	bundleStaged(t, first, nil, writeStagingTree(t))
+	if _, err := os.Stat(archive + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock left after Finalize: %v", err)
+	}
+	second, err := newAppendTarGzSink(archive, "snapshot_2/abcdef12", false)
+	bundleStaged(t, second, err, writeStagingTree(t))
+}
+
+func TestSharedTarGzSinkWithPrefixes(t *testing.T) {
+	var out bytes.Buffer
+	shared := newTarGzSink(nopWriteCloser{&out}, "", false)
+
+	for _, prefix := range []string{"snapshot_1/abcdef12", "snapshot_1/12345678"} {
+		if err := writeStagedFiles(prefixSink{sink: shared, prefix: prefix}, writeStagingTree(t)); err != nil {
+			t.Fatalf("writeStagedFiles: %v", err)
+		}
+	}
+	// A reader without Stat is buffered to learn its size
+	if err := shared.Write("notes.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		if !h.ModTime.Equal(time.Unix(0, 0)) {
+			t.Errorf("%s: ModTime = %v, want epoch", h.Name, h.ModTime)
+		}
+		if h.Name == "notes.txt" {
+			data, _ := io.ReadAll(tr)
+			if string(data) != "hello" {
+				t.Errorf("notes.txt = %q", data)
+			}
+		}
+	}
+	if len(names) != 2*len(stagedNames)+1 || names[0] != "snapshot_1/abcdef12/config_dump.json" || names[len(stagedNames)] != "snapshot_1/12345678/config_dump.json" {
+		t.Errorf("unexpected entries: %v", names)
+	}
+}
+
+func TestArchiveSinksWriteAtomically(t *testing.T) {
+	staged := writeStagingTree(t)
+	tests := []struct {
+		name string
+		open func(path string) (ArtifactSink, error)
+	}{
+		{"tar.gz", func(p string) (ArtifactSink, error) { return newTarGzFileSink(p, "", false) }},
+		{"zip", func(p string) (ArtifactSink, error) { return newZipFileSink(p, false) }},
+		{"append tar.gz", func(p string) (ArtifactSink, error) { return newAppendTarGzSink(p, "snap", false) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "snap.archive")
+
+			// Interrupted: nothing appears under the final name
+			sink, err := tt.open(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Write("stats.json", strings.NewReader("partial")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(archive); !os.IsNotExist(err) {
+				t.Errorf("archive visible before Finalize: %v", err)
+			}
+			sink.Abort()
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Abort left files behind: %v", entries)
+			}
+
+			// Completed: moved into place, temporary file gone
+			sink, err = tt.open(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeStagedFiles(sink, staged); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Finalize(); err != nil {
+				t.Fatalf("Finalize: %v", err)
+			}
+			if _, err := os.Stat(archive); err != nil {
+				t.Errorf("archive missing after Finalize: %v", err)
+			}
+			if _, err := os.Stat(archive + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left after Finalize: %v", err)
+			}
+		})
+	}
+}
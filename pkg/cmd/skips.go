@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// SkipReason classifies why an allocation was not captured.
+type SkipReason string
+
+const (
+	SkipLookupFailed     SkipReason = "lookup-failed"
+	SkipNotRunning       SkipReason = "not-running"
+	SkipExcludedByFilter SkipReason = "excluded-by-filter"
+	SkipNoTasks          SkipReason = "no-tasks"
+	SkipNoSidecar        SkipReason = "no-sidecar-detected"
+	SkipNoHTTPTool       SkipReason = "no-http-tool"
+	SkipNoAdminPort      SkipReason = "no-admin-port"
+	SkipEnvoyTooOld      SkipReason = "envoy-too-old"
+)
+
+// skippedAlloc records one allocation that was left out of a capture run.
+type skippedAlloc struct {
+	AllocID string
+	Reason  SkipReason
+	Detail  string
+}
+
+// skipReport collects skipped allocations keyed by allocation ID.
+type skipReport struct {
+	skipped map[string]skippedAlloc
+}
+
+func newSkipReport() *skipReport {
+	return &skipReport{skipped: make(map[string]skippedAlloc)}
+}
+
+func (r *skipReport) add(allocID string, reason SkipReason, detail string) {
+	r.skipped[allocID] = skippedAlloc{AllocID: allocID, Reason: reason, Detail: detail}
+}
+
+// count returns how many allocations were skipped for any of the reasons.
+func (r *skipReport) count(reasons ...SkipReason) int {
+	n := 0
+	for _, s := range r.skipped {
+		for _, reason := range reasons {
+			if s.Reason == reason {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// print writes a concise per-allocation skip summary, grouped by reason.
+func (r *skipReport) print(w io.Writer) {
+	if len(r.skipped) == 0 {
+		return
+	}
+
+	entries := make([]skippedAlloc, 0, len(r.skipped))
+	for _, s := range r.skipped {
+		entries = append(entries, s)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Reason != entries[j].Reason {
+			return entries[i].Reason < entries[j].Reason
+		}
+		return entries[i].AllocID < entries[j].AllocID
+	})
+
+	fmt.Fprintf(w, "\nSkipped %d allocation(s):\n", len(entries))
+	for _, s := range entries {
+		if s.Detail != "" {
+			fmt.Fprintf(w, "  %-36s  %-20s  %s\n", s.AllocID, s.Reason, s.Detail)
+		} else {
+			fmt.Fprintf(w, "  %-36s  %s\n", s.AllocID, s.Reason)
+		}
+	}
+}
+
+// classifySkip reports whether an allocation should be skipped before any
+// exec or capture work is attempted, and why.
+func classifySkip(alloc nomad.AllocationInfo, namespace string) (SkipReason, string, bool) {
+	if alloc.ClientStatus != "" && alloc.ClientStatus != "running" {
+		return SkipNotRunning, "client status " + alloc.ClientStatus, true
+	}
+	if alloc.Namespace != "" && !nomad.NamespaceMatches(namespace, alloc.Namespace) {
+		return SkipExcludedByFilter, "namespace " + alloc.Namespace, true
+	}
+	if len(alloc.Tasks) == 0 {
+		return SkipNoTasks, "allocation has no tasks", true
+	}
+	if alloc.SidecarTask == "" && !alloc.Connect {
+		return SkipNoSidecar, "", true
+	}
+	return "", "", false
+}
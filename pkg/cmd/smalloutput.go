@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// minEndpointSize is the smallest plausible response of an endpoint from a
+// configured proxy. Anything smaller usually means the wrong port, a proxy
+// that never received its config or a truncated response.
+var minEndpointSize = map[string]int{
+	"/config_dump": 1024,
+	"/stats":       512,
+}
+
+// suspiciousOutput returns a warning for each captured endpoint whose
+// response is non-empty but implausibly small or empty of content. Empty
+// responses are reported as fetch failures instead.
+func suspiciousOutput(captured map[string][]byte, endpoints []string) []string {
+	var warnings []string
+	for _, endpoint := range endpoints {
+		data, ok := captured[endpoint]
+		if !ok || len(data) == 0 {
+			continue
+		}
+		if w := suspiciousEndpoint(endpoint, data); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings
+}
+
+func suspiciousEndpoint(endpoint string, data []byte) string {
+	path, _, _ := strings.Cut(endpoint, "?")
+	switch path {
+	case "/clusters":
+		if n, ok := countEntries(data, "cluster_statuses", "::"); ok && n == 0 {
+			return fmt.Sprintf("%s lists no clusters; the proxy may not be configured or the admin port may belong to another Envoy", endpoint)
+		}
+	case "/listeners":
+		if n, ok := countEntries(data, "listener_statuses", ""); ok && n == 0 {
+			return fmt.Sprintf("%s lists no listeners; the proxy may not be configured or the admin port may belong to another Envoy", endpoint)
+		}
+	}
+	if min, ok := minEndpointSize[path]; ok && len(data) < min {
+		return fmt.Sprintf("%s is only %s, below the %s expected from a configured proxy; check the admin port and look for a truncated response",
+			endpoint, formatBytes(int64(len(data))), formatBytes(int64(min)))
+	}
+	return ""
+}
+
+// countEntries counts the entries of a /clusters or /listeners response: the
+// elements of jsonKey in the JSON format, or else the text lines (those
+// containing sep, when set). ok is false when the JSON is unreadable.
+func countEntries(data []byte, jsonKey, sep string) (n int, ok bool) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return 0, false
+		}
+		var entries []json.RawMessage
+		if raw, found := doc[jsonKey]; found {
+			if err := json.Unmarshal(raw, &entries); err != nil {
+				return 0, false
+			}
+		}
+		return len(entries), true
+	}
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		if strings.TrimSpace(line) != "" && strings.Contains(line, sep) {
+			n++
+		}
+	}
+	return n, true
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuspiciousEndpoint(t *testing.T) {
+	bigDump := `{"configs":[` + strings.Repeat(`{"@type":"x"},`, 100) + `{}]}`
+	tests := []struct {
+		name     string
+		endpoint string
+		data     string
+		want     string // substring of the warning, "" for none
+	}{
+		{"tiny config dump", "/config_dump", `{"configs":[]}`, "/config_dump is only 14 B"},
+		{"plausible config dump", "/config_dump", bigDump, ""},
+		{"config dump with query", "/config_dump?resource=dynamic_active_clusters", `{}`, "is only 2 B"},
+		{"text clusters", "/clusters", "local_app::10.0.0.1:8080::cx_active::0\nlocal_app::10.0.0.1:8080::health_flags::healthy\n", ""},
+		{"no text clusters", "/clusters", "\n", "lists no clusters"},
+		{"json clusters", "/clusters?format=json", `{"cluster_statuses":[{"name":"local_app"}]}`, ""},
+		{"no json clusters", "/clusters?format=json", `{"cluster_statuses":[]}`, "lists no clusters"},
+		{"json clusters missing key", "/clusters?format=json", `{}`, "lists no clusters"},
+		{"unreadable json clusters", "/clusters?format=json", `{"cluster_statuses":`, ""},
+		{"text listeners", "/listeners", "public_listener:0.0.0.0:21000::0.0.0.0:21000\n", ""},
+		{"no json listeners", "/listeners?format=json", `{"listener_statuses":[]}`, "lists no listeners"},
+		{"tiny stats", "/stats", "server.live: 1\n", "/stats is only"},
+		{"no threshold", "/certs", `{"certificates":[]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suspiciousEndpoint(tt.endpoint, []byte(tt.data))
+			if tt.want == "" && got != "" {
+				t.Errorf("suspiciousEndpoint() = %q, want no warning", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("suspiciousEndpoint() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuspiciousOutputSkipsMissingAndEmpty(t *testing.T) {
+	captured := map[string][]byte{
+		"/config_dump": {},
+		"/clusters":    []byte("\n"),
+	}
+	got := suspiciousOutput(captured, []string{"/stats", "/config_dump", "/clusters"})
+	if len(got) != 1 || !strings.Contains(got[0], "/clusters") {
+		t.Errorf("suspiciousOutput() = %q, want only the /clusters warning", got)
+	}
+}
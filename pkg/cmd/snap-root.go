@@ -7,9 +7,12 @@ import (
 
 // NewRootCommand creates the root command for xDSnap
 func NewRootCommand(streams IOStreams) *cobra.Command {
+	var cfgFile string
+
 	rootCmd := &cobra.Command{
-		Use:   "xdsnap",
-		Short: "XDSnap captures Envoy state snapshots from Consul Connect sidecars on Nomad.",
+		Use:     "xdsnap",
+		Version: Version,
+		Short:   "XDSnap captures Envoy state snapshots from Consul Connect sidecars on Nomad.",
 		Long: `XDSnap is a tool for capturing and archiving Envoy proxy configuration
 snapshots from Consul Connect service mesh workloads running on Nomad.
 
@@ -18,12 +21,22 @@ It helps operators debug service mesh connectivity issues by collecting:
 - Stats, listeners, clusters, and certificates
 - Task logs (application and sidecar)
 - Optional network traffic captures`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadConfig(defaultConfigFiles(), cfgFile); err != nil {
+				return err
+			}
+			return applyConfigDefaults(cmd.Flags())
+		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to a config file (YAML, JSON or TOML), loaded over ~/.config/xdsnap/config.yaml and ./.xdsnap.yaml")
+
 	// Add the capture subcommand
 	rootCmd.AddCommand(NewCaptureCommand(streams))
-	// Add the analyze subcommand (disabled)
-	// rootCmd.AddCommand(NewAnalyzeCommand(streams))
+	// Add the analyze subcommand
+	rootCmd.AddCommand(NewAnalyzeCommand(streams))
+	// Add the list subcommand
+	rootCmd.AddCommand(NewListCommand(streams))
 
 	return rootCmd
 }
@@ -1,20 +1,20 @@
 package cmd
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
+	"github.com/markcampv/xDSnap/consul"
 	"github.com/markcampv/xDSnap/nomad"
 )
 
@@ -24,42 +24,125 @@ type SnapshotConfig struct {
 	SidecarTask       string
 	Endpoints         []string
 	OutputDir         string
+	TempDir           string // where the staging directory is created; "" for the system temp dir
+	Report            *CaptureResult
+	Deployment        *nomad.JobDeployment // latest deployment and evaluations of the allocation's job; nil unless --deployment
 	ExtraLogs         []string
 	Duration          time.Duration
 	EnableTrace       bool
 	TcpdumpEnabled    bool
+	TcpdumpRotation   tcpdumpRotation // ring buffer inside the task instead of one streamed capture when set
+	TcpdumpInterface  string          // interface tcpdump captures on; DefaultTcpdumpInterface when empty
 	SkipLogLevelReset bool
+	PreserveMetadata  bool
+	ArchiveInto       string
+	WatchStat         string
+	WatchInterval     time.Duration
+	WatchDuration     time.Duration
+	LogsOnly          bool
+	NoLogLevelChange  bool
+	VersionGate       bool              // skip endpoints the running Envoy version doesn't serve
+	AllEndpoints      bool              // also capture every readable endpoint on the admin index
+	Allowlist         endpointAllowlist // admin requests outside it are refused; nil allows all
+	AdminHeaders      []nomad.Header
+	AdminPathPrefix   string // prepended to every Envoy admin path
+	AdminAddr         string // IP Envoy admin listens on inside the allocation; nomad.EnvoyAdminAddr when empty
+	AdminPort         int    // Envoy admin port; nomad.EnvoyAdminPort when 0
+	AdminPorts        []int  // capture every listed admin port into port_<n>/ when more than one
+	EndpointTimeouts  endpointTimeouts
 	ExecStrategy      *nomad.ExecStrategy
+	MemoryThreshold   int64 // bytes allocated by Envoy before the summary warns; 0 disables
+	FocusClusters     []string
+	FocusListeners    []string
+	SidecarEnv        bool
+	ListeningSockets  bool
+	DNS               bool
+	TrustBundle       bool // save the trusted CAs from /config_dump as trust_bundle.pem
+	AdminIndex        bool
+	LogLimit          logLimit
+	LogFilter         logFilter
+	MergeStderr       bool                      // write stdout and stderr interleaved into one <task>.log
+	CompressLogs      bool                      // gzip task logs as they stream, into <task>-stdout.log.gz etc.
+	Dedup             *dedupTracker             // write markers for endpoints unchanged since the previous cycle when set
+	Epochs            *epochTracker             // restart epochs from earlier captures; flags hot restarts when set
+	Tail              *lineMux                  // also copy streamed log lines here, prefixed with alloc and task; nil disables
+	Interrupt         *interruptHandler         // stops fetching on Ctrl-C but still archives the capture; nil never interrupts
+	Intentions        *consul.ServiceIntentions // Consul intentions of the selected service, if any
+	IntentionsAt      time.Time                 // when Intentions was looked up; they are re-checked once the capture ends
+	CheckService      string                    // Consul service whose health-check output is saved to health_checks.txt; empty disables
+	HealthChecks      []consul.ServiceCheck     // this allocation's checks, looked up from CheckService on each capture
+	NodeStatus        *nomad.NodeStatus         // status of the allocation's node, saved as node.json when set
+	ResourceStats     bool                      // save the tasks' Nomad resource usage to resource_stats.json
+	AllocStats        *nomad.AllocResourceStats // resource usage looked up on each capture when ResourceStats is set
+	OutputFormat      string                    // one of OutputFormats; tar.gz when empty
+	GzipOver          int64                     // gzip staged files larger than this many bytes individually; 0 disables
+	ConfigFormat      string                    // one of ConfigFormats; JSON responses are saved as-is when empty
+	Sink              ArtifactSink              // shared output for every capture (e.g. stdout); not finalized here
+	Webhook           *webhook                  // also POST each finished archive here when set
+	Progress          io.Writer                 // progress messages; os.Stdout when nil
+	Timings           *captureTimings           // phase durations, logged and saved to timings.txt when set
 }
 
 var DefaultEndpoints = []string{"/stats", "/config_dump", "/listeners", "/clusters", "/certs"}
 
-func CaptureSnapshot(nomadService nomad.NomadApiService, config SnapshotConfig) error {
+// OptionalEndpoints are additional Envoy admin endpoints that are not captured
+// by default but are understood by the capture summary when requested.
+var OptionalEndpoints = []string{"/init_dump", "/memory", "/stats/recentlookups", "/contention"}
+
+// CaptureSnapshot captures one allocation into an archive under
+// config.OutputDir and returns the record of what was captured, which is
+// also saved in the archive as capture_report.json. The record is nil when
+// the capture failed before anything was fetched.
+func CaptureSnapshot(nomadService nomad.NomadApiService, config SnapshotConfig) (*CaptureResult, error) {
 	if len(config.Endpoints) == 0 {
 		config.Endpoints = DefaultEndpoints
 	}
 
 	log.Printf("CaptureSnapshot called with Alloc=%s Task=%s Sidecar=%s EnableTrace=%v",
 		config.AllocID[:8], config.TaskName, config.SidecarTask, config.EnableTrace)
+	captureStart := time.Now()
+	config.Timings = config.Timings.forAlloc(config.AllocID)
 
 	// Resolve exec strategy if not already set
-	if config.ExecStrategy == nil {
+	if config.ExecStrategy == nil && !config.LogsOnly {
 		taskOrder := buildTaskOrder(config.SidecarTask, config.TaskName, config.ExtraLogs)
+		stop := config.Timings.start(config.AllocID, "exec strategy")
 		strategy, err := nomad.ResolveExecStrategy(nomadService, config.AllocID, taskOrder)
+		stop()
 		if err != nil {
-			return fmt.Errorf("failed to resolve exec strategy: %w", err)
+			return nil, fmt.Errorf("failed to resolve exec strategy: %w", err)
 		}
 		config.ExecStrategy = strategy
 	}
+	if config.ExecStrategy != nil && (len(config.AdminHeaders) > 0 || config.AdminPathPrefix != "" || config.AdminAddr != "") {
+		// Copy so a strategy shared across captures isn't mutated
+		strategy := *config.ExecStrategy
+		strategy.Headers = config.AdminHeaders
+		strategy.PathPrefix = config.AdminPathPrefix
+		strategy.Address = config.AdminAddr
+		config.ExecStrategy = &strategy
+	}
 
-	tempDir, err := os.MkdirTemp("", config.AllocID[:8])
+	tempDir, err := os.MkdirTemp(config.TempDir, config.AllocID[:8])
 	if err != nil {
-		return fmt.Errorf("failed to create temporary directory: %w", err)
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
+	config.Report = newCaptureResult(config, tempDir, captureStart)
 
-	// Stream logs from app task + any extras (e.g., sidecar)
+	// Stream logs from app task + any extras (e.g., sidecar), ending early
+	// when the capture is interrupted
+	logCtx, stopLogs := context.WithCancel(context.Background())
+	defer stopLogs()
+	go func() {
+		select {
+		case <-config.Interrupt.done():
+			stopLogs()
+		case <-logCtx.Done():
+		}
+	}()
 	logResults := make(chan struct{}, len(config.ExtraLogs)+1)
+	logStart := time.Now()
 
 	// Collect unique tasks to get logs from
 	tasksToLog := []string{config.TaskName}
@@ -79,33 +162,69 @@ func CaptureSnapshot(nomadService nomad.NomadApiService, config SnapshotConfig)
 			log.Printf("Starting log stream for task %s", task)
 			stdoutPath := filepath.Join(tempDir, fmt.Sprintf("%s-stdout.log", task))
 			stderrPath := filepath.Join(tempDir, fmt.Sprintf("%s-stderr.log", task))
-			if err := streamLogsToFiles(nomadService, config.AllocID, task, config.Duration+10*time.Second, stdoutPath, stderrPath); err != nil {
+			if config.MergeStderr {
+				stdoutPath = filepath.Join(tempDir, fmt.Sprintf("%s.log", task))
+				stderrPath = stdoutPath
+			}
+			if config.CompressLogs {
+				stdoutPath, stderrPath = stdoutPath+".gz", stderrPath+".gz"
+			}
+			err := streamLogsToFiles(logCtx, nomadService, config.AllocID, task, config.Duration+10*time.Second, stdoutPath, stderrPath, config.CompressLogs, config.LogLimit, config.LogFilter, config.Tail)
+			if err != nil {
 				log.Printf("Failed to stream logs for task %s: %v", task, err)
 			}
+			config.Report.addLog(task, []string{stdoutPath, stderrPath}, err)
 			logResults <- struct{}{}
 		}()
 	}
 
 	// --- Set Envoy log level via exec ---
-	logLevel := "debug"
-	if config.EnableTrace {
-		logLevel = "trace"
+	if config.changesLogLevel() {
+		logLevel := "debug"
+		if config.EnableTrace {
+			logLevel = "trace"
+		}
+		log.Printf("Setting Envoy log level to '%s' via nomad exec", logLevel)
+
+		stop := config.Timings.start(config.AllocID, "set log level")
+		for _, port := range config.adminPorts() {
+			config.AdminPort = port
+			if err := setEnvoyLogLevel(nomadService, config, logLevel); err != nil {
+				log.Printf("Failed to set log level on admin port %d: %v", port, err)
+			}
+		}
+		stop()
 	}
-	log.Printf("Setting Envoy log level to '%s' via nomad exec", logLevel)
+	ports := config.adminPorts()
+	config.AdminPort = ports[0]
 
-	if err := setEnvoyLogLevel(nomadService, config, logLevel); err != nil {
-		log.Printf("Failed to set log level: %v", err)
+	// --- Optional stat time series ---
+	watchDone := make(chan struct{})
+	if config.WatchStat != "" && !config.LogsOnly {
+		go func() {
+			defer close(watchDone)
+			name := strings.NewReplacer(".", "_", "/", "_").Replace(config.WatchStat)
+			csvPath := filepath.Join(tempDir, fmt.Sprintf("watch_%s.csv", name))
+			if err := watchStat(nomadService, config, csvPath); err != nil {
+				log.Printf("Failed to watch stat %s: %v", config.WatchStat, err)
+			}
+		}()
+	} else {
+		close(watchDone)
 	}
 
 	// --- Optional tcpdump capture ---
-	if config.TcpdumpEnabled {
+	if config.TcpdumpEnabled && !config.LogsOnly {
 		log.Printf("Starting tcpdump capture...")
-		pcapData, err := captureTcpdump(nomadService, config)
+		stop := config.Timings.start(config.AllocID, "tcpdump")
+		pcaps, err := captureTcpdump(nomadService, config)
+		stop()
 		if err != nil {
 			log.Printf("Failed to capture tcpdump: %v", err)
-		} else if len(pcapData) > 0 {
-			pcapPath := filepath.Join(tempDir, "capture.pcap")
-			if err := os.WriteFile(pcapPath, pcapData, 0644); err != nil {
+		}
+		for _, pcap := range pcaps {
+			pcapPath := filepath.Join(tempDir, pcap.name)
+			if err := os.WriteFile(pcapPath, pcap.data, 0644); err != nil {
 				log.Printf("Failed to write pcap file: %v", err)
 			} else {
 				log.Printf("Saved .pcap file: %s", pcapPath)
@@ -113,82 +232,460 @@ func CaptureSnapshot(nomadService nomad.NomadApiService, config SnapshotConfig)
 		}
 	}
 
-	// --- Envoy admin endpoints ---
+	// --- Nomad node state, shared by every allocation on the node ---
+	if config.NodeStatus != nil {
+		if err := writeNodeStatus(config.NodeStatus, filepath.Join(tempDir, "node.json")); err != nil {
+			log.Printf("Failed to write node info: %v", err)
+		}
+	}
+
+	// --- Nomad deployment and evaluations, shared by the job's allocations ---
+	if config.Deployment != nil {
+		if err := writeJobDeployment(config.Deployment, tempDir); err != nil {
+			log.Printf("Failed to write deployment info: %v", err)
+		}
+	}
+
+	// --- Nomad resource usage, which changes between captures ---
+	if config.ResourceStats {
+		stats, err := nomadService.GetAllocationStats(config.AllocID)
+		if err != nil {
+			log.Printf("Failed to get resource stats: %v", err)
+		} else {
+			config.AllocStats = stats
+			if err := writeResourceStats(stats, config.SidecarTask, filepath.Join(tempDir, "resource_stats.json")); err != nil {
+				log.Printf("Failed to write resource stats: %v", err)
+			}
+		}
+	}
+
+	// --- Envoy admin endpoints, once per admin port ---
+	var missing []string
+	var configDump []byte
+	if !config.LogsOnly {
+		if config.CheckService != "" {
+			// Check output changes between captures, so it is fetched each time
+			checks, err := nomadService.GetServiceChecks(config.CheckService)
+			if err != nil {
+				log.Printf("Failed to get health checks of %s: %v", config.CheckService, err)
+			} else {
+				config.HealthChecks = allocChecks(checks, config.AllocID)
+				if err := writeHealthChecks(config.HealthChecks, filepath.Join(tempDir, "health_checks.txt")); err != nil {
+					log.Printf("Failed to write health checks: %v", err)
+				}
+			}
+		}
+		multi := len(ports) > 1
+		for i, port := range ports {
+			portConfig := config
+			portConfig.AdminPort = port
+			if i > 0 {
+				// Intentions, checks, the node, the deployment and resource
+				// usage are shared, report them once
+				portConfig.Intentions = nil
+				portConfig.HealthChecks = nil
+				portConfig.NodeStatus = nil
+				portConfig.Deployment = nil
+				portConfig.AllocStats = nil
+			}
+			dir := adminPortDir(tempDir, port, multi)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return config.Report, fmt.Errorf("failed to create directory for admin port %d: %w", port, err)
+			}
+			captured, portMissing := captureAdminPort(nomadService, portConfig, dir)
+			if i == 0 {
+				configDump = captured["/config_dump"]
+			}
+			for _, endpoint := range portMissing {
+				if multi {
+					endpoint = fmt.Sprintf("%s (port %d)", endpoint, port)
+				}
+				missing = append(missing, endpoint)
+			}
+		}
+		if config.Intentions != nil {
+			if err := writeIntentions(config.Intentions, filepath.Join(tempDir, "intentions.json")); err != nil {
+				log.Printf("Failed to write intentions: %v", err)
+			}
+		}
+		if config.Interrupt.interrupted() {
+			config.ListeningSockets, config.DNS, config.SidecarEnv = false, false, false
+		}
+		stopExtras := config.Timings.start(config.AllocID, "sidecar exec extras")
+		if config.ListeningSockets {
+			if err := captureListeningSockets(nomadService, config, filepath.Join(tempDir, "listening_sockets.txt")); err != nil {
+				log.Printf("Failed to capture listening sockets: %v", err)
+			}
+		}
+		if config.DNS {
+			if configDump == nil {
+				if configDump, err = fetchEnvoyEndpoint(nomadService, config, "/config_dump"); err != nil {
+					log.Printf("Failed to fetch /config_dump for DNS upstreams: %v", err)
+				}
+			}
+			if err := captureDNS(nomadService, config, dnsHostnames(configDump), filepath.Join(tempDir, "dns.txt")); err != nil {
+				log.Printf("Failed to capture DNS state: %v", err)
+			}
+		}
+		if config.SidecarEnv {
+			if err := captureSidecarEnv(nomadService, config, filepath.Join(tempDir, "sidecar_env.txt")); err != nil {
+				log.Printf("Failed to capture sidecar environment: %v", err)
+			}
+		}
+		if config.ListeningSockets || config.DNS || config.SidecarEnv {
+			stopExtras()
+		}
+	}
+
+	// Wait for all log streams and the stat watcher to finish
+	for i := 0; i < len(tasksToLog); i++ {
+		<-logResults
+	}
+	config.Timings.record(config.AllocID, "log streams", time.Since(logStart))
+	<-watchDone
+
+	// --- Intentions changed while capturing, with the summary of the first port ---
+	if config.Intentions != nil && !config.LogsOnly {
+		recheckIntentions(nomadService, config, tempDir, adminPortDir(tempDir, ports[0], len(ports) > 1))
+	}
+
+	if config.GzipOver > 0 {
+		stop := config.Timings.start(config.AllocID, "gzip large files")
+		if err := gzipLargeFiles(tempDir, config.GzipOver); err != nil {
+			log.Printf("Failed to compress large files: %v", err)
+		}
+		stop()
+	}
+
+	if err := config.Report.write(time.Now()); err != nil {
+		log.Printf("Failed to write %s: %v", CaptureReportFile, err)
+	}
+
+	// The archive can't hold its own timing, so timings.txt stops here
+	if config.Timings != nil {
+		if err := config.Timings.write(filepath.Join(tempDir, "timings.txt"), time.Since(captureStart)); err != nil {
+			log.Printf("Failed to write timings: %v", err)
+		}
+	}
+
+	// Bundle snapshot
+	stopArchive := config.Timings.start(config.AllocID, "archive")
+	location, bundleErr := bundleSnapshot(config, tempDir)
+	if bundleErr == nil {
+		stopArchive()
+		config.Timings.log(config.AllocID[:8], time.Since(captureStart))
+		if sizes, err := sizeSummary(tempDir, location); err == nil {
+			fmt.Fprint(config.progress(), sizes)
+		}
+	}
+
+	// Reset log level, also mid-run when interrupted since no later capture
+	// will
+	if config.changesLogLevel() && (!config.SkipLogLevelReset || config.Interrupt.interrupted()) {
+		log.Printf("Resetting Envoy log level back to 'info' on alloc: %s", config.AllocID[:8])
+		for _, port := range ports {
+			config.AdminPort = port
+			if err := setEnvoyLogLevel(nomadService, config, "info"); err != nil {
+				log.Printf("Failed to reset log level to info on admin port %d: %v", port, err)
+			}
+		}
+	}
+
+	if bundleErr != nil {
+		return config.Report, bundleErr
+	}
+
+	// Upload last, so a slow or failing webhook neither delays the log
+	// level reset nor loses the local archive
+	uploadErr := uploadSnapshot(config, location)
+	if len(missing) > 0 || uploadErr != nil {
+		return config.Report, &PartialCaptureError{AllocID: config.AllocID, Missing: missing, UploadErr: uploadErr}
+	}
+	return config.Report, nil
+}
+
+// createSnapshotDir creates dir, or dir_2, dir_3, ... when it already
+// exists, and returns the directory it created. Creation is exclusive, so
+// concurrent runs sharing an output directory never share a snapshot
+// directory.
+func createSnapshotDir(dir string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	for n := 1; ; n++ {
+		candidate := dir
+		if n > 1 {
+			candidate = fmt.Sprintf("%s_%d", dir, n)
+		}
+		err := os.Mkdir(candidate, 0755)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// bundleSnapshot writes the staged files in tempDir to the configured output
+// and returns where they went. When config.Sink is set the files are added to
+// that shared sink under snapshot_<timestamp>/<alloc>/ and it is left open.
+func bundleSnapshot(config SnapshotConfig, tempDir string) (string, error) {
+	alloc := config.AllocID[:8]
+	prefix := path.Join(filepath.Base(config.OutputDir), alloc)
+
+	var sink ArtifactSink
+	var location string
+	var err error
+	switch {
+	case config.Sink != nil:
+		sink, location = prefixSink{sink: config.Sink, prefix: prefix}, ""
+	case config.ArchiveInto != "":
+		location = config.ArchiveInto
+		sink, err = newAppendTarGzSink(location, prefix, config.PreserveMetadata)
+	case config.OutputFormat == FormatTar:
+		location = filepath.Join(config.OutputDir, fmt.Sprintf("%s_snapshot.tar", alloc))
+		sink, err = newTarFileSink(location, config.PreserveMetadata)
+	case config.OutputFormat == FormatZip:
+		location = filepath.Join(config.OutputDir, fmt.Sprintf("%s_snapshot.zip", alloc))
+		sink, err = newZipFileSink(location, config.PreserveMetadata)
+	case config.OutputFormat == FormatDir:
+		location = filepath.Join(config.OutputDir, alloc)
+		sink, err = newDirSink(location, config.PreserveMetadata)
+	case config.OutputFormat == FormatFlat:
+		location = config.OutputDir
+		sink, err = newFlatSink(location, alloc, config.PreserveMetadata)
+	default:
+		location = filepath.Join(config.OutputDir, fmt.Sprintf("%s_snapshot.tar.gz", alloc))
+		sink, err = newTarGzFileSink(location, "", config.PreserveMetadata)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create output for %s: %w", alloc, err)
+	}
+	if err := writeStagedFiles(sink, tempDir); err != nil {
+		sink.Abort()
+		return "", fmt.Errorf("failed to bundle snapshot: %w", err)
+	}
+	if err := sink.Finalize(); err != nil {
+		return "", fmt.Errorf("failed to bundle snapshot: %w", err)
+	}
+
+	switch {
+	case config.Sink != nil:
+		fmt.Fprintf(config.progress(), "Snapshot for %s written under %s/\n", alloc, prefix)
+	case config.ArchiveInto != "":
+		fmt.Fprintf(config.progress(), "Snapshot for %s appended to %s under %s/\n", alloc, location, prefix)
+	case config.OutputFormat == FormatFlat:
+		fmt.Fprintf(config.progress(), "Snapshot for %s saved as %s\n", alloc, filepath.Join(location, alloc+"_*"))
+	default:
+		fmt.Fprintf(config.progress(), "Snapshot for %s saved as %s\n", alloc, location)
+	}
+	return location, nil
+}
+
+// progress is where human-readable capture progress is printed.
+func (c SnapshotConfig) progress() io.Writer {
+	if c.Progress != nil {
+		return c.Progress
+	}
+	return os.Stdout
+}
+
+// changesLogLevel reports whether the capture raises the Envoy log level (and
+// later resets it).
+func (c SnapshotConfig) changesLogLevel() bool {
+	return !c.LogsOnly && !c.NoLogLevelChange
+}
+
+// captureEndpoints fetches each configured endpoint into dir. It returns the
+// captured data and the failure category of each endpoint that failed.
+func captureEndpoints(nomadService nomad.NomadApiService, config SnapshotConfig, dir string) (map[string][]byte, map[string]string) {
+	captured := make(map[string][]byte)
+	failures := make(map[string]string)
+	fileNames := endpointFileNames(config.Endpoints)
+	access := accessMethod(config.ExecStrategy)
 	for _, endpoint := range config.Endpoints {
+		result := EndpointResult{Endpoint: endpoint, AdminPort: config.adminPort(), Access: access, Status: StatusFailed}
+		if config.Interrupt.interrupted() {
+			failures[endpoint] = FailureInterrupted
+			result.Failure = FailureInterrupted
+			config.Report.addEndpoint(result)
+			continue
+		}
+		stop := config.Timings.start(config.AllocID, endpointPhase(config, "fetch "+endpoint))
+		began := time.Now()
+		result.Attempts++
 		data, err := fetchEnvoyEndpoint(nomadService, config, endpoint)
+		stop()
+		result.DurationMS, result.Bytes = time.Since(began).Milliseconds(), len(data)
 		if err != nil {
-			log.Printf("Error capturing %s: %v", endpoint, err)
+			failures[endpoint] = classifyFetchFailure(err)
+			log.Printf("Error capturing %s [%s]: %v", endpoint, failures[endpoint], err)
+			result.Failure, result.Error = failures[endpoint], err.Error()
+			config.Report.addEndpoint(result)
 			continue
 		}
+		if endpoint == "/contention" {
+			if _, enabled := parseContention(data); !enabled {
+				// Nothing worth a file; the summary explains why
+				log.Printf("Mutex tracing is not enabled on alloc %s, not saving /contention", config.AllocID[:8])
+				captured[endpoint] = data
+				result.Status, result.Error = StatusSkipped, "mutex tracing is not enabled"
+				config.Report.addEndpoint(result)
+				continue
+			}
+		}
 		if len(data) == 0 {
+			failures[endpoint] = FailureEmptyResponse
 			log.Printf("Warning: No data received from endpoint %s for alloc %s", endpoint, config.AllocID[:8])
+			result.Failure = FailureEmptyResponse
+			config.Report.addEndpoint(result)
 			continue
 		}
-		filePath := filepath.Join(tempDir, fmt.Sprintf("%s.json", strings.TrimPrefix(endpoint, "/")))
-		if err := os.WriteFile(filePath, data, 0644); err != nil {
+		filePath := filepath.Join(dir, fileNames[endpoint])
+		out := data
+		if config.ConfigFormat == ConfigFormatYAML && convertsToYAML(endpoint) {
+			// Non-JSON responses (e.g. text /clusters) are kept as they are
+			if y, err := jsonToYAML(data); err == nil {
+				out = y
+				filePath = strings.TrimSuffix(filePath, ".json") + ".yaml"
+			}
+		}
+		if config.Dedup != nil {
+			key := fmt.Sprintf("%s:%d:%s", config.AllocID, config.adminPort(), endpoint)
+			if snapshot, ok := config.Dedup.unchanged(key, out, filepath.Base(config.OutputDir)); ok {
+				marker := filePath + ".unchanged"
+				if err := os.WriteFile(marker, unchangedMarker(filepath.Base(filePath), snapshot, out), 0644); err != nil {
+					log.Printf("Failed to write unchanged marker for %s: %v", endpoint, err)
+				} else {
+					fmt.Fprintf(config.progress(), "%s for %s is unchanged since %s\n", endpoint, config.AllocID[:8], snapshot)
+				}
+				captured[endpoint] = data
+				result.Status, result.File = StatusUnchanged, marker
+				config.Report.addEndpoint(result)
+				continue
+			}
+		}
+		if err := os.WriteFile(filePath, out, 0644); err != nil {
 			log.Printf("Failed to write data for %s: %v", endpoint, err)
+			result.Error = err.Error()
 		} else {
-			fmt.Printf("Captured %s for %s and saved to %s\n", endpoint, config.AllocID[:8], filePath)
+			fmt.Fprintf(config.progress(), "Captured %s for %s and saved to %s\n", endpoint, config.AllocID[:8], filePath)
+			result.Status, result.File = StatusCaptured, filePath
 		}
+		captured[endpoint] = data
+		config.Report.addEndpoint(result)
 	}
+	return captured, failures
+}
 
-	// Wait for all log streams to finish
-	for i := 0; i < len(tasksToLog); i++ {
-		<-logResults
+// versionGatedEndpoints drops the configured endpoints that the sidecar's
+// Envoy version (read from /server_info) does not serve. All endpoints are
+// kept when the version can't be determined.
+func versionGatedEndpoints(nomadService nomad.NomadApiService, config SnapshotConfig) []string {
+	data, err := fetchEnvoyEndpoint(nomadService, config, "/server_info")
+	if err != nil {
+		log.Printf("Version gate: failed to fetch /server_info, capturing all endpoints: %v", err)
+		return config.Endpoints
+	}
+	version, err := parseServerInfoVersion(data)
+	if err != nil {
+		log.Printf("Version gate: %v, capturing all endpoints", err)
+		return config.Endpoints
 	}
+	supported, skipped := gateEndpoints(config.Endpoints, version)
+	for _, s := range skipped {
+		log.Printf("Skipping %s for alloc %s", s, config.AllocID[:8])
+	}
+	return supported
+}
 
-	// Bundle snapshot
-	tarFilePath := filepath.Join(config.OutputDir, fmt.Sprintf("%s_snapshot.tar.gz", config.AllocID[:8]))
-	if err := createTarGz(tarFilePath, tempDir); err != nil {
-		return fmt.Errorf("failed to create tar.gz file: %w", err)
+// endpointFileName returns the flat, filesystem-safe file name an endpoint's
+// response is saved under, e.g. /stats?filter=http becomes
+// stats_filter_http.json.
+func endpointFileName(endpoint string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(endpoint, "_"), "_")
+	if name == "" {
+		name = "root"
 	}
-	fmt.Printf("Snapshot for %s saved as %s\n", config.AllocID[:8], tarFilePath)
+	return name + ".json"
+}
 
-	// Reset log level
-	if !config.SkipLogLevelReset {
-		log.Printf("Resetting Envoy log level back to 'info' on alloc: %s", config.AllocID[:8])
-		if err := setEnvoyLogLevel(nomadService, config, "info"); err != nil {
-			log.Printf("Failed to reset log level to info: %v", err)
+// endpointFileNames maps each endpoint to a unique file name, numbering names
+// that would otherwise collide (stats_x.json, stats_x_2.json, ...).
+func endpointFileNames(endpoints []string) map[string]string {
+	names := make(map[string]string, len(endpoints))
+	used := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		if _, ok := names[endpoint]; ok {
+			continue
+		}
+		name := endpointFileName(endpoint)
+		base := strings.TrimSuffix(name, ".json")
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d.json", base, i)
 		}
+		used[name] = true
+		names[endpoint] = name
 	}
-
-	return nil
+	return names
 }
 
-func streamLogsToFiles(nomadService nomad.NomadApiService, allocID, task string, duration time.Duration, stdoutPath, stderrPath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
+// streamLogsToFiles follows the task's stdout and stderr into the given files
+// for duration, keeping the lines selected by filter and capping each file by
+// limit. When both paths are the same the streams are merged line by line, in
+// arrival order, into that one file. With compress the files are gzipped as
+// the logs arrive; limit applies to the uncompressed log.
+func streamLogsToFiles(parent context.Context, nomadService nomad.NomadApiService, allocID, task string, duration time.Duration, stdoutPath, stderrPath string, compress bool, limit logLimit, filter logFilter, tail *lineMux) error {
+	ctx, cancel := context.WithTimeout(parent, duration)
 	defer cancel()
 
 	// Create output files
-	stdoutFile, err := os.Create(stdoutPath)
+	stdoutFile, err := createLogFile(stdoutPath, compress)
 	if err != nil {
 		return fmt.Errorf("failed to create stdout file: %w", err)
 	}
 	defer stdoutFile.Close()
 
-	stderrFile, err := os.Create(stderrPath)
-	if err != nil {
-		return fmt.Errorf("failed to create stderr file: %w", err)
+	var stdoutW, stderrW io.WriteCloser
+	if stderrPath == stdoutPath {
+		// One cap for the merged file, shared by both streams
+		merged := limit.wrap(stdoutFile)
+		defer merged.Close()
+		mux := &lineMux{w: merged}
+		stdoutW, stderrW = mux.stream(), mux.stream()
+	} else {
+		stderrFile, err := createLogFile(stderrPath, compress)
+		if err != nil {
+			return fmt.Errorf("failed to create stderr file: %w", err)
+		}
+		defer stderrFile.Close()
+		stdoutW, stderrW = limit.wrap(stdoutFile), limit.wrap(stderrFile)
 	}
-	defer stderrFile.Close()
 
-	// Stream both stdout and stderr to separate files
+	// Stream stdout and stderr concurrently
 	done := make(chan error, 2)
 
-	go func() {
-		done <- nomadService.FetchTaskLogs(ctx, allocID, task, "stdout", true, stdoutFile)
-	}()
-
-	go func() {
-		done <- nomadService.FetchTaskLogs(ctx, allocID, task, "stderr", true, stderrFile)
-	}()
+	stream := func(logType string, out io.WriteCloser) {
+		if tail != nil {
+			out = teeWriter{a: out, b: tail.prefixed(fmt.Sprintf("[%s/%s %s] ", allocID[:8], task, logType))}
+		}
+		w := filter.wrap(out)
+		err := nomadService.FetchTaskLogs(ctx, allocID, task, logType, true, w)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		done <- err
+	}
+	go stream("stdout", stdoutW)
+	go stream("stderr", stderrW)
 
 	// Wait for context timeout or both streams to complete
 	var firstErr error
 	for i := 0; i < 2; i++ {
 		select {
 		case err := <-done:
-			if err != nil && firstErr == nil && err != context.DeadlineExceeded {
+			if err != nil && firstErr == nil && err != context.DeadlineExceeded && err != context.Canceled {
 				firstErr = err
 			}
 		case <-ctx.Done():
@@ -206,16 +703,116 @@ func streamLogsToFiles(nomadService nomad.NomadApiService, allocID, task string,
 	return firstErr
 }
 
+// captureAdminPort captures the Envoy admin endpoints, focus bundles, admin
+// index, hot-restart state and summary of the proxy on config.AdminPort into
+// dir. It returns the captured endpoint data and the endpoints that could
+// not be captured.
+func captureAdminPort(nomadService nomad.NomadApiService, config SnapshotConfig, dir string) (map[string][]byte, []string) {
+	if config.AllEndpoints {
+		config.Endpoints = allAdminEndpoints(nomadService, config)
+	}
+	if config.VersionGate {
+		config.Endpoints = versionGatedEndpoints(nomadService, config)
+	}
+	captured, failures := captureEndpoints(nomadService, config, dir)
+	if config.Interrupt.interrupted() {
+		// Skip the remaining fetches but still write the summary
+		config.FocusClusters, config.FocusListeners, config.AdminIndex = nil, nil, false
+	}
+	for _, target := range focusTargets(config.FocusClusters, config.FocusListeners) {
+		if err := captureFocus(nomadService, config, dir, target); err != nil {
+			log.Printf("Failed to capture focus bundle for %s %s: %v", target.kind, target.name, err)
+		}
+	}
+	if config.AdminIndex {
+		if err := captureAdminIndex(nomadService, config, filepath.Join(dir, "available_endpoints.txt")); err != nil {
+			log.Printf("Failed to capture admin index: %v", err)
+		}
+	}
+
+	summary := summarizeCapture(captured, config)
+	for _, endpoint := range config.Endpoints {
+		if category, ok := failures[endpoint]; ok {
+			summary.addf("%s failed [%s]: %s", endpoint, category, failureHints[category])
+		}
+	}
+	if config.TrustBundle && !config.Interrupt.interrupted() {
+		captureTrustBundle(nomadService, config, captured["/config_dump"], dir, summary)
+	}
+	// Hot-restart state is a lookup of its own, left out when the
+	// allowlist rejects /server_info
+	if !config.Interrupt.interrupted() && config.Allowlist.allows("/server_info") {
+		if restart, err := captureRestartInfo(nomadService, config, filepath.Join(dir, "hot_restart.txt")); err != nil {
+			log.Printf("Failed to capture hot restart state: %v", err)
+		} else if config.Epochs != nil {
+			key := fmt.Sprintf("%s:%d", config.AllocID, config.adminPort())
+			if prev, changed := config.Epochs.observe(key, restart.Epoch); changed {
+				summary.addf("Envoy hot-restarted since the previous capture (restart epoch %d -> %d)", prev, restart.Epoch)
+			}
+		}
+	}
+	if !summary.empty() {
+		summary.log(config.AllocID[:8])
+		if err := summary.write(filepath.Join(dir, "summary.txt")); err != nil {
+			log.Printf("Failed to write summary: %v", err)
+		}
+	}
+
+	var missing []string
+	for _, endpoint := range config.Endpoints {
+		if _, ok := captured[endpoint]; !ok {
+			if category, ok := failures[endpoint]; ok {
+				endpoint = fmt.Sprintf("%s [%s]", endpoint, category)
+			}
+			missing = append(missing, endpoint)
+		}
+	}
+	return captured, missing
+}
+
+// captureTrustBundle writes the trusted CAs of configDump, fetched when it
+// wasn't captured, into dir and adds their expiry findings to summary.
+func captureTrustBundle(nomadService nomad.NomadApiService, config SnapshotConfig, configDump []byte, dir string, summary *captureSummary) {
+	if configDump == nil {
+		var err error
+		if configDump, err = fetchEnvoyEndpoint(nomadService, config, "/config_dump"); err != nil {
+			log.Printf("Failed to fetch /config_dump for the trust bundle: %v", err)
+			return
+		}
+	}
+	certs, err := writeTrustBundle(configDump, dir, time.Now())
+	if err != nil {
+		log.Printf("Failed to extract the trust bundle: %v", err)
+		return
+	}
+	if len(certs) == 0 {
+		summary.addf("no trusted CA found in /config_dump; its TLS contexts may load the bundle from a file")
+		return
+	}
+	fmt.Fprintf(config.progress(), "Saved %d trusted CA(s) for %s to %s\n", len(certs), config.AllocID[:8], filepath.Join(dir, "trust_bundle.pem"))
+	for _, f := range trustBundleFindings(certs, time.Now()) {
+		summary.addf("%s", f)
+	}
+}
+
 func setEnvoyLogLevel(nomadService nomad.NomadApiService, config SnapshotConfig, level string) error {
 	path := fmt.Sprintf("/logging?level=%s", level)
-	return nomadService.EnvoyAdminPOST(config.AllocID, config.ExecStrategy, nomad.EnvoyAdminPort, path)
+	if err := config.Allowlist.permit(path); err != nil {
+		return err
+	}
+	return nomadService.EnvoyAdminPOST(config.AllocID, config.ExecStrategy, config.adminPort(), path)
 }
 
+// fetchEnvoyEndpoint GETs endpoint from the admin API, refusing endpoints
+// the allowlist rejects. Every admin GET of a capture goes through it.
 func fetchEnvoyEndpoint(nomadService nomad.NomadApiService, config SnapshotConfig, endpoint string) ([]byte, error) {
-	return nomadService.EnvoyAdminGET(config.AllocID, config.ExecStrategy, nomad.EnvoyAdminPort, endpoint)
+	if err := config.Allowlist.permit(endpoint); err != nil {
+		return nil, err
+	}
+	return nomadService.EnvoyAdminGET(config.AllocID, config.EndpointTimeouts.apply(config.ExecStrategy, endpoint), config.adminPort(), endpoint)
 }
 
-func captureTcpdump(nomadService nomad.NomadApiService, config SnapshotConfig) ([]byte, error) {
+func captureTcpdump(nomadService nomad.NomadApiService, config SnapshotConfig) ([]pcapFile, error) {
 	durationSecs := int(config.Duration.Seconds())
 	if durationSecs < 5 {
 		durationSecs = 5
@@ -224,51 +821,36 @@ func captureTcpdump(nomadService nomad.NomadApiService, config SnapshotConfig) (
 	// Build task order: sidecar first, then siblings (all share network namespace)
 	tasksToTry := buildTaskOrder(config.SidecarTask, config.TaskName, config.ExtraLogs)
 
-	cmd := []string{
-		"sh", "-c",
-		fmt.Sprintf("timeout %d tcpdump -i any -s0 -w - 2>/dev/null | base64", durationSecs),
+	iface := config.TcpdumpInterface
+	if iface == "" {
+		iface = DefaultTcpdumpInterface
 	}
+	cmd := tcpdumpCommand(durationSecs, iface, config.TcpdumpRotation)
 
-	for _, task := range tasksToTry {
-		var stdout bytes.Buffer
-		var stderr bytes.Buffer
-
-		log.Printf("Running tcpdump for %d seconds in task %s", durationSecs, task)
-
-		_, err := nomadService.ExecuteCommandWithStderr(config.AllocID, task, cmd, &stdout, &stderr)
-		if err != nil {
-			if strings.Contains(stderr.String(), "not found") || strings.Contains(err.Error(), "not found") {
-				log.Printf("tcpdump/sh not available in task %q, trying next task...", task)
-				continue
-			}
-			return nil, fmt.Errorf("tcpdump failed in task %q: %w (stderr: %s)", task, err, stderr.String())
-		}
-
-		if stdout.Len() == 0 {
-			log.Printf("No tcpdump data captured in task %s", task)
-			return nil, nil
-		}
-
-		if task != config.SidecarTask {
-			log.Printf("Captured tcpdump via sibling task %q (shared network namespace)", task)
-		}
+	// A quick check first, so a missing interface or capability fails now
+	// rather than as an empty pcap after the full duration
+	task, err := checkTcpdump(nomadService, config.AllocID, tasksToTry, iface)
+	if err != nil {
+		return nil, err
+	}
 
-		// Decode base64
-		raw := stdout.String()
-		clean := regexp.MustCompile(`[^A-Za-z0-9+/=]`).ReplaceAllString(strings.TrimSpace(raw), "")
-		if clean == "" {
-			return nil, nil
-		}
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	log.Printf("Running tcpdump on %s for %d seconds in task %s", iface, durationSecs, task)
+	if _, err := nomadService.ExecuteCommandWithStderr(config.AllocID, task, cmd, &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("tcpdump failed in task %q: %w (stderr: %s)", task, err, stderr.String())
+	}
 
-		data, err := base64.StdEncoding.DecodeString(clean)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode base64 tcpdump stream: %w", err)
-		}
+	if stdout.Len() == 0 {
+		log.Printf("No tcpdump data captured in task %s", task)
+		return nil, nil
+	}
 
-		return data, nil
+	if task != config.SidecarTask {
+		log.Printf("Captured tcpdump via sibling task %q (shared network namespace)", task)
 	}
 
-	return nil, fmt.Errorf("tcpdump not available in any task (tried: %s)", strings.Join(tasksToTry, ", "))
+	return parseTcpdumpOutput(stdout.Bytes(), config.TcpdumpRotation)
 }
 
 // buildTaskOrder returns a deduplicated list of tasks to try, with sidecar first.
@@ -288,47 +870,3 @@ func buildTaskOrder(sidecarTask, taskName string, extraLogs []string) []string {
 	}
 	return order
 }
-
-func createTarGz(outputFile string, sourceDir string) error {
-	tarFile, err := os.Create(outputFile)
-	if err != nil {
-		return err
-	}
-	defer tarFile.Close()
-
-	gzipWriter := gzip.NewWriter(tarFile)
-	defer gzipWriter.Close()
-
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
-
-	err = filepath.Walk(sourceDir, func(file string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if fi.IsDir() {
-			return nil
-		}
-		relPath, err := filepath.Rel(sourceDir, file)
-		if err != nil {
-			return err
-		}
-		header, err := tar.FileInfoHeader(fi, relPath)
-		if err != nil {
-			return err
-		}
-		header.Name = relPath
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
-		f, err := os.Open(file)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		_, err = io.Copy(tarWriter, f)
-		return err
-	})
-
-	return err
-}
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildTaskOrder(t *testing.T) {
 	tests := []struct {
-		name        string
-		sidecar     string
-		taskName    string
-		extraLogs   []string
-		want        []string
+		name      string
+		sidecar   string
+		taskName  string
+		extraLogs []string
+		want      []string
 	}{
 		{
 			name:     "sidecar first then task",
@@ -91,3 +100,225 @@ func TestBuildTaskOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateTarGzDeterministic(t *testing.T) {
+	files := map[string]string{
+		"stats.json":       "stats",
+		"config_dump.json": `{"configs":[]}`,
+		"web-stdout.log":   "hello\n",
+	}
+	stampedTree := func(dir string, mtime time.Time) {
+		writeTree(t, dir, files)
+		for name := range files {
+			if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	dirA, dirB, out := t.TempDir(), t.TempDir(), t.TempDir()
+	stampedTree(dirA, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	stampedTree(dirB, time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC))
+
+	archiveA := filepath.Join(out, "a.tar.gz")
+	archiveB := filepath.Join(out, "b.tar.gz")
+	sinkA, err := newTarGzFileSink(archiveA, "", false)
+	bundleStaged(t, sinkA, err, dirA)
+	sinkB, err := newTarGzFileSink(archiveB, "", false)
+	bundleStaged(t, sinkB, err, dirB)
+
+	a, _ := os.ReadFile(archiveA)
+	b, _ := os.ReadFile(archiveB)
+	if !bytes.Equal(a, b) {
+		t.Fatal("archives of identical content differ")
+	}
+
+	headers := readTarHeaders(t, archiveA)
+	wantOrder := []string{"config_dump.json", "stats.json", "web-stdout.log"}
+	if len(headers) != len(wantOrder) {
+		t.Fatalf("got %d entries, want %d", len(headers), len(wantOrder))
+	}
+	for i, h := range headers {
+		if h.Name != wantOrder[i] {
+			t.Errorf("entry[%d] = %q, want %q", i, h.Name, wantOrder[i])
+		}
+		if !h.ModTime.Equal(time.Unix(0, 0)) || h.Uid != 0 || h.Gid != 0 {
+			t.Errorf("entry %q not normalized: mtime=%v uid=%d gid=%d", h.Name, h.ModTime, h.Uid, h.Gid)
+		}
+	}
+}
+
+func TestCreateTarGzPreserveMetadata(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, "stats.json")
+	if err := os.WriteFile(path, []byte("stats"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(out, "snap.tar.gz")
+	sink, err := newTarGzFileSink(archive, "", true)
+	bundleStaged(t, sink, err, dir)
+	headers := readTarHeaders(t, archive)
+	if len(headers) != 1 || !headers[0].ModTime.Equal(mtime) {
+		t.Errorf("expected preserved mtime %v, got %+v", mtime, headers)
+	}
+}
+
+func readTarHeaders(t *testing.T, path string) []*tar.Header {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var headers []*tar.Header
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, h)
+	}
+	return headers
+}
+
+func TestAppendToTarGz(t *testing.T) {
+	out := t.TempDir()
+	archive := filepath.Join(out, "debug.tar.gz")
+
+	first, second := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(first, "stats.json"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(second, "stats.json"), []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newAppendTarGzSink(archive, "snapshot_20240101_000000/abcdef12", false)
+	bundleStaged(t, sink, err, first)
+	sink, err = newAppendTarGzSink(archive, "snapshot_20240101_000100/abcdef12", false)
+	bundleStaged(t, sink, err, second)
+
+	headers := readTarHeaders(t, archive)
+	want := []string{
+		"snapshot_20240101_000000/abcdef12/stats.json",
+		"snapshot_20240101_000100/abcdef12/stats.json",
+	}
+	if len(headers) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(headers), len(want))
+	}
+	for i, h := range headers {
+		if h.Name != want[i] {
+			t.Errorf("entry[%d] = %q, want %q", i, h.Name, want[i])
+		}
+	}
+	if _, err := os.Stat(archive + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary archive was left behind")
+	}
+}
+
+func TestChangesLogLevel(t *testing.T) {
+	tests := []struct {
+		name   string
+		config SnapshotConfig
+		want   bool
+	}{
+		{"default", SnapshotConfig{}, true},
+		{"trace", SnapshotConfig{EnableTrace: true}, true},
+		{"logs only", SnapshotConfig{LogsOnly: true}, false},
+		{"no log level change", SnapshotConfig{NoLogLevelChange: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.config.changesLogLevel(); got != tt.want {
+			t.Errorf("%s: changesLogLevel() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEndpointFileName(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"/stats", "stats.json"},
+		{"/config_dump", "config_dump.json"},
+		{"/stats/recentlookups", "stats_recentlookups.json"},
+		{"/stats?filter=ssl", "stats_filter_ssl.json"},
+		{"/stats?format=json&usedonly", "stats_format_json_usedonly.json"},
+		{"/stats?filter=(upstream_cx|upstream_rq)", "stats_filter_upstream_cx_upstream_rq.json"},
+		{"/stats?filter=cluster.web", "stats_filter_cluster.web.json"},
+		{"/", "root.json"},
+	}
+	for _, tt := range tests {
+		if got := endpointFileName(tt.endpoint); got != tt.want {
+			t.Errorf("endpointFileName(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestEndpointFileNamesUnique(t *testing.T) {
+	got := endpointFileNames([]string{"/stats?filter=a", "/stats/filter/a", "/stats?filter=a", "/stats_filter=a", "/clusters"})
+	want := map[string]string{
+		"/stats?filter=a": "stats_filter_a.json",
+		"/stats/filter/a": "stats_filter_a_2.json",
+		"/stats_filter=a": "stats_filter_a_3.json",
+		"/clusters":       "clusters.json",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("endpointFileNames() = %v, want %v", got, want)
+	}
+}
+
+func TestClaimFlatDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	release, err := claimFlatDir(dir)
+	if err != nil {
+		t.Fatalf("claimFlatDir() error: %v", err)
+	}
+	if _, err := claimFlatDir(dir); err == nil || !strings.Contains(err.Error(), "is writing to "+dir) {
+		t.Errorf("second claimFlatDir() error = %v, want the directory reported as in use", err)
+	}
+	release()
+	release, err = claimFlatDir(dir)
+	if err != nil {
+		t.Fatalf("claimFlatDir() after release error: %v", err)
+	}
+	release()
+
+	// A run killed before releasing its claim doesn't block the next one
+	writeStaleLock(t, filepath.Join(dir, flatLockFile))
+	release, err = claimFlatDir(dir)
+	if err != nil {
+		t.Fatalf("claimFlatDir() over a stale lock error: %v", err)
+	}
+	release()
+}
+
+func TestCreateSnapshotDir(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "out", "snapshot_20240101_120000")
+	want := []string{base, base + "_2", base + "_3"}
+	for i, w := range want {
+		got, err := createSnapshotDir(base)
+		if err != nil {
+			t.Fatalf("call %d: createSnapshotDir() error: %v", i+1, err)
+		}
+		if got != w {
+			t.Errorf("call %d: createSnapshotDir() = %q, want %q", i+1, got, w)
+		}
+		if fi, err := os.Stat(got); err != nil || !fi.IsDir() {
+			t.Errorf("call %d: %s was not created", i+1, got)
+		}
+	}
+}
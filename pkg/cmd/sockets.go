@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// socketCommands list listening TCP sockets with their owning processes and
+// are tried in order until one is available in the task.
+var socketCommands = [][]string{
+	{"ss", "-tlnp"},
+	{"netstat", "-tlnp"},
+}
+
+// captureListeningSockets runs the first available socket listing in the task
+// used for Envoy admin access (which shares the sidecar's network namespace)
+// and writes its output to path.
+func captureListeningSockets(nomadService nomad.NomadApiService, config SnapshotConfig, path string) error {
+	task := config.SidecarTask
+	if config.ExecStrategy != nil {
+		task = config.ExecStrategy.Task
+	}
+
+	var tried []string
+	for _, cmd := range socketCommands {
+		var stdout, stderr bytes.Buffer
+		code, err := nomadService.ExecuteCommandWithStderr(config.AllocID, task, cmd, &stdout, &stderr)
+		if commandMissing(code, err, stderr.String()) {
+			tried = append(tried, cmd[0])
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s failed in task %s: %w (stderr: %s)", cmd[0], task, err, stderr.String())
+		}
+		if code != 0 {
+			return fmt.Errorf("%s exited with code %d in task %s (stderr: %s)", cmd[0], code, task, stderr.String())
+		}
+		header := fmt.Sprintf("# %s (task %s)\n", strings.Join(cmd, " "), task)
+		return os.WriteFile(path, append([]byte(header), stdout.Bytes()...), 0644)
+	}
+	return fmt.Errorf("no socket listing tool in task %s (tried: %s)", task, strings.Join(tried, ", "))
+}
+
+// commandMissing reports whether an exec failed because the binary does not
+// exist in the task, as opposed to the command itself failing.
+func commandMissing(code int, err error, stderr string) bool {
+	if code == 127 {
+		return true
+	}
+	msg := stderr
+	if err != nil {
+		msg += " " + err.Error()
+	}
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "no such file")
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommandMissing(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		err    error
+		stderr string
+		want   bool
+	}{
+		{"success", 0, nil, "", false},
+		{"shell exit 127", 127, nil, "", true},
+		{"exec lookup error", 0, errors.New(`exec: "ss": executable file not found in $PATH`), "", true},
+		{"missing file on stderr", 1, nil, "sh: netstat: No such file or directory", true},
+		{"command failed", 1, nil, "Cannot open netlink socket: Permission denied", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandMissing(tt.code, tt.err, tt.stderr); got != tt.want {
+				t.Errorf("commandMissing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
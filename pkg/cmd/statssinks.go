@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// statsSink is one entry of the bootstrap's stats_sinks: where Envoy pushes
+// its metrics.
+type statsSink struct {
+	Name        string
+	Kind        string // statsd, dogstatsd, hystrix, metrics service, opentelemetry, or the config type
+	Destination string
+	Cluster     string // cluster the sink sends to, "" when it sends to an address
+	Prefix      string
+}
+
+// prometheusListener is a bootstrap listener that serves /stats/prometheus,
+// such as the one Consul adds for envoy_prometheus_bind_addr.
+type prometheusListener struct {
+	Name    string
+	Address string
+	Paths   []string // request paths rewritten to /stats/prometheus
+}
+
+// metricsConfig is how one proxy exports metrics, from its bootstrap.
+type metricsConfig struct {
+	Sinks         []statsSink
+	Prometheus    []prometheusListener
+	FlushInterval string   // stats_flush_interval, "" when Envoy's default applies
+	Matcher       string   // stats_matcher summary, "" when every stat is kept
+	Clusters      []string // every cluster in the dump, to check sink clusters against
+}
+
+type grpcService struct {
+	EnvoyGrpc *struct {
+		ClusterName string `json:"cluster_name"`
+	} `json:"envoy_grpc"`
+	GoogleGrpc *struct {
+		TargetURI string `json:"target_uri"`
+	} `json:"google_grpc"`
+}
+
+// target describes where a gRPC sink sends to and the cluster it uses.
+func (g grpcService) target() (string, string) {
+	switch {
+	case g.EnvoyGrpc != nil:
+		return "gRPC cluster " + g.EnvoyGrpc.ClusterName, g.EnvoyGrpc.ClusterName
+	case g.GoogleGrpc != nil:
+		return "gRPC target " + g.GoogleGrpc.TargetURI, ""
+	}
+	return "(no gRPC service)", ""
+}
+
+// sinkConfig mirrors the typed_config fields of the stats sinks Envoy ships.
+type sinkConfig struct {
+	Type    string `json:"@type"`
+	Address *struct {
+		SocketAddress *socketAddress `json:"socket_address"`
+		Pipe          *struct {
+			Path string `json:"path"`
+		} `json:"pipe"`
+	} `json:"address"`
+	TCPClusterName string      `json:"tcp_cluster_name"`
+	Prefix         string      `json:"prefix"`
+	GrpcService    grpcService `json:"grpc_service"`
+}
+
+// summarizeStatsSinks reads the stats sinks, Prometheus listeners, flush
+// interval and stats matcher of an Envoy /config_dump's bootstrap.
+func summarizeStatsSinks(configDump []byte) (metricsConfig, error) {
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return metricsConfig{}, fmt.Errorf("failed to parse config dump: %w", err)
+	}
+	delta, err := summarizeXDSDelta(configDump)
+	if err != nil {
+		return metricsConfig{}, err
+	}
+
+	cfg := metricsConfig{Clusters: delta.BootstrapClusters}
+	for _, c := range delta.Clusters {
+		cfg.Clusters = append(cfg.Clusters, c.Name)
+	}
+	for _, raw := range dump.Configs {
+		var section struct {
+			Type      string `json:"@type"`
+			Bootstrap struct {
+				StatsSinks []struct {
+					Name        string          `json:"name"`
+					TypedConfig json.RawMessage `json:"typed_config"`
+				} `json:"stats_sinks"`
+				StatsFlushInterval string `json:"stats_flush_interval"`
+				StatsConfig        struct {
+					StatsMatcher *struct {
+						RejectAll     bool `json:"reject_all"`
+						InclusionList *struct {
+							Patterns []json.RawMessage `json:"patterns"`
+						} `json:"inclusion_list"`
+						ExclusionList *struct {
+							Patterns []json.RawMessage `json:"patterns"`
+						} `json:"exclusion_list"`
+					} `json:"stats_matcher"`
+				} `json:"stats_config"`
+				StaticResources struct {
+					Listeners []json.RawMessage `json:"listeners"`
+				} `json:"static_resources"`
+			} `json:"bootstrap"`
+		}
+		if err := json.Unmarshal(raw, &section); err != nil || !strings.HasSuffix(section.Type, ".BootstrapConfigDump") {
+			continue
+		}
+		b := section.Bootstrap
+		for _, s := range b.StatsSinks {
+			var tc sinkConfig
+			if len(s.TypedConfig) > 0 {
+				if err := json.Unmarshal(s.TypedConfig, &tc); err != nil {
+					return metricsConfig{}, fmt.Errorf("failed to parse stats sink %s: %w", s.Name, err)
+				}
+			}
+			cfg.Sinks = append(cfg.Sinks, newStatsSink(s.Name, tc))
+		}
+		cfg.FlushInterval = b.StatsFlushInterval
+		if m := b.StatsConfig.StatsMatcher; m != nil {
+			switch {
+			case m.RejectAll:
+				cfg.Matcher = "reject_all: no stats are kept, so nothing is exported"
+			case m.InclusionList != nil:
+				cfg.Matcher = fmt.Sprintf("inclusion list: only stats matching %d patterns are kept", len(m.InclusionList.Patterns))
+			case m.ExclusionList != nil:
+				cfg.Matcher = fmt.Sprintf("exclusion list: stats matching %d patterns are dropped", len(m.ExclusionList.Patterns))
+			}
+		}
+		for _, l := range b.StaticResources.Listeners {
+			if p, ok := parsePrometheusListener(l); ok {
+				cfg.Prometheus = append(cfg.Prometheus, p)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// newStatsSink describes a stats sink from its name and typed_config.
+func newStatsSink(name string, tc sinkConfig) statsSink {
+	s := statsSink{Name: name, Prefix: tc.Prefix}
+	kind := tc.Type[strings.LastIndex(tc.Type, "/")+1:]
+	switch {
+	case strings.HasSuffix(kind, ".DogStatsdSink"):
+		s.Kind = "dogstatsd"
+	case strings.HasSuffix(kind, ".StatsdSink"):
+		s.Kind = "statsd"
+	case strings.HasSuffix(kind, ".HystrixSink"):
+		s.Kind, s.Destination = "hystrix", "admin /hystrix_event_stream"
+	case strings.HasSuffix(kind, ".MetricsServiceConfig"):
+		s.Kind = "metrics service"
+		s.Destination, s.Cluster = tc.GrpcService.target()
+	case strings.Contains(kind, ".open_telemetry.") && strings.HasSuffix(kind, ".SinkConfig"):
+		s.Kind = "opentelemetry"
+		s.Destination, s.Cluster = tc.GrpcService.target()
+	case kind != "":
+		s.Kind = kind
+	default:
+		s.Kind = name
+	}
+	if s.Kind == "statsd" || s.Kind == "dogstatsd" {
+		switch {
+		case tc.TCPClusterName != "":
+			s.Destination, s.Cluster = "tcp cluster "+tc.TCPClusterName, tc.TCPClusterName
+		case tc.Address != nil && tc.Address.SocketAddress != nil:
+			sa := tc.Address.SocketAddress
+			s.Destination = fmt.Sprintf("udp %s:%d", sa.Address, sa.PortValue)
+		case tc.Address != nil && tc.Address.Pipe != nil:
+			s.Destination = "unix " + tc.Address.Pipe.Path
+		}
+	}
+	return s
+}
+
+// parsePrometheusListener reports whether a bootstrap listener routes
+// requests to the admin /stats/prometheus endpoint, and on which paths.
+func parsePrometheusListener(raw json.RawMessage) (prometheusListener, bool) {
+	var l struct {
+		Name    string `json:"name"`
+		Address struct {
+			SocketAddress socketAddress `json:"socket_address"`
+		} `json:"address"`
+	}
+	var tree interface{}
+	if json.Unmarshal(raw, &l) != nil || json.Unmarshal(raw, &tree) != nil {
+		return prometheusListener{}, false
+	}
+	paths := prometheusPaths(tree)
+	if len(paths) == 0 {
+		return prometheusListener{}, false
+	}
+	sa := l.Address.SocketAddress
+	return prometheusListener{Name: l.Name, Address: fmt.Sprintf("%s:%d", sa.Address, sa.PortValue), Paths: sortedUnique(paths)}, true
+}
+
+// prometheusPaths finds the routes in a decoded listener whose match is
+// served by /stats/prometheus, directly or through a prefix rewrite.
+func prometheusPaths(v interface{}) []string {
+	var paths []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		match, _ := v["match"].(map[string]interface{})
+		route, _ := v["route"].(map[string]interface{})
+		if match != nil && route != nil {
+			p, _ := match["prefix"].(string)
+			if p == "" {
+				p, _ = match["path"].(string)
+			}
+			rewrite, _ := route["prefix_rewrite"].(string)
+			if strings.HasPrefix(rewrite, "/stats/prometheus") || (rewrite == "" && strings.HasPrefix(p, "/stats/prometheus")) {
+				paths = append(paths, p)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			paths = append(paths, prometheusPaths(v[k])...)
+		}
+	case []interface{}:
+		for _, e := range v {
+			paths = append(paths, prometheusPaths(e)...)
+		}
+	}
+	return paths
+}
+
+// printStatsSinks writes where the proxy exports metrics, flagging sinks
+// whose cluster isn't in the config and configurations that export nothing.
+func printStatsSinks(w io.Writer, cfg metricsConfig) {
+	if len(cfg.Sinks) == 0 {
+		fmt.Fprintln(w, "Stats sinks: none")
+	} else {
+		fmt.Fprintln(w, "Stats sinks:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tKIND\tDESTINATION\tPREFIX\tNOTE")
+		for _, s := range cfg.Sinks {
+			prefix, note := s.Prefix, ""
+			if prefix == "" {
+				prefix = "-"
+			}
+			if s.Cluster != "" && !containsString(cfg.Clusters, s.Cluster) {
+				note = "CLUSTER NOT FOUND"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", s.Name, s.Kind, s.Destination, prefix, note)
+		}
+		tw.Flush()
+	}
+
+	if len(cfg.Prometheus) == 0 {
+		fmt.Fprintln(w, "Prometheus listener: none")
+	}
+	for _, p := range cfg.Prometheus {
+		fmt.Fprintf(w, "Prometheus listener: %s on %s, scrape %s\n", p.Name, p.Address, strings.Join(p.Paths, ", "))
+	}
+
+	interval := cfg.FlushInterval
+	if interval == "" {
+		interval = "5s (default)"
+	}
+	if len(cfg.Sinks) > 0 {
+		fmt.Fprintf(w, "Flush interval: %s\n", interval)
+	}
+	if cfg.Matcher != "" {
+		fmt.Fprintf(w, "Stats matcher: %s\n", cfg.Matcher)
+	}
+	if len(cfg.Sinks) == 0 && len(cfg.Prometheus) == 0 {
+		fmt.Fprintln(w, "Nothing exports this proxy's metrics; they are only available from the admin /stats endpoint.")
+	}
+}
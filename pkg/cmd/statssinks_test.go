@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const statsSinksDump = `{"configs":[
+ {"@type":"type.googleapis.com/envoy.admin.v3.BootstrapConfigDump",
+  "bootstrap":{
+   "stats_sinks":[
+    {"name":"envoy.stat_sinks.dog_statsd","typed_config":{"@type":"type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink","address":{"socket_address":{"address":"127.0.0.1","port_value":8125}},"prefix":"envoy"}},
+    {"name":"envoy.stat_sinks.statsd","typed_config":{"@type":"type.googleapis.com/envoy.config.metrics.v3.StatsdSink","tcp_cluster_name":"statsd_tcp"}},
+    {"name":"envoy.stat_sinks.metrics_service","typed_config":{"@type":"type.googleapis.com/envoy.config.metrics.v3.MetricsServiceConfig","grpc_service":{"envoy_grpc":{"cluster_name":"metrics_collector"}}}},
+    {"name":"envoy.stat_sinks.hystrix","typed_config":{"@type":"type.googleapis.com/envoy.config.metrics.v3.HystrixSink","num_buckets":10}}],
+   "stats_flush_interval":"10s",
+   "stats_config":{"stats_matcher":{"exclusion_list":{"patterns":[{"prefix":"cluster.local_agent"},{"suffix":"rq_time"}]}}},
+   "static_resources":{
+    "clusters":[{"name":"local_agent"},{"name":"self_admin"}],
+    "listeners":[
+     {"name":"envoy_prometheus_metrics_listener","address":{"socket_address":{"address":"0.0.0.0","port_value":20200}},
+      "filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{"route_config":{"virtual_hosts":[{"routes":[
+       {"match":{"prefix":"/metrics"},"route":{"cluster":"self_admin","prefix_rewrite":"/stats/prometheus"}},
+       {"match":{"prefix":"/"},"direct_response":{"status":404}}]}]}}}]}]},
+     {"name":"envoy_ready_listener","address":{"socket_address":{"address":"0.0.0.0","port_value":21100}},
+      "filter_chains":[{"filters":[{"typed_config":{"route_config":{"virtual_hosts":[{"routes":[
+       {"match":{"path":"/ready"},"route":{"cluster":"self_admin","prefix_rewrite":"/ready"}}]}]}}}]}]}]}}},
+ {"@type":"type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+  "dynamic_active_clusters":[{"cluster":{"name":"statsd_tcp"}}]}
+]}`
+
+func TestSummarizeStatsSinks(t *testing.T) {
+	cfg, err := summarizeStatsSinks([]byte(statsSinksDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSinks := []statsSink{
+		{Name: "envoy.stat_sinks.dog_statsd", Kind: "dogstatsd", Destination: "udp 127.0.0.1:8125", Prefix: "envoy"},
+		{Name: "envoy.stat_sinks.statsd", Kind: "statsd", Destination: "tcp cluster statsd_tcp", Cluster: "statsd_tcp"},
+		{Name: "envoy.stat_sinks.metrics_service", Kind: "metrics service", Destination: "gRPC cluster metrics_collector", Cluster: "metrics_collector"},
+		{Name: "envoy.stat_sinks.hystrix", Kind: "hystrix", Destination: "admin /hystrix_event_stream"},
+	}
+	if !reflect.DeepEqual(cfg.Sinks, wantSinks) {
+		t.Errorf("Sinks = %+v, want %+v", cfg.Sinks, wantSinks)
+	}
+	wantPrometheus := []prometheusListener{{Name: "envoy_prometheus_metrics_listener", Address: "0.0.0.0:20200", Paths: []string{"/metrics"}}}
+	if !reflect.DeepEqual(cfg.Prometheus, wantPrometheus) {
+		t.Errorf("Prometheus = %+v, want %+v", cfg.Prometheus, wantPrometheus)
+	}
+	if cfg.FlushInterval != "10s" || cfg.Matcher != "exclusion list: stats matching 2 patterns are dropped" {
+		t.Errorf("FlushInterval = %q, Matcher = %q", cfg.FlushInterval, cfg.Matcher)
+	}
+
+	if _, err := summarizeStatsSinks([]byte("not json")); err == nil {
+		t.Error("summarizeStatsSinks() accepted invalid JSON")
+	}
+}
+
+func TestPrintStatsSinks(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want []string
+	}{
+		{
+			name: "sinks and prometheus",
+			dump: statsSinksDump,
+			want: []string{
+				"  envoy.stat_sinks.dog_statsd       dogstatsd        udp 127.0.0.1:8125              envoy",
+				"  envoy.stat_sinks.metrics_service  metrics service  gRPC cluster metrics_collector  -       CLUSTER NOT FOUND\n",
+				"Prometheus listener: envoy_prometheus_metrics_listener on 0.0.0.0:20200, scrape /metrics\n",
+				"Flush interval: 10s\n",
+			},
+		},
+		{
+			name: "nothing exported",
+			dump: `{"configs":[{"@type":"type.googleapis.com/envoy.admin.v3.BootstrapConfigDump","bootstrap":{"stats_config":{"stats_matcher":{"reject_all":true}}}}]}`,
+			want: []string{
+				"Stats sinks: none\nPrometheus listener: none\n",
+				"Stats matcher: reject_all: no stats are kept, so nothing is exported\n",
+				"Nothing exports this proxy's metrics",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := summarizeStatsSinks([]byte(tt.dump))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			printStatsSinks(&out, cfg)
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("printStatsSinks() output missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
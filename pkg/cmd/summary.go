@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// captureSummary collects findings about captured Envoy data that are worth
+// calling out to the operator. It is logged after each capture and written
+// into the snapshot archive as summary.txt.
+type captureSummary struct {
+	findings []string
+}
+
+func (s *captureSummary) addf(format string, args ...interface{}) {
+	s.findings = append(s.findings, fmt.Sprintf(format, args...))
+}
+
+func (s *captureSummary) empty() bool {
+	return len(s.findings) == 0
+}
+
+func (s *captureSummary) String() string {
+	var b strings.Builder
+	for _, f := range s.findings {
+		b.WriteString("- ")
+		b.WriteString(f)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// log prints every finding prefixed with the allocation it belongs to.
+func (s *captureSummary) log(allocID string) {
+	for _, f := range s.findings {
+		log.Printf("SUMMARY [%s]: %s", allocID, f)
+	}
+}
+
+func (s *captureSummary) write(path string) error {
+	return os.WriteFile(path, []byte(s.String()), 0644)
+}
+
+// appendTo adds the findings to the summary file at path, creating it when
+// the capture had no findings before.
+func (s *captureSummary) appendTo(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// summarizeCapture inspects the captured endpoint data (keyed by endpoint
+// path) and returns the findings worth surfacing.
+func summarizeCapture(captured map[string][]byte, config SnapshotConfig) *captureSummary {
+	summary := &captureSummary{}
+
+	for _, warning := range suspiciousOutput(captured, config.Endpoints) {
+		summary.addf("WARNING: %s", warning)
+	}
+
+	if data, ok := captured["/init_dump"]; ok {
+		for _, target := range pendingInitTargets(data) {
+			summary.addf("Envoy is still initializing: %s", target)
+		}
+	}
+
+	if data, ok := captured["/memory"]; ok && config.MemoryThreshold > 0 {
+		if mem, err := parseMemoryStats(data); err == nil && int64(mem.Allocated) > config.MemoryThreshold {
+			summary.addf("Envoy has %s allocated (heap %s), above the %s threshold",
+				formatBytes(int64(mem.Allocated)), formatBytes(int64(mem.HeapSize)), formatBytes(config.MemoryThreshold))
+		}
+	}
+
+	if data, ok := captured["/contention"]; ok {
+		if stats, enabled := parseContention(data); !enabled {
+			summary.addf("/contention has no data: Envoy was not started with --enable-mutex-tracing")
+		} else if stats.NumContentions > contentionWarnCount {
+			summary.addf("Envoy recorded %d contended mutex acquisitions (%d lifetime wait cycles)",
+				stats.NumContentions, stats.LifetimeWaitCycles)
+		}
+	}
+
+	if config.Intentions != nil {
+		for _, denied := range deniedIntentions(config.Intentions) {
+			summary.addf("Consul %s", denied)
+		}
+	}
+
+	for _, failing := range failingChecks(config.HealthChecks) {
+		summary.addf("Consul %s", failing)
+	}
+
+	for _, finding := range nodeFindings(config.NodeStatus) {
+		summary.addf("%s", finding)
+	}
+
+	for _, finding := range deploymentFindings(config.Deployment) {
+		summary.addf("%s", finding)
+	}
+
+	for _, finding := range resourceFindings(config.AllocStats, config.SidecarTask) {
+		summary.addf("%s", finding)
+	}
+
+	return summary
+}
+
+// memoryStats mirrors Envoy's /memory response. Envoy encodes the 64-bit
+// counters as JSON strings.
+type memoryStats struct {
+	Allocated        uint64 `json:"allocated,string"`
+	HeapSize         uint64 `json:"heap_size,string"`
+	TotalThreadCache uint64 `json:"total_thread_cache,string"`
+}
+
+func parseMemoryStats(data []byte) (memoryStats, error) {
+	var mem memoryStats
+	err := json.Unmarshal(data, &mem)
+	return mem, err
+}
+
+// initDump mirrors the subset of Envoy's /init_dump response we care about.
+type initDump struct {
+	UnreadyTargetsDumps []struct {
+		Name        string   `json:"name"`
+		TargetNames []string `json:"target_names"`
+	} `json:"unready_targets_dumps"`
+}
+
+// pendingInitTargets returns a description of each init manager that still
+// has unready targets. An empty result means Envoy finished initializing.
+func pendingInitTargets(data []byte) []string {
+	var dump initDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil
+	}
+
+	var pending []string
+	for _, d := range dump.UnreadyTargetsDumps {
+		if len(d.TargetNames) == 0 {
+			continue
+		}
+		pending = append(pending, fmt.Sprintf("%s waiting on %s", d.Name, strings.Join(d.TargetNames, ", ")))
+	}
+	return pending
+}
+
+// sizeSummary lists every file under dir with its size, the total, and the
+// size of the resulting archive.
+func sizeSummary(dir, archivePath string) (string, error) {
+	type entry struct {
+		name string
+		size int64
+	}
+	var entries []entry
+	var total int64
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name: filepath.ToSlash(rel), size: fi.Size()})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	width := len("total")
+	for _, e := range entries {
+		if len(e.name) > width {
+			width = len(e.name)
+		}
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "  %-*s  %10s\n", width, e.name, formatBytes(e.size))
+	}
+	fmt.Fprintf(&b, "  %-*s  %10s\n", width, "total", formatBytes(total))
+	if fi, err := os.Stat(archivePath); err == nil && fi.Mode().IsRegular() {
+		fmt.Fprintf(&b, "  %-*s  %10s\n", width, "archive", formatBytes(fi.Size()))
+	}
+	return b.String(), nil
+}
+
+// formatBytes renders a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
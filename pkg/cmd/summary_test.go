@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPendingInitTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "fully initialized",
+			input: `{}`,
+			want:  nil,
+		},
+		{
+			name:  "pending listener targets",
+			input: `{"unready_targets_dumps":[{"name":"init manager Server","target_names":["RDS: public_listener","LDS"]}]}`,
+			want:  []string{"init manager Server waiting on RDS: public_listener, LDS"},
+		},
+		{
+			name:  "manager without targets ignored",
+			input: `{"unready_targets_dumps":[{"name":"init manager Server","target_names":[]}]}`,
+			want:  nil,
+		},
+		{
+			name:  "invalid json",
+			input: `not json`,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pendingInitTargets([]byte(tt.input))
+			if len(got) != len(tt.want) {
+				t.Fatalf("pendingInitTargets() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("pendingInitTargets()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeCaptureInitDump(t *testing.T) {
+	captured := map[string][]byte{
+		"/init_dump": []byte(`{"unready_targets_dumps":[{"name":"init manager Server","target_names":["LDS"]}]}`),
+	}
+	summary := summarizeCapture(captured, SnapshotConfig{})
+	if summary.empty() {
+		t.Fatal("expected a finding for pending init targets")
+	}
+	if !strings.Contains(summary.String(), "still initializing") {
+		t.Errorf("unexpected summary: %q", summary.String())
+	}
+
+	if s := summarizeCapture(map[string][]byte{"/init_dump": []byte(`{}`)}, SnapshotConfig{}); !s.empty() {
+		t.Errorf("expected no findings for initialized proxy, got %q", s.String())
+	}
+}
+
+func TestSummarizeCaptureMemory(t *testing.T) {
+	captured := map[string][]byte{
+		"/memory": []byte(`{"allocated":"314572800","heap_size":"335544320","pageheap_unmapped":"0","pageheap_free":"0","total_thread_cache":"1048576"}`),
+	}
+	tests := []struct {
+		name      string
+		threshold int64
+		wantWarn  bool
+	}{
+		{"above threshold", 256 << 20, true},
+		{"below threshold", 512 << 20, false},
+		{"disabled", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := summarizeCapture(captured, SnapshotConfig{MemoryThreshold: tt.threshold})
+			if got := !summary.empty(); got != tt.wantWarn {
+				t.Fatalf("warned = %v, want %v (summary %q)", got, tt.wantWarn, summary.String())
+			}
+			if tt.wantWarn && !strings.Contains(summary.String(), "300.0 MiB allocated") {
+				t.Errorf("unexpected summary: %q", summary.String())
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{50 * 1024 * 1024, "50.0 MiB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSizeSummary(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config_dump.json"), make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stats.json"), []byte("ok"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "snap.tar.gz")
+	sink, err := newTarGzFileSink(archive, "", false)
+	bundleStaged(t, sink, err, dir)
+
+	got, err := sizeSummary(dir, archive)
+	if err != nil {
+		t.Fatalf("sizeSummary() error: %v", err)
+	}
+	for _, want := range []string{"config_dump.json", "2.0 KiB", "stats.json", "2 B", "total", "2.0 KiB", "archive"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sizeSummary() missing %q:\n%s", want, got)
+		}
+	}
+}
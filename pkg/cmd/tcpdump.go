@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// DefaultTcpdumpFiles is how many rotated pcap files --tcpdump-max-size keeps
+// when --tcpdump-files is not given.
+const DefaultTcpdumpFiles = 5
+
+// DefaultTcpdumpInterface is the interface tcpdump captures on when
+// --tcpdump-interface is not given: every interface.
+const DefaultTcpdumpInterface = "any"
+
+// tcpdumpInterfaceName matches the interface names --tcpdump-interface
+// accepts, so the name can be put in a shell command unquoted.
+var tcpdumpInterfaceName = regexp.MustCompile(`^[A-Za-z0-9_.:@-]+$`)
+
+// tcpdumpRotation makes tcpdump write a ring buffer of files of at most
+// maxBytes each inside the task, keeping the newest files. A zero maxBytes
+// streams a single unbounded capture instead.
+type tcpdumpRotation struct {
+	maxBytes int64
+	files    int
+}
+
+// sizeMB returns maxBytes in tcpdump's -C units of 1,000,000 bytes, rounded
+// up.
+func (r tcpdumpRotation) sizeMB() int64 {
+	mb := (r.maxBytes + 999999) / 1000000
+	if mb < 1 {
+		mb = 1
+	}
+	return mb
+}
+
+// pcapFile is one packet capture saved into the snapshot.
+type pcapFile struct {
+	name string
+	data []byte
+}
+
+// rotatedPcapMarker starts each rotated file in the command's output.
+const rotatedPcapMarker = "==> "
+
+// tcpdumpCommand returns the command run in the task to capture on iface.
+// Without rotation the
+// capture is streamed as base64; with it the ring buffer is written under
+// /tmp, then each remaining file is printed oldest first, as a marker line
+// and its base64, and removed.
+func tcpdumpCommand(durationSecs int, iface string, rotation tcpdumpRotation) []string {
+	if rotation.maxBytes <= 0 {
+		return []string{"sh", "-c", fmt.Sprintf("timeout %d tcpdump -i %s -s0 -w - 2>/dev/null | base64", durationSecs, iface)}
+	}
+	script := fmt.Sprintf(`dir=/tmp/xdsnap-pcap-$$; mkdir -p "$dir" || exit 1
+timeout %d tcpdump -i %s -s0 -C %d -W %d -w "$dir/capture.pcap" 2>/dev/null
+for f in $(ls -tr "$dir"); do echo "%s$f"; base64 "$dir/$f"; done
+rm -rf "$dir"`, durationSecs, iface, rotation.sizeMB(), rotation.files, rotatedPcapMarker)
+	return []string{"sh", "-c", script}
+}
+
+var base64Junk = regexp.MustCompile(`[^A-Za-z0-9+/=]`)
+
+func decodeBase64Capture(raw string) ([]byte, error) {
+	clean := base64Junk.ReplaceAllString(strings.TrimSpace(raw), "")
+	if clean == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(clean)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 tcpdump stream: %w", err)
+	}
+	return data, nil
+}
+
+// parseTcpdumpOutput decodes the output of tcpdumpCommand. Rotated files are
+// named capture_01.pcap, capture_02.pcap, ... from oldest to newest.
+func parseTcpdumpOutput(out []byte, rotation tcpdumpRotation) ([]pcapFile, error) {
+	if rotation.maxBytes <= 0 {
+		data, err := decodeBase64Capture(string(out))
+		if err != nil || len(data) == 0 {
+			return nil, err
+		}
+		return []pcapFile{{name: "capture.pcap", data: data}}, nil
+	}
+
+	var encoded []*strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, rotatedPcapMarker) {
+			encoded = append(encoded, &strings.Builder{})
+			continue
+		}
+		if len(encoded) > 0 {
+			encoded[len(encoded)-1].WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tcpdump output: %w", err)
+	}
+
+	var files []pcapFile
+	for _, b := range encoded {
+		data, err := decodeBase64Capture(b.String())
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		files = append(files, pcapFile{name: fmt.Sprintf("capture_%02d.pcap", len(files)+1), data: data})
+	}
+	return files, nil
+}
+
+// tcpdumpCheckMarker separates the sections of tcpdumpCheckCommand's output.
+const tcpdumpCheckMarker = "==> "
+
+// tcpdumpCheckCommand returns a quick command that lists the interfaces
+// tcpdump can see (tcpdump -D) and opens iface for at most two seconds, so a
+// missing interface or capability fails before the full capture runs.
+func tcpdumpCheckCommand(iface string) []string {
+	script := fmt.Sprintf(`command -v tcpdump >/dev/null 2>&1 || { echo "tcpdump: not found" >&2; exit 127; }
+tcpdump -D 2>/dev/null
+echo "%sopen"
+timeout 2 tcpdump -i %s -c 1 -s0 -w /dev/null 2>&1
+echo "%sexit $?"`, tcpdumpCheckMarker, iface, tcpdumpCheckMarker)
+	return []string{"sh", "-c", script}
+}
+
+// checkTcpdump runs the tcpdump check in each of tasks, which share the
+// network namespace, and returns the first task tcpdump is installed in. The
+// error says why tcpdump can't capture there, or that no task has it.
+func checkTcpdump(nomadService nomad.NomadApiService, allocID string, tasks []string, iface string) (string, error) {
+	for _, task := range tasks {
+		var stdout, stderr bytes.Buffer
+		code, err := nomadService.ExecuteCommandWithStderr(allocID, task, tcpdumpCheckCommand(iface), &stdout, &stderr)
+		if code == 127 || (err != nil && strings.Contains(err.Error(), "not found")) {
+			log.Printf("tcpdump/sh not available in task %q, trying next task...", task)
+			continue
+		}
+		if err != nil {
+			return task, fmt.Errorf("tcpdump check failed in task %q: %w (stderr: %s)", task, err, stderr.String())
+		}
+		if err := checkTcpdumpOutput(stdout.Bytes(), iface); err != nil {
+			return task, fmt.Errorf("not running tcpdump in task %q: %w", task, err)
+		}
+		return task, nil
+	}
+	return "", fmt.Errorf("tcpdump not available in any task (tried: %s)", strings.Join(tasks, ", "))
+}
+
+// checkTcpdumpOutput reads the output of tcpdumpCheckCommand and returns why
+// tcpdump can't capture on iface, or nil when it can.
+func checkTcpdumpOutput(out []byte, iface string) error {
+	var interfaces, opened []string
+	section, exit := "", ""
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if rest, ok := strings.CutPrefix(line, tcpdumpCheckMarker); ok {
+			section = rest
+			if code, ok := strings.CutPrefix(rest, "exit "); ok {
+				exit = code
+			}
+			continue
+		}
+		switch section {
+		case "":
+			// tcpdump -D lines look like "1.eth0 [Up, Running]" or "2.any (Pseudo-device ...)"
+			if _, name, ok := strings.Cut(line, "."); ok {
+				if name, _, _ = strings.Cut(name, " "); name != "" {
+					interfaces = append(interfaces, name)
+				}
+			}
+		case "open":
+			if line = strings.TrimSpace(line); line != "" {
+				opened = append(opened, line)
+			}
+		}
+	}
+	msg := strings.Join(opened, "; ")
+
+	if iface != DefaultTcpdumpInterface && len(interfaces) > 0 && !containsString(interfaces, iface) {
+		return fmt.Errorf("tcpdump interface %q does not exist in the task (available: %s)", iface, strings.Join(interfaces, ", "))
+	}
+	// timeout exits 124 when the interface opened but no packet arrived
+	switch exit {
+	case "0", "124":
+		return nil
+	case "":
+		return fmt.Errorf("tcpdump check did not finish: %s", msg)
+	}
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "permission") || strings.Contains(lower, "not permitted"):
+		return fmt.Errorf("tcpdump lacks permission to capture on %s; the task needs the NET_RAW and NET_ADMIN capabilities (%s)", iface, msg)
+	case strings.Contains(lower, "no such device") || strings.Contains(lower, "doesn't exist"):
+		return fmt.Errorf("tcpdump interface %q does not exist in the task (%s)", iface, msg)
+	}
+	return fmt.Errorf("tcpdump cannot capture on %s (exit %s): %s", iface, exit, msg)
+}
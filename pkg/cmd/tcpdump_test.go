@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTcpdumpRotationSizeMB(t *testing.T) {
+	tests := []struct {
+		maxBytes int64
+		want     int64
+	}{
+		{1, 1},
+		{1000000, 1},
+		{1000001, 2},
+		{50 << 20, 53},
+	}
+	for _, tt := range tests {
+		if got := (tcpdumpRotation{maxBytes: tt.maxBytes}).sizeMB(); got != tt.want {
+			t.Errorf("sizeMB(%d) = %d, want %d", tt.maxBytes, got, tt.want)
+		}
+	}
+}
+
+func TestTcpdumpCommand(t *testing.T) {
+	streamed := tcpdumpCommand(30, "any", tcpdumpRotation{})
+	if want := "timeout 30 tcpdump -i any -s0 -w - 2>/dev/null | base64"; streamed[2] != want {
+		t.Errorf("streamed command = %q, want %q", streamed[2], want)
+	}
+
+	rotated := tcpdumpCommand(30, "eth0", tcpdumpRotation{maxBytes: 10 << 20, files: 3})
+	for _, want := range []string{
+		`timeout 30 tcpdump -i eth0 -s0 -C 11 -W 3 -w "$dir/capture.pcap"`,
+		`ls -tr "$dir"`,
+		`rm -rf "$dir"`,
+	} {
+		if !strings.Contains(rotated[2], want) {
+			t.Errorf("rotated command missing %q:\n%s", want, rotated[2])
+		}
+	}
+}
+
+func TestParseTcpdumpOutput(t *testing.T) {
+	enc := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name     string
+		out      string
+		rotation tcpdumpRotation
+		want     []pcapFile
+	}{
+		{
+			name: "streamed",
+			out:  enc("packets") + "\r\n",
+			want: []pcapFile{{name: "capture.pcap", data: []byte("packets")}},
+		},
+		{
+			name: "streamed empty",
+			out:  "\n",
+		},
+		{
+			name:     "rotated oldest first",
+			out:      "==> capture.pcap2\n" + enc("oldest") + "\n==> capture.pcap0\n" + enc("newest") + "\n",
+			rotation: tcpdumpRotation{maxBytes: 1, files: 3},
+			want: []pcapFile{
+				{name: "capture_01.pcap", data: []byte("oldest")},
+				{name: "capture_02.pcap", data: []byte("newest")},
+			},
+		},
+		{
+			name:     "rotated skips empty files",
+			out:      "==> capture.pcap0\n==> capture.pcap1\n" + enc("data") + "\n",
+			rotation: tcpdumpRotation{maxBytes: 1, files: 2},
+			want:     []pcapFile{{name: "capture_01.pcap", data: []byte("data")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTcpdumpOutput([]byte(tt.out), tt.rotation)
+			if err != nil {
+				t.Fatalf("parseTcpdumpOutput() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTcpdumpOutput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseTcpdumpOutput([]byte("==> capture.pcap0\n!!!notbase64=x=\n"), tcpdumpRotation{maxBytes: 1, files: 1}); err == nil {
+		t.Error("parseTcpdumpOutput() accepted corrupt base64")
+	}
+}
+
+func TestCheckTcpdumpOutput(t *testing.T) {
+	const listing = "1.eth0 [Up, Running]\n2.any (Pseudo-device that captures on all interfaces) [Up, Running]\n3.lo [Up, Running, Loopback]\n"
+	tests := []struct {
+		name    string
+		out     string
+		iface   string
+		wantErr string
+	}{
+		{
+			name:  "no packet before the timeout",
+			out:   listing + "==> open\ntcpdump: listening on eth0\n==> exit 124\n",
+			iface: "eth0",
+		},
+		{
+			name:  "one packet",
+			out:   listing + "==> open\n1 packet captured\n==> exit 0\n",
+			iface: "any",
+		},
+		{
+			name:    "missing interface",
+			out:     listing + "==> open\ntcpdump: eth1: No such device exists\n==> exit 1\n",
+			iface:   "eth1",
+			wantErr: `tcpdump interface "eth1" does not exist in the task (available: eth0, any, lo)`,
+		},
+		{
+			name:    "missing interface without a listing",
+			out:     "==> open\ntcpdump: eth1: No such device exists\n==> exit 1\n",
+			iface:   "eth1",
+			wantErr: `tcpdump interface "eth1" does not exist in the task`,
+		},
+		{
+			name:    "no capability",
+			out:     "==> open\ntcpdump: any: You don't have permission to capture on that device\n(socket: Operation not permitted)\n==> exit 1\n",
+			iface:   "any",
+			wantErr: "tcpdump lacks permission to capture on any; the task needs the NET_RAW and NET_ADMIN capabilities",
+		},
+		{
+			name:    "other failure",
+			out:     listing + "==> open\ntcpdump: something broke\n==> exit 2\n",
+			iface:   "eth0",
+			wantErr: "tcpdump cannot capture on eth0 (exit 2): tcpdump: something broke",
+		},
+		{
+			name:    "cut short",
+			out:     listing + "==> open\n",
+			iface:   "eth0",
+			wantErr: "tcpdump check did not finish",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTcpdumpOutput([]byte(tt.out), tt.iface)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkTcpdumpOutput() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkTcpdumpOutput() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTcpdumpInterfaceName(t *testing.T) {
+	for name, want := range map[string]bool{"any": true, "eth0": true, "eth0.100": true, "veth@if4": true, "": false, "eth0; rm -rf /": false, "$(id)": false} {
+		if got := tcpdumpInterfaceName.MatchString(name); got != want {
+			t.Errorf("tcpdumpInterfaceName.MatchString(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
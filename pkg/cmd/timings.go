@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// phaseTiming is how long one phase of a capture run took.
+type phaseTiming struct {
+	Alloc    string // allocation the phase belongs to; "" for run-wide phases such as discovery
+	Phase    string
+	Duration time.Duration
+}
+
+// captureTimings collects the phase durations reported by --timings. A nil
+// collector records nothing.
+type captureTimings struct {
+	mu     sync.Mutex
+	phases []phaseTiming
+}
+
+func (t *captureTimings) record(alloc, phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, phaseTiming{Alloc: alloc, Phase: phase, Duration: d})
+}
+
+// start times a phase until the returned func is called.
+func (t *captureTimings) start(alloc, phase string) func() {
+	if t == nil {
+		return func() {}
+	}
+	began := time.Now()
+	return func() { t.record(alloc, phase, time.Since(began)) }
+}
+
+// endpointPhase names a per-endpoint phase, with the admin port when more
+// than one is captured.
+func endpointPhase(config SnapshotConfig, phase string) string {
+	if len(config.AdminPorts) > 1 {
+		return fmt.Sprintf("%s (port %d)", phase, config.adminPort())
+	}
+	return phase
+}
+
+// forAlloc returns a collector for one capture of allocID, starting with the
+// run-wide phases and those recorded for allocID so far.
+func (t *captureTimings) forAlloc(allocID string) *captureTimings {
+	if t == nil {
+		return nil
+	}
+	seeded := &captureTimings{}
+	for _, p := range t.list() {
+		if p.Alloc == "" || p.Alloc == allocID {
+			seeded.phases = append(seeded.phases, p)
+		}
+	}
+	return seeded
+}
+
+func (t *captureTimings) list() []phaseTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]phaseTiming(nil), t.phases...)
+}
+
+// print writes the phases as a table, run-wide ones marked "(run)", the
+// slowest phase and the total time of the capture.
+func (t *captureTimings) print(w io.Writer, total time.Duration) {
+	phases := t.list()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tDURATION")
+	var slowest phaseTiming
+	for _, p := range phases {
+		name := p.Phase
+		if p.Alloc == "" {
+			name += " (run)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, p.Duration.Round(time.Millisecond))
+		if p.Duration > slowest.Duration {
+			slowest = p
+		}
+	}
+	tw.Flush()
+	if slowest.Phase != "" {
+		fmt.Fprintf(w, "Slowest phase: %s (%s)\n", slowest.Phase, slowest.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "Capture total: %s\n", total.Round(time.Millisecond))
+}
+
+// write saves the table to path.
+func (t *captureTimings) write(path string, total time.Duration) error {
+	var b strings.Builder
+	t.print(&b, total)
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// log prints the phases on one line for the allocation.
+func (t *captureTimings) log(alloc string, total time.Duration) {
+	phases := t.list()
+	if len(phases) == 0 {
+		return
+	}
+	parts := make([]string, 0, len(phases))
+	for _, p := range phases {
+		parts = append(parts, fmt.Sprintf("%s=%s", p.Phase, p.Duration.Round(time.Millisecond)))
+	}
+	log.Printf("Capture timings for %s (total %s): %s", alloc, total.Round(time.Millisecond), strings.Join(parts, ", "))
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureTimingsForAlloc(t *testing.T) {
+	run := &captureTimings{}
+	run.record("", "discovery", 1200*time.Millisecond)
+	run.record("alloc-a", "exec strategy", 300*time.Millisecond)
+	run.record("alloc-b", "exec strategy", 500*time.Millisecond)
+
+	capture := run.forAlloc("alloc-a")
+	capture.record("alloc-a", "fetch /stats", 80*time.Millisecond)
+	want := []phaseTiming{
+		{Phase: "discovery", Duration: 1200 * time.Millisecond},
+		{Alloc: "alloc-a", Phase: "exec strategy", Duration: 300 * time.Millisecond},
+		{Alloc: "alloc-a", Phase: "fetch /stats", Duration: 80 * time.Millisecond},
+	}
+	if got := capture.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("forAlloc() phases = %+v, want %+v", got, want)
+	}
+	if n := len(run.list()); n != 3 {
+		t.Errorf("recording a capture phase changed the run's phases: %d", n)
+	}
+
+	var out bytes.Buffer
+	capture.print(&out, 2*time.Second)
+	for _, want := range []string{
+		"PHASE            DURATION\n",
+		"discovery (run)  1.2s\n",
+		"exec strategy    300ms\n",
+		"Slowest phase: discovery (1.2s)\n",
+		"Capture total: 2s\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("print() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCaptureTimingsNil(t *testing.T) {
+	var timings *captureTimings
+	timings.start("alloc-a", "fetch /stats")()
+	timings.record("", "discovery", time.Second)
+	if timings.forAlloc("alloc-a") != nil || timings.list() != nil {
+		t.Error("a nil collector recorded phases")
+	}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// trustBundleExpiryWarning is how close to expiry a trusted CA is flagged in
+// the capture summary.
+const trustBundleExpiryWarning = 30 * 24 * time.Hour
+
+// trustedCAs returns the CA certificates Envoy validates peers against: every
+// validation_context.trusted_ca in the config dump, be it in a cluster or
+// listener TLS context or an SDS secret, de-duplicated and sorted by
+// subject.
+func trustedCAs(configDump []byte) ([]*x509.Certificate, error) {
+	var dump interface{}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse /config_dump: %w", err)
+	}
+	seen := make(map[[32]byte]bool)
+	var certs []*x509.Certificate
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ca, ok := v["trusted_ca"].(map[string]interface{}); ok {
+				for _, c := range parsePEMCerts(dataSourceBytes(ca)) {
+					if sum := sha256.Sum256(c.Raw); !seen[sum] {
+						seen[sum] = true
+						certs = append(certs, c)
+					}
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(dump)
+	sort.Slice(certs, func(i, j int) bool {
+		a, b := certs[i].Subject.String(), certs[j].Subject.String()
+		if a != b {
+			return a < b
+		}
+		return certs[i].NotAfter.Before(certs[j].NotAfter)
+	})
+	return certs, nil
+}
+
+// dataSourceBytes returns the inline content of an Envoy DataSource:
+// inline_string, or inline_bytes, which the JSON form base64-encodes.
+// Filenames can't be read from outside the task and give nothing.
+func dataSourceBytes(source map[string]interface{}) []byte {
+	if s, ok := source["inline_string"].(string); ok {
+		return []byte(s)
+	}
+	if s, ok := source["inline_bytes"].(string); ok {
+		if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// parsePEMCerts returns the certificates in PEM data, skipping blocks that
+// don't parse.
+func parsePEMCerts(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+}
+
+// spiffeTrustDomain returns the trust domain of the certificate's spiffe://
+// URI SAN, e.g. 11111111-2222-3333-4444-555555555555.consul for a Consul CA,
+// or "" when it has none.
+func spiffeTrustDomain(c *x509.Certificate) string {
+	for _, u := range c.URIs {
+		if u.Scheme == "spiffe" {
+			return u.Host
+		}
+	}
+	return ""
+}
+
+// caNote flags a CA that is expired, not yet valid or close to expiry at now.
+func caNote(c *x509.Certificate, now time.Time) string {
+	switch {
+	case now.After(c.NotAfter):
+		return "EXPIRED"
+	case now.Before(c.NotBefore):
+		return "NOT YET VALID"
+	case c.NotAfter.Sub(now) < trustBundleExpiryWarning:
+		return fmt.Sprintf("expires in %s", formatDays(c.NotAfter.Sub(now)))
+	}
+	return ""
+}
+
+// formatDays renders d in whole days, or hours below a day.
+func formatDays(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// printTrustBundle writes a table of the trusted CAs.
+func printTrustBundle(w io.Writer, certs []*x509.Certificate, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBJECT\tTRUST DOMAIN\tNOT BEFORE\tNOT AFTER\tNOTE")
+	for _, c := range certs {
+		domain := spiffeTrustDomain(c)
+		if domain == "" {
+			domain = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Subject, domain,
+			c.NotBefore.UTC().Format(time.RFC3339), c.NotAfter.UTC().Format(time.RFC3339), caNote(c, now))
+	}
+	tw.Flush()
+}
+
+// trustBundleFindings reports trusted CAs that are expired, not yet valid
+// or close to expiry, and proxies that trust more than one trust domain.
+func trustBundleFindings(certs []*x509.Certificate, now time.Time) []string {
+	var findings []string
+	domains := make(map[string]bool)
+	for _, c := range certs {
+		if note := caNote(c, now); note != "" {
+			findings = append(findings, fmt.Sprintf("trusted CA %q %s (not after %s)", c.Subject.String(), strings.ToLower(note), c.NotAfter.UTC().Format(time.RFC3339)))
+		}
+		if d := spiffeTrustDomain(c); d != "" {
+			domains[d] = true
+		}
+	}
+	if len(domains) > 1 {
+		names := make([]string, 0, len(domains))
+		for d := range domains {
+			names = append(names, d)
+		}
+		sort.Strings(names)
+		findings = append(findings, fmt.Sprintf("trust bundle spans %d SPIFFE trust domains: %s", len(names), strings.Join(names, ", ")))
+	}
+	return findings
+}
+
+// writeTrustBundle saves the trusted CAs of a config dump into dir as
+// trust_bundle.pem and their decoded summary as trust_bundle.txt. It
+// returns the CAs found.
+func writeTrustBundle(configDump []byte, dir string, now time.Time) ([]*x509.Certificate, error) {
+	certs, err := trustedCAs(configDump)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	var bundle bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	if err := os.WriteFile(filepath.Join(dir, "trust_bundle.pem"), bundle.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write trust bundle: %w", err)
+	}
+	var summary bytes.Buffer
+	printTrustBundle(&summary, certs, now)
+	if err := os.WriteFile(filepath.Join(dir, "trust_bundle.txt"), summary.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write trust bundle summary: %w", err)
+	}
+	return certs, nil
+}
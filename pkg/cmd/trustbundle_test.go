@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA returns a self-signed CA certificate in PEM form.
+func testCA(t *testing.T, cn, trustDomain string, notBefore, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	if trustDomain != "" {
+		tmpl.URIs = []*url.URL{{Scheme: "spiffe", Host: trustDomain}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestTrustedCAs(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	primary := testCA(t, "Consul CA 7", "1111.consul", now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0))
+	peer := testCA(t, "Peer CA", "2222.consul", now.AddDate(-1, 0, 0), now.AddDate(0, 0, 10))
+
+	// The primary CA is in a cluster and a listener; the peer's is an SDS
+	// secret given as inline_bytes
+	dump := map[string]interface{}{"configs": []interface{}{
+		map[string]interface{}{"dynamic_active_clusters": []interface{}{map[string]interface{}{"cluster": map[string]interface{}{
+			"transport_socket": map[string]interface{}{"typed_config": map[string]interface{}{"common_tls_context": map[string]interface{}{
+				"validation_context": map[string]interface{}{"trusted_ca": map[string]interface{}{"inline_string": primary + peer}},
+			}}},
+		}}}},
+		map[string]interface{}{"dynamic_listeners": []interface{}{map[string]interface{}{
+			"validation_context": map[string]interface{}{"trusted_ca": map[string]interface{}{"inline_string": primary}},
+		}}},
+		map[string]interface{}{"dynamic_active_secrets": []interface{}{map[string]interface{}{"secret": map[string]interface{}{
+			"validation_context": map[string]interface{}{"trusted_ca": map[string]interface{}{"inline_bytes": base64.StdEncoding.EncodeToString([]byte(peer))}},
+		}}}},
+		map[string]interface{}{"static_clusters": []interface{}{map[string]interface{}{
+			"validation_context": map[string]interface{}{"trusted_ca": map[string]interface{}{"filename": "/etc/ssl/ca.pem"}},
+		}}},
+	}}
+	data, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := trustedCAs(data)
+	if err != nil {
+		t.Fatalf("trustedCAs() error: %v", err)
+	}
+	var subjects, domains []string
+	for _, c := range certs {
+		subjects = append(subjects, c.Subject.CommonName)
+		domains = append(domains, spiffeTrustDomain(c))
+	}
+	if want := []string{"Consul CA 7", "Peer CA"}; !reflect.DeepEqual(subjects, want) {
+		t.Fatalf("trustedCAs() subjects = %v, want %v", subjects, want)
+	}
+	if want := []string{"1111.consul", "2222.consul"}; !reflect.DeepEqual(domains, want) {
+		t.Errorf("trust domains = %v, want %v", domains, want)
+	}
+
+	wantFindings := []string{
+		`trusted CA "CN=Peer CA" expires in 10d (not after 2026-10-11T00:00:00Z)`,
+		"trust bundle spans 2 SPIFFE trust domains: 1111.consul, 2222.consul",
+	}
+	if got := trustBundleFindings(certs, now); !reflect.DeepEqual(got, wantFindings) {
+		t.Errorf("trustBundleFindings() = %q, want %q", got, wantFindings)
+	}
+
+	dir := t.TempDir()
+	if _, err := writeTrustBundle(data, dir, now.AddDate(0, 0, 20)); err != nil {
+		t.Fatalf("writeTrustBundle() error: %v", err)
+	}
+	bundle, err := os.ReadFile(filepath.Join(dir, "trust_bundle.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(parsePEMCerts(bundle)); n != 2 {
+		t.Errorf("trust_bundle.pem has %d certificates, want 2", n)
+	}
+	summary, err := os.ReadFile(filepath.Join(dir, "trust_bundle.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"SUBJECT         TRUST DOMAIN  NOT BEFORE",
+		"CN=Consul CA 7  1111.consul   2025-10-01T00:00:00Z  2027-10-01T00:00:00Z  \n",
+		"CN=Peer CA      2222.consul   2025-10-01T00:00:00Z  2026-10-11T00:00:00Z  EXPIRED\n",
+	} {
+		if !strings.Contains(string(summary), want) {
+			t.Errorf("trust_bundle.txt missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestCANote(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		want      string
+	}{
+		{"valid", now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0), ""},
+		{"expired", now.AddDate(-1, 0, 0), now.Add(-time.Minute), "EXPIRED"},
+		{"not yet valid", now.Add(time.Hour), now.AddDate(1, 0, 0), "NOT YET VALID"},
+		{"expires soon", now.AddDate(-1, 0, 0), now.AddDate(0, 0, 3), "expires in 3d"},
+		{"expires today", now.AddDate(-1, 0, 0), now.Add(5 * time.Hour), "expires in 5h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parsePEMCerts([]byte(testCA(t, "CA", "", tt.notBefore, tt.notAfter)))[0]
+			if got := caNote(c, now); got != tt.want {
+				t.Errorf("caNote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedCAsEmpty(t *testing.T) {
+	certs, err := trustedCAs([]byte(`{"configs":[{"static_clusters":[]}]}`))
+	if err != nil || len(certs) != 0 {
+		t.Errorf("trustedCAs() = %v, %v; want no certificates", certs, err)
+	}
+	if _, err := trustedCAs([]byte("not json")); err == nil {
+		t.Error("trustedCAs() accepted an invalid config dump")
+	}
+	if certs, err := writeTrustBundle([]byte(`{}`), t.TempDir(), time.Now()); err != nil || certs != nil {
+		t.Errorf("writeTrustBundle() without CAs = %v, %v", certs, err)
+	}
+}
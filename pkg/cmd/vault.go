@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultRef names one field of a Vault secret, written path#field, e.g.
+// secret/data/nomad#token.
+type vaultRef struct {
+	path  string
+	field string
+}
+
+func parseVaultRef(s string) (vaultRef, error) {
+	path, field, ok := strings.Cut(s, "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || field == "" {
+		return vaultRef{}, fmt.Errorf("invalid Vault reference %q: expected <path>#<field>, e.g. secret/data/nomad#token", s)
+	}
+	return vaultRef{path: path, field: field}, nil
+}
+
+func (r vaultRef) String() string {
+	return r.path + "#" + r.field
+}
+
+// vaultClient reads secrets over Vault's HTTP API.
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// newVaultClientFromEnv configures a client the way the vault CLI does:
+// VAULT_ADDR (default https://127.0.0.1:8200), VAULT_TOKEN or else
+// ~/.vault-token, VAULT_NAMESPACE, VAULT_CACERT and VAULT_SKIP_VERIFY.
+func newVaultClientFromEnv(timeout time.Duration) (*vaultClient, error) {
+	c := &vaultClient{
+		addr:      strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		token:     os.Getenv("VAULT_TOKEN"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if c.addr == "" {
+		c.addr = "https://127.0.0.1:8200"
+	}
+	if c.token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				c.token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if c.token == "" {
+		return nil, fmt.Errorf("no Vault token: set VAULT_TOKEN or log in with vault login")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: os.Getenv("VAULT_SKIP_VERIFY") == "true"}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read VAULT_CACERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("VAULT_CACERT %s contains no certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	c.http = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	return c, nil
+}
+
+// read returns the string field named by ref. Both KV version 1 secrets and
+// KV version 2 secrets (read through their data/ path) are understood.
+func (c *vaultClient) read(ref vaultRef) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.addr+"/v1/"+(&url.URL{Path: ref.path}).EscapedPath(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from Vault: %w", ref.path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read %s from Vault: HTTP %d", ref.path, resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode Vault secret %s: %w", ref.path, err)
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = nested
+		}
+	}
+	value, ok := data[ref.field]
+	if !ok {
+		return "", fmt.Errorf("secret %s in Vault has no field %q", ref.path, ref.field)
+	}
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("field %s in Vault is not a non-empty string", ref)
+	}
+	return s, nil
+}
+
+// loadVaultTokens reads the Nomad and Consul tokens named by the
+// --nomad-token-vault and --consul-token-vault references into NOMAD_TOKEN
+// and CONSUL_HTTP_TOKEN, where the API clients pick them up. Empty references
+// are skipped.
+func loadVaultTokens(nomadRef, consulRef string, timeout time.Duration) error {
+	targets := []struct{ flag, ref, env string }{
+		{"--nomad-token-vault", nomadRef, "NOMAD_TOKEN"},
+		{"--consul-token-vault", consulRef, "CONSUL_HTTP_TOKEN"},
+	}
+	var client *vaultClient
+	for _, t := range targets {
+		if t.ref == "" {
+			continue
+		}
+		ref, err := parseVaultRef(t.ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.flag, err)
+		}
+		if client == nil {
+			if client, err = newVaultClientFromEnv(timeout); err != nil {
+				return err
+			}
+		}
+		token, err := client.read(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.flag, err)
+		}
+		if err := os.Setenv(t.env, token); err != nil {
+			return fmt.Errorf("%s: %w", t.flag, err)
+		}
+	}
+	return nil
+}
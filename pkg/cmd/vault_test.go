@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVaultRef(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    vaultRef
+		wantErr bool
+	}{
+		{"secret/data/nomad#token", vaultRef{path: "secret/data/nomad", field: "token"}, false},
+		{"/kv/consul/#secret_id", vaultRef{path: "kv/consul", field: "secret_id"}, false},
+		{"secret/data/nomad", vaultRef{}, true},
+		{"#token", vaultRef{}, true},
+		{"secret/data/nomad#", vaultRef{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseVaultRef(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVaultRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseVaultRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultClientRead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "ops" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/nomad":
+			w.Write([]byte(`{"data":{"data":{"token":"nomad-secret"},"metadata":{"version":3}}}`))
+		case "/v1/kv/consul":
+			w.Write([]byte(`{"data":{"token":"consul-secret","ttl":60}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := &vaultClient{addr: srv.URL, token: "root", namespace: "ops", http: srv.Client()}
+
+	tests := []struct {
+		ref     vaultRef
+		want    string
+		wantErr string
+	}{
+		{vaultRef{"secret/data/nomad", "token"}, "nomad-secret", ""},
+		{vaultRef{"kv/consul", "token"}, "consul-secret", ""},
+		{vaultRef{"kv/consul", "ttl"}, "", "not a non-empty string"},
+		{vaultRef{"secret/data/nomad", "secret_id"}, "", `no field "secret_id"`},
+		{vaultRef{"secret/data/missing", "token"}, "", "HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref.String(), func(t *testing.T) {
+			got, err := client.read(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("read() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadVaultTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"data":{"token":"from-vault"},"metadata":{}}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("NOMAD_TOKEN", "from-env")
+	t.Setenv("CONSUL_HTTP_TOKEN", "from-env")
+
+	if err := loadVaultTokens("secret/data/nomad#token", "", time.Second); err != nil {
+		t.Fatalf("loadVaultTokens() error = %v", err)
+	}
+	if got := os.Getenv("NOMAD_TOKEN"); got != "from-vault" {
+		t.Errorf("NOMAD_TOKEN = %q, want from-vault", got)
+	}
+	if got := os.Getenv("CONSUL_HTTP_TOKEN"); got != "from-env" {
+		t.Errorf("CONSUL_HTTP_TOKEN = %q, want it left alone", got)
+	}
+}
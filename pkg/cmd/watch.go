@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/markcampv/xDSnap/nomad"
+)
+
+// watchStat samples a single Envoy stat every config.WatchInterval for
+// config.WatchDuration and writes the samples as "timestamp,value" rows to
+// csvPath. Samples where the stat could not be read are recorded with an
+// empty value so gaps remain visible when plotting. Sampling stops at the
+// first failed write, e.g. when the disk is full, and the error is returned.
+func watchStat(nomadService nomad.NomadApiService, config SnapshotConfig, csvPath string) (err error) {
+	f, err := os.Create(csvPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", csvPath, err)
+	}
+	w := bufio.NewWriter(f)
+	defer func() {
+		if flushErr := w.Flush(); err == nil && flushErr != nil {
+			err = fmt.Errorf("failed to write %s: %w", csvPath, flushErr)
+		}
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write %s: %w", csvPath, closeErr)
+		}
+	}()
+	if _, err := fmt.Fprintln(w, "timestamp,value"); err != nil {
+		return fmt.Errorf("failed to write %s: %w", csvPath, err)
+	}
+
+	endpoint := "/stats?filter=" + url.QueryEscape("^"+regexp.QuoteMeta(config.WatchStat)+"$")
+	deadline := time.Now().Add(config.WatchDuration)
+	samples := 0
+
+	for {
+		ts := time.Now().UTC().Format(time.RFC3339)
+		value := ""
+		data, err := fetchEnvoyEndpoint(nomadService, config, endpoint)
+		if err != nil {
+			log.Printf("watch-stat: failed to fetch %s: %v", config.WatchStat, err)
+		} else if v, ok := parseStatValue(data, config.WatchStat); ok {
+			value = v
+		} else {
+			log.Printf("watch-stat: stat %s not found for alloc %s", config.WatchStat, config.AllocID[:8])
+		}
+		if _, err := fmt.Fprintf(w, "%s,%s\n", ts, value); err != nil {
+			return fmt.Errorf("failed to write %s after %d samples: %w", csvPath, samples, err)
+		}
+		samples++
+
+		if time.Now().Add(config.WatchInterval).After(deadline) {
+			break
+		}
+		if !config.Interrupt.sleep(config.WatchInterval) {
+			break
+		}
+	}
+
+	log.Printf("watch-stat: recorded %d samples of %s for alloc %s", samples, config.WatchStat, config.AllocID[:8])
+	return nil
+}
+
+// parseStatValue finds the named stat in Envoy's plain-text /stats output
+// ("name: value" per line) and returns its value.
+func parseStatValue(data []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	prefix := name + ": "
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseStatValue(t *testing.T) {
+	stats := []byte(`cluster.api.default.dc1.internal.consul.upstream_cx_active: 4
+http.public_listener.downstream_cx_active: 12
+http.public_listener.downstream_cx_active_extra: 99
+`)
+
+	tests := []struct {
+		name   string
+		stat   string
+		want   string
+		wantOK bool
+	}{
+		{name: "exact match", stat: "http.public_listener.downstream_cx_active", want: "12", wantOK: true},
+		{name: "does not match longer names", stat: "http.public_listener.downstream_cx", wantOK: false},
+		{name: "cluster stat", stat: "cluster.api.default.dc1.internal.consul.upstream_cx_active", want: "4", wantOK: true},
+		{name: "missing", stat: "server.live", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseStatValue(stats, tt.stat)
+			if ok != tt.wantOK {
+				t.Fatalf("parseStatValue(%q) ok = %v, want %v", tt.stat, ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("parseStatValue(%q) = %q, want %q", tt.stat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchStatWriteErrors(t *testing.T) {
+	const stat = "cluster.api.upstream_cx_active"
+	svc := &probeService{responses: map[string]string{
+		"/stats?filter=" + url.QueryEscape("^"+regexp.QuoteMeta(stat)+"$"): stat + ": 3\n",
+	}}
+	config := SnapshotConfig{AllocID: "abcdef12-3456", WatchStat: stat}
+
+	csvPath := filepath.Join(t.TempDir(), "watch.csv")
+	if err := watchStat(svc, config, csvPath); err != nil {
+		t.Fatalf("watchStat() error: %v", err)
+	}
+	if data, _ := os.ReadFile(csvPath); !strings.HasPrefix(string(data), "timestamp,value\n") || !strings.HasSuffix(string(data), ",3\n") {
+		t.Errorf("watch.csv = %q", data)
+	}
+
+	// /dev/full fails every write with ENOSPC, like a full --temp-dir
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	if err := watchStat(svc, config, "/dev/full"); err == nil || !strings.Contains(err.Error(), "failed to write /dev/full") {
+		t.Errorf("watchStat() into a full disk error = %v, want the write failure", err)
+	}
+}
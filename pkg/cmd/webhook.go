@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// webhookAttempts is how many times an upload is tried before giving up;
+// webhookBackoff is the wait before the first retry, doubled on each retry.
+var (
+	webhookAttempts = 3
+	webhookBackoff  = 2 * time.Second
+)
+
+// webhookTimeout bounds each upload attempt.
+const webhookTimeout = 5 * time.Minute
+
+// webhook POSTs finished snapshot archives to a collection endpoint.
+type webhook struct {
+	url     string
+	headers http.Header
+	client  *http.Client
+}
+
+// newWebhook validates the --webhook URL and --webhook-header values, which
+// are written "Name: value" like curl -H.
+func newWebhook(rawURL string, headers []string) (*webhook, error) {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return nil, fmt.Errorf("webhook URL %q must start with http:// or https://", rawURL)
+	}
+	w := &webhook{url: rawURL, headers: make(http.Header), client: &http.Client{Timeout: webhookTimeout}}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid webhook header %q: expected \"Name: value\"", h)
+		}
+		w.headers.Add(name, value)
+	}
+	return w, nil
+}
+
+// snapshotMetadata describes a capture in the X-Xdsnap-* headers sent with
+// its archive.
+func snapshotMetadata(config SnapshotConfig) map[string]string {
+	meta := map[string]string{
+		"X-Xdsnap-Alloc-Id": config.AllocID,
+		"X-Xdsnap-Snapshot": filepath.Base(config.OutputDir),
+	}
+	if config.TaskName != "" {
+		meta["X-Xdsnap-Task"] = config.TaskName
+	}
+	if config.SidecarTask != "" {
+		meta["X-Xdsnap-Sidecar"] = config.SidecarTask
+	}
+	return meta
+}
+
+// upload POSTs the archive at path with meta as extra headers, retrying
+// network errors, 429 and 5xx responses.
+func (w *webhook) upload(path string, meta map[string]string) error {
+	backoff := webhookBackoff
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		var retry bool
+		if retry, err = w.post(path, meta); err == nil || !retry {
+			break
+		}
+		if attempt < webhookAttempts {
+			log.Printf("Webhook upload of %s failed (attempt %d of %d), retrying in %s: %v",
+				filepath.Base(path), attempt, webhookAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to webhook: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// post makes one upload attempt and reports whether a failure is worth
+// retrying.
+func (w *webhook) post(path string, meta map[string]string) (retry bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, f)
+	if err != nil {
+		return false, err
+	}
+	req.ContentLength = fi.Size()
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	for name, value := range meta {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", archiveContentType(path))
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+func archiveContentType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(path, ".tar"):
+		return "application/x-tar"
+	default:
+		return "application/gzip"
+	}
+}
+
+// uploadSnapshot POSTs the finished archive at location to config.Webhook,
+// when one is set. The local archive is kept either way.
+func uploadSnapshot(config SnapshotConfig, location string) error {
+	if config.Webhook == nil {
+		return nil
+	}
+	if err := config.Webhook.upload(location, snapshotMetadata(config)); err != nil {
+		return err
+	}
+	fmt.Fprintf(config.progress(), "Snapshot for %s uploaded to the webhook\n", config.AllocID[:8])
+	return nil
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		headers []string
+		wantErr bool
+	}{
+		{"https", "https://collector.example.com/upload", nil, false},
+		{"with auth header", "http://10.0.0.1:8080/", []string{"Authorization: Bearer abc:def"}, false},
+		{"no scheme", "collector.example.com", nil, true},
+		{"header without colon", "https://c.example.com", []string{"Authorization Bearer abc"}, true},
+		{"empty header name", "https://c.example.com", []string{": value"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newWebhook(tt.url, tt.headers); (err != nil) != tt.wantErr {
+				t.Errorf("newWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func writeArchive(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "abcdef12_snapshot.tar.gz")
+	if err := os.WriteFile(path, []byte("archive bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWebhookUpload(t *testing.T) {
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got, body = r, string(data)
+	}))
+	defer srv.Close()
+
+	hook, err := newWebhook(srv.URL, []string{"Authorization: Bearer tok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := snapshotMetadata(SnapshotConfig{AllocID: "abcdef12-3456", OutputDir: "/tmp/out/snapshot_1", SidecarTask: "connect-proxy-web"})
+	if err := hook.upload(writeArchive(t), meta); err != nil {
+		t.Fatalf("upload() error = %v", err)
+	}
+	if got.Method != http.MethodPost || body != "archive bytes" {
+		t.Errorf("upload sent %s with body %q", got.Method, body)
+	}
+	for name, want := range map[string]string{
+		"Authorization":       "Bearer tok",
+		"Content-Type":        "application/gzip",
+		"Content-Disposition": `attachment; filename="abcdef12_snapshot.tar.gz"`,
+		"X-Xdsnap-Alloc-Id":   "abcdef12-3456",
+		"X-Xdsnap-Snapshot":   "snapshot_1",
+		"X-Xdsnap-Sidecar":    "connect-proxy-web",
+	} {
+		if v := got.Header.Get(name); v != want {
+			t.Errorf("header %s = %q, want %q", name, v, want)
+		}
+	}
+	if v := got.Header.Get("X-Xdsnap-Task"); v != "" {
+		t.Errorf("X-Xdsnap-Task = %q, want it omitted", v)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	defer func(b time.Duration) { webhookBackoff = b }(webhookBackoff)
+	webhookBackoff = 0
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   string
+	}{
+		{"transient then ok", []int{503, 429, 200}, 3, ""},
+		{"persistent server error", []int{500, 502, 503}, 3, "HTTP 503"},
+		{"client error is final", []int{401}, 1, "HTTP 401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer srv.Close()
+
+			hook, _ := newWebhook(srv.URL, nil)
+			err := hook.upload(writeArchive(t), nil)
+			if calls != tt.wantCalls {
+				t.Errorf("webhook called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("upload() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("upload() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadSnapshot(t *testing.T) {
+	defer func(b time.Duration) { webhookBackoff = b }(webhookBackoff)
+	webhookBackoff = 0
+
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		uploaded, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	archive := writeArchive(t)
+	var progress strings.Builder
+	config := SnapshotConfig{AllocID: "abcdef12-3456", Progress: &progress}
+	if err := uploadSnapshot(config, archive); err != nil || progress.Len() != 0 {
+		t.Errorf("uploadSnapshot() without a webhook = %v, printed %q", err, progress.String())
+	}
+
+	config.Webhook, _ = newWebhook(srv.URL, nil)
+	if err := uploadSnapshot(config, archive); err != nil {
+		t.Fatalf("uploadSnapshot() error = %v", err)
+	}
+	if string(uploaded) != "archive bytes" || !strings.Contains(progress.String(), "uploaded to the webhook") {
+		t.Errorf("uploaded %q, printed %q", uploaded, progress.String())
+	}
+
+	config.Webhook, _ = newWebhook(srv.URL+"/down", nil)
+	err := uploadSnapshot(config, archive)
+	partial := &PartialCaptureError{AllocID: config.AllocID, UploadErr: err}
+	if err == nil || !strings.Contains(partial.Error(), "snapshot for abcdef12 was saved locally but not uploaded") {
+		t.Errorf("failed upload reported as %v", partial)
+	}
+	if _, statErr := os.Stat(archive); statErr != nil {
+		t.Errorf("local archive removed after a failed upload: %v", statErr)
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// workerThread is one Envoy thread's share of the per-worker stats:
+// listener.<prefix>.worker_<n>.* connection counters summed over listeners,
+// and server.<thread>.watchdog_* misses.
+type workerThread struct {
+	Name          string // worker_<n> or main_thread
+	HasConns      bool
+	Active        uint64
+	Total         uint64
+	WatchdogMiss  uint64
+	WatchdogMega  uint64
+	listenerConns map[string]uint64 // active connections by listener stat prefix
+}
+
+// workerStats is the per-thread breakdown of one /stats capture.
+type workerStats struct {
+	Threads   []workerThread
+	Listeners []string // listener stat prefixes with per-worker counters
+}
+
+// summarizeWorkers groups the per-worker stats in a /stats capture by
+// thread, workers in numeric order and main_thread last.
+func summarizeWorkers(stats map[string]uint64) workerStats {
+	threads := make(map[string]*workerThread)
+	thread := func(name string) *workerThread {
+		if threads[name] == nil {
+			threads[name] = &workerThread{Name: name, listenerConns: make(map[string]uint64)}
+		}
+		return threads[name]
+	}
+	listeners := make(map[string]bool)
+
+	for name, v := range stats {
+		switch {
+		case strings.HasPrefix(name, "listener."):
+			// listener.<prefix>.worker_<n>.<stat>, where the prefix may hold dots
+			rest := strings.TrimPrefix(name, "listener.")
+			i := strings.LastIndex(rest, ".worker_")
+			if i < 0 {
+				continue
+			}
+			worker, stat, ok := strings.Cut(rest[i+1:], ".")
+			if !ok || !isWorkerName(worker) {
+				continue
+			}
+			t := thread(worker)
+			switch stat {
+			case "downstream_cx_active":
+				t.HasConns, t.Active = true, t.Active+v
+				t.listenerConns[rest[:i]] += v
+				listeners[rest[:i]] = true
+			case "downstream_cx_total":
+				t.HasConns, t.Total = true, t.Total+v
+			}
+		case strings.HasPrefix(name, "server."):
+			th, stat, ok := strings.Cut(strings.TrimPrefix(name, "server."), ".")
+			if !ok || (th != "main_thread" && !isWorkerName(th)) {
+				continue
+			}
+			switch stat {
+			case "watchdog_miss":
+				thread(th).WatchdogMiss = v
+			case "watchdog_mega_miss":
+				thread(th).WatchdogMega = v
+			}
+		}
+	}
+
+	var ws workerStats
+	for _, t := range threads {
+		ws.Threads = append(ws.Threads, *t)
+	}
+	sort.Slice(ws.Threads, func(i, j int) bool {
+		a, b := ws.Threads[i].Name, ws.Threads[j].Name
+		if (a == "main_thread") != (b == "main_thread") {
+			return b == "main_thread"
+		}
+		na, _ := strconv.Atoi(strings.TrimPrefix(a, "worker_"))
+		nb, _ := strconv.Atoi(strings.TrimPrefix(b, "worker_"))
+		return na < nb
+	})
+	for l := range listeners {
+		ws.Listeners = append(ws.Listeners, l)
+	}
+	sort.Strings(ws.Listeners)
+	return ws
+}
+
+// isWorkerName reports whether s is a worker thread name, worker_<n>.
+func isWorkerName(s string) bool {
+	n := strings.TrimPrefix(s, "worker_")
+	if n == s || n == "" {
+		return false
+	}
+	_, err := strconv.Atoi(n)
+	return err == nil
+}
+
+// hotWorkerFactor is how many times the mean active connections a worker
+// must hold to be flagged as hot.
+const hotWorkerFactor = 2
+
+// isHot reports whether active is at least hotWorkerFactor times the mean
+// of sum spread over workers. Fewer connections than workers can't be
+// spread evenly, so they never make a worker hot.
+func isHot(active, sum uint64, workers int) bool {
+	if workers < 2 || sum < uint64(workers) {
+		return false
+	}
+	return active*uint64(workers) >= hotWorkerFactor*sum
+}
+
+// printWorkers writes a row per thread, flagging hot workers and watchdog
+// misses, then the listeners whose connections are unevenly spread.
+func printWorkers(w io.Writer, ws workerStats) {
+	var workers int
+	var sum uint64
+	for _, t := range ws.Threads {
+		if t.HasConns {
+			workers++
+			sum += t.Active
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "THREAD\tACTIVE CX\tTOTAL CX\tWATCHDOG MISS\tMEGA MISS\tNOTE")
+	for _, t := range ws.Threads {
+		active, total := "-", "-"
+		if t.HasConns {
+			active, total = strconv.FormatUint(t.Active, 10), strconv.FormatUint(t.Total, 10)
+		}
+		var notes []string
+		if t.HasConns && isHot(t.Active, sum, workers) {
+			notes = append(notes, "HOT")
+		}
+		if t.WatchdogMega > 0 {
+			notes = append(notes, "BLOCKED (watchdog mega miss)")
+		} else if t.WatchdogMiss > 0 {
+			notes = append(notes, "watchdog misses")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", t.Name, active, total, t.WatchdogMiss, t.WatchdogMega, strings.Join(notes, ", "))
+	}
+	tw.Flush()
+
+	for _, l := range ws.Listeners {
+		var lsum uint64
+		counts := make([]string, 0, workers)
+		for _, t := range ws.Threads {
+			if t.HasConns {
+				lsum += t.listenerConns[l]
+				counts = append(counts, strconv.FormatUint(t.listenerConns[l], 10))
+			}
+		}
+		for _, t := range ws.Threads {
+			if t.HasConns && isHot(t.listenerConns[l], lsum, workers) {
+				fmt.Fprintf(w, "listener %s is unbalanced: active connections per worker %s\n", l, strings.Join(counts, ", "))
+				break
+			}
+		}
+	}
+}
+
+// analyzeWorkers prints the per-thread breakdown of every /stats capture in
+// snapshot.
+func analyzeWorkers(w io.Writer, snapshot string) error {
+	stats, err := readStatCounters(snapshot)
+	if err != nil {
+		return exitErrorf(ExitNoData, "%w", err)
+	}
+	if len(stats) == 0 {
+		return exitErrorf(ExitNoData, "no /stats output found in %s", snapshot)
+	}
+	dirs := make([]string, 0, len(stats))
+	for dir := range stats {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for i, dir := range dirs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", dir)
+		ws := summarizeWorkers(stats[dir])
+		if len(ws.Threads) == 0 {
+			fmt.Fprintln(w, "no per-worker stats captured")
+			continue
+		}
+		printWorkers(w, ws)
+	}
+	return nil
+}
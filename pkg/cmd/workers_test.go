@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeWorkers(t *testing.T) {
+	stats := map[string]uint64{
+		"listener.0.0.0.0_21000.worker_0.downstream_cx_active":   9,
+		"listener.0.0.0.0_21000.worker_0.downstream_cx_total":    40,
+		"listener.0.0.0.0_21000.worker_1.downstream_cx_active":   1,
+		"listener.0.0.0.0_21000.worker_1.downstream_cx_total":    12,
+		"listener.0.0.0.0_21000.worker_10.downstream_cx_active":  0,
+		"listener.127.0.0.1_15001.worker_1.downstream_cx_active": 2,
+		"listener.0.0.0.0_21000.downstream_cx_active":            10,
+		"listener.admin.main_thread.downstream_cx_active":        1,
+		"server.worker_1.watchdog_miss":                          3,
+		"server.main_thread.watchdog_miss":                       1,
+		"server.main_thread.watchdog_mega_miss":                  1,
+		"server.concurrency":                                     3,
+	}
+	got := summarizeWorkers(stats)
+
+	var names []string
+	for _, th := range got.Threads {
+		names = append(names, th.Name)
+	}
+	if want := []string{"worker_0", "worker_1", "worker_10", "main_thread"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("thread order = %v, want %v", names, want)
+	}
+	if w1 := got.Threads[1]; w1.Active != 3 || w1.Total != 12 || w1.WatchdogMiss != 3 {
+		t.Errorf("worker_1 = %+v", w1)
+	}
+	if main := got.Threads[3]; main.HasConns || main.WatchdogMega != 1 {
+		t.Errorf("main_thread = %+v", main)
+	}
+	if want := []string{"0.0.0.0_21000", "127.0.0.1_15001"}; !reflect.DeepEqual(got.Listeners, want) {
+		t.Errorf("listeners = %v, want %v", got.Listeners, want)
+	}
+
+	var out bytes.Buffer
+	printWorkers(&out, got)
+	for _, want := range []string{
+		"THREAD       ACTIVE CX  TOTAL CX  WATCHDOG MISS  MEGA MISS  NOTE\n",
+		"worker_0     9          40        0              0          HOT\n",
+		"worker_1     3          12        3              0          watchdog misses\n",
+		"main_thread  -          -         1              1          BLOCKED (watchdog mega miss)\n",
+		"listener 0.0.0.0_21000 is unbalanced: active connections per worker 9, 1, 0\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printWorkers() output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "127.0.0.1_15001 is unbalanced") {
+		t.Errorf("printWorkers() flagged a listener on one worker only:\n%s", out.String())
+	}
+}
+
+func TestIsHot(t *testing.T) {
+	tests := []struct {
+		active, sum uint64
+		workers     int
+		want        bool
+	}{
+		{active: 8, sum: 10, workers: 4, want: true},
+		{active: 5, sum: 10, workers: 4, want: true},
+		{active: 4, sum: 10, workers: 4, want: false},
+		{active: 0, sum: 0, workers: 4, want: false},
+		{active: 10, sum: 10, workers: 1, want: false},
+		{active: 2, sum: 2, workers: 3, want: false},
+	}
+	for _, tt := range tests {
+		if got := isHot(tt.active, tt.sum, tt.workers); got != tt.want {
+			t.Errorf("isHot(%d, %d, %d) = %v, want %v", tt.active, tt.sum, tt.workers, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeWorkers(t *testing.T) {
+	staged := t.TempDir()
+	writeTree(t, staged, map[string]string{
+		"abcdef12/stats.json":  "listener.0.0.0.0_21000.worker_0.downstream_cx_active: 2\nlistener.0.0.0.0_21000.worker_0.downstream_cx_total: 5\n",
+		"12345678/stats.json":  "server.concurrency: 2\n",
+		"12345678/server.json": "{}",
+	})
+
+	var out bytes.Buffer
+	if err := analyzeWorkers(&out, staged); err != nil {
+		t.Fatalf("analyzeWorkers() error: %v", err)
+	}
+	for _, want := range []string{
+		"== 12345678 ==\nno per-worker stats captured\n",
+		"== abcdef12 ==\nTHREAD",
+		"worker_0  2          5",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("analyzeWorkers() output missing %q:\n%s", want, out.String())
+		}
+	}
+	if err := analyzeWorkers(&out, filepath.Join(staged, "12345678", "server.json")); err == nil {
+		t.Error("analyzeWorkers() accepted a snapshot without /stats")
+	}
+}
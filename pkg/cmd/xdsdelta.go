@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// xdsResource is a cluster, listener or route configuration Envoy received
+// over xDS.
+type xdsResource struct {
+	Name        string
+	Version     string
+	LastUpdated string
+	State       string // "warming" or "error" for resources not in use yet; empty when active
+	Shadows     bool   // a bootstrap resource has the same name
+}
+
+// xdsDelta separates what the control plane delivered from the static
+// bootstrap in one config dump.
+type xdsDelta struct {
+	BootstrapClusters  []string
+	BootstrapListeners []string
+	BootstrapRoutes    []string
+	Clusters           []xdsResource
+	Listeners          []xdsResource
+	Routes             []xdsResource
+}
+
+type namedResource struct {
+	Name string `json:"name"`
+}
+
+// xdsDump mirrors the config_dump sections that tell bootstrap and
+// xDS-delivered resources apart.
+type xdsDump struct {
+	Type      string `json:"@type"`
+	Bootstrap struct {
+		StaticResources struct {
+			Clusters  []namedResource `json:"clusters"`
+			Listeners []namedResource `json:"listeners"`
+		} `json:"static_resources"`
+	} `json:"bootstrap"`
+	StaticClusters []struct {
+		Cluster namedResource `json:"cluster"`
+	} `json:"static_clusters"`
+	DynamicActiveClusters  []dynamicCluster `json:"dynamic_active_clusters"`
+	DynamicWarmingClusters []dynamicCluster `json:"dynamic_warming_clusters"`
+	StaticListeners        []struct {
+		Listener namedResource `json:"listener"`
+	} `json:"static_listeners"`
+	DynamicListeners []struct {
+		Name         string          `json:"name"`
+		ActiveState  *listenerState  `json:"active_state"`
+		WarmingState *listenerState  `json:"warming_state"`
+		ErrorState   json.RawMessage `json:"error_state"`
+	} `json:"dynamic_listeners"`
+	StaticRouteConfigs []struct {
+		RouteConfig namedResource `json:"route_config"`
+	} `json:"static_route_configs"`
+	DynamicRouteConfigs []struct {
+		VersionInfo string        `json:"version_info"`
+		LastUpdated string        `json:"last_updated"`
+		RouteConfig namedResource `json:"route_config"`
+	} `json:"dynamic_route_configs"`
+}
+
+type dynamicCluster struct {
+	VersionInfo string        `json:"version_info"`
+	LastUpdated string        `json:"last_updated"`
+	Cluster     namedResource `json:"cluster"`
+}
+
+type listenerState struct {
+	VersionInfo string `json:"version_info"`
+	LastUpdated string `json:"last_updated"`
+}
+
+// summarizeXDSDelta lists the clusters, listeners and route configurations
+// of an Envoy /config_dump that came from xDS rather than the bootstrap.
+// The bootstrap is read from the dump's BootstrapConfigDump and static_*
+// sections.
+func summarizeXDSDelta(configDump []byte) (xdsDelta, error) {
+	var dump struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return xdsDelta{}, fmt.Errorf("failed to parse config dump: %w", err)
+	}
+
+	var delta xdsDelta
+	for _, raw := range dump.Configs {
+		var section xdsDump
+		if err := json.Unmarshal(raw, &section); err != nil {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(section.Type, ".BootstrapConfigDump"):
+			for _, c := range section.Bootstrap.StaticResources.Clusters {
+				delta.BootstrapClusters = append(delta.BootstrapClusters, c.Name)
+			}
+			for _, l := range section.Bootstrap.StaticResources.Listeners {
+				delta.BootstrapListeners = append(delta.BootstrapListeners, l.Name)
+			}
+		case strings.HasSuffix(section.Type, ".ClustersConfigDump"):
+			for _, c := range section.StaticClusters {
+				delta.BootstrapClusters = append(delta.BootstrapClusters, c.Cluster.Name)
+			}
+			for _, c := range section.DynamicActiveClusters {
+				delta.Clusters = append(delta.Clusters, xdsResource{Name: c.Cluster.Name, Version: c.VersionInfo, LastUpdated: c.LastUpdated})
+			}
+			for _, c := range section.DynamicWarmingClusters {
+				delta.Clusters = append(delta.Clusters, xdsResource{Name: c.Cluster.Name, Version: c.VersionInfo, LastUpdated: c.LastUpdated, State: "warming"})
+			}
+		case strings.HasSuffix(section.Type, ".ListenersConfigDump"):
+			for _, l := range section.StaticListeners {
+				delta.BootstrapListeners = append(delta.BootstrapListeners, l.Listener.Name)
+			}
+			for _, l := range section.DynamicListeners {
+				r := xdsResource{Name: l.Name}
+				switch {
+				case l.ActiveState != nil:
+					r.Version, r.LastUpdated = l.ActiveState.VersionInfo, l.ActiveState.LastUpdated
+				case l.WarmingState != nil:
+					r.Version, r.LastUpdated, r.State = l.WarmingState.VersionInfo, l.WarmingState.LastUpdated, "warming"
+				case len(l.ErrorState) > 0:
+					r.State = "error"
+				}
+				delta.Listeners = append(delta.Listeners, r)
+			}
+		case strings.HasSuffix(section.Type, ".RoutesConfigDump"):
+			for _, r := range section.StaticRouteConfigs {
+				delta.BootstrapRoutes = append(delta.BootstrapRoutes, r.RouteConfig.Name)
+			}
+			for _, r := range section.DynamicRouteConfigs {
+				delta.Routes = append(delta.Routes, xdsResource{Name: r.RouteConfig.Name, Version: r.VersionInfo, LastUpdated: r.LastUpdated})
+			}
+		}
+	}
+
+	delta.BootstrapClusters = sortedUnique(delta.BootstrapClusters)
+	delta.BootstrapListeners = sortedUnique(delta.BootstrapListeners)
+	delta.BootstrapRoutes = sortedUnique(delta.BootstrapRoutes)
+	markShadowed(delta.Clusters, delta.BootstrapClusters)
+	markShadowed(delta.Listeners, delta.BootstrapListeners)
+	markShadowed(delta.Routes, delta.BootstrapRoutes)
+	return delta, nil
+}
+
+// markShadowed flags the xDS resources named like a bootstrap resource and
+// sorts them by name.
+func markShadowed(resources []xdsResource, bootstrap []string) {
+	for i := range resources {
+		resources[i].Shadows = containsString(bootstrap, resources[i].Name)
+	}
+	sort.SliceStable(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+}
+
+// printXDSDelta writes the bootstrap resource names and then every
+// xDS-delivered resource with its version, marking the ones not yet in use.
+func printXDSDelta(w io.Writer, d xdsDelta) {
+	fmt.Fprintln(w, "Bootstrap (static):")
+	fmt.Fprintf(w, "  clusters:  %s\n", joinOrNone(d.BootstrapClusters))
+	fmt.Fprintf(w, "  listeners: %s\n", joinOrNone(d.BootstrapListeners))
+	fmt.Fprintf(w, "  routes:    %s\n", joinOrNone(d.BootstrapRoutes))
+	for _, section := range []struct {
+		kind      string
+		resources []xdsResource
+	}{
+		{"clusters", d.Clusters},
+		{"listeners", d.Listeners},
+		{"route configs", d.Routes},
+	} {
+		fmt.Fprintf(w, "Added by xDS: %d %s\n", len(section.resources), section.kind)
+		for _, r := range section.resources {
+			var notes []string
+			if r.Version != "" {
+				notes = append(notes, "version "+r.Version)
+			}
+			if r.LastUpdated != "" {
+				notes = append(notes, "updated "+r.LastUpdated)
+			}
+			if r.State != "" {
+				notes = append(notes, strings.ToUpper(r.State))
+			}
+			if r.Shadows {
+				notes = append(notes, "same name as a bootstrap resource")
+			}
+			if len(notes) > 0 {
+				fmt.Fprintf(w, "  + %s (%s)\n", r.Name, strings.Join(notes, ", "))
+			} else {
+				fmt.Fprintf(w, "  + %s\n", r.Name)
+			}
+		}
+	}
+}
+
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "(none)"
+	}
+	return strings.Join(names, ", ")
+}
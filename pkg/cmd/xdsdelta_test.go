@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const xdsDeltaDump = `{"configs":[
+ {"@type":"type.googleapis.com/envoy.admin.v3.BootstrapConfigDump",
+  "bootstrap":{"static_resources":{"clusters":[{"name":"local_agent"},{"name":"self_admin"}],"listeners":[{"name":"envoy_prometheus_metrics_listener"}]}}},
+ {"@type":"type.googleapis.com/envoy.admin.v3.ClustersConfigDump",
+  "static_clusters":[{"cluster":{"name":"local_agent"}},{"cluster":{"name":"self_admin"}}],
+  "dynamic_active_clusters":[
+   {"version_info":"v7","last_updated":"2026-10-14T10:00:00Z","cluster":{"name":"local_app"}},
+   {"version_info":"v7","cluster":{"name":"api.default.dc1.internal.abc.consul"}}],
+  "dynamic_warming_clusters":[{"version_info":"v8","cluster":{"name":"db.default.dc1.internal.abc.consul"}}]},
+ {"@type":"type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+  "static_listeners":[{"listener":{"name":"envoy_prometheus_metrics_listener"}}],
+  "dynamic_listeners":[
+   {"name":"public_listener:0.0.0.0:21000","active_state":{"version_info":"v3","last_updated":"2026-10-14T10:00:01Z"}},
+   {"name":"api:127.0.0.1:9191","warming_state":{"version_info":"v4"}},
+   {"name":"self_admin","error_state":{"details":"bind failed"}}]},
+ {"@type":"type.googleapis.com/envoy.admin.v3.RoutesConfigDump",
+  "dynamic_route_configs":[{"version_info":"v2","route_config":{"name":"api"}}]}
+]}`
+
+func TestSummarizeXDSDelta(t *testing.T) {
+	delta, err := summarizeXDSDelta([]byte(xdsDeltaDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"local_agent", "self_admin"}; !reflect.DeepEqual(delta.BootstrapClusters, want) {
+		t.Errorf("BootstrapClusters = %v, want %v", delta.BootstrapClusters, want)
+	}
+	if want := []string{"envoy_prometheus_metrics_listener"}; !reflect.DeepEqual(delta.BootstrapListeners, want) {
+		t.Errorf("BootstrapListeners = %v, want %v", delta.BootstrapListeners, want)
+	}
+	wantClusters := []xdsResource{
+		{Name: "api.default.dc1.internal.abc.consul", Version: "v7"},
+		{Name: "db.default.dc1.internal.abc.consul", Version: "v8", State: "warming"},
+		{Name: "local_app", Version: "v7", LastUpdated: "2026-10-14T10:00:00Z"},
+	}
+	if !reflect.DeepEqual(delta.Clusters, wantClusters) {
+		t.Errorf("Clusters = %+v, want %+v", delta.Clusters, wantClusters)
+	}
+	wantListeners := []xdsResource{
+		{Name: "api:127.0.0.1:9191", Version: "v4", State: "warming"},
+		{Name: "public_listener:0.0.0.0:21000", Version: "v3", LastUpdated: "2026-10-14T10:00:01Z"},
+		{Name: "self_admin", State: "error"},
+	}
+	if !reflect.DeepEqual(delta.Listeners, wantListeners) {
+		t.Errorf("Listeners = %+v, want %+v", delta.Listeners, wantListeners)
+	}
+	if want := []xdsResource{{Name: "api", Version: "v2"}}; !reflect.DeepEqual(delta.Routes, want) {
+		t.Errorf("Routes = %+v, want %+v", delta.Routes, want)
+	}
+
+	if _, err := summarizeXDSDelta([]byte("not json")); err == nil {
+		t.Error("summarizeXDSDelta() accepted invalid JSON")
+	}
+}
+
+func TestPrintXDSDelta(t *testing.T) {
+	delta, err := summarizeXDSDelta([]byte(xdsDeltaDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The self_admin listener is not a shadow: only same-kind names count
+	delta.Clusters = append(delta.Clusters, xdsResource{Name: "self_admin", Shadows: true})
+	if delta.Listeners[2].Shadows {
+		t.Errorf("listener %s marked as shadowing a bootstrap cluster", delta.Listeners[2].Name)
+	}
+	var out bytes.Buffer
+	printXDSDelta(&out, delta)
+	for _, want := range []string{
+		"  clusters:  local_agent, self_admin\n",
+		"  routes:    (none)\n",
+		"Added by xDS: 4 clusters\n",
+		"  + db.default.dc1.internal.abc.consul (version v8, WARMING)\n",
+		"  + self_admin (same name as a bootstrap resource)\n",
+		"Added by xDS: 3 listeners\n",
+		"  + self_admin (ERROR)\n",
+		"Added by xDS: 1 route configs\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
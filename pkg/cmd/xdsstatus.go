@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// xdsTypeStatus is how one xDS resource type is being delivered: the
+// resources in the config dump and the update counters in /stats.
+type xdsTypeStatus struct {
+	Type        string // CDS, LDS, RDS, EDS or SDS
+	InDump      bool   // the type's resources are listed in the config dump
+	Resources   int
+	Warming     int
+	LastUpdated string // most recent last_updated of the type's resources
+	Version     string // version_info of that resource
+	HasStats    bool
+	Success     uint64
+	Rejected    uint64
+	Failure     uint64
+}
+
+// xdsStatus is the ADS connection state and per-type update state of one
+// proxy.
+type xdsStatus struct {
+	HasConnState bool // /stats had control_plane.connected_state
+	Connected    bool
+	Types        []xdsTypeStatus
+}
+
+// xdsUpdateStats matches each type's update counters: a fixed stat prefix,
+// or for per-resource counters such as RDS and EDS a prefix and an infix
+// that are summed over every resource.
+var xdsUpdateStats = []struct {
+	Type   string
+	Prefix string
+	Infix  string
+}{
+	{"CDS", "cluster_manager.cds.", ""},
+	{"LDS", "listener_manager.lds.", ""},
+	{"RDS", "http.", ".rds."},
+	{"EDS", "cluster.", ""},
+	{"SDS", "sds.", ""},
+}
+
+// summarizeXDSStatus joins the xDS resources of a config dump with the
+// control_plane.* and update_* counters in stats, which may be nil.
+func summarizeXDSStatus(configDump []byte, stats map[string]uint64) (xdsStatus, error) {
+	delta, err := summarizeXDSDelta(configDump)
+	if err != nil {
+		return xdsStatus{}, err
+	}
+	resources := map[string][]xdsResource{"CDS": delta.Clusters, "LDS": delta.Listeners, "RDS": delta.Routes}
+
+	var status xdsStatus
+	if v, ok := stats["control_plane.connected_state"]; ok {
+		status.HasConnState, status.Connected = true, v == 1
+	}
+	for _, u := range xdsUpdateStats {
+		t := xdsTypeStatus{Type: u.Type}
+		if rs, ok := resources[u.Type]; ok {
+			t.InDump, t.Resources = true, len(rs)
+			var latest time.Time
+			for _, r := range rs {
+				if r.State == "warming" {
+					t.Warming++
+				}
+				if at, err := time.Parse(time.RFC3339Nano, r.LastUpdated); err == nil && at.After(latest) {
+					latest, t.LastUpdated, t.Version = at, r.LastUpdated, r.Version
+				}
+			}
+		}
+		for name, v := range stats {
+			if !strings.HasPrefix(name, u.Prefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(name, u.Prefix)
+			if u.Infix != "" && !strings.Contains(rest, u.Infix) {
+				continue
+			}
+			switch rest[strings.LastIndex(rest, ".")+1:] {
+			case "update_success":
+				t.HasStats, t.Success = true, t.Success+v
+			case "update_rejected":
+				t.HasStats, t.Rejected = true, t.Rejected+v
+			case "update_failure":
+				t.HasStats, t.Failure = true, t.Failure+v
+			}
+		}
+		if t.InDump || t.HasStats {
+			status.Types = append(status.Types, t)
+		}
+	}
+	return status, nil
+}
+
+// note flags types whose updates were rejected or failed, and resources that
+// are still warming.
+func (t xdsTypeStatus) note() string {
+	var notes []string
+	if t.Rejected > 0 {
+		notes = append(notes, "UPDATES REJECTED")
+	}
+	if t.Failure > 0 {
+		notes = append(notes, "update failures")
+	}
+	if t.Warming > 0 {
+		notes = append(notes, fmt.Sprintf("%d warming", t.Warming))
+	}
+	return strings.Join(notes, ", ")
+}
+
+// printXDSStatus writes the ADS connection state and a row per xDS type.
+func printXDSStatus(w io.Writer, s xdsStatus) {
+	switch {
+	case !s.HasConnState:
+		fmt.Fprintln(w, "ADS connection: unknown (control_plane.connected_state not captured)")
+	case s.Connected:
+		fmt.Fprintln(w, "ADS connection: connected")
+	default:
+		fmt.Fprintln(w, "ADS connection: DISCONNECTED from the control plane; configuration is not being updated")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tRESOURCES\tLAST UPDATED\tVERSION\tSUCCESS\tREJECTED\tFAILURE\tNOTE")
+	for _, t := range s.Types {
+		cols := []string{t.Type, "-", "-", "-", "-", "-", "-", t.note()}
+		if t.InDump {
+			cols[1] = strconv.Itoa(t.Resources)
+		}
+		if t.LastUpdated != "" {
+			cols[2], cols[3] = t.LastUpdated, t.Version
+		}
+		if t.HasStats {
+			cols[4] = strconv.FormatUint(t.Success, 10)
+			cols[5] = strconv.FormatUint(t.Rejected, 10)
+			cols[6] = strconv.FormatUint(t.Failure, 10)
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	tw.Flush()
+}
+
+// analyzeXDSStatus prints the xDS status of every config dump in snapshot,
+// joined with the /stats captured next to it.
+func analyzeXDSStatus(w io.Writer, snapshot string) error {
+	dumps, err := readConfigDumps(snapshot)
+	if err != nil {
+		return exitErrorf(ExitNoData, "%w", err)
+	}
+	if len(dumps) == 0 {
+		return exitErrorf(ExitNoData, "no config_dump found in %s", snapshot)
+	}
+	stats := make(map[string]map[string]uint64)
+	if !isConfigDumpFile(snapshot) {
+		if stats, err = readStatCounters(snapshot); err != nil {
+			return exitErrorf(ExitNoData, "%w", err)
+		}
+	}
+
+	for i, d := range dumps {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", d.name)
+		status, err := summarizeXDSStatus(d.data, stats[path.Dir(d.name)])
+		if err != nil {
+			return exitErrorf(ExitNoData, "%s: %w", d.name, err)
+		}
+		printXDSStatus(w, status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeXDSStatus(t *testing.T) {
+	stats := map[string]uint64{
+		"control_plane.connected_state":                                 1,
+		"cluster_manager.cds.update_success":                            7,
+		"cluster_manager.cds.update_rejected":                           2,
+		"cluster_manager.cds.update_failure":                            0,
+		"listener_manager.lds.update_success":                           3,
+		"http.public_listener.rds.api.update_success":                   4,
+		"http.public_listener.rds.api.update_rejected":                  0,
+		"http.upstream.rds.db.update_success":                           1,
+		"cluster.api.default.dc1.internal.abc.consul.update_success":    5,
+		"cluster.api.default.dc1.internal.abc.consul.update_failure":    1,
+		"cluster.api.default.dc1.internal.abc.consul.upstream_rq_total": 40,
+	}
+	got, err := summarizeXDSStatus([]byte(xdsDeltaDump), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := xdsStatus{
+		HasConnState: true,
+		Connected:    true,
+		Types: []xdsTypeStatus{
+			{Type: "CDS", InDump: true, Resources: 3, Warming: 1, LastUpdated: "2026-10-14T10:00:00Z", Version: "v7", HasStats: true, Success: 7, Rejected: 2},
+			{Type: "LDS", InDump: true, Resources: 3, Warming: 1, LastUpdated: "2026-10-14T10:00:01Z", Version: "v3", HasStats: true, Success: 3},
+			{Type: "RDS", InDump: true, Resources: 1, HasStats: true, Success: 5},
+			{Type: "EDS", HasStats: true, Success: 5, Failure: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summarizeXDSStatus() = %+v, want %+v", got, want)
+	}
+
+	var out bytes.Buffer
+	printXDSStatus(&out, got)
+	for _, line := range []string{
+		"ADS connection: connected\n",
+		"CDS   3          2026-10-14T10:00:00Z  v7       7        2         0        UPDATES REJECTED, 1 warming\n",
+		"RDS   1          -                     -        5        0         0 ",
+		"EDS   -          -                     -        5        0         1        update failures\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("printXDSStatus() output missing %q:\n%s", line, out.String())
+		}
+	}
+
+	disconnected, err := summarizeXDSStatus([]byte(xdsDeltaDump), map[string]uint64{"control_plane.connected_state": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	printXDSStatus(&out, disconnected)
+	if !strings.HasPrefix(out.String(), "ADS connection: DISCONNECTED") {
+		t.Errorf("printXDSStatus() when disconnected = %q", out.String())
+	}
+}
+
+func TestAnalyzeXDSStatus(t *testing.T) {
+	staged := t.TempDir()
+	writeTree(t, staged, map[string]string{
+		"abcdef12/config_dump.json": xdsDeltaDump,
+		"abcdef12/stats.json":       "control_plane.connected_state: 1\ncluster_manager.cds.update_success: 7\n",
+	})
+
+	var out bytes.Buffer
+	if err := analyzeXDSStatus(&out, staged); err != nil {
+		t.Fatalf("analyzeXDSStatus() error: %v", err)
+	}
+	if want := "== abcdef12/config_dump.json ==\nADS connection: connected\n"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("analyzeXDSStatus() = %q, want prefix %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := analyzeXDSStatus(&out, filepath.Join(staged, "abcdef12", "config_dump.json")); err != nil {
+		t.Fatalf("analyzeXDSStatus() of a config dump file error: %v", err)
+	}
+	if !strings.Contains(out.String(), "ADS connection: unknown") {
+		t.Errorf("analyzeXDSStatus() of a config dump file = %q", out.String())
+	}
+}